@@ -0,0 +1,105 @@
+// Package logcontext contains the field names of the New Relic logs in context
+// format which are shared by the logs in context integrations:
+//
+//	nrlogrusplugin: a logrus Formatter
+//	nrlogxiplugin: a logxi Formatter
+//	nrzapplugin: a zap encoder configuration and fields
+//	nrzerologplugin: a zerolog Hook
+//
+// Each integration reads the Transaction from a context.Context using
+// newrelic.FromContext and adds the transaction's linking metadata to the log
+// line so that logs can be correlated with traces and errors.
+package logcontext
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+
+	newrelic "github.com/newrelic/go-agent"
+)
+
+// Keys used for logging context JSON.
+const (
+	KeyFile       = "file.name"
+	KeyLevel      = "log.level"
+	KeyLine       = "line.number"
+	KeyMessage    = "message"
+	KeyMethod     = "method.name"
+	KeyTimestamp  = "timestamp"
+	KeyTraceID    = "trace.id"
+	KeySpanID     = "span.id"
+	KeyEntityName = "entity.name"
+	KeyEntityType = "entity.type"
+	KeyEntityGUID = "entity.guid"
+	KeyHostname   = "hostname"
+)
+
+// Metadata returns the linking metadata of the Transaction in the context.
+// ok is false if ctx is nil or does not contain a Transaction.
+func Metadata(ctx context.Context) (md newrelic.LinkingMetadata, ok bool) {
+	if nil == ctx {
+		return
+	}
+	txn := newrelic.FromContext(ctx)
+	if nil == txn {
+		return
+	}
+	return txn.GetLinkingMetadata(), true
+}
+
+// ForEachField calls fn with the key and value of each non-empty linking
+// metadata field.
+func ForEachField(md newrelic.LinkingMetadata, fn func(key, val string)) {
+	add := func(key, val string) {
+		if "" != val {
+			fn(key, val)
+		}
+	}
+	add(KeyTraceID, md.TraceID)
+	add(KeySpanID, md.SpanID)
+	add(KeyEntityName, md.EntityName)
+	add(KeyEntityType, md.EntityType)
+	add(KeyEntityGUID, md.EntityGUID)
+	add(KeyHostname, md.Hostname)
+}
+
+// AddLinkingMetadata adds the non-empty linking metadata fields to the map
+// provided.
+func AddLinkingMetadata(set map[string]interface{}, md newrelic.LinkingMetadata) {
+	ForEachField(md, func(key, val string) { set[key] = val })
+}
+
+// FieldValue converts a log field value into a value which can be marshalled
+// into JSON.  Errors are converted to their message, and types other than
+// numbers, booleans, and strings are converted to strings.  ok is false for
+// functions, which should be dropped.
+func FieldValue(v interface{}) (val interface{}, ok bool) {
+	switch x := v.(type) {
+	case nil, string, bool,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64:
+		return x, true
+	case float32:
+		return floatValue(float64(x)), true
+	case float64:
+		return floatValue(x), true
+	case error:
+		return x.Error(), true
+	case fmt.Stringer:
+		return x.String(), true
+	}
+	if reflect.Func == reflect.ValueOf(v).Kind() {
+		return nil, false
+	}
+	return fmt.Sprint(v), true
+}
+
+// floatValue converts values which cannot be represented in JSON to strings.
+func floatValue(f float64) interface{} {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return fmt.Sprint(f)
+	}
+	return f
+}
@@ -0,0 +1,85 @@
+package logcontext
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/newrelic/go-agent/newrelictest"
+)
+
+func TestMetadata(t *testing.T) {
+	if _, ok := Metadata(nil); ok {
+		t.Error("metadata found for nil context")
+	}
+	if _, ok := Metadata(context.Background()); ok {
+		t.Error("metadata found without transaction")
+	}
+
+	cfg := newrelic.NewConfig("my app", "")
+	cfg.DistributedTracer.Enabled = true
+	cfg.CrossApplicationTracer.Enabled = false
+	reply := newrelictest.DefaultReply()
+	reply.EntityGUID = "entity-guid"
+	app, err := newrelictest.NewApplication(cfg, reply)
+	if nil != err {
+		t.Fatal(err)
+	}
+	txn := app.StartTransaction("hello", nil, nil)
+	defer txn.End()
+
+	md, ok := Metadata(newrelic.NewContext(context.Background(), txn))
+	if !ok {
+		t.Fatal("metadata not found")
+	}
+	set := make(map[string]interface{})
+	AddLinkingMetadata(set, md)
+	for _, key := range []string{KeyTraceID, KeySpanID, KeyEntityName, KeyEntityType, KeyEntityGUID, KeyHostname} {
+		if _, ok := set[key]; !ok {
+			t.Error("missing key", key, set)
+		}
+	}
+	if set[KeyEntityName] != "my app" || set[KeyEntityGUID] != "entity-guid" || set[KeyEntityType] != "SERVICE" {
+		t.Error(set)
+	}
+}
+
+func TestAddLinkingMetadataOmitsEmpty(t *testing.T) {
+	set := make(map[string]interface{})
+	AddLinkingMetadata(set, newrelic.LinkingMetadata{
+		EntityName: "my app",
+		EntityType: "SERVICE",
+	})
+	if len(set) != 2 || set[KeyEntityName] != "my app" || set[KeyEntityType] != "SERVICE" {
+		t.Error(set)
+	}
+}
+
+type point struct{ x, y int }
+
+func TestFieldValue(t *testing.T) {
+	testcases := []struct {
+		input  interface{}
+		expect interface{}
+	}{
+		{input: "zap", expect: "zap"},
+		{input: 123, expect: 123},
+		{input: 1.5, expect: 1.5},
+		{input: true, expect: true},
+		{input: nil, expect: nil},
+		{input: math.Inf(1), expect: "+Inf"},
+		{input: errors.New("oops"), expect: "oops"},
+		{input: point{x: 1, y: 2}, expect: "{1 2}"},
+	}
+	for _, tc := range testcases {
+		val, ok := FieldValue(tc.input)
+		if !ok || val != tc.expect {
+			t.Errorf("input=%#v expect=%#v actual=%#v", tc.input, tc.expect, val)
+		}
+	}
+	if _, ok := FieldValue(func() {}); ok {
+		t.Error("function not dropped")
+	}
+}
@@ -0,0 +1,73 @@
+// Package nrlogrusplugin decorates logrus logs with the linking metadata of
+// the Transaction in the log entry's context, and formats them as JSON in the
+// New Relic logs in context format.  This allows the logs to be correlated
+// with traces and errors.  Requires v1.4.0 of the logrus package or newer.
+//
+// To decorate logs, set the logger's formatter to ContextFormatter and add
+// the Transaction to the context of each log entry:
+//
+//	logger := logrus.New()
+//	logger.SetFormatter(nrlogrusplugin.ContextFormatter{})
+//
+//	ctx := newrelic.NewContext(context.Background(), txn)
+//	logger.WithContext(ctx).Info("Hello New Relic!")
+//
+// The log line will look like this:
+//
+//	{"entity.guid":"MTE3ODUwMHxBUE18QVBQTElDQVRJT058Mjc3MDU2Njc1","entity.name":"Example Application","entity.type":"SERVICE","hostname":"my.hostname","log.level":"info","message":"Hello New Relic!","span.id":"9f365c71f0f04a98","timestamp":1568917432034,"trace.id":"469a04f6c1278593"}
+//
+// The trace.id and span.id fields are only present when distributed tracing
+// is enabled.  Fields added using WithField and WithFields are included.  If a
+// field key collides with one of the keys in the logcontext package, the
+// value is overwritten.  Errors are converted to their message, functions are
+// dropped, and types other than numbers, booleans, and strings are converted
+// to strings.
+//
+// Example: https://github.com/newrelic/go-agent/tree/master/_integrations/logcontext/nrlogrusplugin/example/main.go
+package nrlogrusplugin
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/newrelic/go-agent/_integrations/logcontext"
+	"github.com/newrelic/go-agent/internal"
+	"github.com/sirupsen/logrus"
+)
+
+func init() { internal.TrackUsage("integration", "logcontext", "logrus") }
+
+// ContextFormatter is a `logrus.Formatter` that will format logs for sending
+// to New Relic.
+type ContextFormatter struct{}
+
+// Format renders a single log entry.
+func (f ContextFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	// Room is made for the linking metadata and the entry fields below.
+	data := make(map[string]interface{}, len(e.Data)+12)
+	for k, v := range e.Data {
+		if val, ok := logcontext.FieldValue(v); ok {
+			data[k] = val
+		}
+	}
+
+	if md, ok := logcontext.Metadata(e.Context); ok {
+		logcontext.AddLinkingMetadata(data, md)
+	}
+
+	data[logcontext.KeyTimestamp] = e.Time.UnixNano() / int64(1000*1000)
+	data[logcontext.KeyMessage] = e.Message
+	data[logcontext.KeyLevel] = e.Level.String()
+
+	if nil != e.Caller {
+		data[logcontext.KeyFile] = e.Caller.File
+		data[logcontext.KeyLine] = e.Caller.Line
+		data[logcontext.KeyMethod] = e.Caller.Function
+	}
+
+	js, err := json.Marshal(data)
+	if nil != err {
+		return nil, fmt.Errorf("unable to marshal log entry: %v", err)
+	}
+	return append(js, '\n'), nil
+}
@@ -0,0 +1,112 @@
+package nrlogrusplugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/newrelic/go-agent/_integrations/logcontext"
+	"github.com/newrelic/go-agent/newrelictest"
+	"github.com/sirupsen/logrus"
+)
+
+func testTransaction(t *testing.T) newrelic.Transaction {
+	cfg := newrelic.NewConfig("my app", "")
+	cfg.DistributedTracer.Enabled = true
+	cfg.CrossApplicationTracer.Enabled = false
+	reply := newrelictest.DefaultReply()
+	reply.EntityGUID = "entity-guid"
+	app, err := newrelictest.NewApplication(cfg, reply)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return app.StartTransaction("hello", nil, nil)
+}
+
+func format(t *testing.T, e *logrus.Entry) map[string]interface{} {
+	js, err := ContextFormatter{}.Format(e)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if js[len(js)-1] != '\n' {
+		t.Error("missing newline", string(js))
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(js, &data); nil != err {
+		t.Fatal(err, string(js))
+	}
+	return data
+}
+
+func TestFormatWithTransaction(t *testing.T) {
+	txn := testTransaction(t)
+	defer txn.End()
+	md := txn.GetLinkingMetadata()
+
+	data := format(t, &logrus.Entry{
+		Data: logrus.Fields{
+			"zip":   "zap",
+			"count": 2,
+			"error": errors.New("oops"),
+			"fn":    func() {},
+		},
+		Time:    time.Unix(1568917432, 34*int64(time.Millisecond)),
+		Level:   logrus.InfoLevel,
+		Message: "Hello New Relic!",
+		Context: newrelic.NewContext(context.Background(), txn),
+	})
+	expect := map[string]interface{}{
+		"zip":                    "zap",
+		"count":                  float64(2),
+		"error":                  "oops",
+		logcontext.KeyMessage:    "Hello New Relic!",
+		logcontext.KeyLevel:      "info",
+		logcontext.KeyTimestamp:  float64(1568917432034),
+		logcontext.KeyTraceID:    md.TraceID,
+		logcontext.KeySpanID:     md.SpanID,
+		logcontext.KeyEntityName: "my app",
+		logcontext.KeyEntityType: "SERVICE",
+		logcontext.KeyEntityGUID: "entity-guid",
+		logcontext.KeyHostname:   md.Hostname,
+	}
+	if len(data) != len(expect) {
+		t.Error(data)
+	}
+	for key, val := range expect {
+		if data[key] != val {
+			t.Errorf("key=%s expect=%#v actual=%#v", key, val, data[key])
+		}
+	}
+}
+
+func TestFormatWithoutTransaction(t *testing.T) {
+	data := format(t, &logrus.Entry{
+		Data:    logrus.Fields{},
+		Level:   logrus.WarnLevel,
+		Message: "no transaction",
+		Context: context.Background(),
+	})
+	if len(data) != 3 || data[logcontext.KeyLevel] != "warning" || data[logcontext.KeyMessage] != "no transaction" {
+		t.Error(data)
+	}
+}
+
+func TestFormatCaller(t *testing.T) {
+	data := format(t, &logrus.Entry{
+		Data:    logrus.Fields{},
+		Level:   logrus.InfoLevel,
+		Message: "caller",
+		Caller: &runtime.Frame{
+			File:     "main.go",
+			Line:     12,
+			Function: "main.main",
+		},
+	})
+	if data[logcontext.KeyFile] != "main.go" || data[logcontext.KeyLine] != float64(12) || data[logcontext.KeyMethod] != "main.main" {
+		t.Error(data)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mgutz/logxi/v1"
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/newrelic/go-agent/_integrations/logcontext/nrlogxiplugin"
+)
+
+func mustGetEnv(key string) string {
+	if val := os.Getenv(key); "" != val {
+		return val
+	}
+	panic(fmt.Sprintf("environment variable %s unset", key))
+}
+
+func doFunction(ctx context.Context, logger log.Logger) {
+	txn := newrelic.FromContext(ctx)
+	defer newrelic.StartSegment(txn, "doFunction").End()
+	// The context is passed as a key value pair so that the log is
+	// decorated with the transaction's linking metadata.
+	logger.Info("In doFunction", "ctx", ctx, "answer", 42)
+}
+
+func main() {
+	logger := nrlogxiplugin.New(os.Stdout, "example")
+	logger.SetLevel(log.LevelInfo)
+
+	cfg := newrelic.NewConfig("Logxi Log Decoration", mustGetEnv("NEW_RELIC_LICENSE_KEY"))
+	cfg.DistributedTracer.Enabled = true
+	cfg.CrossApplicationTracer.Enabled = false
+
+	app, err := newrelic.NewApplication(cfg)
+	if nil != err {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := app.WaitForConnection(10 * time.Second); nil != err {
+		fmt.Println(err)
+	}
+	defer app.Shutdown(10 * time.Second)
+
+	txn := app.StartTransaction("main", nil, nil)
+	ctx := newrelic.NewContext(context.Background(), txn)
+	doFunction(ctx, logger)
+	logger.Info("Ending transaction", "ctx", ctx)
+	txn.End()
+}
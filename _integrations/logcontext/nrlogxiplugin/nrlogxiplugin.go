@@ -0,0 +1,114 @@
+// Package nrlogxiplugin decorates mgutz/logxi logs with the linking metadata
+// of a Transaction, and formats them as JSON in the New Relic logs in context
+// format.  This allows the logs to be correlated with traces and errors.
+//
+// logxi has no notion of a context, so the context containing the Transaction
+// is passed as one of the key value pairs of the log call.  It is used to find
+// the Transaction and is not itself written:
+//
+//	logger := nrlogxiplugin.New(os.Stdout, "my-logger")
+//
+//	ctx := newrelic.NewContext(context.Background(), txn)
+//	logger.Info("Hello New Relic!", "ctx", ctx, "user", "alice")
+//
+// The log line will look like this:
+//
+//	{"entity.guid":"MTE3ODUwMHxBUE18QVBQTElDQVRJT058Mjc3MDU2Njc1","entity.name":"Example Application","entity.type":"SERVICE","hostname":"my.hostname","log.level":"info","logger":"my-logger","message":"Hello New Relic!","span.id":"9f365c71f0f04a98","timestamp":1568917432034,"trace.id":"469a04f6c1278593","user":"alice"}
+//
+// Example: https://github.com/newrelic/go-agent/tree/master/_integrations/logcontext/nrlogxiplugin/example/main.go
+package nrlogxiplugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mgutz/logxi/v1"
+	"github.com/newrelic/go-agent/_integrations/logcontext"
+	"github.com/newrelic/go-agent/internal"
+)
+
+func init() { internal.TrackUsage("integration", "logcontext", "logxi", "v1") }
+
+const (
+	keyLogger = "logger"
+	// keyMissingValue is used for the final argument when an odd number
+	// of arguments is provided.
+	keyMissingValue = "_"
+)
+
+// ContextFormatter is a logxi Formatter which writes each log as a line of
+// JSON in the New Relic logs in context format.
+type ContextFormatter struct {
+	// Name is the name of the logger.  It is omitted if empty.
+	Name string
+}
+
+// New creates a logxi Logger named name which writes to w using a
+// ContextFormatter.
+func New(w io.Writer, name string) log.Logger {
+	return log.NewLogger3(w, name, &ContextFormatter{Name: name})
+}
+
+func levelName(level int) string {
+	switch level {
+	case log.LevelTrace:
+		return "trace"
+	case log.LevelDebug:
+		return "debug"
+	case log.LevelInfo:
+		return "info"
+	case log.LevelWarn:
+		return "warn"
+	case log.LevelError:
+		return "error"
+	case log.LevelFatal:
+		return "fatal"
+	default:
+		return fmt.Sprintf("level-%d", level)
+	}
+}
+
+func (f *ContextFormatter) format(level int, msg string, args []interface{}) ([]byte, error) {
+	data := make(map[string]interface{}, len(args)/2+10)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			if val, ok := logcontext.FieldValue(args[i]); ok {
+				data[keyMissingValue] = val
+			}
+			break
+		}
+		if ctx, ok := args[i+1].(context.Context); ok {
+			if md, ok := logcontext.Metadata(ctx); ok {
+				logcontext.AddLinkingMetadata(data, md)
+			}
+			continue
+		}
+		if val, ok := logcontext.FieldValue(args[i+1]); ok {
+			data[fmt.Sprint(args[i])] = val
+		}
+	}
+	if "" != f.Name {
+		data[keyLogger] = f.Name
+	}
+	data[logcontext.KeyTimestamp] = time.Now().UnixNano() / int64(time.Millisecond)
+	data[logcontext.KeyMessage] = msg
+	data[logcontext.KeyLevel] = levelName(level)
+
+	js, err := json.Marshal(data)
+	if nil != err {
+		return nil, err
+	}
+	return append(js, '\n'), nil
+}
+
+// Format implements log.Formatter.
+func (f *ContextFormatter) Format(w io.Writer, level int, msg string, args []interface{}) {
+	js, err := f.format(level, msg, args)
+	if nil != err {
+		js = []byte(fmt.Sprintf("unable to format log message %q: %v\n", msg, err))
+	}
+	w.Write(js)
+}
@@ -0,0 +1,89 @@
+package nrlogxiplugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mgutz/logxi/v1"
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/newrelic/go-agent/_integrations/logcontext"
+	"github.com/newrelic/go-agent/newrelictest"
+)
+
+func testTransaction(t *testing.T) newrelic.Transaction {
+	cfg := newrelic.NewConfig("my app", "")
+	cfg.DistributedTracer.Enabled = true
+	cfg.CrossApplicationTracer.Enabled = false
+	app, err := newrelictest.NewApplication(cfg, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return app.StartTransaction("hello", nil, nil)
+}
+
+func format(t *testing.T, f *ContextFormatter, level int, msg string, args ...interface{}) map[string]interface{} {
+	buf := &bytes.Buffer{}
+	f.Format(buf, level, msg, args)
+	var data map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &data); nil != err {
+		t.Fatal(err, buf.String())
+	}
+	return data
+}
+
+func TestFormatWithTransaction(t *testing.T) {
+	txn := testTransaction(t)
+	defer txn.End()
+	md := txn.GetLinkingMetadata()
+	ctx := newrelic.NewContext(context.Background(), txn)
+
+	data := format(t, &ContextFormatter{Name: "my-logger"}, log.LevelError, "Hello New Relic!",
+		"ctx", ctx, "zip", "zap", 1, 2)
+	expect := map[string]interface{}{
+		"zip":                    "zap",
+		"1":                      float64(2),
+		"logger":                 "my-logger",
+		logcontext.KeyMessage:    "Hello New Relic!",
+		logcontext.KeyLevel:      "error",
+		logcontext.KeyTraceID:    md.TraceID,
+		logcontext.KeySpanID:     md.SpanID,
+		logcontext.KeyEntityName: "my app",
+		logcontext.KeyEntityType: "SERVICE",
+		logcontext.KeyHostname:   md.Hostname,
+	}
+	if len(data) != len(expect)+1 {
+		t.Error(data)
+	}
+	for key, val := range expect {
+		if data[key] != val {
+			t.Errorf("key=%s expect=%#v actual=%#v", key, val, data[key])
+		}
+	}
+	if _, ok := data[logcontext.KeyTimestamp].(float64); !ok {
+		t.Error(data)
+	}
+}
+
+func TestFormatWithoutTransaction(t *testing.T) {
+	data := format(t, &ContextFormatter{}, log.LevelInfo, "no transaction",
+		"ctx", context.Background(), "odd")
+	if len(data) != 4 || data[logcontext.KeyLevel] != "info" || data["_"] != "odd" {
+		t.Error(data)
+	}
+}
+
+func TestNew(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(buf, "my-logger")
+	logger.SetLevel(log.LevelInfo)
+	logger.Info("hello")
+	var data map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &data); nil != err {
+		t.Fatal(err, buf.String())
+	}
+	if data[logcontext.KeyMessage] != "hello" || data["logger"] != "my-logger" {
+		t.Error(data)
+	}
+}
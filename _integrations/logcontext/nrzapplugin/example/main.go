@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/newrelic/go-agent/_integrations/logcontext/nrzapplugin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func mustGetEnv(key string) string {
+	if val := os.Getenv(key); "" != val {
+		return val
+	}
+	panic(fmt.Sprintf("environment variable %s unset", key))
+}
+
+func doFunction(ctx context.Context, logger *zap.Logger) {
+	txn := newrelic.FromContext(ctx)
+	defer newrelic.StartSegment(txn, "doFunction").End()
+	// Create the child logger after starting the segment so that the
+	// log contains the segment's span id.
+	nrzapplugin.WithContext(ctx, logger).Info("In doFunction", zap.Int("answer", 42))
+}
+
+func main() {
+	core := zapcore.NewCore(
+		zapcore.NewJSONEncoder(nrzapplugin.EncoderConfig()),
+		zapcore.AddSync(os.Stdout),
+		zap.InfoLevel,
+	)
+	logger := zap.New(core)
+	defer logger.Sync()
+
+	cfg := newrelic.NewConfig("Zap Log Decoration", mustGetEnv("NEW_RELIC_LICENSE_KEY"))
+	cfg.DistributedTracer.Enabled = true
+	cfg.CrossApplicationTracer.Enabled = false
+
+	app, err := newrelic.NewApplication(cfg)
+	if nil != err {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := app.WaitForConnection(10 * time.Second); nil != err {
+		fmt.Println(err)
+	}
+	defer app.Shutdown(10 * time.Second)
+
+	txn := app.StartTransaction("main", nil, nil)
+	ctx := newrelic.NewContext(context.Background(), txn)
+	doFunction(ctx, logger)
+	nrzapplugin.WithContext(ctx, logger).Info("Ending transaction")
+	txn.End()
+}
@@ -0,0 +1,82 @@
+// Package nrzapplugin decorates go.uber.org/zap logs with the linking metadata
+// of a Transaction, and configures zap to write JSON in the New Relic logs in
+// context format.  This allows the logs to be correlated with traces and
+// errors.
+//
+// zap entries do not carry a context, so the linking metadata is added as
+// fields to a child logger.  Create the logger using EncoderConfig and use
+// WithContext to create a logger for each context containing a Transaction:
+//
+//	core := zapcore.NewCore(
+//		zapcore.NewJSONEncoder(nrzapplugin.EncoderConfig()),
+//		zapcore.AddSync(os.Stdout),
+//		zap.InfoLevel,
+//	)
+//	logger := zap.New(core)
+//
+//	ctx := newrelic.NewContext(context.Background(), txn)
+//	nrzapplugin.WithContext(ctx, logger).Info("Hello New Relic!")
+//
+// The log line will look like this:
+//
+//	{"log.level":"info","timestamp":1568917432034,"message":"Hello New Relic!","trace.id":"469a04f6c1278593","span.id":"9f365c71f0f04a98","entity.name":"Example Application","entity.type":"SERVICE","entity.guid":"MTE3ODUwMHxBUE18QVBQTElDQVRJT058Mjc3MDU2Njc1","hostname":"my.hostname"}
+//
+// Example: https://github.com/newrelic/go-agent/tree/master/_integrations/logcontext/nrzapplugin/example/main.go
+package nrzapplugin
+
+import (
+	"context"
+
+	"github.com/newrelic/go-agent/_integrations/logcontext"
+	"github.com/newrelic/go-agent/internal"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func init() { internal.TrackUsage("integration", "logcontext", "zap") }
+
+// EncoderConfig returns a zapcore.EncoderConfig which uses the field names
+// and timestamp format of the New Relic logs in context format.  Use it with
+// zapcore.NewJSONEncoder.
+func EncoderConfig() zapcore.EncoderConfig {
+	return zapcore.EncoderConfig{
+		MessageKey:     logcontext.KeyMessage,
+		LevelKey:       logcontext.KeyLevel,
+		TimeKey:        logcontext.KeyTimestamp,
+		NameKey:        "logger",
+		CallerKey:      "caller",
+		StacktraceKey:  "stacktrace",
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeTime:     zapcore.EpochMillisTimeEncoder,
+		EncodeDuration: zapcore.SecondsDurationEncoder,
+		EncodeCaller:   zapcore.ShortCallerEncoder,
+	}
+}
+
+// Fields returns the linking metadata of the Transaction in the context as zap
+// fields.  It returns nil if ctx is nil or does not contain a Transaction.
+func Fields(ctx context.Context) []zap.Field {
+	md, ok := logcontext.Metadata(ctx)
+	if !ok {
+		return nil
+	}
+	var fields []zap.Field
+	logcontext.ForEachField(md, func(key, val string) {
+		fields = append(fields, zap.String(key, val))
+	})
+	return fields
+}
+
+// WithContext returns a child of the logger provided which adds the linking
+// metadata of the Transaction in the context to each log.  The span id is that
+// of the segment in progress when WithContext is called, so create a new child
+// logger after starting a segment.  The logger is returned unchanged if ctx is
+// nil or does not contain a Transaction.
+func WithContext(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	fields := Fields(ctx)
+	if nil == fields {
+		return logger
+	}
+	return logger.With(fields...)
+}
@@ -0,0 +1,51 @@
+package nrzapplugin
+
+import (
+	"context"
+	"testing"
+
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/newrelic/go-agent/_integrations/logcontext"
+	"github.com/newrelic/go-agent/newrelictest"
+	"go.uber.org/zap"
+)
+
+func TestFields(t *testing.T) {
+	cfg := newrelic.NewConfig("my app", "")
+	cfg.DistributedTracer.Enabled = true
+	cfg.CrossApplicationTracer.Enabled = false
+	app, err := newrelictest.NewApplication(cfg, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	txn := app.StartTransaction("hello", nil, nil)
+	defer txn.End()
+	md := txn.GetLinkingMetadata()
+
+	fields := Fields(newrelic.NewContext(context.Background(), txn))
+	expect := map[string]string{
+		logcontext.KeyTraceID:    md.TraceID,
+		logcontext.KeySpanID:     md.SpanID,
+		logcontext.KeyEntityName: "my app",
+		logcontext.KeyEntityType: "SERVICE",
+		logcontext.KeyHostname:   md.Hostname,
+	}
+	if len(fields) != len(expect) {
+		t.Error(fields)
+	}
+	for _, f := range fields {
+		if expect[f.Key] != f.String {
+			t.Errorf("key=%s expect=%s actual=%s", f.Key, expect[f.Key], f.String)
+		}
+	}
+}
+
+func TestWithContextNoTransaction(t *testing.T) {
+	logger := zap.NewNop()
+	if WithContext(context.Background(), logger) != logger {
+		t.Error("logger changed without transaction")
+	}
+	if WithContext(nil, logger) != logger {
+		t.Error("logger changed with nil context")
+	}
+}
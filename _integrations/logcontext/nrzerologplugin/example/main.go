@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/newrelic/go-agent/_integrations/logcontext/nrzerologplugin"
+	"github.com/rs/zerolog"
+)
+
+func mustGetEnv(key string) string {
+	if val := os.Getenv(key); "" != val {
+		return val
+	}
+	panic(fmt.Sprintf("environment variable %s unset", key))
+}
+
+func doFunction(ctx context.Context, logger zerolog.Logger) {
+	txn := newrelic.FromContext(ctx)
+	defer newrelic.StartSegment(txn, "doFunction").End()
+	logger.Info().Ctx(ctx).Int("answer", 42).Msg("In doFunction")
+}
+
+func main() {
+	nrzerologplugin.SetFieldNames()
+	logger := zerolog.New(os.Stdout).Hook(nrzerologplugin.Hook{}).With().Timestamp().Logger()
+
+	cfg := newrelic.NewConfig("Zerolog Log Decoration", mustGetEnv("NEW_RELIC_LICENSE_KEY"))
+	cfg.DistributedTracer.Enabled = true
+	cfg.CrossApplicationTracer.Enabled = false
+
+	app, err := newrelic.NewApplication(cfg)
+	if nil != err {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := app.WaitForConnection(10 * time.Second); nil != err {
+		fmt.Println(err)
+	}
+	defer app.Shutdown(10 * time.Second)
+
+	txn := app.StartTransaction("main", nil, nil)
+	ctx := newrelic.NewContext(context.Background(), txn)
+	doFunction(ctx, logger)
+	logger.Info().Ctx(ctx).Msg("Ending transaction")
+	txn.End()
+}
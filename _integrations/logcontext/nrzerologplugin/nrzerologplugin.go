@@ -0,0 +1,55 @@
+// Package nrzerologplugin decorates rs/zerolog logs with the linking metadata
+// of the Transaction in the event's context, and configures zerolog to write
+// JSON in the New Relic logs in context format.  This allows the logs to be
+// correlated with traces and errors.  Requires v1.31.0 of the zerolog package
+// or newer.
+//
+// zerolog field names are global, so call SetFieldNames once before logging.
+// Then add the Hook to the logger, and add the context containing the
+// Transaction to each event:
+//
+//	nrzerologplugin.SetFieldNames()
+//	logger := zerolog.New(os.Stdout).Hook(nrzerologplugin.Hook{}).With().Timestamp().Logger()
+//
+//	ctx := newrelic.NewContext(context.Background(), txn)
+//	logger.Info().Ctx(ctx).Msg("Hello New Relic!")
+//
+// The log line will look like this:
+//
+//	{"log.level":"info","timestamp":1568917432034,"trace.id":"469a04f6c1278593","span.id":"9f365c71f0f04a98","entity.name":"Example Application","entity.type":"SERVICE","entity.guid":"MTE3ODUwMHxBUE18QVBQTElDQVRJT058Mjc3MDU2Njc1","hostname":"my.hostname","message":"Hello New Relic!"}
+//
+// Example: https://github.com/newrelic/go-agent/tree/master/_integrations/logcontext/nrzerologplugin/example/main.go
+package nrzerologplugin
+
+import (
+	"github.com/newrelic/go-agent/_integrations/logcontext"
+	"github.com/newrelic/go-agent/internal"
+	"github.com/rs/zerolog"
+)
+
+func init() { internal.TrackUsage("integration", "logcontext", "zerolog") }
+
+// SetFieldNames sets zerolog's global message, level, and timestamp field
+// names and the timestamp format to those of the New Relic logs in context
+// format.
+func SetFieldNames() {
+	zerolog.MessageFieldName = logcontext.KeyMessage
+	zerolog.LevelFieldName = logcontext.KeyLevel
+	zerolog.TimestampFieldName = logcontext.KeyTimestamp
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMs
+}
+
+// Hook is a zerolog.Hook which adds the linking metadata of the Transaction in
+// the event's context to the event.
+type Hook struct{}
+
+// Run implements zerolog.Hook.
+func (Hook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	md, ok := logcontext.Metadata(e.GetCtx())
+	if !ok {
+		return
+	}
+	logcontext.ForEachField(md, func(key, val string) {
+		e.Str(key, val)
+	})
+}
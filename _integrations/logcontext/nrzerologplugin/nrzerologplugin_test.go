@@ -0,0 +1,58 @@
+package nrzerologplugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/newrelic/go-agent/_integrations/logcontext"
+	"github.com/newrelic/go-agent/newrelictest"
+	"github.com/rs/zerolog"
+)
+
+func TestHook(t *testing.T) {
+	cfg := newrelic.NewConfig("my app", "")
+	cfg.DistributedTracer.Enabled = true
+	cfg.CrossApplicationTracer.Enabled = false
+	app, err := newrelictest.NewApplication(cfg, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	txn := app.StartTransaction("hello", nil, nil)
+	defer txn.End()
+	md := txn.GetLinkingMetadata()
+
+	SetFieldNames()
+	buf := &bytes.Buffer{}
+	logger := zerolog.New(buf).Hook(Hook{})
+	logger.Info().Ctx(newrelic.NewContext(context.Background(), txn)).Msg("Hello New Relic!")
+	logger.Info().Msg("no transaction")
+
+	dec := json.NewDecoder(buf)
+	var data map[string]interface{}
+	if err := dec.Decode(&data); nil != err {
+		t.Fatal(err)
+	}
+	expect := map[string]interface{}{
+		logcontext.KeyMessage:    "Hello New Relic!",
+		logcontext.KeyTraceID:    md.TraceID,
+		logcontext.KeySpanID:     md.SpanID,
+		logcontext.KeyEntityName: "my app",
+		logcontext.KeyEntityType: "SERVICE",
+		logcontext.KeyHostname:   md.Hostname,
+	}
+	for key, val := range expect {
+		if data[key] != val {
+			t.Errorf("key=%s expect=%#v actual=%#v", key, val, data[key])
+		}
+	}
+	data = nil
+	if err := dec.Decode(&data); nil != err {
+		t.Fatal(err)
+	}
+	if _, ok := data[logcontext.KeyTraceID]; ok || data[logcontext.KeyMessage] != "no transaction" {
+		t.Error(data)
+	}
+}
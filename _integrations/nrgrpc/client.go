@@ -0,0 +1,112 @@
+package nrgrpc
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	newrelic "github.com/newrelic/go-agent"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// targetHost removes the resolver scheme and authority from a dial target,
+// eg. "dns:///example.com:443" becomes "example.com:443".
+func targetHost(target string) string {
+	if idx := strings.Index(target, "://"); idx >= 0 {
+		target = target[idx+len("://"):]
+		if idx := strings.Index(target, "/"); idx >= 0 {
+			target = target[idx+1:]
+		}
+	}
+	return target
+}
+
+// startClientSegment starts an external segment for the call and returns a
+// context whose outgoing metadata contains the distributed tracing payload.
+func startClientSegment(ctx context.Context, txn newrelic.Transaction, method, target string) (*newrelic.ExternalSegment, context.Context) {
+	seg := &newrelic.ExternalSegment{
+		StartTime: newrelic.StartSegmentNow(txn),
+		URL:       "grpc://" + targetHost(target) + method,
+	}
+
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	for key, values := range seg.OutboundHeaders() {
+		md.Append(key, values...)
+	}
+	return seg, metadata.NewOutgoingContext(ctx, md)
+}
+
+// UnaryClientInterceptor instruments client unary calls.  If the context
+// contains a transaction, the call is recorded as an external segment and
+// the distributed tracing payload is added to the outgoing metadata.  Use it
+// with grpc.WithUnaryInterceptor.
+func UnaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	txn := newrelic.FromContext(ctx)
+	if nil == txn {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	seg, ctx := startClientSegment(ctx, txn, method, cc.Target())
+	defer seg.End()
+
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// wrappedClientStream ends the segment when the stream is finished: when
+// receiving returns an error, including io.EOF, or when the single response
+// of a stream without server streaming is received.
+type wrappedClientStream struct {
+	grpc.ClientStream
+	segment       *newrelic.ExternalSegment
+	serverStreams bool
+	endOnce       sync.Once
+}
+
+func (s *wrappedClientStream) end() {
+	s.endOnce.Do(func() { s.segment.End() })
+}
+
+func (s *wrappedClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if nil != err || !s.serverStreams {
+		s.end()
+	}
+	return err
+}
+
+func (s *wrappedClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if nil != err && io.EOF != err {
+		s.end()
+	}
+	return err
+}
+
+// StreamClientInterceptor instruments client streaming calls.  If the
+// context contains a transaction, the call is recorded as an external
+// segment which ends when the stream is finished, and the distributed
+// tracing payload is added to the outgoing metadata.  Use it with
+// grpc.WithStreamInterceptor.
+func StreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	txn := newrelic.FromContext(ctx)
+	if nil == txn {
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+	seg, ctx := startClientSegment(ctx, txn, method, cc.Target())
+	s, err := streamer(ctx, desc, cc, method, opts...)
+	if nil != err {
+		seg.End()
+		return s, err
+	}
+	return &wrappedClientStream{
+		ClientStream:  s,
+		segment:       seg,
+		serverStreams: desc.ServerStreams,
+	}, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/newrelic/go-agent/_integrations/nrgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func mustGetEnv(key string) string {
+	if val := os.Getenv(key); "" != val {
+		return val
+	}
+	panic(fmt.Sprintf("environment variable %s unset", key))
+}
+
+// startServer starts a gRPC health server instrumented with the server
+// interceptors.  Checks of unknown services return NotFound, which is
+// recorded as an expected error.
+func startServer(app newrelic.Application) string {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if nil != err {
+		panic(err)
+	}
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(nrgrpc.UnaryServerInterceptor(app,
+			nrgrpc.WithStatusHandler(codes.NotFound, nrgrpc.ExpectedStatusHandler))),
+		grpc.StreamInterceptor(nrgrpc.StreamServerInterceptor(app)),
+	)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(lis)
+	return lis.Addr().String()
+}
+
+func main() {
+	cfg := newrelic.NewConfig("gRPC App", mustGetEnv("NEW_RELIC_LICENSE_KEY"))
+	cfg.Logger = newrelic.NewDebugLogger(os.Stdout)
+	cfg.DistributedTracer.Enabled = true
+	cfg.CrossApplicationTracer.Enabled = false
+	app, err := newrelic.NewApplication(cfg)
+	if nil != err {
+		panic(err)
+	}
+	if err := app.WaitForConnection(5 * time.Second); nil != err {
+		fmt.Println(err)
+	}
+
+	addr := startServer(app)
+	conn, err := grpc.Dial(addr,
+		grpc.WithInsecure(),
+		grpc.WithUnaryInterceptor(nrgrpc.UnaryClientInterceptor),
+		grpc.WithStreamInterceptor(nrgrpc.StreamClientInterceptor),
+	)
+	if nil != err {
+		panic(err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	txn := app.StartTransaction("checkHealth", nil, nil)
+	ctx := newrelic.NewContext(context.Background(), txn)
+	for _, service := range []string{"", "unknown.Service"} {
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		fmt.Println(resp, err)
+	}
+	txn.End()
+
+	app.Shutdown(10 * time.Second)
+}
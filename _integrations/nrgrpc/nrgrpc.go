@@ -0,0 +1,50 @@
+// Package nrgrpc instruments https://github.com/grpc/grpc-go.
+//
+// This package creates transactions for the calls handled by a gRPC server and
+// external segments for the calls made by a gRPC client.  Distributed tracing
+// payloads are sent and received as gRPC metadata, so traces continue across
+// instrumented clients and servers.
+//
+// To instrument a server, add the server interceptors when creating the
+// server.  Each call starts a web transaction named after the full method,
+// eg. "WebTransaction/Go/helloworld.Greeter/SayHello", and the transaction is
+// added to the handler's context:
+//
+//	server := grpc.NewServer(
+//		grpc.UnaryInterceptor(nrgrpc.UnaryServerInterceptor(app)),
+//		grpc.StreamInterceptor(nrgrpc.StreamServerInterceptor(app)),
+//	)
+//
+//	func (s *Server) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloReply, error) {
+//		txn := newrelic.FromContext(ctx)
+//		// ...
+//	}
+//
+// The status code of each call is recorded in the grpcStatusCode attribute.
+// Calls which return a status other than OK are recorded as errors by
+// default.  Use WithStatusHandler to change how a status code is handled:
+//
+//	nrgrpc.UnaryServerInterceptor(app,
+//		nrgrpc.WithStatusHandler(codes.NotFound, nrgrpc.IgnoreStatusHandler),
+//		nrgrpc.WithStatusHandler(codes.InvalidArgument, nrgrpc.ExpectedStatusHandler),
+//	)
+//
+// To instrument a client, add the client interceptors when dialing.  Calls
+// made with a context containing a transaction are recorded as external
+// segments with a URL of the form "grpc://host/helloworld.Greeter/SayHello":
+//
+//	conn, err := grpc.Dial(
+//		"localhost:8080",
+//		grpc.WithUnaryInterceptor(nrgrpc.UnaryClientInterceptor),
+//		grpc.WithStreamInterceptor(nrgrpc.StreamClientInterceptor),
+//	)
+//
+//	ctx := newrelic.NewContext(context.Background(), txn)
+//	reply, err := client.SayHello(ctx, &pb.HelloRequest{Name: "New Relic"})
+//
+// Example: https://github.com/newrelic/go-agent/tree/master/_integrations/nrgrpc/example/main.go
+package nrgrpc
+
+import "github.com/newrelic/go-agent/internal"
+
+func init() { internal.TrackUsage("integration", "framework", "grpc") }
@@ -0,0 +1,465 @@
+package nrgrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/newrelic/go-agent/internal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// codec marshals string messages so that the test service does not need
+// generated protocol buffer code.
+type codec struct{}
+
+func (codec) Name() string { return "proto" }
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	s, ok := v.(*string)
+	if !ok {
+		return nil, errors.New("not a string")
+	}
+	return []byte(*s), nil
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	s, ok := v.(*string)
+	if !ok {
+		return errors.New("not a string")
+	}
+	*s = string(data)
+	return nil
+}
+
+const serviceName = "testapp.TestApplication"
+
+// metadataReply returns the distributed tracing metadata received by the
+// server.
+func metadataReply(ctx context.Context) (string, error) {
+	if nil == newrelic.FromContext(ctx) {
+		return "", status.Error(codes.Internal, "no transaction in context")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	js, err := json.Marshal(map[string][]string{
+		"newrelic":    md.Get("newrelic"),
+		"traceparent": md.Get("traceparent"),
+	})
+	return string(js), err
+}
+
+func unaryMethod(name string, fn func(context.Context) (string, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			var in string
+			if err := dec(&in); nil != err {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				reply, err := fn(ctx)
+				if nil != err {
+					return nil, err
+				}
+				return &reply, nil
+			}
+			if nil == interceptor {
+				return handler(ctx, &in)
+			}
+			return interceptor(ctx, &in, &grpc.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: "/" + serviceName + "/" + name,
+			}, handler)
+		},
+	}
+}
+
+// doStreamStream replies to each message received with the metadata.
+func doStreamStream(srv interface{}, stream grpc.ServerStream) error {
+	for {
+		var in string
+		if err := stream.RecvMsg(&in); io.EOF == err {
+			return nil
+		} else if nil != err {
+			return err
+		}
+		reply, err := metadataReply(stream.Context())
+		if nil != err {
+			return err
+		}
+		if err := stream.SendMsg(&reply); nil != err {
+			return err
+		}
+	}
+}
+
+// doUnaryStream replies to a single message with three messages.
+func doUnaryStream(srv interface{}, stream grpc.ServerStream) error {
+	var in string
+	if err := stream.RecvMsg(&in); nil != err {
+		return err
+	}
+	reply, err := metadataReply(stream.Context())
+	if nil != err {
+		return err
+	}
+	for i := 0; i < 3; i++ {
+		if err := stream.SendMsg(&reply); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		unaryMethod("DoUnaryUnary", metadataReply),
+		unaryMethod("DoUnaryUnaryError", func(ctx context.Context) (string, error) {
+			return "", status.Error(codes.DataLoss, "oooooops!")
+		}),
+		unaryMethod("DoUnaryUnaryNotFound", func(ctx context.Context) (string, error) {
+			return "", status.Error(codes.NotFound, "not here")
+		}),
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "DoStreamStream",
+			Handler:       doStreamStream,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DoUnaryStream",
+			Handler:       doUnaryStream,
+			ServerStreams: true,
+		},
+	},
+}
+
+func distributedTracingReplyFields(reply *internal.ConnectReply) {
+	reply.AccountID = "123"
+	reply.AppID = "456"
+	reply.PrimaryAppID = "456"
+	reply.TrustedAccountKey = "123"
+	reply.AdaptiveSampler = internal.SampleEverything{}
+}
+
+func testApp(t *testing.T) newrelic.Application {
+	cfg := newrelic.NewConfig("appname", "0123456789012345678901234567890123456789")
+	cfg.Enabled = false
+	cfg.DistributedTracer.Enabled = true
+	cfg.CrossApplicationTracer.Enabled = false
+	app, err := newrelic.NewApplication(cfg)
+	if nil != err {
+		t.Fatal(err)
+	}
+	internal.HarvestTesting(app, distributedTracingReplyFields)
+	return app
+}
+
+// newTestServer starts an in-process server using the server interceptors
+// and returns a connection to it which uses the client interceptors.
+func newTestServer(t *testing.T, app newrelic.Application, options ...HandlerOption) *grpc.ClientConn {
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(codec{}),
+		grpc.UnaryInterceptor(UnaryServerInterceptor(app, options...)),
+		grpc.StreamInterceptor(StreamServerInterceptor(app, options...)),
+	)
+	server.RegisterService(&serviceDesc, nil)
+	go server.Serve(lis)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return lis.Dial()
+		}),
+		grpc.WithInsecure(),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(codec{})),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor),
+		grpc.WithStreamInterceptor(StreamClientInterceptor),
+	)
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		server.Stop()
+	})
+	return conn
+}
+
+func invoke(ctx context.Context, conn *grpc.ClientConn, method string) (map[string][]string, error) {
+	in, out := "hello", ""
+	if err := conn.Invoke(ctx, "/"+serviceName+"/"+method, &in, &out); nil != err {
+		return nil, err
+	}
+	var md map[string][]string
+	err := json.Unmarshal([]byte(out), &md)
+	return md, err
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	app := testApp(t)
+	conn := newTestServer(t, app)
+
+	if _, err := invoke(context.Background(), conn, "DoUnaryUnary"); nil != err {
+		t.Fatal(err)
+	}
+	app.(internal.Expect).ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "WebTransaction/Go/" + serviceName + "/DoUnaryUnary", Scope: "", Forced: true, Data: nil},
+	})
+	app.(internal.Expect).ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name":             "WebTransaction/Go/" + serviceName + "/DoUnaryUnary",
+			"nr.apdexPerfZone": internal.MatchAnything,
+			"guid":             internal.MatchAnything,
+			"traceId":          internal.MatchAnything,
+			"priority":         internal.MatchAnything,
+			"sampled":          internal.MatchAnything,
+		},
+		AgentAttributes: map[string]interface{}{
+			newrelic.AttributeGRPCStatusCode: "OK",
+			"request.method":                 "POST",
+			"request.uri":                    "grpc://bufnet/" + serviceName + "/DoUnaryUnary",
+			"request.headers.contentType":    "application/grpc+proto",
+		},
+		UserAttributes: map[string]interface{}{},
+	}})
+}
+
+func TestUnaryServerInterceptorError(t *testing.T) {
+	app := testApp(t)
+	conn := newTestServer(t, app)
+
+	_, err := invoke(context.Background(), conn, "DoUnaryUnaryError")
+	if codes.DataLoss != status.Code(err) {
+		t.Fatal(err)
+	}
+	app.(internal.Expect).ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":     "gRPC Status: DataLoss",
+			"error.message":   "oooooops!",
+			"transactionName": "WebTransaction/Go/" + serviceName + "/DoUnaryUnaryError",
+			"guid":            internal.MatchAnything,
+			"traceId":         internal.MatchAnything,
+			"priority":        internal.MatchAnything,
+			"sampled":         internal.MatchAnything,
+		},
+		AgentAttributes: map[string]interface{}{
+			newrelic.AttributeGRPCStatusCode: "DataLoss",
+			"request.method":                 "POST",
+			"request.uri":                    "grpc://bufnet/" + serviceName + "/DoUnaryUnaryError",
+			"request.headers.contentType":    "application/grpc+proto",
+			"request.headers.User-Agent":     internal.MatchAnything,
+		},
+		UserAttributes: map[string]interface{}{},
+	}})
+}
+
+func TestStatusHandlers(t *testing.T) {
+	app := testApp(t)
+	conn := newTestServer(t, app,
+		WithStatusHandler(codes.DataLoss, IgnoreStatusHandler),
+		WithStatusHandler(codes.NotFound, ExpectedStatusHandler),
+	)
+
+	if _, err := invoke(context.Background(), conn, "DoUnaryUnaryError"); codes.DataLoss != status.Code(err) {
+		t.Fatal(err)
+	}
+	if _, err := invoke(context.Background(), conn, "DoUnaryUnaryNotFound"); codes.NotFound != status.Code(err) {
+		t.Fatal(err)
+	}
+	app.(internal.Expect).ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":     "gRPC Status: NotFound",
+			"error.message":   "not here",
+			"error.expected":  true,
+			"transactionName": "WebTransaction/Go/" + serviceName + "/DoUnaryUnaryNotFound",
+			"guid":            internal.MatchAnything,
+			"traceId":         internal.MatchAnything,
+			"priority":        internal.MatchAnything,
+			"sampled":         internal.MatchAnything,
+		},
+		AgentAttributes: map[string]interface{}{
+			newrelic.AttributeGRPCStatusCode: "NotFound",
+			"request.method":                 "POST",
+			"request.uri":                    "grpc://bufnet/" + serviceName + "/DoUnaryUnaryNotFound",
+			"request.headers.contentType":    "application/grpc+proto",
+			"request.headers.User-Agent":     internal.MatchAnything,
+		},
+		UserAttributes: map[string]interface{}{},
+	}})
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	app := testApp(t)
+	conn := newTestServer(t, app)
+
+	stream, err := conn.NewStream(context.Background(), &serviceDesc.Streams[0], "/"+serviceName+"/DoStreamStream")
+	if nil != err {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		in, out := "hello", ""
+		if err := stream.SendMsg(&in); nil != err {
+			t.Fatal(err)
+		}
+		if err := stream.RecvMsg(&out); nil != err {
+			t.Fatal(err)
+		}
+	}
+	stream.CloseSend()
+	var out string
+	if err := stream.RecvMsg(&out); io.EOF != err {
+		t.Fatal(err)
+	}
+	app.(internal.Expect).ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "WebTransaction/Go/" + serviceName + "/DoStreamStream", Scope: "", Forced: true, Data: nil},
+	})
+}
+
+func TestClientUnaryDistributedTracing(t *testing.T) {
+	serverApp := testApp(t)
+	conn := newTestServer(t, serverApp)
+
+	app := testApp(t)
+	txn := app.StartTransaction("client", nil, nil)
+	ctx := newrelic.NewContext(context.Background(), txn)
+	md, err := invoke(ctx, conn, "DoUnaryUnary")
+	if nil != err {
+		t.Fatal(err)
+	}
+	txn.End()
+	if len(md["newrelic"]) != 1 || len(md["traceparent"]) != 1 {
+		t.Error("distributed tracing metadata not received", md)
+	}
+
+	app.(internal.Expect).ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "External/bufnet/all", Scope: "", Forced: false, Data: nil},
+		{Name: "External/bufnet/all", Scope: "OtherTransaction/Go/client", Forced: false, Data: nil},
+	})
+	app.(internal.Expect).ExpectSpanEvents(t, []internal.WantEvent{
+		{
+			Intrinsics: map[string]interface{}{
+				"name":          "OtherTransaction/Go/client",
+				"category":      "generic",
+				"nr.entryPoint": true,
+				"guid":          internal.MatchAnything,
+				"transactionId": internal.MatchAnything,
+				"traceId":       internal.MatchAnything,
+				"priority":      internal.MatchAnything,
+				"sampled":       internal.MatchAnything,
+			},
+			UserAttributes:  map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":          "External/bufnet/all",
+				"category":      "http",
+				"component":     "http",
+				"span.kind":     "client",
+				"http.url":      "grpc://bufnet/" + serviceName + "/DoUnaryUnary",
+				"parentId":      internal.MatchAnything,
+				"guid":          internal.MatchAnything,
+				"transactionId": internal.MatchAnything,
+				"traceId":       internal.MatchAnything,
+				"priority":      internal.MatchAnything,
+				"sampled":       internal.MatchAnything,
+			},
+			UserAttributes:  map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{},
+		},
+	})
+	serverApp.(internal.Expect).ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "Supportability/DistributedTrace/AcceptPayload/Success", Scope: "", Forced: true, Data: nil},
+	})
+}
+
+func TestClientStreamingDistributedTracing(t *testing.T) {
+	serverApp := testApp(t)
+	conn := newTestServer(t, serverApp)
+
+	app := testApp(t)
+	txn := app.StartTransaction("client", nil, nil)
+	ctx := newrelic.NewContext(context.Background(), txn)
+	stream, err := conn.NewStream(ctx, &serviceDesc.Streams[1], "/"+serviceName+"/DoUnaryStream")
+	if nil != err {
+		t.Fatal(err)
+	}
+	in := "hello"
+	if err := stream.SendMsg(&in); nil != err {
+		t.Fatal(err)
+	}
+	stream.CloseSend()
+	var replies int
+	for {
+		var out string
+		if err := stream.RecvMsg(&out); io.EOF == err {
+			break
+		} else if nil != err {
+			t.Fatal(err)
+		}
+		replies++
+	}
+	txn.End()
+	if 3 != replies {
+		t.Error(replies)
+	}
+
+	app.(internal.Expect).ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "External/bufnet/all", Scope: "OtherTransaction/Go/client", Forced: false, Data: nil},
+	})
+	serverApp.(internal.Expect).ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "Supportability/DistributedTrace/AcceptPayload/Success", Scope: "", Forced: true, Data: nil},
+	})
+}
+
+func TestClientNoTransaction(t *testing.T) {
+	app := testApp(t)
+	conn := newTestServer(t, app)
+
+	md, err := invoke(context.Background(), conn, "DoUnaryUnary")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if len(md["newrelic"]) != 0 || len(md["traceparent"]) != 0 {
+		t.Error("unexpected distributed tracing metadata", md)
+	}
+}
+
+func TestNilApp(t *testing.T) {
+	conn := newTestServer(t, nil)
+
+	_, err := invoke(context.Background(), conn, "DoUnaryUnary")
+	if codes.Internal != status.Code(err) {
+		t.Error("transaction should not be in context", err)
+	}
+}
+
+func TestTargetHost(t *testing.T) {
+	testcases := []struct {
+		target string
+		expect string
+	}{
+		{target: "localhost:8080", expect: "localhost:8080"},
+		{target: "dns:///example.com:443", expect: "example.com:443"},
+		{target: "dns://8.8.8.8/example.com", expect: "example.com"},
+		{target: "passthrough:///bufnet", expect: "bufnet"},
+	}
+	for _, tc := range testcases {
+		if actual := targetHost(tc.target); actual != tc.expect {
+			t.Errorf("target=%q expect=%q actual=%q", tc.target, tc.expect, actual)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package nrgrpc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/newrelic/go-agent/internal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// StatusHandler is called by the server interceptors with the status of each
+// call once the handler has returned.
+type StatusHandler func(ctx context.Context, txn newrelic.Transaction, s *status.Status)
+
+// ErrorStatusHandler records the status as an error.  The error class is the
+// status code, eg. "gRPC Status: NotFound", and the error message is the
+// status message.  It is the default handler for all codes other than OK.
+func ErrorStatusHandler(ctx context.Context, txn newrelic.Transaction, s *status.Status) {
+	txn.NoticeError(newrelic.Error{
+		Message: s.Message(),
+		Class:   statusClass(s),
+	})
+}
+
+// ExpectedStatusHandler records the status as an expected error: it appears
+// in the errors inbox but does not affect the error rate or Apdex.
+func ExpectedStatusHandler(ctx context.Context, txn newrelic.Transaction, s *status.Status) {
+	txn.NoticeError(newrelic.Error{
+		Message:  s.Message(),
+		Class:    statusClass(s),
+		Expected: true,
+	})
+}
+
+// IgnoreStatusHandler does not record an error.  It is the default handler
+// for OK.
+func IgnoreStatusHandler(ctx context.Context, txn newrelic.Transaction, s *status.Status) {}
+
+func statusClass(s *status.Status) string {
+	return "gRPC Status: " + s.Code().String()
+}
+
+// HandlerOption configures the server interceptors.
+type HandlerOption func(*handlerConfig)
+
+type handlerConfig struct {
+	statusHandlers map[codes.Code]StatusHandler
+}
+
+// WithStatusHandler sets the handler used for calls which return the code
+// provided.
+func WithStatusHandler(c codes.Code, h StatusHandler) HandlerOption {
+	return func(cfg *handlerConfig) {
+		cfg.statusHandlers[c] = h
+	}
+}
+
+func newHandlerConfig(options []HandlerOption) *handlerConfig {
+	cfg := &handlerConfig{
+		statusHandlers: make(map[codes.Code]StatusHandler),
+	}
+	for _, opt := range options {
+		opt(cfg)
+	}
+	return cfg
+}
+
+func (cfg *handlerConfig) reportStatus(ctx context.Context, txn newrelic.Transaction, err error) {
+	s := status.Convert(err)
+	internal.AddAgentAttribute(txn, internal.AttributeGRPCStatusCode, s.Code().String(), nil)
+
+	h, ok := cfg.statusHandlers[s.Code()]
+	if !ok {
+		if codes.OK == s.Code() {
+			h = IgnoreStatusHandler
+		} else {
+			h = ErrorStatusHandler
+		}
+	}
+	if nil != h {
+		h(ctx, txn, s)
+	}
+}
+
+// request implements newrelic.WebRequest for an incoming call.  The
+// metadata is used as the request headers so that distributed tracing
+// payloads are accepted.
+type request struct {
+	header http.Header
+	url    *url.URL
+}
+
+func (r request) Header() http.Header               { return r.header }
+func (r request) URL() *url.URL                     { return r.url }
+func (r request) Method() string                    { return "POST" }
+func (r request) Transport() newrelic.TransportType { return newrelic.TransportHTTP }
+
+func newRequest(ctx context.Context, fullMethod string) request {
+	r := request{
+		header: make(http.Header),
+		url:    &url.URL{Scheme: "grpc", Path: fullMethod},
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, values := range md {
+		// Binary metadata and pseudo headers such as :authority are
+		// not useful headers.
+		if strings.HasSuffix(key, "-bin") || strings.HasPrefix(key, ":") {
+			continue
+		}
+		for _, val := range values {
+			r.header.Add(key, val)
+		}
+	}
+	if authority := md.Get(":authority"); len(authority) > 0 {
+		r.url.Host = authority[0]
+	}
+	return r
+}
+
+func startTransaction(ctx context.Context, app newrelic.Application, fullMethod string) newrelic.Transaction {
+	txn := app.StartTransaction(strings.TrimPrefix(fullMethod, "/"), nil, nil)
+	txn.SetWebRequest(newRequest(ctx, fullMethod))
+	return txn
+}
+
+// UnaryServerInterceptor instruments server unary calls.  Each call is
+// recorded as a web transaction which is added to the handler's context.  If
+// app is nil, the interceptor calls the handler without instrumentation.
+func UnaryServerInterceptor(app newrelic.Application, options ...HandlerOption) grpc.UnaryServerInterceptor {
+	if nil == app {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			return handler(ctx, req)
+		}
+	}
+	cfg := newHandlerConfig(options)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		txn := startTransaction(ctx, app, info.FullMethod)
+		defer txn.End()
+
+		ctx = newrelic.NewContext(ctx, txn)
+		resp, err := handler(ctx, req)
+		cfg.reportStatus(ctx, txn, err)
+		return resp, err
+	}
+}
+
+// wrappedServerStream replaces the context of the server stream with one
+// containing the transaction.
+type wrappedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s wrappedServerStream) Context() context.Context { return s.ctx }
+
+// StreamServerInterceptor instruments server streaming calls.  Each call is
+// recorded as a web transaction which is added to the stream's context.  If
+// app is nil, the interceptor calls the handler without instrumentation.
+func StreamServerInterceptor(app newrelic.Application, options ...HandlerOption) grpc.StreamServerInterceptor {
+	if nil == app {
+		return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			return handler(srv, ss)
+		}
+	}
+	cfg := newHandlerConfig(options)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		txn := startTransaction(ss.Context(), app, info.FullMethod)
+		defer txn.End()
+
+		ctx := newrelic.NewContext(ss.Context(), txn)
+		err := handler(srv, wrappedServerStream{ServerStream: ss, ctx: ctx})
+		cfg.reportStatus(ctx, txn, err)
+		return err
+	}
+}
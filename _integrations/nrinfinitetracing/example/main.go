@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/newrelic/go-agent/_integrations/nrinfinitetracing"
+)
+
+func mustGetEnv(key string) string {
+	if val := os.Getenv(key); "" != val {
+		return val
+	}
+	panic(fmt.Sprintf("environment variable %s unset", key))
+}
+
+func main() {
+	cfg := newrelic.NewConfig("Infinite Tracing App", mustGetEnv("NEW_RELIC_LICENSE_KEY"))
+	cfg.Logger = newrelic.NewDebugLogger(os.Stdout)
+	cfg.DistributedTracer.Enabled = true
+	cfg.CrossApplicationTracer.Enabled = false
+	cfg.InfiniteTracing.TraceObserver = nrinfinitetracing.NewTraceObserver(nrinfinitetracing.Config{
+		Host: mustGetEnv("NEW_RELIC_TRACE_OBSERVER_HOST"),
+	})
+	app, err := newrelic.NewApplication(cfg)
+	if nil != err {
+		panic(err)
+	}
+	if err := app.WaitForConnection(5 * time.Second); nil != err {
+		fmt.Println(err)
+	}
+
+	txn := app.StartTransaction("myTransaction", nil, nil)
+	segment := newrelic.StartSegment(txn, "mySegment")
+	time.Sleep(10 * time.Millisecond)
+	segment.End()
+	txn.End()
+
+	app.Shutdown(10 * time.Second)
+}
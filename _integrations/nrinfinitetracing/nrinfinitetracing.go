@@ -0,0 +1,187 @@
+// Package nrinfinitetracing streams span events to a New Relic trace observer
+// over gRPC.
+//
+// Infinite tracing sends every span event to the trace observer as the span
+// ends rather than sending a sample of span events each harvest.  The trace
+// observer decides which traces to keep once they are complete.  Set
+// Config.InfiniteTracing.TraceObserver to enable it:
+//
+//	cfg := newrelic.NewConfig("Example App", os.Getenv("NEW_RELIC_LICENSE_KEY"))
+//	cfg.DistributedTracer.Enabled = true
+//	cfg.CrossApplicationTracer.Enabled = false
+//	cfg.InfiniteTracing.TraceObserver = nrinfinitetracing.NewTraceObserver(nrinfinitetracing.Config{
+//		Host: "YOUR_TRACE_OBSERVER_HOST",
+//	})
+//
+// This package is separate from the agent so that applications which do not
+// use infinite tracing do not depend on gRPC.
+//
+// Example: https://github.com/newrelic/go-agent/tree/master/_integrations/nrinfinitetracing/example/main.go
+package nrinfinitetracing
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/newrelic/go-agent/internal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+func init() { internal.TrackUsage("integration", "infinitetracing") }
+
+const (
+	defaultPort = 443
+	// closeTimeout limits the time spent waiting for the trace observer
+	// to acknowledge the end of a stream.
+	closeTimeout = 5 * time.Second
+)
+
+// Config contains the location of the trace observer.
+type Config struct {
+	// Host is the trace observer host, eg. "trace-observer.example.com".
+	Host string
+	// Port is the trace observer port.  It defaults to 443.
+	Port int
+}
+
+type traceObserver struct {
+	addr string
+	// dialOptions are used when dialing the trace observer.  Connections
+	// use TLS.
+	dialOptions []grpc.DialOption
+
+	// conn is created by the first DialTraceObserver call and shared by
+	// all streams.
+	sync.Mutex
+	conn *grpc.ClientConn
+}
+
+// NewTraceObserver creates a TraceObserver for the trace observer provided.
+// No connection is made until the application connects to New Relic.
+func NewTraceObserver(cfg Config) newrelic.TraceObserver {
+	port := cfg.Port
+	if 0 == port {
+		port = defaultPort
+	}
+	return &traceObserver{
+		addr: net.JoinHostPort(cfg.Host, strconv.Itoa(port)),
+		dialOptions: []grpc.DialOption{
+			grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})),
+		},
+	}
+}
+
+func (to *traceObserver) getConn() (*grpc.ClientConn, error) {
+	to.Lock()
+	defer to.Unlock()
+
+	if nil == to.conn {
+		conn, err := grpc.Dial(to.addr, to.dialOptions...)
+		if nil != err {
+			return nil, err
+		}
+		to.conn = conn
+	}
+	return to.conn, nil
+}
+
+// DialTraceObserver implements internal.TraceObserverDialer.
+func (to *traceObserver) DialTraceObserver(license string, runID internal.AgentRunID) (internal.TraceObserverStream, error) {
+	conn, err := to.getConn()
+	if nil != err {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = metadata.AppendToOutgoingContext(ctx,
+		"license_key", license,
+		"agent_run_token", runID.String())
+	cs, err := conn.NewStream(ctx, &grpc.StreamDesc{
+		StreamName:    "RecordSpan",
+		ServerStreams: true,
+		ClientStreams: true,
+	}, recordSpanMethod, grpc.ForceCodec(codec{}))
+	if nil != err {
+		cancel()
+		return nil, err
+	}
+	s := &stream{
+		cs:       cs,
+		cancel:   cancel,
+		recvDone: make(chan struct{}),
+	}
+	go s.receive()
+	return s, nil
+}
+
+type stream struct {
+	cs     grpc.ClientStream
+	cancel context.CancelFunc
+
+	// recvDone is closed when the trace observer closes the stream.
+	// recvErr is the reason, and is nil if the stream was closed
+	// normally.
+	recvDone chan struct{}
+	recvErr  error
+}
+
+// receive reads the RecordStatus messages sent by the trace observer until the
+// stream ends.
+func (s *stream) receive() {
+	defer close(s.recvDone)
+	for {
+		var status recordStatus
+		if err := s.cs.RecvMsg(&status); nil != err {
+			if err != io.EOF {
+				s.recvErr = err
+			}
+			return
+		}
+	}
+}
+
+// Send implements internal.TraceObserverStream.
+func (s *stream) Send(e *internal.SpanEvent) error {
+	select {
+	case <-s.recvDone:
+		if nil != s.recvErr {
+			return s.recvErr
+		}
+		return io.EOF
+	default:
+	}
+	err := s.cs.SendMsg(newSpan(e))
+	if io.EOF == err {
+		// The stream has been closed by the trace observer, and
+		// the reason is available from the receive goroutine.
+		<-s.recvDone
+		if nil != s.recvErr {
+			err = s.recvErr
+		}
+	}
+	return err
+}
+
+// Close implements internal.TraceObserverStream.
+func (s *stream) Close() error {
+	defer s.cancel()
+
+	if err := s.cs.CloseSend(); nil != err {
+		return err
+	}
+	t := time.NewTimer(closeTimeout)
+	defer t.Stop()
+	select {
+	case <-s.recvDone:
+		return s.recvErr
+	case <-t.C:
+		return nil
+	}
+}
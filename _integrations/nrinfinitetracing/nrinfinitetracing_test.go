@@ -0,0 +1,319 @@
+package nrinfinitetracing
+
+import (
+	"encoding/binary"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/newrelic/go-agent/internal"
+	"github.com/newrelic/go-agent/internal/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// receivedSpan is a Span message decoded by the test server.
+type receivedSpan struct {
+	traceID        string
+	intrinsics     map[string]interface{}
+	userAttributes map[string]interface{}
+}
+
+func decodeAttributeValue(b []byte) (interface{}, error) {
+	field, _, num, val, _, err := consumeField(b)
+	if nil != err {
+		return nil, err
+	}
+	switch field {
+	case 1:
+		return string(val), nil
+	case 2:
+		return 1 == num, nil
+	case 3:
+		return int64(num), nil
+	default:
+		return math.Float64frombits(binary.LittleEndian.Uint64(val)), nil
+	}
+}
+
+func decodeAttribute(attrs map[string]interface{}, b []byte) error {
+	_, _, _, key, entry, err := consumeField(b)
+	if nil != err {
+		return err
+	}
+	_, _, _, value, _, err := consumeField(entry)
+	if nil != err {
+		return err
+	}
+	v, err := decodeAttributeValue(value)
+	if nil != err {
+		return err
+	}
+	attrs[string(key)] = v
+	return nil
+}
+
+func (s *receivedSpan) unmarshal(b []byte) error {
+	s.intrinsics = make(map[string]interface{})
+	s.userAttributes = make(map[string]interface{})
+	for len(b) > 0 {
+		field, _, _, val, rest, err := consumeField(b)
+		if nil != err {
+			return err
+		}
+		b = rest
+		switch field {
+		case 1:
+			s.traceID = string(val)
+		case 2:
+			if err := decodeAttribute(s.intrinsics, val); nil != err {
+				return err
+			}
+		case 3:
+			if err := decodeAttribute(s.userAttributes, val); nil != err {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r recordStatus) marshal() []byte {
+	return appendVarint(appendTag(nil, 1, wireVarint), r.messagesSeen)
+}
+
+// testServer is a local stand-in for the trace observer.
+type testServer struct {
+	sync.Mutex
+	spans    []receivedSpan
+	metadata []metadata.MD
+	// failures is the number of streams which should fail after
+	// receiving a span.
+	failures int
+
+	addr   string
+	server *grpc.Server
+}
+
+func (ts *testServer) recordSpan(srv interface{}, stream grpc.ServerStream) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	ts.Lock()
+	ts.metadata = append(ts.metadata, md)
+	ts.Unlock()
+
+	var seen uint64
+	for {
+		var s receivedSpan
+		if err := stream.RecvMsg(&s); nil != err {
+			// The client has closed the stream.
+			return nil
+		}
+		seen++
+		ts.Lock()
+		ts.spans = append(ts.spans, s)
+		fail := ts.failures > 0
+		if fail {
+			ts.failures--
+		}
+		ts.Unlock()
+		if fail {
+			return status.Error(codes.Unavailable, "try again")
+		}
+		if err := stream.SendMsg(recordStatus{messagesSeen: seen}); nil != err {
+			return err
+		}
+	}
+}
+
+func newTestServer(t *testing.T) *testServer {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	ts := &testServer{
+		addr:   lis.Addr().String(),
+		server: grpc.NewServer(grpc.ForceServerCodec(codec{})),
+	}
+	ts.server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "com.newrelic.trace.v1.IngestService",
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "RecordSpan",
+			Handler:       ts.recordSpan,
+			ServerStreams: true,
+			ClientStreams: true,
+		}},
+	}, ts)
+	go ts.server.Serve(lis)
+	return ts
+}
+
+func (ts *testServer) numSpans() int {
+	ts.Lock()
+	defer ts.Unlock()
+	return len(ts.spans)
+}
+
+func (ts *testServer) waitForSpans(t *testing.T, n int) {
+	deadline := time.Now().Add(10 * time.Second)
+	for ts.numSpans() < n {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for spans", ts.numSpans(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func testObserver(ts *testServer) *traceObserver {
+	return &traceObserver{
+		addr:        ts.addr,
+		dialOptions: []grpc.DialOption{grpc.WithInsecure()},
+	}
+}
+
+func TestNewTraceObserver(t *testing.T) {
+	to := NewTraceObserver(Config{Host: "trace-observer.example.com"}).(*traceObserver)
+	if to.addr != "trace-observer.example.com:443" {
+		t.Error(to.addr)
+	}
+	to = NewTraceObserver(Config{Host: "localhost", Port: 8080}).(*traceObserver)
+	if to.addr != "localhost:8080" {
+		t.Error(to.addr)
+	}
+}
+
+func TestWireFormat(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.server.Stop()
+
+	stream, err := testObserver(ts).DialTraceObserver("my-license", "my-run-id")
+	if nil != err {
+		t.Fatal(err)
+	}
+	err = stream.Send(&internal.SpanEvent{
+		TraceID:       "trace-id",
+		GUID:          "guid",
+		TransactionID: "txn-id",
+		Sampled:       true,
+		Priority:      0.5,
+		Timestamp:     time.Unix(1488393111, 0),
+		Duration:      2 * time.Second,
+		Name:          "myName",
+		IsEntrypoint:  true,
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := stream.Close(); nil != err {
+		t.Error(err)
+	}
+	ts.waitForSpans(t, 1)
+
+	if md := ts.metadata[0]; md.Get("license_key")[0] != "my-license" || md.Get("agent_run_token")[0] != "my-run-id" {
+		t.Error(md)
+	}
+	s := ts.spans[0]
+	if s.traceID != "trace-id" {
+		t.Error(s.traceID)
+	}
+	expect := map[string]interface{}{
+		"type":          "Span",
+		"traceId":       "trace-id",
+		"guid":          "guid",
+		"transactionId": "txn-id",
+		"sampled":       true,
+		"priority":      float64(0.5),
+		"timestamp":     int64(1488393111000),
+		"duration":      float64(2),
+		"name":          "myName",
+		"category":      "",
+		"nr.entryPoint": true,
+	}
+	if len(s.intrinsics) != len(expect) {
+		t.Error(s.intrinsics)
+	}
+	for key, val := range expect {
+		if v := s.intrinsics[key]; v != val {
+			t.Errorf("key=%s expect=%#v actual=%#v", key, val, v)
+		}
+	}
+}
+
+func TestStreamError(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.server.Stop()
+	ts.failures = 1
+
+	stream, err := testObserver(ts).DialTraceObserver("my-license", "my-run-id")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := stream.Send(&internal.SpanEvent{Name: "first"}); nil != err {
+		t.Fatal(err)
+	}
+	ts.waitForSpans(t, 1)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		err = stream.Send(&internal.SpanEvent{Name: "second"})
+		if nil != err || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if status.Code(err) != codes.Unavailable {
+		t.Error(err)
+	}
+	stream.Close()
+}
+
+func TestApplication(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.server.Stop()
+
+	cfg := newrelic.NewConfig("my app", "")
+	cfg.Enabled = false
+	cfg.DistributedTracer.Enabled = true
+	cfg.CrossApplicationTracer.Enabled = false
+	cfg.InfiniteTracing.TraceObserver = testObserver(ts)
+	if err := cfg.Validate(); nil != err {
+		t.Fatal(err)
+	}
+	observer := internal.NewTraceObserver(internal.TraceObserverConfig{
+		Dialer:  cfg.InfiniteTracing.TraceObserver,
+		License: "my-license",
+		Logger:  logger.ShimLogger{},
+	})
+	observer.SetRunID("my-run-id")
+
+	txndata := &internal.TxnData{
+		SpanEventsEnabled:      true,
+		LazilyCalculateSampled: func() bool { return true },
+		TraceObserver:          observer,
+	}
+	txndata.Attrs = internal.NewAttributes(internal.CreateAttributeConfig(internal.AttributeConfigInput{
+		Attributes: internal.AttributeDestinationConfig{Enabled: true},
+		SpanEvents: internal.AttributeDestinationConfig{Enabled: true},
+	}, true))
+	thread := internal.NewThread(txndata)
+	start := internal.StartSegment(txndata, thread, time.Now())
+	if err := internal.AddSegmentAttribute(txndata, thread, start, "zip", "zap"); nil != err {
+		t.Fatal(err)
+	}
+	if err := internal.EndBasicSegment(txndata, thread, start, time.Now(), "mySegment"); nil != err {
+		t.Fatal(err)
+	}
+	observer.Shutdown(10 * time.Second)
+
+	ts.waitForSpans(t, 1)
+	if name := ts.spans[0].intrinsics["name"]; name != "Custom/mySegment" {
+		t.Error(name)
+	}
+	if zip := ts.spans[0].userAttributes["zip"]; zip != "zap" {
+		t.Error(ts.spans[0].userAttributes)
+	}
+}
@@ -0,0 +1,211 @@
+package nrinfinitetracing
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/newrelic/go-agent/internal"
+)
+
+// The trace observer uses the com.newrelic.trace.v1 protocol:
+//
+//	service IngestService {
+//		rpc RecordSpan(stream Span) returns (stream RecordStatus) {}
+//	}
+//	message Span {
+//		string trace_id = 1;
+//		map<string, AttributeValue> intrinsics = 2;
+//		map<string, AttributeValue> user_attributes = 3;
+//		map<string, AttributeValue> agent_attributes = 4;
+//	}
+//	message AttributeValue {
+//		oneof value {
+//			string string_value = 1;
+//			bool bool_value = 2;
+//			int64 int_value = 3;
+//			double double_value = 4;
+//		}
+//	}
+//	message RecordStatus {
+//		uint64 messages_seen = 1;
+//	}
+//
+// The messages are small, so they are encoded here rather than adding a
+// dependency on generated protobuf code.
+
+const (
+	recordSpanMethod = "/com.newrelic.trace.v1.IngestService/RecordSpan"
+
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+var errMalformedMessage = errors.New("malformed protobuf message")
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendTag(b []byte, field int, wireType int) []byte {
+	return appendVarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func appendBytesField(b []byte, field int, val []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = appendVarint(b, uint64(len(val)))
+	return append(b, val...)
+}
+
+func appendAttributeValue(b []byte, val interface{}) []byte {
+	switch v := val.(type) {
+	case string:
+		return appendBytesField(b, 1, []byte(v))
+	case bool:
+		b = appendTag(b, 2, wireVarint)
+		if v {
+			return appendVarint(b, 1)
+		}
+		return appendVarint(b, 0)
+	case int:
+		return appendVarint(appendTag(b, 3, wireVarint), uint64(v))
+	case int64:
+		return appendVarint(appendTag(b, 3, wireVarint), uint64(v))
+	case float32:
+		return appendDouble(b, float64(v))
+	case float64:
+		return appendDouble(b, v)
+	default:
+		return appendBytesField(b, 1, []byte(fmt.Sprint(v)))
+	}
+}
+
+func appendDouble(b []byte, v float64) []byte {
+	b = appendTag(b, 4, wireFixed64)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+	return append(b, buf[:]...)
+}
+
+func appendAttributes(b []byte, field int, attrs map[string]interface{}) []byte {
+	// Keys are sorted so that the encoding is deterministic.
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var entry []byte
+		entry = appendBytesField(entry, 1, []byte(key))
+		entry = appendBytesField(entry, 2, appendAttributeValue(nil, attrs[key]))
+		b = appendBytesField(b, field, entry)
+	}
+	return b
+}
+
+// span is a span event encoded as a Span message.
+type span []byte
+
+func newSpan(e *internal.SpanEvent) span {
+	var b []byte
+	b = appendBytesField(b, 1, []byte(e.TraceID))
+	b = appendAttributes(b, 2, e.Intrinsics())
+	b = appendAttributes(b, 3, e.UserAttributes())
+	return span(b)
+}
+
+// recordStatus is the RecordStatus message.
+type recordStatus struct {
+	messagesSeen uint64
+}
+
+func consumeVarint(b []byte) (uint64, []byte, error) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * uint(i))
+		if b[i] < 0x80 {
+			return v, b[i+1:], nil
+		}
+	}
+	return 0, nil, errMalformedMessage
+}
+
+// consumeField reads a single field.  The value of varint fields is returned
+// as num, and the value of fixed64 and length delimited fields is returned as
+// val.
+func consumeField(b []byte) (field int, wireType int, num uint64, val []byte, rest []byte, err error) {
+	tag, b, err := consumeVarint(b)
+	if nil != err {
+		return
+	}
+	field, wireType = int(tag>>3), int(tag&7)
+	switch wireType {
+	case wireVarint:
+		num, rest, err = consumeVarint(b)
+	case wireFixed64:
+		if len(b) < 8 {
+			err = errMalformedMessage
+			return
+		}
+		val, rest = b[:8], b[8:]
+	case wireBytes:
+		var n uint64
+		n, b, err = consumeVarint(b)
+		if nil != err {
+			return
+		}
+		if uint64(len(b)) < n {
+			err = errMalformedMessage
+			return
+		}
+		val, rest = b[:n], b[n:]
+	default:
+		err = errMalformedMessage
+	}
+	return
+}
+
+func (r *recordStatus) unmarshal(b []byte) error {
+	for len(b) > 0 {
+		field, wireType, num, _, rest, err := consumeField(b)
+		if nil != err {
+			return err
+		}
+		if 1 == field && wireVarint == wireType {
+			r.messagesSeen = num
+		}
+		b = rest
+	}
+	return nil
+}
+
+// codec encodes the messages for gRPC.  It uses the name "proto" so that the
+// messages are sent with the content type expected by the trace observer.
+type codec struct{}
+
+func (codec) Name() string { return "proto" }
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(interface{ marshal() []byte })
+	if !ok {
+		return nil, fmt.Errorf("unable to marshal %T", v)
+	}
+	return m.marshal(), nil
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(interface{ unmarshal([]byte) error })
+	if !ok {
+		return fmt.Errorf("unable to unmarshal %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+func (s span) marshal() []byte { return []byte(s) }
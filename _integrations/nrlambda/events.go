@@ -0,0 +1,129 @@
+package nrlambda
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	newrelic "github.com/newrelic/go-agent"
+)
+
+func getEventSourceARN(event interface{}) string {
+	switch v := event.(type) {
+	case events.KinesisFirehoseEvent:
+		return v.DeliveryStreamArn
+	case events.KinesisEvent:
+		if len(v.Records) > 0 {
+			return v.Records[0].EventSourceArn
+		}
+	case events.CodeCommitEvent:
+		if len(v.Records) > 0 {
+			return v.Records[0].EventSourceARN
+		}
+	case events.DynamoDBEvent:
+		if len(v.Records) > 0 {
+			return v.Records[0].EventSourceArn
+		}
+	case events.SQSEvent:
+		if len(v.Records) > 0 {
+			return v.Records[0].EventSourceARN
+		}
+	case events.S3Event:
+		if len(v.Records) > 0 {
+			return v.Records[0].S3.Bucket.Arn
+		}
+	case events.SNSEvent:
+		if len(v.Records) > 0 {
+			return v.Records[0].EventSubscriptionArn
+		}
+	}
+	return ""
+}
+
+type webRequest struct {
+	header    http.Header
+	method    string
+	u         *url.URL
+	transport newrelic.TransportType
+}
+
+func (r webRequest) Header() http.Header               { return r.header }
+func (r webRequest) URL() *url.URL                     { return r.u }
+func (r webRequest) Method() string                    { return r.method }
+func (r webRequest) Transport() newrelic.TransportType { return r.transport }
+
+func eventHeader(single map[string]string, multi map[string][]string) http.Header {
+	h := make(http.Header, len(single)+len(multi))
+	for k, vs := range multi {
+		for _, v := range vs {
+			h.Add(k, v)
+		}
+	}
+	for k, v := range single {
+		h.Set(k, v)
+	}
+	return h
+}
+
+// eventWebRequest returns a WebRequest for API Gateway and Application Load
+// Balancer events, and nil for all other events.  Any distributed trace
+// payload in the request headers is accepted by Transaction.SetWebRequest.
+func eventWebRequest(event interface{}) newrelic.WebRequest {
+	var path string
+	var request webRequest
+
+	switch r := event.(type) {
+	case events.APIGatewayProxyRequest:
+		request.method = r.HTTPMethod
+		path = r.Path
+		request.header = eventHeader(r.Headers, r.MultiValueHeaders)
+	case events.ALBTargetGroupRequest:
+		// https://docs.aws.amazon.com/elasticloadbalancing/latest/application/lambda-functions.html#receive-event-from-load-balancer
+		request.method = r.HTTPMethod
+		path = r.Path
+		request.header = eventHeader(r.Headers, r.MultiValueHeaders)
+	default:
+		return nil
+	}
+
+	var host string
+	if port := request.header.Get("X-Forwarded-Port"); "" != port {
+		host = ":" + port
+	}
+	request.u = &url.URL{
+		Path: path,
+		Host: host,
+	}
+
+	switch strings.ToLower(request.header.Get("X-Forwarded-Proto")) {
+	case "https":
+		request.transport = newrelic.TransportHTTPS
+	case "http":
+		request.transport = newrelic.TransportHTTP
+	default:
+		request.transport = newrelic.TransportUnknown
+	}
+
+	return request
+}
+
+func eventResponse(event interface{}) *response {
+	var code int
+	var header http.Header
+
+	switch r := event.(type) {
+	case events.APIGatewayProxyResponse:
+		code = r.StatusCode
+		header = eventHeader(r.Headers, r.MultiValueHeaders)
+	case events.ALBTargetGroupResponse:
+		code = r.StatusCode
+		header = eventHeader(r.Headers, r.MultiValueHeaders)
+	default:
+		return nil
+	}
+	return &response{
+		code:   code,
+		header: header,
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/newrelic/go-agent/_integrations/nrlambda"
+)
+
+func handler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// nrlambda uses the context to store the transaction, so segments can
+	// be created using newrelic.FromContext.
+	if txn := newrelic.FromContext(ctx); nil != txn {
+		defer newrelic.StartSegment(txn, "mySegment").End()
+	}
+
+	fmt.Println("hello world")
+	return events.APIGatewayProxyResponse{StatusCode: 200, Body: "hello world"}, nil
+}
+
+func main() {
+	// nrlambda.NewConfig should be used in place of newrelic.NewConfig
+	// since it sets Lambda specific configuration settings including
+	// Config.ServerlessMode.Enabled.
+	cfg := nrlambda.NewConfig()
+	// Here is the opportunity to change configuration settings before the
+	// application is created.
+	app, err := newrelic.NewApplication(cfg)
+	if nil != err {
+		fmt.Println("error creating app (invalid config):", err)
+	}
+	// nrlambda.Start should be used in place of lambda.Start.
+	// nrlambda.StartHandler should be used in place of lambda.StartHandler.
+	nrlambda.Start(handler, app)
+}
@@ -0,0 +1,296 @@
+package nrlambda
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/newrelic/go-agent/internal"
+)
+
+func testApp(getenv func(string) string, t *testing.T) newrelic.Application {
+	if nil == getenv {
+		getenv = func(string) string { return "" }
+	}
+	cfg := newConfigInternal(getenv)
+	cfg.Enabled = false
+	app, err := newrelic.NewApplication(cfg)
+	if nil != err {
+		t.Fatal(err)
+	}
+	internal.HarvestTesting(app, nil)
+	return app
+}
+
+func distributedTracingEnabled(key string) string {
+	switch key {
+	case "NEW_RELIC_ACCOUNT_ID":
+		return "1"
+	case "NEW_RELIC_TRUSTED_ACCOUNT_KEY":
+		return "1"
+	case "NEW_RELIC_PRIMARY_APPLICATION_ID":
+		return "1"
+	default:
+		return ""
+	}
+}
+
+func testHandler(app newrelic.Application, handler interface{}) *wrappedHandler {
+	wrapped := Wrap(handler, app).(*wrappedHandler)
+	wrapped.functionName = "functionName"
+	wrapped.writer = &bytes.Buffer{}
+	return wrapped
+}
+
+func testContext() context.Context {
+	return lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+		AwsRequestID:       "request-id",
+		InvokedFunctionArn: "function-arn",
+	})
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	js, err := json.Marshal(v)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return js
+}
+
+var (
+	backgroundMetrics = []internal.WantMetric{
+		{Name: "OtherTransaction/Go/functionName", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransaction/all", Scope: "", Forced: true, Data: nil},
+		{Name: "DurationByCaller/Unknown/Unknown/Unknown/Unknown/all", Scope: "", Forced: false, Data: nil},
+		{Name: "DurationByCaller/Unknown/Unknown/Unknown/Unknown/allOther", Scope: "", Forced: false, Data: nil},
+	}
+)
+
+func TestColdStart(t *testing.T) {
+	app := testApp(nil, t)
+	wrapped := testHandler(app, func(ctx context.Context, s string) (string, error) {
+		return "hello", nil
+	})
+
+	resp, err := wrapped.Invoke(testContext(), mustMarshal(t, "input"))
+	if nil != err || string(resp) != `"hello"` {
+		t.Error(string(resp), err)
+	}
+	// The second invocation should not have the cold start attribute.
+	resp, err = wrapped.Invoke(testContext(), mustMarshal(t, "input"))
+	if nil != err || string(resp) != `"hello"` {
+		t.Error(string(resp), err)
+	}
+
+	app.(internal.Expect).ExpectMetrics(t, backgroundMetrics)
+	intrinsics := map[string]interface{}{
+		"name":     "OtherTransaction/Go/functionName",
+		"guid":     internal.MatchAnything,
+		"priority": internal.MatchAnything,
+		"sampled":  internal.MatchAnything,
+		"traceId":  internal.MatchAnything,
+	}
+	app.(internal.Expect).ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: intrinsics,
+		AgentAttributes: map[string]interface{}{
+			"aws.requestId":        "request-id",
+			"aws.lambda.arn":       "function-arn",
+			"aws.lambda.coldStart": true,
+		},
+	}, {
+		Intrinsics: intrinsics,
+		AgentAttributes: map[string]interface{}{
+			"aws.requestId":  "request-id",
+			"aws.lambda.arn": "function-arn",
+		},
+	}})
+}
+
+func TestErrorCapture(t *testing.T) {
+	app := testApp(nil, t)
+	returnError := errors.New("problem")
+	wrapped := testHandler(app, func(ctx context.Context, s string) (string, error) {
+		return "", returnError
+	})
+
+	if _, err := wrapped.Invoke(testContext(), mustMarshal(t, "input")); err != returnError {
+		t.Error(err)
+	}
+	app.(internal.Expect).ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":     "*errors.errorString",
+			"error.message":   "problem",
+			"transactionName": "OtherTransaction/Go/functionName",
+			"guid":            internal.MatchAnything,
+			"priority":        internal.MatchAnything,
+			"sampled":         internal.MatchAnything,
+			"traceId":         internal.MatchAnything,
+		},
+	}})
+}
+
+func TestEventSourceARN(t *testing.T) {
+	app := testApp(nil, t)
+	wrapped := testHandler(app, func(ctx context.Context, event events.SQSEvent) (string, error) {
+		return "", nil
+	})
+
+	event := events.SQSEvent{
+		Records: []events.SQSMessage{{EventSourceARN: "queue-arn"}},
+	}
+	if _, err := wrapped.Invoke(testContext(), mustMarshal(t, event)); nil != err {
+		t.Error(err)
+	}
+	app.(internal.Expect).ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name":     "OtherTransaction/Go/functionName",
+			"guid":     internal.MatchAnything,
+			"priority": internal.MatchAnything,
+			"sampled":  internal.MatchAnything,
+			"traceId":  internal.MatchAnything,
+		},
+		AgentAttributes: map[string]interface{}{
+			"aws.requestId":              "request-id",
+			"aws.lambda.arn":             "function-arn",
+			"aws.lambda.coldStart":       true,
+			"aws.lambda.eventSource.arn": "queue-arn",
+		},
+	}})
+}
+
+func TestAPIGatewayProxyRequest(t *testing.T) {
+	app := testApp(distributedTracingEnabled, t)
+	wrapped := testHandler(app, func(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+			Headers: map[string]string{
+				"Content-Type": "text/html",
+			},
+		}, nil
+	})
+
+	payload := app.StartTransaction("caller", nil, nil).CreateDistributedTracePayload()
+	event := events.APIGatewayProxyRequest{
+		Path:       "/users",
+		HTTPMethod: "GET",
+		Headers: map[string]string{
+			newrelic.DistributedTracePayloadHeader: payload.HTTPSafe(),
+			"X-Forwarded-Port":                     "443",
+			"X-Forwarded-Proto":                    "https",
+		},
+	}
+	if _, err := wrapped.Invoke(testContext(), mustMarshal(t, event)); nil != err {
+		t.Error(err)
+	}
+	app.(internal.Expect).ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "WebTransaction/Go/functionName", Scope: "", Forced: true, Data: nil},
+		{Name: "DurationByCaller/App/1/1/HTTPS/all", Scope: "", Forced: false, Data: nil},
+	})
+	app.(internal.Expect).ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name":                     "WebTransaction/Go/functionName",
+			"nr.apdexPerfZone":         "S",
+			"guid":                     internal.MatchAnything,
+			"priority":                 internal.MatchAnything,
+			"sampled":                  internal.MatchAnything,
+			"traceId":                  internal.MatchAnything,
+			"parent.type":              "App",
+			"parent.account":           "1",
+			"parent.app":               "1",
+			"parent.transportType":     "HTTPS",
+			"parent.transportDuration": internal.MatchAnything,
+			"parentId":                 internal.MatchAnything,
+			"parentSpanId":             internal.MatchAnything,
+		},
+		AgentAttributes: map[string]interface{}{
+			"aws.requestId":                "request-id",
+			"aws.lambda.arn":               "function-arn",
+			"aws.lambda.coldStart":         true,
+			"request.method":               "GET",
+			"request.uri":                  "//:443/users",
+			"httpResponseCode":             "200",
+			"response.headers.contentType": "text/html",
+		},
+	}})
+}
+
+func TestServerlessWrite(t *testing.T) {
+	cfg := newConfigInternal(func(string) string { return "" })
+	app, err := newrelic.NewApplication(cfg)
+	if nil != err {
+		t.Fatal(err)
+	}
+	wrapped := testHandler(app, func(ctx context.Context, s string) (string, error) {
+		return "hello", nil
+	})
+	if _, err := wrapped.Invoke(testContext(), mustMarshal(t, "input")); nil != err {
+		t.Error(err)
+	}
+	buf := wrapped.writer.(*bytes.Buffer)
+	metadata, data, err := internal.ParseServerlessPayload(buf.Bytes())
+	if nil != err {
+		t.Fatal(err, buf.String())
+	}
+	if v := string(metadata["arn"]); v != `"function-arn"` {
+		t.Error(v)
+	}
+	if v := string(data["analytic_event_data"]); !strings.Contains(v, `"aws.lambda.coldStart":true`) {
+		t.Error(v)
+	}
+}
+
+func TestWrapNilApp(t *testing.T) {
+	handler := func(ctx context.Context, s string) (string, error) {
+		return "hello", nil
+	}
+	wrapped := Wrap(handler, nil)
+	if _, ok := wrapped.(*wrappedHandler); ok {
+		t.Error("handler should not be wrapped when app is nil")
+	}
+	resp, err := wrapped.Invoke(context.Background(), mustMarshal(t, "input"))
+	if nil != err || string(resp) != `"hello"` {
+		t.Error(string(resp), err)
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	cfg := newConfigInternal(func(key string) string {
+		switch key {
+		case "NEW_RELIC_ACCOUNT_ID":
+			return "the-account-id"
+		case "NEW_RELIC_TRUSTED_ACCOUNT_KEY":
+			return "the-trust-key"
+		case "NEW_RELIC_PRIMARY_APPLICATION_ID":
+			return "the-app-id"
+		case "NEW_RELIC_APDEX_T":
+			return "65"
+		default:
+			return ""
+		}
+	})
+	if !cfg.ServerlessMode.Enabled {
+		t.Error(cfg.ServerlessMode.Enabled)
+	}
+	if cfg.ServerlessMode.AccountID != "the-account-id" {
+		t.Error(cfg.ServerlessMode.AccountID)
+	}
+	if cfg.ServerlessMode.TrustedAccountKey != "the-trust-key" {
+		t.Error(cfg.ServerlessMode.TrustedAccountKey)
+	}
+	if cfg.ServerlessMode.PrimaryAppID != "the-app-id" {
+		t.Error(cfg.ServerlessMode.PrimaryAppID)
+	}
+	if cfg.ServerlessMode.ApdexThreshold != 65*time.Second {
+		t.Error(cfg.ServerlessMode.ApdexThreshold)
+	}
+	if !cfg.DistributedTracer.Enabled {
+		t.Error(cfg.DistributedTracer.Enabled)
+	}
+}
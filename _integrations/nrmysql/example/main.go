@@ -0,0 +1,52 @@
+// +build go1.10
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	newrelic "github.com/newrelic/go-agent"
+	_ "github.com/newrelic/go-agent/_integrations/nrmysql"
+)
+
+func mustGetEnv(key string) string {
+	if val := os.Getenv(key); "" != val {
+		return val
+	}
+	panic(fmt.Sprintf("environment variable %s unset", key))
+}
+
+func main() {
+	// Set up a local mysql docker container with:
+	// docker run -it -p 3306:3306 --net "bridge" -e MYSQL_ALLOW_EMPTY_PASSWORD=true mysql
+
+	db, err := sql.Open("nrmysql", "root@/information_schema")
+	if nil != err {
+		panic(err)
+	}
+
+	cfg := newrelic.NewConfig("MySQL App", mustGetEnv("NEW_RELIC_LICENSE_KEY"))
+	cfg.Logger = newrelic.NewDebugLogger(os.Stdout)
+	app, err := newrelic.NewApplication(cfg)
+	if nil != err {
+		panic(err)
+	}
+	if err := app.WaitForConnection(5 * time.Second); nil != err {
+		fmt.Println(err)
+	}
+
+	txn := app.StartTransaction("mysqlQuery", nil, nil)
+	ctx := newrelic.NewContext(context.Background(), txn)
+	row := db.QueryRowContext(ctx, "SELECT count(*) from tables")
+	var count int
+	row.Scan(&count)
+	txn.End()
+
+	app.Shutdown(5 * time.Second)
+
+	fmt.Println("number of tables in information_schema", count)
+}
@@ -0,0 +1,42 @@
+// +build go1.10
+
+package nrmysql
+
+import (
+	"testing"
+
+	newrelic "github.com/newrelic/go-agent"
+)
+
+func TestParseDSN(t *testing.T) {
+	testcases := []struct {
+		dsn   string
+		host  string
+		ppoid string
+		db    string
+	}{
+		{dsn: "user@unix(/path/to/socket)/dbname", host: "localhost", ppoid: "/path/to/socket", db: "dbname"},
+		{dsn: "user:password@tcp(localhost:5555)/dbname?tls=skip-verify&autocommit=true", host: "localhost", ppoid: "5555", db: "dbname"},
+		{dsn: "user:password@/dbname?sql_mode=TRADITIONAL", host: "127.0.0.1", ppoid: "3306", db: "dbname"},
+		{dsn: "user:password@tcp([de:ad:be:ef::ca:fe]:80)/dbname?timeout=90s", host: "de:ad:be:ef::ca:fe", ppoid: "80", db: "dbname"},
+		{dsn: "id:password@tcp(your-amazonaws-uri.com:3306)/dbname", host: "your-amazonaws-uri.com", ppoid: "3306", db: "dbname"},
+		{dsn: "user@cloudsql(project-id:instance-name)/dbname", host: "project-id:instance-name", ppoid: "", db: "dbname"},
+		{dsn: "user@tcp(:3306)/", host: "localhost", ppoid: "3306", db: ""},
+		{dsn: "user:password@tcp(localhost)/dbname", host: "localhost", ppoid: "3306", db: "dbname"},
+		{dsn: "not a valid dsn", host: "", ppoid: "", db: ""},
+	}
+
+	for _, tc := range testcases {
+		s := &newrelic.DatastoreSegment{}
+		parseDSN(s, tc.dsn)
+		if tc.host != s.Host {
+			t.Errorf(`incorrect host, expected="%s", actual="%s", dsn="%s"`, tc.host, s.Host, tc.dsn)
+		}
+		if tc.ppoid != s.PortPathOrID {
+			t.Errorf(`incorrect port path or id, expected="%s", actual="%s", dsn="%s"`, tc.ppoid, s.PortPathOrID, tc.dsn)
+		}
+		if tc.db != s.DatabaseName {
+			t.Errorf(`incorrect database name, expected="%s", actual="%s", dsn="%s"`, tc.db, s.DatabaseName, tc.dsn)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+// +build go1.10
+
+// Package nrpq instruments https://github.com/lib/pq.
+//
+// Use this package to instrument your Postgres calls without having to manually
+// create DatastoreSegments.  This is done in a two step process:
+//
+// 1. Use this package's driver in place of the postgres driver.
+//
+// If your code is using sql.Open like this:
+//
+//	import (
+//		_ "github.com/lib/pq"
+//	)
+//
+//	func main() {
+//		db, err := sql.Open("postgres", "user=pqgotest dbname=pqgotest sslmode=verify-full")
+//	}
+//
+// Then change the side-effect import to this package, and open "nrpostgres" instead:
+//
+//	import (
+//		_ "github.com/newrelic/go-agent/_integrations/nrpq"
+//	)
+//
+//	func main() {
+//		db, err := sql.Open("nrpostgres", "user=pqgotest dbname=pqgotest sslmode=verify-full")
+//	}
+//
+// If your code is using pq.NewConnector, wrap the connector using
+// nrpq.NewConnector:
+//
+//	connector, err := pq.NewConnector(dsn)
+//	db := sql.OpenDB(nrpq.NewConnector(connector, dsn))
+//
+// 2. Provide a context containing a newrelic.Transaction to all exec and query
+// methods on sql.DB, sql.Conn, sql.Tx, and sql.Stmt.  This requires using the
+// context methods ExecContext, QueryContext, and QueryRowContext in place of
+// Exec, Query, and QueryRow respectively.  For example, instead of the
+// following:
+//
+//	row := db.QueryRow("SELECT count(*) FROM pg_catalog.pg_tables")
+//
+// Do this:
+//
+//	ctx := newrelic.NewContext(context.Background(), txn)
+//	row := db.QueryRowContext(ctx, "SELECT count(*) FROM pg_catalog.pg_tables")
+//
+// Example: https://github.com/newrelic/go-agent/tree/master/_integrations/nrpq/example/main.go
+package nrpq
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/lib/pq"
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/newrelic/go-agent/internal"
+	"github.com/newrelic/go-agent/internal/sqlparse"
+)
+
+var (
+	baseBuilder = newrelic.SQLDriverSegmentBuilder{
+		BaseSegment: newrelic.DatastoreSegment{
+			Product: newrelic.DatastorePostgres,
+		},
+		ParseQuery: sqlparse.ParseQuery,
+		ParseDSN:   parseDSN(os.Getenv),
+	}
+)
+
+func init() {
+	sql.Register("nrpostgres", newrelic.InstrumentSQLDriver(&pq.Driver{}, baseBuilder))
+	internal.TrackUsage("integration", "driver", "postgres")
+}
+
+// NewConnector instruments a connector created using pq.NewConnector.  The
+// data source name provided to pq.NewConnector is used to populate the host,
+// port, and database name of the datastore segments.
+func NewConnector(connector driver.Connector, dsn string) driver.Connector {
+	bld := baseBuilder
+	bld.ParseDSN(&bld.BaseSegment, dsn)
+	return newrelic.InstrumentSQLConnector(connector, bld)
+}
+
+func parseDSN(getenv func(string) string) func(*newrelic.DatastoreSegment, string) {
+	return func(s *newrelic.DatastoreSegment, dsn string) {
+		host := getenv("PGHOST")
+		hostaddr := getenv("PGHOSTADDR")
+		ppoid := getenv("PGPORT")
+		dbname := getenv("PGDATABASE")
+
+		set := func(key, value string) {
+			switch key {
+			case "host":
+				host = value
+			case "hostaddr":
+				hostaddr = value
+			case "port":
+				ppoid = value
+			case "dbname":
+				dbname = value
+			}
+		}
+
+		if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+			u, err := url.Parse(dsn)
+			if nil != err {
+				return
+			}
+			if h := u.Hostname(); "" != h {
+				host = h
+			}
+			if p := u.Port(); "" != p {
+				ppoid = p
+			}
+			if db := strings.TrimPrefix(u.Path, "/"); "" != db {
+				dbname = db
+			}
+			for key, values := range u.Query() {
+				set(key, values[0])
+			}
+		} else {
+			for key, value := range parseKeyValues(dsn) {
+				set(key, value)
+			}
+		}
+
+		// Multiple hosts and ports may be provided: the first is used.
+		host = strings.Split(host, ",")[0]
+		ppoid = strings.Split(ppoid, ",")[0]
+
+		if "" != hostaddr {
+			host = hostaddr
+		} else if "" == host {
+			host = "localhost"
+		}
+		if "" == ppoid {
+			ppoid = "5432"
+		}
+		if strings.HasPrefix(host, "/") {
+			// This is a unix socket.
+			ppoid = path.Join(host, ".s.PGSQL."+ppoid)
+			host = "localhost"
+		}
+
+		s.Host = host
+		s.PortPathOrID = ppoid
+		s.DatabaseName = dbname
+	}
+}
+
+// parseKeyValues parses a connection string of the form
+// "host=localhost dbname='my db'".  Values may be single quoted, and
+// backslashes escape the following character.
+func parseKeyValues(dsn string) map[string]string {
+	vals := make(map[string]string)
+	r := []rune(dsn)
+	i := 0
+	skipSpace := func() {
+		for i < len(r) && (' ' == r[i] || '\t' == r[i] || '\n' == r[i]) {
+			i++
+		}
+	}
+	for {
+		skipSpace()
+		if i >= len(r) {
+			return vals
+		}
+		start := i
+		for i < len(r) && '=' != r[i] && ' ' != r[i] {
+			i++
+		}
+		key := string(r[start:i])
+		skipSpace()
+		if i >= len(r) || '=' != r[i] {
+			return vals
+		}
+		i++
+		skipSpace()
+
+		var value []rune
+		if i < len(r) && '\'' == r[i] {
+			i++
+			for i < len(r) && '\'' != r[i] {
+				if '\\' == r[i] && i+1 < len(r) {
+					i++
+				}
+				value = append(value, r[i])
+				i++
+			}
+			i++
+		} else {
+			for i < len(r) && ' ' != r[i] {
+				if '\\' == r[i] && i+1 < len(r) {
+					i++
+				}
+				value = append(value, r[i])
+				i++
+			}
+		}
+		vals[key] = string(value)
+	}
+}
@@ -0,0 +1,53 @@
+// +build go1.10
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	newrelic "github.com/newrelic/go-agent"
+	_ "github.com/newrelic/go-agent/_integrations/nrsqlite3"
+)
+
+func mustGetEnv(key string) string {
+	if val := os.Getenv(key); "" != val {
+		return val
+	}
+	panic(fmt.Sprintf("environment variable %s unset", key))
+}
+
+func main() {
+	db, err := sql.Open("nrsqlite3", ":memory:")
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	db.Exec("CREATE TABLE zaps ( zap_num INTEGER )")
+	db.Exec("INSERT INTO zaps (zap_num) VALUES (22)")
+
+	cfg := newrelic.NewConfig("SQLite App", mustGetEnv("NEW_RELIC_LICENSE_KEY"))
+	cfg.Logger = newrelic.NewDebugLogger(os.Stdout)
+	app, err := newrelic.NewApplication(cfg)
+	if nil != err {
+		panic(err)
+	}
+	if err := app.WaitForConnection(5 * time.Second); nil != err {
+		fmt.Println(err)
+	}
+
+	txn := app.StartTransaction("sqliteQuery", nil, nil)
+	ctx := newrelic.NewContext(context.Background(), txn)
+	row := db.QueryRowContext(ctx, "SELECT count(*) from zaps")
+	var count int
+	row.Scan(&count)
+	txn.End()
+
+	app.Shutdown(5 * time.Second)
+
+	fmt.Println("number of entries in table", count)
+}
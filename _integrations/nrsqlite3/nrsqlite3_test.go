@@ -0,0 +1,43 @@
+// +build go1.10
+
+package nrsqlite3
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	newrelic "github.com/newrelic/go-agent"
+)
+
+func TestParseDSN(t *testing.T) {
+	_, here, _, _ := runtime.Caller(0)
+	currentDir := filepath.Dir(here)
+
+	testcases := []struct {
+		dsn   string
+		ppoid string
+	}{
+		{dsn: ":memory:", ppoid: ":memory:"},
+		{dsn: "test.db", ppoid: filepath.Join(currentDir, "test.db")},
+		{dsn: "file:test.db?cache=shared&mode=memory", ppoid: filepath.Join(currentDir, "test.db")},
+		{dsn: "file::memory:", ppoid: ":memory:"},
+		{dsn: "file::memory:?cache=shared", ppoid: ":memory:"},
+		{dsn: "/home/user/my.db", ppoid: "/home/user/my.db"},
+		{dsn: "", ppoid: ""},
+	}
+
+	for _, tc := range testcases {
+		s := &newrelic.DatastoreSegment{}
+		parseDSN(s, tc.dsn)
+		if "localhost" != s.Host {
+			t.Errorf(`incorrect host, expected="localhost", actual="%s", dsn="%s"`, s.Host, tc.dsn)
+		}
+		if tc.ppoid != s.PortPathOrID {
+			t.Errorf(`incorrect port path or id, expected="%s", actual="%s", dsn="%s"`, tc.ppoid, s.PortPathOrID, tc.dsn)
+		}
+		if "" != s.DatabaseName {
+			t.Errorf(`incorrect database name, expected="", actual="%s", dsn="%s"`, s.DatabaseName, tc.dsn)
+		}
+	}
+}
@@ -2,19 +2,24 @@ package newrelic
 
 import (
 	"net/http"
+	"strings"
 	"time"
 )
 
 // Application represents your application.
 type Application interface {
 	// StartTransaction begins a Transaction.
-	// * The Transaction should only be used in a single goroutine.
+	// * The Transaction should only be used in a single goroutine.  Use
+	//   Transaction.NewGoroutine to use it in additional goroutines.
 	// * This method never returns nil.
 	// * If an http.Request is provided then the Transaction is considered
 	//   a web transaction.
 	// * If an http.ResponseWriter is provided then the Transaction can be
 	//   used in its place.  This allows instrumentation of the response
 	//   code and response headers.
+	// * If no http.Request is provided and the name is a full background
+	//   transaction name, eg. "OtherTransaction/Job/sendEmails", then the
+	//   Transaction is named as it would be by StartBackgroundTransaction.
 	StartTransaction(name string, w http.ResponseWriter, r *http.Request) Transaction
 
 	// RecordCustomEvent adds a custom event to the application.  This
@@ -52,6 +57,69 @@ type Application interface {
 	Shutdown(timeout time.Duration)
 }
 
+// BackgroundTransactionStarter is implemented by the Application returned by
+// NewApplication.  StartBackgroundTransaction and StartMessageTransaction use
+// it to name transactions with a prefix other than "OtherTransaction/Go".
+// Types which wrap an Application should implement it by forwarding to the
+// wrapped Application.  Applications which do not implement it are passed the
+// full transaction name, eg. "OtherTransaction/Job/sendEmails", by
+// StartTransaction.
+type BackgroundTransactionStarter interface {
+	// StartBackgroundTransactionWithPrefix begins a background
+	// Transaction named using the prefix provided, eg.
+	// "OtherTransaction/Job", in place of "OtherTransaction/Go".
+	StartBackgroundTransactionWithPrefix(prefix, name string) Transaction
+}
+
+func startBackgroundTransaction(app Application, prefix, name string) Transaction {
+	if starter, ok := app.(BackgroundTransactionStarter); ok {
+		return starter.StartBackgroundTransactionWithPrefix(prefix, name)
+	}
+	return app.StartTransaction(prefix+"/"+name, nil, nil)
+}
+
+// splitBackgroundName splits a full background transaction name, eg.
+// "OtherTransaction/Job/sendEmails", into its prefix, "OtherTransaction/Job",
+// and name, "sendEmails".
+func splitBackgroundName(fullName string) (prefix, name string, ok bool) {
+	if !strings.HasPrefix(fullName, backgroundPrefix) {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(fullName, backgroundPrefix), "/", 2)
+	if 2 != len(parts) || "" == parts[0] || "" == parts[1] {
+		return "", "", false
+	}
+	return backgroundPrefix + parts[0], parts[1], true
+}
+
+const (
+	backgroundPrefix  = "OtherTransaction/"
+	defaultBgCategory = "Go"
+)
+
+// StartBackgroundTransaction begins a background (non-web) Transaction.  The
+// transaction is named "OtherTransaction/{category}/{name}": the category
+// allows different kinds of background work, such as "Job" or "Task", to be
+// grouped separately.  If category is empty, "Go" is used, as with
+// Application.StartTransaction.
+//
+// Unlike transactions started using Application.StartTransaction, the
+// transaction remains a background transaction even if SetWebRequest is
+// called: the request is only used to accept distributed tracing headers and
+// to record request attributes.  Background transactions do not have an
+// apdex, and their transaction trace threshold may be set using
+// Config.TransactionTracer.BackgroundThreshold.
+//
+//	txn := newrelic.StartBackgroundTransaction(app, "Job", "sendEmails")
+//	defer txn.End()
+func StartBackgroundTransaction(app Application, category, name string) Transaction {
+	category = strings.Trim(category, "/")
+	if "" == category {
+		category = defaultBgCategory
+	}
+	return startBackgroundTransaction(app, backgroundPrefix+category, name)
+}
+
 // NewApplication creates an Application and spawns goroutines to manage the
 // aggregation and harvesting of data.  On success, a non-nil Application and a
 // nil error are returned. On failure, a nil Application and a non-nil error
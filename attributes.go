@@ -6,6 +6,9 @@ package newrelic
 // Transaction.AddAttribute method (see transaction.go).
 //
 // These attribute names are exposed here to facilitate configuration.
+// Headers listed in Config.HeaderAttributes are recorded as attributes named
+// "request.headers." or "response.headers." followed by the lower case header
+// name.
 //
 // For more information, see:
 // https://docs.newrelic.com/docs/agents/manage-apm-agents/agent-metrics/agent-attributes
@@ -43,3 +46,34 @@ const (
 	// string parameters are removed.
 	AttributeRequestReferer = "request.headers.referer"
 )
+
+// Attributes destined for Errors:
+const (
+	// AttributeErrorGroupName is the error group name returned by
+	// Config.ErrorCollector.ErrorGroupCallback.
+	AttributeErrorGroupName = "error.group.name"
+	// AttributeErrorChain contains the messages of the errors wrapped by
+	// a noticed error, separated by newlines.
+	AttributeErrorChain = "error.chain"
+)
+
+// AWS Lambda specific attributes:
+const (
+	// AttributeAWSRequestID is the AWS request id of the Lambda invocation.
+	AttributeAWSRequestID = "aws.requestId"
+	// AttributeAWSLambdaARN is the ARN of the invoked Lambda function.
+	AttributeAWSLambdaARN = "aws.lambda.arn"
+	// AttributeAWSLambdaColdStart is added to the first transaction of
+	// each Lambda execution environment.
+	AttributeAWSLambdaColdStart = "aws.lambda.coldStart"
+	// AttributeAWSLambdaEventSourceARN is the ARN of the resource which
+	// triggered the invocation, eg. the SQS queue or Kinesis stream.
+	AttributeAWSLambdaEventSourceARN = "aws.lambda.eventSource.arn"
+)
+
+// gRPC specific attributes:
+const (
+	// AttributeGRPCStatusCode is the status code of a gRPC call handled by
+	// a transaction, eg. "OK" or "NotFound".
+	AttributeGRPCStatusCode = "grpcStatusCode"
+)
@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/newrelic/go-agent/internal"
 )
 
 // Config contains Application and Transaction behavior settings.
@@ -56,6 +58,11 @@ type Config struct {
 		// custom analytics events.  High security mode overrides this
 		// setting.
 		Enabled bool
+		// MaxSamplesStored is the number of custom events kept each
+		// harvest.  It defaults to 10000 and may be raised as high as
+		// 100000.  New Relic may send a lower limit when the
+		// application connects, which takes precedence.
+		MaxSamplesStored int
 	}
 
 	// TransactionEvents controls the behavior of transaction analytics
@@ -63,6 +70,11 @@ type Config struct {
 	TransactionEvents struct {
 		// Enabled controls whether transaction events are captured.
 		Enabled bool
+		// MaxSamplesStored is the number of transaction events kept
+		// each harvest.  It defaults to 10000, which is also the
+		// largest value allowed.  New Relic may send a lower limit
+		// when the application connects, which takes precedence.
+		MaxSamplesStored int
 		// Attributes controls the attributes included with transaction
 		// events.
 		Attributes AttributeDestinationConfig
@@ -81,6 +93,18 @@ type Config struct {
 		// greater than or equal to 400, with the exception of 404, are
 		// turned into errors.
 		IgnoreStatusCodes []int
+		// ExpectStatusCodes controls which of the http response codes
+		// turned into errors are expected.  Expected errors are
+		// recorded but do not affect error rate metrics or Apdex.
+		ExpectStatusCodes []int
+		// ExpectClasses contains the classes of expected errors.
+		ExpectClasses []string
+		// ExpectMessages contains the messages of expected errors
+		// indexed by error class.
+		ExpectMessages map[string][]string
+		// ErrorGroupCallback, if set, is used to name the group of
+		// each error.  See ErrorGroupCallback.
+		ErrorGroupCallback ErrorGroupCallback `json:"-"`
 		// Attributes controls the attributes included with errors.
 		Attributes AttributeDestinationConfig
 	}
@@ -100,6 +124,12 @@ type Config struct {
 			// threshold, otherwise it is ignored.
 			Duration time.Duration
 		}
+		// BackgroundThreshold, if non-zero, is used in place of
+		// Threshold for background transactions.  Background
+		// transactions do not have an apdex, so a threshold based on
+		// the apdex threshold is often unsuitable for long running
+		// jobs.
+		BackgroundThreshold time.Duration
 		// SegmentThreshold is the threshold at which segments will be
 		// added to the trace.  Lowering this setting may increase
 		// overhead.
@@ -118,6 +148,82 @@ type Config struct {
 	BrowserMonitoring struct {
 		Enabled    bool
 		Attributes AttributeDestinationConfig
+		// AutoInstrument inserts the browser timing header into HTML
+		// responses written using the Transaction's
+		// http.ResponseWriter methods, so that BrowserTimingHeader
+		// does not need to be added to templates.  The header is
+		// inserted after the first meta charset tag in the head, or
+		// after the head tag itself.  Responses which are not
+		// text/html, are compressed, or are flushed before the
+		// insertion point is written are left unchanged.  Note that
+		// the transaction name is frozen when the header is inserted.
+		AutoInstrument bool
+	}
+
+	// HeaderAttributes lists additional request and response headers
+	// recorded as agent attributes, eg. "X-Request-ID".  The attribute
+	// names are "request.headers." or "response.headers." followed by
+	// the lower case header name, eg. "request.headers.x-request-id".
+	// Like other agent attributes, they are controlled by the Include and
+	// Exclude settings, and by default they are sent to transaction
+	// events, transaction traces, errors, and error events.  The
+	// Authorization, Proxy-Authorization, Cookie, and Set-Cookie headers
+	// are only recorded if their attribute is also added to
+	// Attributes.Include, and are never recorded in HighSecurity mode.
+	HeaderAttributes struct {
+		Request  []string
+		Response []string
+	}
+
+	// Redaction masks sensitive values before they are recorded.  The
+	// rules are applied to the string values of custom attributes,
+	// including span and error attributes, to custom event parameters, to
+	// error messages, and to the "request.uri" and
+	// "request.headers.referer" attributes.  Note that "request.uri" never
+	// contains the query string.  Redaction is applied in every mode,
+	// including HighSecurity.
+	Redaction struct {
+		// Rules are applied in order.
+		Rules []RedactionRule
+	}
+
+	// TransactionNaming controls how transaction names are created.
+	TransactionNaming struct {
+		// Rules rename or ignore transactions.  They are applied to
+		// the full transaction name, eg. "WebTransaction/Go/users/123",
+		// after the rules sent by New Relic, and use the same regular
+		// expression semantics:  Expressions are case insensitive and
+		// replacements use "\1" style backreferences.  A transaction
+		// is ignored if an Ignore rule matches its name.
+		Rules []TransactionNamingRule
+		// MaxNamesPerPrefix, if positive, limits the number of
+		// distinct transaction names with the same prefix in each
+		// harvest.  The prefix is the first segment of the name after
+		// "WebTransaction/Go" or "OtherTransaction/Go", eg.
+		// "WebTransaction/Go/users" for "WebTransaction/Go/users/123".
+		// Names with a single segment, eg. "WebTransaction/Go/login",
+		// share the "WebTransaction/Go" prefix.  Once the limit is
+		// reached, transactions with new names are named with the
+		// prefix followed by "/other", a warning is logged, and the
+		// metric "Supportability/Go/TransactionNames/Limited/<prefix>"
+		// is recorded.  This prevents names containing IDs from
+		// creating more metrics than can be sent.  The default of zero
+		// disables the limit.
+		MaxNamesPerPrefix int
+	}
+
+	// HTTPClientTrace records the phases of external requests made using
+	// NewRoundTripper or StartExternalSegment.  When enabled, an
+	// httptrace.ClientTrace is added to the request's context and the
+	// external segment's span event and transaction trace segment include
+	// the time spent on the DNS lookup, connecting, the TLS handshake,
+	// waiting for the first response byte, and after the first byte until
+	// the segment ends, along with whether the connection was reused and
+	// the remote address.  With NewRoundTripper, the response phase lasts
+	// until the response body is read to EOF or closed.  This requires Go
+	// 1.8 or newer and is disabled by default to avoid its overhead.
+	HTTPClientTrace struct {
+		Enabled bool
 	}
 
 	// HostDisplayName gives this server a recognizable name in the New
@@ -128,6 +234,33 @@ type Config struct {
 	// servers.  This may be used to configure a proxy.
 	Transport http.RoundTripper
 
+	// HarvestSink, if non-nil, receives the harvest data in place of the
+	// New Relic servers.  The application does not connect to New Relic,
+	// a License is not required, and a synthetic agent run id is used.
+	// This is useful in environments which cannot reach New Relic, or to
+	// inspect exactly what would be sent.  See NewHarvestWriterSink and
+	// NewHarvestDirectorySink.
+	HarvestSink HarvestSink
+
+	// Spool controls the buffering of harvest data on disk.  When
+	// Directory is set, data which cannot be sent to New Relic because of
+	// a collector outage or during shutdown is written to the directory
+	// and sent after the application next connects, even if the process
+	// restarted.  The spool is not used in ServerlessMode or with a
+	// HarvestSink.
+	Spool struct {
+		// Directory is where payloads are stored.  It is created if
+		// it does not exist.  Each application should use its own
+		// directory.
+		Directory string
+		// MaxBytes limits the total size of the stored payloads.
+		// The oldest payloads are discarded to stay within the limit.
+		MaxBytes int64
+		// MaxAge is the age after which stored payloads are
+		// discarded rather than sent.
+		MaxAge time.Duration
+	}
+
 	// Utilization controls the detection and gathering of system
 	// information.
 	Utilization struct {
@@ -169,12 +302,45 @@ type Config struct {
 	// CrossApplicationTracer cannot be simultaneously enabled.
 	DistributedTracer struct {
 		Enabled bool
+		// ExcludeNewRelicHeader prevents the proprietary Newrelic header
+		// from being added to outbound requests: only the W3C
+		// traceparent and tracestate headers are added.  This is useful
+		// when downstream services are not instrumented by New Relic.
+		ExcludeNewRelicHeader bool
 	}
 
 	// SpanEvents controls behavior relating to Span Events.  Span Events
 	// require that distributed tracing is enabled.
 	SpanEvents struct {
 		Enabled bool
+		// MaxSamplesStored is the number of span events kept each
+		// harvest.  It defaults to 1000 and may be raised as high as
+		// 10000.  New Relic may send a lower limit when the application
+		// connects, which takes precedence.
+		MaxSamplesStored int
+		// Attributes controls the attributes included with span events
+		// and added to segments using AddAttribute.
+		Attributes AttributeDestinationConfig
+	}
+
+	// InfiniteTracing controls the streaming of span events to a trace
+	// observer, which allows New Relic to sample traces after they are
+	// complete.  When a TraceObserver is set, every span event is sent
+	// as its segment ends: every distributed tracing transaction is
+	// sampled, and span events are not sent at harvest time.  The segment
+	// span events of a transaction which is later ignored have already
+	// been sent, but its root span event is not.  Infinite tracing
+	// requires that distributed tracing is enabled.
+	InfiniteTracing struct {
+		// TraceObserver, if non-nil, receives the span events.  See
+		// TraceObserver.
+		TraceObserver TraceObserver
+		SpanEvents    struct {
+			// QueueSize is the number of span events which may be
+			// waiting to be sent.  Span events are dropped when the
+			// queue is full.
+			QueueSize int
+		}
 	}
 
 	// DatastoreTracer controls behavior relating to datastore segments.
@@ -188,6 +354,12 @@ type Config struct {
 		QueryParameters struct {
 			Enabled bool
 		}
+		// RecordSQL controls how the queries of datastore segments are
+		// recorded in slow query traces, transaction traces, and span
+		// events.  See the RecordSQLMode constants.  RecordSQLRaw is
+		// treated as RecordSQLObfuscated when HighSecurity is enabled or
+		// when the record_sql security policy is set.
+		RecordSQL RecordSQLMode
 		// SlowQuery controls the capture of slow query traces.  Slow
 		// query traces show you instances of your slowest datastore
 		// segments.
@@ -207,10 +379,64 @@ type Config struct {
 		// Enabled controls whether runtime statistics are captured.
 		Enabled bool
 	}
+
+	// ThreadProfiler controls the goroutine profiler.  The profiler is
+	// started on demand from the New Relic UI.  While running, it
+	// periodically samples the stack of every goroutine and sends the
+	// aggregated call tree to New Relic.
+	ThreadProfiler struct {
+		// Enabled controls whether the agent asks New Relic for
+		// profiler commands.  The profiler is disabled by default.
+		Enabled bool
+		// CPUProfileDir, if non-empty, is a directory in which a
+		// runtime/pprof CPU profile is written for each profile
+		// session.  The files are named "cpu-<profile id>.pprof".  No
+		// CPU profile is written if another CPU profile is already
+		// running.
+		CPUProfileDir string
+	}
+
+	// ServerlessMode contains fields which control behavior when running in
+	// AWS Lambda.
+	//
+	// https://docs.newrelic.com/docs/serverless-function-monitoring/aws-lambda-monitoring/get-started/introduction-new-relic-monitoring-aws-lambda
+	ServerlessMode struct {
+		// Enabling ServerlessMode will print each transaction's data to
+		// stdout.  No agent goroutines will be spawned in serverless
+		// mode, and no data will be sent directly to the New Relic
+		// backend.  nrlambda.NewConfig sets Enabled to true.
+		Enabled bool
+		// ApdexThreshold sets the Apdex threshold when in
+		// ServerlessMode.  The default is 500 milliseconds.
+		// nrlambda.NewConfig populates this field using the
+		// NEW_RELIC_APDEX_T environment variable.
+		ApdexThreshold time.Duration
+		// AccountID, TrustedAccountKey, and PrimaryAppID are used for
+		// distributed tracing in ServerlessMode.  AccountID and
+		// TrustedAccountKey must be populated for distributed tracing
+		// to be enabled.  nrlambda.NewConfig populates these fields
+		// using the NEW_RELIC_ACCOUNT_ID,
+		// NEW_RELIC_TRUSTED_ACCOUNT_KEY, and
+		// NEW_RELIC_PRIMARY_APPLICATION_ID environment variables.
+		AccountID         string
+		TrustedAccountKey string
+		PrimaryAppID      string
+	}
+
+	// sources records the fields set by ConfigFromEnvironment and
+	// ConfigFromFile.
+	sources map[string]configSource
 }
 
 // AttributeDestinationConfig controls the attributes included with errors and
 // transaction events.
+//
+// Include and Exclude entries match attribute keys exactly, or as a prefix if
+// they end with a '*' wildcard, eg. "request.headers.*".  Entries with a '*'
+// elsewhere, eg. "request.*.token", match the whole key with each '*'
+// matching any characters.  Entries surrounded by '/', eg.
+// "/^request\.headers\.x-.*$/", are regular expressions.  Exclude has
+// priority over Include.
 type AttributeDestinationConfig struct {
 	Enabled bool
 	Include []string
@@ -227,7 +453,9 @@ func NewConfig(appname, license string) Config {
 	c.Enabled = true
 	c.Labels = make(map[string]string)
 	c.CustomInsightsEvents.Enabled = true
+	c.CustomInsightsEvents.MaxSamplesStored = internal.MaxCustomEvents
 	c.TransactionEvents.Enabled = true
+	c.TransactionEvents.MaxSamplesStored = internal.MaxTxnEvents
 	c.TransactionEvents.Attributes.Enabled = true
 	c.HighSecurity = false
 	c.ErrorCollector.Enabled = true
@@ -244,6 +472,8 @@ func NewConfig(appname, license string) Config {
 	c.Utilization.DetectKubernetes = true
 	c.Attributes.Enabled = true
 	c.RuntimeSampler.Enabled = true
+	c.Spool.MaxBytes = internal.SpoolMaxBytes
+	c.Spool.MaxAge = internal.SpoolMaxAge
 
 	c.TransactionTracer.Enabled = true
 	c.TransactionTracer.Threshold.IsApdexFailing = true
@@ -259,19 +489,98 @@ func NewConfig(appname, license string) Config {
 	c.CrossApplicationTracer.Enabled = true
 	c.DistributedTracer.Enabled = false
 	c.SpanEvents.Enabled = true
+	c.SpanEvents.MaxSamplesStored = internal.MaxSpanEvents
+	c.SpanEvents.Attributes.Enabled = true
+	c.InfiniteTracing.SpanEvents.QueueSize = internal.TraceObserverQueueSize
 
 	c.DatastoreTracer.InstanceReporting.Enabled = true
 	c.DatastoreTracer.DatabaseNameReporting.Enabled = true
 	c.DatastoreTracer.QueryParameters.Enabled = true
+	c.DatastoreTracer.RecordSQL = RecordSQLObfuscated
 	c.DatastoreTracer.SlowQuery.Enabled = true
 	c.DatastoreTracer.SlowQuery.Threshold = 10 * time.Millisecond
 
+	c.ServerlessMode.ApdexThreshold = 500 * time.Millisecond
+
 	return c
 }
 
+// TransactionNamingRule is a transaction naming rule set in
+// Config.TransactionNaming.Rules.  Rules are applied in increasing EvalOrder.
+type TransactionNamingRule struct {
+	// MatchExpression is the regular expression matched against the
+	// transaction name.
+	MatchExpression string
+	// Replacement replaces the first match, or each match if ReplaceAll
+	// is set.
+	Replacement string
+	// Ignore causes matching transactions to be ignored.
+	Ignore bool
+	// EachSegment applies the rule to each "/" separated segment of the
+	// name rather than to the whole name.
+	EachSegment bool
+	// ReplaceAll replaces every match rather than only the first.
+	ReplaceAll bool
+	// TerminateChain stops further rules from being applied if this rule
+	// matches.
+	TerminateChain bool
+	// EvalOrder determines the order in which rules are applied.
+	EvalOrder int
+}
+
+// RedactionRule is a value redaction rule set in Config.Redaction.Rules.
+type RedactionRule struct {
+	// Pattern is the regular expression, in Go syntax, matched against
+	// values.  Each match is replaced.  The patterns
+	// RedactionPatternEmail, RedactionPatternCardNumber, and
+	// RedactionPatternToken match common sensitive values.
+	Pattern string
+	// Replacement replaces each match and may refer to submatches, eg.
+	// "${1}".  If empty, "[REDACTED]" is used.
+	Replacement string
+	// Hash replaces each match with "sha256:" followed by the first 16
+	// hex digits of the SHA-256 hash of the match, rather than with
+	// Replacement.  This allows equal values to be correlated without
+	// recording them.
+	Hash bool
+}
+
+// These patterns may be used as RedactionRule.Pattern.
+const (
+	// RedactionPatternEmail matches email addresses.
+	RedactionPatternEmail = `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`
+	// RedactionPatternCardNumber matches payment card numbers of 13 to 19
+	// digits, which may be separated by spaces or dashes.
+	RedactionPatternCardNumber = `\b(?:[0-9][ -]?){12,18}[0-9]\b`
+	// RedactionPatternToken matches bearer tokens and token, secret,
+	// password, and API key assignments, eg. "api_key=abc123".
+	RedactionPatternToken = `(?i)(?:bearer\s+|(?:token|secret|password|api[_-]?key)["']?\s*[:=]\s*["']?)[A-Za-z0-9._~+/-]+=*`
+)
+
+// RecordSQLMode controls how datastore segment queries are recorded.
+type RecordSQLMode string
+
+const (
+	// RecordSQLOff causes no queries to be recorded.
+	RecordSQLOff RecordSQLMode = "off"
+	// RecordSQLObfuscated causes DatastoreSegment.ParameterizedQuery to be
+	// recorded as provided, and DatastoreSegment.RawQuery to be recorded
+	// with its literal values replaced by '?'.
+	RecordSQLObfuscated RecordSQLMode = "obfuscated"
+	// RecordSQLRaw causes DatastoreSegment.RawQuery to be recorded as
+	// provided.  Raw queries may contain sensitive information.
+	RecordSQLRaw RecordSQLMode = "raw"
+)
+
 const (
 	licenseLength = 40
 	appNameLimit  = 3
+
+	// The largest event reservoir sizes which may be configured using
+	// MaxSamplesStored.
+	maxTxnEventsLimit    = 10 * 1000
+	maxCustomEventsLimit = 100 * 1000
+	maxSpanEventsLimit   = 10 * 1000
 )
 
 // The following errors will be returned if your Config fails to validate.
@@ -280,33 +589,56 @@ var (
 	errAppNameMissing                   = errors.New("string AppName required")
 	errAppNameLimit                     = fmt.Errorf("max of %d rollup application names", appNameLimit)
 	errHighSecurityWithSecurityPolicies = errors.New("SecurityPoliciesToken and HighSecurity are incompatible; please ensure HighSecurity is set to false if SecurityPoliciesToken is a non-empty string and a security policy has been set for your account")
+	errRecordSQLMode                    = errors.New("DatastoreTracer.RecordSQL must be one of RecordSQLOff, RecordSQLObfuscated, or RecordSQLRaw")
+	errInfiniteTracingRequiresDT        = errors.New("InfiniteTracing.TraceObserver requires DistributedTracer.Enabled")
 	errMixedTracers                     = errors.New("CrossApplicationTracer and DistributedTracer cannot be enabled simultaneously; please choose CrossApplicationTracer (available since v1.11) or DistributedTracer (available since v2.1)")
 )
 
 // Validate checks the config for improper fields.  If the config is invalid,
-// newrelic.NewApplication returns an error.
+// newrelic.NewApplication returns an error.  If the invalid value was set by
+// ConfigFromEnvironment or ConfigFromFile, the error names the environment
+// variable or the file.
 func (c Config) Validate() error {
-	if c.Enabled {
+	if c.Enabled && nil == c.HarvestSink && !c.ServerlessMode.Enabled {
 		if len(c.License) != licenseLength {
-			return errLicenseLen
+			return c.validationSource(errLicenseLen, "License")
 		}
 	} else {
-		// The License may be empty when the agent is not enabled.
+		// The License may be empty when the agent is not enabled, when
+		// the harvest data is written to a HarvestSink, or in
+		// serverless mode.
 		if len(c.License) != licenseLength && len(c.License) != 0 {
-			return errLicenseLen
+			return c.validationSource(errLicenseLen, "License")
 		}
 	}
-	if "" == c.AppName && c.Enabled {
-		return errAppNameMissing
+	if "" == c.AppName && c.Enabled && !c.ServerlessMode.Enabled {
+		return c.validationSource(errAppNameMissing, "AppName", "Enabled")
 	}
 	if c.HighSecurity && "" != c.SecurityPoliciesToken {
-		return errHighSecurityWithSecurityPolicies
+		return c.validationSource(errHighSecurityWithSecurityPolicies, "HighSecurity", "SecurityPoliciesToken")
 	}
 	if c.CrossApplicationTracer.Enabled && c.DistributedTracer.Enabled {
-		return errMixedTracers
+		return c.validationSource(errMixedTracers, "CrossApplicationTracer.Enabled", "DistributedTracer.Enabled")
+	}
+	if nil != c.InfiniteTracing.TraceObserver && !c.DistributedTracer.Enabled {
+		return c.validationSource(errInfiniteTracingRequiresDT, "DistributedTracer.Enabled")
+	}
+	switch c.DatastoreTracer.RecordSQL {
+	case "", RecordSQLOff, RecordSQLObfuscated, RecordSQLRaw:
+	default:
+		return c.validationSource(errRecordSQLMode, "DatastoreTracer.RecordSQL")
 	}
 	if strings.Count(c.AppName, ";") >= appNameLimit {
-		return errAppNameLimit
+		return c.validationSource(errAppNameLimit, "AppName")
+	}
+	if err := internal.ValidateLocalRules(c.localTxnNameRules()); nil != err {
+		return c.validationSource(fmt.Errorf("TransactionNaming.Rules: %v", err), "TransactionNaming.Rules")
+	}
+	if _, err := internal.NewRedactor(c.redactionRules()); nil != err {
+		return c.validationSource(fmt.Errorf("Redaction.Rules: %v", err), "Redaction.Rules")
+	}
+	if err := c.validateAttributePatterns(); nil != err {
+		return err
 	}
 	return nil
 }
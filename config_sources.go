@@ -0,0 +1,414 @@
+package newrelic
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	envConfigFile = "NEW_RELIC_CONFIG_FILE"
+	envLog        = "NEW_RELIC_LOG"
+	envLogLevel   = "NEW_RELIC_LOG_LEVEL"
+)
+
+// configEnvNames contains the environment variable names which do not follow
+// from the field path.
+var configEnvNames = map[string]string{
+	"License":                 "NEW_RELIC_LICENSE_KEY",
+	"Utilization.TotalRAMMIB": "NEW_RELIC_UTILIZATION_TOTAL_RAM_MIB",
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// configSource records where a setting came from, and the value it was given,
+// so that Validate can report the source if that value is invalid.
+type configSource struct {
+	description string
+	value       interface{}
+}
+
+// configSourceError reports the source of an invalid setting.
+type configSourceError struct {
+	source string
+	err    error
+}
+
+func (e configSourceError) Error() string {
+	return e.source + ": " + e.err.Error()
+}
+
+// NewConfigFromEnvironment creates a Config with the default values, then
+// applies the JSON config file named by the NEW_RELIC_CONFIG_FILE environment
+// variable, if set, using ConfigFromFile, and then the NEW_RELIC_* environment
+// variables using ConfigFromEnvironment.  Environment variables therefore take
+// precedence over the config file, and fields set in code after this call
+// take precedence over both.
+func NewConfigFromEnvironment() (Config, error) {
+	return newConfigFromEnvironment(os.Getenv)
+}
+
+func newConfigFromEnvironment(getenv func(string) string) (Config, error) {
+	cfg := NewConfig("", "")
+	if filename := getenv(envConfigFile); "" != filename {
+		if err := ConfigFromFile(&cfg, filename); nil != err {
+			return cfg, err
+		}
+	}
+	err := configFromEnvironment(&cfg, getenv)
+	return cfg, err
+}
+
+// ConfigFromEnvironment sets fields of the Config from NEW_RELIC_*
+// environment variables.  The name of each variable is the field path in
+// upper case with underscores between words, eg.
+// NEW_RELIC_DATASTORE_TRACER_SLOW_QUERY_THRESHOLD for
+// DatastoreTracer.SlowQuery.Threshold, except for License, which is set using
+// NEW_RELIC_LICENSE_KEY, and Utilization.TotalRAMMIB, which is set using
+// NEW_RELIC_UTILIZATION_TOTAL_RAM_MIB.  Empty variables are ignored.  Values
+// are parsed as follows:
+//
+//	bool                  true, false, 1, 0
+//	time.Duration         10ms, 1.5s
+//	[]string, []int       comma separated, eg. 404,500
+//	map[string]string     semicolon separated pairs, eg. env:prod;team:web
+//	map[string][]string   eg. class1:msg1,msg2;class2:msg3
+//
+// The Logger is set using NEW_RELIC_LOG, which may be "stdout" or "stderr",
+// and NEW_RELIC_LOG_LEVEL, which may be "info" or "debug".  Fields whose
+// values are interfaces or functions, such as Transport, cannot be set.
+func ConfigFromEnvironment(c *Config) error {
+	return configFromEnvironment(c, os.Getenv)
+}
+
+func configFromEnvironment(c *Config, getenv func(string) string) error {
+	sources := c.copySources()
+	defer func() { c.sources = sources }()
+
+	for _, f := range configFields(reflect.ValueOf(c).Elem(), "", nil) {
+		name := configEnvName(f.path)
+		s := getenv(name)
+		if "" == s {
+			continue
+		}
+		source := "environment variable " + name
+		val, err := parseConfigValue(f.value.Type(), s)
+		if nil != err {
+			return configSourceError{source: source, err: err}
+		}
+		f.value.Set(val)
+		sources[f.path] = configSource{description: source, value: val.Interface()}
+	}
+
+	if out := getenv(envLog); "" != out {
+		w := os.Stdout
+		switch out {
+		case "stdout":
+		case "stderr":
+			w = os.Stderr
+		default:
+			return configSourceError{
+				source: "environment variable " + envLog,
+				err:    fmt.Errorf("invalid value %q, must be stdout or stderr", out),
+			}
+		}
+		switch level := getenv(envLogLevel); strings.ToLower(level) {
+		case "", "info":
+			c.Logger = NewLogger(w)
+		case "debug":
+			c.Logger = NewDebugLogger(w)
+		default:
+			return configSourceError{
+				source: "environment variable " + envLogLevel,
+				err:    fmt.Errorf("invalid value %q, must be info or debug", level),
+			}
+		}
+	}
+	return nil
+}
+
+// ConfigFromFile sets fields of the Config from a JSON file.  The keys are
+// the field names, and nested fields are nested objects:
+//
+//	{
+//		"AppName": "My Application",
+//		"DatastoreTracer": {"SlowQuery": {"Threshold": "50ms"}},
+//		"Attributes": {"Exclude": ["request.headers.*"]}
+//	}
+//
+// Values use their JSON types, or are strings in the format used by
+// ConfigFromEnvironment, eg. durations may be nanoseconds or "50ms".  An
+// error is returned for unknown keys and for fields whose values are
+// interfaces or functions.
+func ConfigFromFile(c *Config, filename string) error {
+	source := "config file " + filename
+	data, err := ioutil.ReadFile(filename)
+	if nil != err {
+		return configSourceError{source: source, err: err}
+	}
+	sources := c.copySources()
+	defer func() { c.sources = sources }()
+
+	err = applyConfigJSON(reflect.ValueOf(c).Elem(), "", data, source, sources)
+	if nil != err {
+		return configSourceError{source: source, err: err}
+	}
+	return nil
+}
+
+func (c *Config) copySources() map[string]configSource {
+	sources := make(map[string]configSource, len(c.sources))
+	for path, s := range c.sources {
+		sources[path] = s
+	}
+	return sources
+}
+
+// validationSource returns the error for an invalid setting, including the
+// source of the first of the fields which was set from the environment or a
+// config file and has not been changed since.
+func (c Config) validationSource(err error, paths ...string) error {
+	for _, path := range paths {
+		s, ok := c.sources[path]
+		if !ok {
+			continue
+		}
+		if v, ok := configFieldByPath(reflect.ValueOf(c), path); ok && reflect.DeepEqual(v.Interface(), s.value) {
+			return configSourceError{source: s.description, err: err}
+		}
+	}
+	return err
+}
+
+// configField is a field which may be set from the environment or a config
+// file.
+type configField struct {
+	path  string
+	value reflect.Value
+}
+
+func configFields(v reflect.Value, prefix string, fields []configField) []configField {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if "" != f.PkgPath {
+			continue
+		}
+		path := f.Name
+		if "" != prefix {
+			path = prefix + "." + f.Name
+		}
+		if reflect.Struct == f.Type.Kind() {
+			fields = configFields(v.Field(i), path, fields)
+		} else if configSettable(f.Type) {
+			fields = append(fields, configField{path: path, value: v.Field(i)})
+		}
+	}
+	return fields
+}
+
+func configFieldByPath(v reflect.Value, path string) (reflect.Value, bool) {
+	for _, name := range strings.Split(path, ".") {
+		if reflect.Struct != v.Kind() {
+			return v, false
+		}
+		v = v.FieldByName(name)
+		if !v.IsValid() {
+			return v, false
+		}
+	}
+	return v, true
+}
+
+func configSettable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Int, reflect.Int64:
+		return true
+	case reflect.Slice:
+		return configSettable(t.Elem()) && reflect.Slice != t.Elem().Kind()
+	case reflect.Map:
+		return reflect.String == t.Key().Kind() && configSettable(t.Elem()) && reflect.Map != t.Elem().Kind()
+	}
+	return false
+}
+
+// configFileSettable returns true for types which may be set from a config
+// file but not from an environment variable, eg. TransactionNaming.Rules.
+func configFileSettable(t reflect.Type) bool {
+	return reflect.Slice == t.Kind() && reflect.Struct == t.Elem().Kind()
+}
+
+// configEnvName returns the environment variable name of a field path, eg.
+// "DatastoreTracer.SlowQuery.Threshold" becomes
+// "NEW_RELIC_DATASTORE_TRACER_SLOW_QUERY_THRESHOLD".
+func configEnvName(path string) string {
+	if name, ok := configEnvNames[path]; ok {
+		return name
+	}
+	var buf bytes.Buffer
+	buf.WriteString("NEW_RELIC")
+	for _, name := range strings.Split(path, ".") {
+		buf.WriteByte('_')
+		runes := []rune(name)
+		for i, r := range runes {
+			// Words start with an upper case letter which follows a
+			// lower case letter or digit, or which ends an acronym,
+			// eg. "CPUProfileDir" becomes "CPU_PROFILE_DIR".
+			if i > 0 && unicode.IsUpper(r) {
+				prev := runes[i-1]
+				nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+				if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+					buf.WriteByte('_')
+				}
+			}
+			buf.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return buf.String()
+}
+
+func splitConfigList(s, sep string) []string {
+	var elems []string
+	for _, e := range strings.Split(s, sep) {
+		if e = strings.TrimSpace(e); "" != e {
+			elems = append(elems, e)
+		}
+	}
+	return elems
+}
+
+var errConfigPair = errors.New("invalid key:value pair")
+
+// parseConfigValue parses the string representation of a value of type t.
+func parseConfigValue(t reflect.Type, s string) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	if durationType == t {
+		d, err := time.ParseDuration(strings.TrimSpace(s))
+		if nil != err {
+			return v, err
+		}
+		v.SetInt(int64(d))
+		return v, nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if nil != err {
+			return v, err
+		}
+		v.SetBool(b)
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(strings.TrimSpace(s), 10, t.Bits())
+		if nil != err {
+			return v, err
+		}
+		v.SetInt(i)
+	case reflect.Slice:
+		elems := splitConfigList(s, ",")
+		v = reflect.MakeSlice(t, 0, len(elems))
+		for _, e := range elems {
+			ev, err := parseConfigValue(t.Elem(), e)
+			if nil != err {
+				return v, err
+			}
+			v = reflect.Append(v, ev)
+		}
+	case reflect.Map:
+		v = reflect.MakeMap(t)
+		for _, pair := range splitConfigList(s, ";") {
+			kv := strings.SplitN(pair, ":", 2)
+			if len(kv) != 2 {
+				return v, errConfigPair
+			}
+			ev, err := parseConfigValue(t.Elem(), strings.TrimSpace(kv[1]))
+			if nil != err {
+				return v, err
+			}
+			v.SetMapIndex(reflect.ValueOf(strings.TrimSpace(kv[0])).Convert(t.Key()), ev)
+		}
+	default:
+		return v, fmt.Errorf("unsupported type %s", t)
+	}
+	return v, nil
+}
+
+// decodeConfigJSON decodes a config file value of type t.  Strings are parsed
+// using parseConfigValue unless t is a string type.
+func decodeConfigJSON(t reflect.Type, js json.RawMessage) (reflect.Value, error) {
+	var s string
+	if reflect.String != t.Kind() && nil == json.Unmarshal(js, &s) {
+		return parseConfigValue(t, s)
+	}
+	v := reflect.New(t)
+	if err := json.Unmarshal(js, v.Interface()); nil != err {
+		return v.Elem(), err
+	}
+	return v.Elem(), nil
+}
+
+// applyConfigJSON sets the fields of the struct v from a JSON object.  Keys
+// are matched to field names case insensitively.
+func applyConfigJSON(v reflect.Value, prefix string, data []byte, source string, sources map[string]configSource) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); nil != err {
+		if "" != prefix {
+			return fmt.Errorf("%s: %v", prefix, err)
+		}
+		return err
+	}
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	t := v.Type()
+	for _, key := range keys {
+		idx := -1
+		for i := 0; i < t.NumField(); i++ {
+			if "" == t.Field(i).PkgPath && strings.EqualFold(t.Field(i).Name, key) {
+				idx = i
+				break
+			}
+		}
+		path := key
+		if idx >= 0 {
+			path = t.Field(idx).Name
+		}
+		if "" != prefix {
+			path = prefix + "." + path
+		}
+		if idx < 0 {
+			return fmt.Errorf("unknown setting %s", path)
+		}
+		f := t.Field(idx)
+		fv := v.Field(idx)
+		if reflect.Struct == f.Type.Kind() {
+			if err := applyConfigJSON(fv, path, raw[key], source, sources); nil != err {
+				return err
+			}
+			continue
+		}
+		if !configSettable(f.Type) && !configFileSettable(f.Type) {
+			return fmt.Errorf("%s cannot be set from a config file", path)
+		}
+		val, err := decodeConfigJSON(f.Type, raw[key])
+		if nil != err {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		fv.Set(val)
+		sources[path] = configSource{description: source, value: val.Interface()}
+	}
+	return nil
+}
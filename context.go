@@ -47,3 +47,28 @@ func transactionFromRequestContext(req *http.Request) Transaction {
 	}
 	return txn
 }
+
+// WrapBackgroundFunc wraps a function so that each call is instrumented as a
+// background transaction started using StartBackgroundTransaction.  The
+// transaction is added to the context passed to fn, errors returned by fn are
+// recorded using NoticeError, and panics are recorded before being re-panicked.
+// If app is nil, fn is returned unchanged.
+//
+//	job := newrelic.WrapBackgroundFunc(app, "Job", "sendEmails", sendEmails)
+//	err := job(context.Background())
+//
+func WrapBackgroundFunc(app Application, category, name string, fn func(ctx context.Context) error) func(ctx context.Context) error {
+	if app == nil {
+		return fn
+	}
+	return func(ctx context.Context) error {
+		txn := StartBackgroundTransaction(app, category, name)
+		defer txn.End()
+
+		err := fn(NewContext(ctx, txn))
+		if nil != err {
+			txn.NoticeError(err)
+		}
+		return err
+	}
+}
@@ -1,5 +1,7 @@
 package newrelic
 
+import "github.com/newrelic/go-agent/internal"
+
 // StackTracer can be implemented by errors to provide a stack trace when using
 // Transaction.NoticeError.
 type StackTracer interface {
@@ -18,9 +20,66 @@ type ErrorAttributer interface {
 	ErrorAttributes() map[string]interface{}
 }
 
-// Error is an error that implements ErrorClasser and ErrorAttributer.  It can
-// be used with Transaction.NoticeError to control exactly how errors are
-// recorded.  Example use:
+// ErrorExpecter can be implemented by errors to mark them as expected when
+// using Transaction.NoticeError.  Expected errors are recorded as traced
+// errors and error events with the error.expected attribute, but they do not
+// affect error rate metrics or Apdex.  Errors may also be marked as expected
+// using the Config.ErrorCollector expected error settings.
+type ErrorExpecter interface {
+	ErrorExpected() bool
+}
+
+// ErrorInfo describes an error noticed by a transaction.  It is provided to
+// Config.ErrorCollector.ErrorGroupCallback.
+type ErrorInfo struct {
+	// Error is the error provided to Transaction.NoticeError.  It is nil
+	// for errors created from panics and response codes.
+	Error error
+	// TransactionName is the final name of the transaction, eg.
+	// "WebTransaction/Go/users".
+	TransactionName string
+	// Message is the error message as recorded, which may be redacted by
+	// high security or security policies.
+	Message string
+	// Class is the error class.
+	Class string
+	// Expected indicates whether the error is expected.
+	Expected bool
+}
+
+// ErrorGroupCallback returns the group name of an error.  The name is added
+// to the error's traced error and error event as the error.group.name
+// attribute, which is used to group errors in the errors inbox.  An empty
+// string leaves the error ungrouped.  The callback is called when the
+// transaction ends while the transaction is locked: it must not use the
+// transaction.
+type ErrorGroupCallback func(ErrorInfo) string
+
+// unwrapper is implemented by errors which wrap another error, including those
+// created by fmt.Errorf with the %w verb in Go 1.13 and newer.
+type unwrapper interface {
+	Unwrap() error
+}
+
+// errorChain returns the error followed by the errors it wraps, from the
+// outermost to the innermost.  The chain is limited to
+// internal.ErrorChainLimit errors to guard against cycles.
+func errorChain(err error) []error {
+	var chain []error
+	for nil != err && len(chain) < internal.ErrorChainLimit {
+		chain = append(chain, err)
+		u, ok := err.(unwrapper)
+		if !ok {
+			break
+		}
+		err = u.Unwrap()
+	}
+	return chain
+}
+
+// Error is an error that implements ErrorClasser, ErrorAttributer, and
+// ErrorExpecter.  It can be used with Transaction.NoticeError to control
+// exactly how errors are recorded.  Example use:
 //
 // 	txn.NoticeError(newrelic.Error{
 // 		Message: "error message: something went very wrong",
@@ -40,6 +99,9 @@ type Error struct {
 	// additional context.  These attributes are validated just like those
 	// added to `Transaction.AddAttribute`.
 	Attributes map[string]interface{}
+	// Expected marks the error as expected: it is recorded but does not
+	// affect error rate metrics or Apdex.
+	Expected bool
 }
 
 func (e Error) Error() string { return e.Message }
@@ -49,3 +111,6 @@ func (e Error) ErrorClass() string { return e.Class }
 
 // ErrorAttributes implements the ErrorAttributes interface.
 func (e Error) ErrorAttributes() map[string]interface{} { return e.Attributes }
+
+// ErrorExpected implements the ErrorExpecter interface.
+func (e Error) ErrorExpected() bool { return e.Expected }
@@ -0,0 +1,110 @@
+package newrelic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// HarvestSink receives the harvest data in place of the New Relic servers.
+// Set Config.HarvestSink to use one.  WriteHarvest is called once for each
+// payload of each harvest, and may be called concurrently.
+type HarvestSink interface {
+	WriteHarvest(p HarvestPayload) error
+}
+
+// HarvestPayload is the data that would be sent to a single collector method
+// in a single harvest.
+type HarvestPayload struct {
+	// Cmd is the collector method, eg. "metric_data" or
+	// "analytic_event_data".
+	Cmd string
+	// RunID is the agent run id.  When using a HarvestSink this is a
+	// synthetic id.
+	RunID string
+	// HarvestStart is the time the harvest began.
+	HarvestStart time.Time
+	// Data is the uncompressed JSON payload.
+	Data []byte
+}
+
+// MarshalJSON writes the payload as a single line of JSON.  The data is
+// included as JSON rather than as a string.
+func (p HarvestPayload) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Cmd          string          `json:"cmd"`
+		RunID        string          `json:"run_id"`
+		HarvestStart int64           `json:"harvest_start"`
+		Data         json.RawMessage `json:"data"`
+	}{
+		Cmd:          p.Cmd,
+		RunID:        p.RunID,
+		HarvestStart: p.HarvestStart.Unix(),
+		Data:         json.RawMessage(p.Data),
+	})
+}
+
+func harvestPayloadLine(p HarvestPayload) ([]byte, error) {
+	js, err := json.Marshal(p)
+	if nil != err {
+		return nil, err
+	}
+	return append(js, '\n'), nil
+}
+
+type writerSink struct {
+	sync.Mutex
+	w io.Writer
+}
+
+// NewHarvestWriterSink creates a HarvestSink which writes each payload to w as
+// a line of JSON:
+//
+//	{"cmd":"metric_data","run_id":"offline","harvest_start":1561000000,"data":[...]}
+//
+// Writes are serialized, so w need not be safe for concurrent use.
+func NewHarvestWriterSink(w io.Writer) HarvestSink {
+	return &writerSink{w: w}
+}
+
+func (s *writerSink) WriteHarvest(p HarvestPayload) error {
+	line, err := harvestPayloadLine(p)
+	if nil != err {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	_, err = s.w.Write(line)
+	return err
+}
+
+type directorySink struct {
+	dir string
+}
+
+// NewHarvestDirectorySink creates a HarvestSink which writes each payload to a
+// separate file in dir, which is created if it does not exist.  Files are named
+// using the harvest start time and the collector method, eg.
+// "1561000000123456789_metric_data.json", and contain a single line of JSON in
+// the format used by NewHarvestWriterSink.
+func NewHarvestDirectorySink(dir string) HarvestSink {
+	return &directorySink{dir: dir}
+}
+
+func (s *directorySink) WriteHarvest(p HarvestPayload) error {
+	line, err := harvestPayloadLine(p)
+	if nil != err {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0755); nil != err {
+		return err
+	}
+	name := fmt.Sprintf("%d_%s.json", p.HarvestStart.UnixNano(), p.Cmd)
+	return ioutil.WriteFile(filepath.Join(s.dir, name), line, 0644)
+}
@@ -0,0 +1,177 @@
+// +build go1.8
+
+package newrelic
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/newrelic/go-agent/internal"
+)
+
+// httpClientTrace records the phases of an external request using the
+// httptrace.ClientTrace hooks.  The hooks may be called from other
+// goroutines, eg. during dialing, so the fields are protected by a mutex.
+type httpClientTrace struct {
+	sync.Mutex
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	reused       bool
+	remoteAddr   string
+	// recorded is the timing recorded when the segment ended.  Its
+	// response phase is extended by wrapResponseBody.
+	recorded *internal.ExternalTiming
+}
+
+func (ct *httpClientTrace) set(field *time.Time) func() {
+	return func() {
+		ct.Lock()
+		defer ct.Unlock()
+		*field = time.Now()
+	}
+}
+
+func (ct *httpClientTrace) clientTrace() *httptrace.ClientTrace {
+	dnsStart := ct.set(&ct.dnsStart)
+	dnsDone := ct.set(&ct.dnsDone)
+	connectDone := ct.set(&ct.connectDone)
+	tlsStart := ct.set(&ct.tlsStart)
+	tlsDone := ct.set(&ct.tlsDone)
+	firstByte := ct.set(&ct.firstByte)
+	wroteRequest := ct.set(&ct.wroteRequest)
+
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart() },
+		DNSDone:  func(httptrace.DNSDoneInfo) { dnsDone() },
+		ConnectStart: func(network, addr string) {
+			// When multiple addresses are dialed the connect
+			// phase begins with the first attempt.
+			ct.Lock()
+			defer ct.Unlock()
+			if ct.connectStart.IsZero() {
+				ct.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if nil == err {
+				connectDone()
+			}
+		},
+		TLSHandshakeStart: tlsStart,
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { tlsDone() },
+		GotConn: func(info httptrace.GotConnInfo) {
+			ct.Lock()
+			defer ct.Unlock()
+			ct.reused = info.Reused
+			if nil != info.Conn {
+				ct.remoteAddr = info.Conn.RemoteAddr().String()
+			}
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { wroteRequest() },
+		GotFirstResponseByte: firstByte,
+	}
+}
+
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+// timing returns the phases of the request.  The response phase lasts from
+// the first response byte until now.
+func (ct *httpClientTrace) timing(now time.Time) *internal.ExternalTiming {
+	if nil == ct {
+		return nil
+	}
+	ct.Lock()
+	defer ct.Unlock()
+
+	ct.recorded = &internal.ExternalTiming{
+		DNS:              between(ct.dnsStart, ct.dnsDone),
+		Connect:          between(ct.connectStart, ct.connectDone),
+		TLS:              between(ct.tlsStart, ct.tlsDone),
+		Wait:             between(ct.wroteRequest, ct.firstByte),
+		Response:         between(ct.firstByte, now),
+		ConnectionReused: ct.reused,
+		RemoteAddress:    ct.remoteAddr,
+	}
+	return ct.recorded
+}
+
+// responseBodyTimer calls end once, when the body is read to EOF or closed.
+type responseBodyTimer struct {
+	io.ReadCloser
+	once sync.Once
+	end  func()
+}
+
+func (b *responseBodyTimer) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if io.EOF == err {
+		b.once.Do(b.end)
+	}
+	return n, err
+}
+
+func (b *responseBodyTimer) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.end)
+	return err
+}
+
+// wrapResponseBody extends the response phase of the timing recorded when the
+// segment ended until the body is read to EOF or closed.  The segment itself
+// is not extended, since segments started while the body is read would
+// otherwise be ended with it.  The timing is only updated until the
+// transaction ends.  Bodies which may be written to, ie. those of 101
+// Switching Protocols responses, are not wrapped.
+func (ct *httpClientTrace) wrapResponseBody(thd *thread, body io.ReadCloser) io.ReadCloser {
+	if nil == ct || nil == thd || nil == body {
+		return body
+	}
+	if _, ok := body.(io.Writer); ok {
+		return body
+	}
+	ct.Lock()
+	timing := ct.recorded
+	ct.Unlock()
+	if nil == timing {
+		return body
+	}
+	return &responseBodyTimer{ReadCloser: body, end: func() {
+		now := time.Now()
+		txn := thd.txn
+		txn.Lock()
+		defer txn.Unlock()
+
+		if txn.finished {
+			return
+		}
+		ct.Lock()
+		defer ct.Unlock()
+		timing.Response = between(ct.firstByte, now)
+	}}
+}
+
+// addHTTPClientTrace adds an httptrace.ClientTrace to the request's context.
+// The request is modified in place, like the distributed tracing headers
+// added by StartExternalSegment, so that callers do not need to use a new
+// request.  Hooks already present in the context are still called.
+func addHTTPClientTrace(request *http.Request) *httpClientTrace {
+	ct := &httpClientTrace{}
+	ctx := httptrace.WithClientTrace(request.Context(), ct.clientTrace())
+	*request = *request.WithContext(ctx)
+	return ct
+}
@@ -0,0 +1,25 @@
+// +build !go1.8
+
+package newrelic
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/newrelic/go-agent/internal"
+)
+
+type httpClientTrace struct{}
+
+func (ct *httpClientTrace) timing(now time.Time) *internal.ExternalTiming {
+	return nil
+}
+
+func addHTTPClientTrace(request *http.Request) *httpClientTrace {
+	return nil
+}
+
+func (ct *httpClientTrace) wrapResponseBody(thd *thread, body io.ReadCloser) io.ReadCloser {
+	return body
+}
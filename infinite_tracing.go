@@ -0,0 +1,15 @@
+package newrelic
+
+import "github.com/newrelic/go-agent/internal"
+
+// TraceObserver streams span events to a New Relic trace observer.  Set
+// Config.InfiniteTracing.TraceObserver to use one.  TraceObservers are
+// created by the nrinfinitetracing integration, which contains the gRPC
+// dependency:
+//
+//	cfg.InfiniteTracing.TraceObserver = nrinfinitetracing.NewTraceObserver(nrinfinitetracing.Config{
+//		Host: "YOUR_TRACE_OBSERVER_HOST",
+//	})
+type TraceObserver interface {
+	internal.TraceObserverDialer
+}
@@ -64,8 +64,15 @@ func WrapHandleFunc(app Application, pattern string, handler func(http.ResponseW
 //   request = newrelic.RequestWithTransactionContext(request, txn)
 //   resp, err := client.Do(request)
 //
+// When Config.HTTPClientTrace is enabled, the phases of each request are
+// recorded.  The segment ends once the response headers are read, but the
+// response phase lasts until the response body is read to EOF or closed.
+//
 func NewRoundTripper(txn Transaction, original http.RoundTripper) http.RoundTripper {
 	return roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		// RoundTrip must not modify the request, so the headers and
+		// client trace are added to a copy.
+		request = cloneRequest(request)
 		segment := StartExternalSegment(txn, request)
 
 		if nil == original {
@@ -76,10 +83,27 @@ func NewRoundTripper(txn Transaction, original http.RoundTripper) http.RoundTrip
 		segment.Response = response
 		segment.End()
 
+		if nil != response {
+			response.Body = segment.clientTrace.wrapResponseBody(segment.StartTime.thread, response.Body)
+		}
+
 		return response, err
 	})
 }
 
+// cloneRequest returns a shallow copy of the request with its own Header.
+func cloneRequest(r *http.Request) *http.Request {
+	c := new(http.Request)
+	*c = *r
+	if nil != r.Header {
+		c.Header = make(http.Header, len(r.Header))
+		for key, values := range r.Header {
+			c.Header[key] = append([]string(nil), values...)
+		}
+	}
+	return c
+}
+
 type roundTripperFunc func(*http.Request) (*http.Response, error)
 
 func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
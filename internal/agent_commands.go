@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// AgentCommand is a command sent by the collector in the reply to
+// get_agent_commands.  The collector sends each command as an array
+// containing the command id and the command details:
+//
+//	[123,{"name":"start_profiler","arguments":{"profile_id":-1}}]
+type AgentCommand struct {
+	ID        int64
+	Name      string
+	Arguments json.RawMessage
+}
+
+// UnmarshalJSON unmarshals the array sent by the collector.
+func (cmd *AgentCommand) UnmarshalJSON(data []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); nil != err {
+		return err
+	}
+	if len(fields) != 2 {
+		return fmt.Errorf("agent command has %d fields", len(fields))
+	}
+	if err := json.Unmarshal(fields[0], &cmd.ID); nil != err {
+		return err
+	}
+	var details struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(fields[1], &details); nil != err {
+		return err
+	}
+	cmd.Name = details.Name
+	cmd.Arguments = details.Arguments
+	return nil
+}
+
+// GetAgentCommands asks the collector for the agent commands which should be
+// executed.  The cmd provided should contain the collector and the run id.
+func GetAgentCommands(cmd RpmCmd, cs RpmControls) ([]AgentCommand, RPMResponse) {
+	data, err := json.Marshal([]string{cmd.RunID})
+	if nil != err {
+		return nil, RPMResponse{Err: err}
+	}
+	cmd.Name = cmdAgentCommands
+	cmd.Data = data
+
+	resp := CollectorRequest(cmd, cs)
+	if nil != resp.Err {
+		return nil, resp
+	}
+
+	var reply struct {
+		Commands []AgentCommand `json:"return_value"`
+	}
+	if err := json.Unmarshal(resp.body, &reply); nil != err {
+		return nil, RPMResponse{Err: fmt.Errorf("unable to parse agent commands reply: %v", err)}
+	}
+	return reply.Commands, resp
+}
+
+// AgentCommandResults contains the result of each agent command by command id.
+// A nil error indicates that the command was successful.
+type AgentCommandResults map[int64]error
+
+var (
+	errUnknownAgentCommand = errors.New("unknown agent command")
+	errProfilerDisabled    = errors.New("profiler disabled")
+)
+
+// ExecuteAgentCommands executes the agent commands.  The profiler may be nil
+// if it is disabled.
+func ExecuteAgentCommands(cmds []AgentCommand, p *Profiler) AgentCommandResults {
+	results := make(AgentCommandResults, len(cmds))
+	for _, cmd := range cmds {
+		var err error
+		switch cmd.Name {
+		case "start_profiler":
+			err = p.StartProfiler(cmd.Arguments, time.Now())
+		case "stop_profiler":
+			err = p.StopProfiler(cmd.Arguments)
+		default:
+			err = errUnknownAgentCommand
+		}
+		results[cmd.ID] = err
+	}
+	return results
+}
+
+// Data prepares the agent_command_results JSON.
+func (results AgentCommandResults) Data(agentRunID string, harvestStart time.Time) ([]byte, error) {
+	if 0 == len(results) {
+		return nil, nil
+	}
+	out := make(map[string]interface{}, len(results))
+	for id, err := range results {
+		if nil != err {
+			out[strconv.FormatInt(id, 10)] = map[string]string{"error": err.Error()}
+		} else {
+			out[strconv.FormatInt(id, 10)] = struct{}{}
+		}
+	}
+	return json.Marshal([]interface{}{agentRunID, out})
+}
+
+// EndpointMethod is used for the collector request.
+func (results AgentCommandResults) EndpointMethod() string {
+	return cmdAgentCommandResults
+}
@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/internal/logger"
+)
+
+type agentCommandsMock struct {
+	response endpointResult
+	body     string
+}
+
+func (m *agentCommandsMock) RoundTrip(r *http.Request) (*http.Response, error) {
+	if cmd := r.URL.Query().Get("method"); cmd != cmdAgentCommands {
+		return nil, errors.New("unexpected method: " + cmd)
+	}
+	compressed, _ := ioutil.ReadAll(r.Body)
+	m.body = string(compressed)
+	return m.response.response, m.response.err
+}
+
+func (m *agentCommandsMock) CancelRequest(req *http.Request) {}
+
+func testAgentCommandsHelper(m *agentCommandsMock) ([]AgentCommand, RPMResponse) {
+	cs := RpmControls{
+		License:      "12345",
+		Client:       &http.Client{Transport: m},
+		Logger:       logger.ShimLogger{IsDebugEnabled: true},
+		AgentVersion: "1",
+	}
+	return GetAgentCommands(RpmCmd{Collector: "collector.com", RunID: "run-id"}, cs)
+}
+
+func TestGetAgentCommands(t *testing.T) {
+	m := &agentCommandsMock{response: endpointResult{response: makeResponse(200, `{"return_value":[
+		[123,{"name":"start_profiler","arguments":{"profile_id":-1,"sample_period":0.1,"duration":120}}],
+		[456,{"name":"stop_profiler","arguments":{"profile_id":-1,"report_data":true}}]
+	]}`)}}
+	cmds, resp := testAgentCommandsHelper(m)
+	if nil != resp.Err {
+		t.Fatal(resp.Err)
+	}
+	if len(cmds) != 2 {
+		t.Fatal(cmds)
+	}
+	if cmds[0].ID != 123 || cmds[0].Name != "start_profiler" ||
+		string(cmds[0].Arguments) != `{"profile_id":-1,"sample_period":0.1,"duration":120}` {
+		t.Error(cmds[0])
+	}
+	if cmds[1].ID != 456 || cmds[1].Name != "stop_profiler" {
+		t.Error(cmds[1])
+	}
+	if "" == m.body {
+		t.Error("no request body")
+	}
+}
+
+func TestGetAgentCommandsEmpty(t *testing.T) {
+	cmds, resp := testAgentCommandsHelper(&agentCommandsMock{
+		response: endpointResult{response: makeResponse(200, `{"return_value":[]}`)},
+	})
+	if nil != resp.Err || len(cmds) != 0 {
+		t.Error(cmds, resp.Err)
+	}
+}
+
+func TestGetAgentCommandsMalformed(t *testing.T) {
+	cmds, resp := testAgentCommandsHelper(&agentCommandsMock{
+		response: endpointResult{response: makeResponse(200, `{"return_value":[[123]]}`)},
+	})
+	if nil == resp.Err || nil != cmds {
+		t.Error(cmds, resp.Err)
+	}
+}
+
+func TestGetAgentCommandsRestart(t *testing.T) {
+	_, resp := testAgentCommandsHelper(&agentCommandsMock{
+		response: endpointResult{response: makeResponse(401, `{}`)},
+	})
+	if !resp.IsRestartException() {
+		t.Error(resp)
+	}
+}
+
+func TestExecuteAgentCommands(t *testing.T) {
+	results := ExecuteAgentCommands([]AgentCommand{
+		{ID: 1, Name: "start_profiler", Arguments: []byte(`{"profile_id":1,"duration":10}`)},
+		{ID: 2, Name: "unknown_command"},
+	}, nil)
+	if len(results) != 2 || results[1] != errProfilerDisabled || results[2] != errUnknownAgentCommand {
+		t.Error(results)
+	}
+}
+
+func TestAgentCommandResultsData(t *testing.T) {
+	results := AgentCommandResults{
+		1: nil,
+		2: errors.New("oops"),
+	}
+	js, err := results.Data("run-id", time.Now())
+	if nil != err {
+		t.Fatal(err)
+	}
+	if string(js) != `["run-id",{"1":{},"2":{"error":"oops"}}]` {
+		t.Error(string(js))
+	}
+	if results.EndpointMethod() != "agent_command_results" {
+		t.Error(results.EndpointMethod())
+	}
+	js, err = AgentCommandResults{}.Data("run-id", time.Now())
+	if nil != js || nil != err {
+		t.Error(string(js), err)
+	}
+}
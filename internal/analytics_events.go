@@ -53,6 +53,11 @@ func (events *analyticsEvents) addEvent(e analyticsEvent) {
 		return
 	}
 
+	if 0 == cap(events.events) {
+		// The reservoir size may be configured to zero.
+		return
+	}
+
 	if e.priority.isLowerPriority((events.events)[0].priority) {
 		return
 	}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -30,6 +31,13 @@ const (
 	attributeResponseHeadersContentType
 	attributeResponseHeadersContentLength
 	attributeResponseCode
+	AttributeAWSRequestID
+	AttributeAWSLambdaARN
+	AttributeAWSLambdaColdStart
+	AttributeAWSLambdaEventSourceARN
+	AttributeGRPCStatusCode
+	attributeErrorGroupName
+	attributeErrorChain
 )
 
 var (
@@ -51,11 +59,63 @@ var (
 		attributeResponseHeadersContentType:   {name: "response.headers.contentType", defaultDests: usualDests},
 		attributeResponseHeadersContentLength: {name: "response.headers.contentLength", defaultDests: usualDests},
 		attributeResponseCode:                 {name: "httpResponseCode", defaultDests: usualDests},
+		AttributeAWSRequestID:                 {name: "aws.requestId", defaultDests: usualDests},
+		AttributeAWSLambdaARN:                 {name: "aws.lambda.arn", defaultDests: usualDests},
+		AttributeAWSLambdaColdStart:           {name: "aws.lambda.coldStart", defaultDests: usualDests},
+		AttributeAWSLambdaEventSourceARN:      {name: "aws.lambda.eventSource.arn", defaultDests: usualDests},
+		AttributeGRPCStatusCode:               {name: "grpcStatusCode", defaultDests: usualDests},
+		attributeErrorGroupName:               {name: "error.group.name", defaultDests: destError},
+		attributeErrorChain:                   {name: "error.chain", defaultDests: destError},
 	}
 )
 
 func (id AgentAttributeID) name() string { return agentAttributeInfo[id].name }
 
+const (
+	requestHeaderAttributePrefix  = "request.headers."
+	responseHeaderAttributePrefix = "response.headers."
+)
+
+var (
+	// fixedRequestHeaders and fixedResponseHeaders are recorded by their
+	// own agent attributes, and so are not recorded again if configured
+	// as header attributes.
+	fixedRequestHeaders = map[string]struct{}{
+		"Accept":         {},
+		"Content-Type":   {},
+		"Content-Length": {},
+		"Host":           {},
+		"User-Agent":     {},
+		"Referer":        {},
+	}
+	fixedResponseHeaders = map[string]struct{}{
+		"Content-Type":   {},
+		"Content-Length": {},
+	}
+	// sensitiveHeaders are only recorded if their attribute is explicitly
+	// included.
+	sensitiveHeaders = map[string]struct{}{
+		"Authorization":       {},
+		"Proxy-Authorization": {},
+		"Cookie":              {},
+		"Set-Cookie":          {},
+	}
+)
+
+// IsSensitiveHeader returns true for headers such as Authorization and Cookie
+// which contain credentials.
+func IsSensitiveHeader(name string) bool {
+	_, ok := sensitiveHeaders[http.CanonicalHeaderKey(name)]
+	return ok
+}
+
+// headerAttribute is a request or response header recorded as an agent
+// attribute.
+type headerAttribute struct {
+	header string // canonical header name
+	key    string // attribute name
+}
+
 // https://source.datanerd.us/agents/agent-specs/blob/master/Agent-Attributes-PORTED.md
 
 // AttributeDestinationConfig matches newrelic.AttributeDestinationConfig to
@@ -73,16 +133,23 @@ const (
 	destError
 	destTxnTrace
 	destBrowser
+	destSpan
 )
 
 const (
 	destNone destinationSet = 0
 	// DestAll contains all destinations.
-	DestAll destinationSet = destTxnEvent | destTxnTrace | destError | destBrowser
+	DestAll destinationSet = destTxnEvent | destTxnTrace | destError | destBrowser | destSpan
+	// destSegment contains the destinations of the attributes added to
+	// segments and spans: span events and transaction trace nodes.
+	destSegment destinationSet = destSpan | destTxnTrace
 )
 
 const (
 	attributeWildcardSuffix = '*'
+	// attributeRegexDelimiter surrounds include and exclude entries which
+	// are regular expressions, eg. "/^request\.headers\..*token$/".
+	attributeRegexDelimiter = "/"
 )
 
 type attributeModifier struct {
@@ -90,6 +157,13 @@ type attributeModifier struct {
 	includeExclude
 }
 
+// attributePatternModifier is an include or exclude entry which is a regular
+// expression or which contains a '*' wildcard before its end.
+type attributePatternModifier struct {
+	re *regexp.Regexp
+	includeExclude
+}
+
 type byMatch []*attributeModifier
 
 func (m byMatch) Len() int           { return len(m) }
@@ -104,7 +178,16 @@ type AttributeConfig struct {
 	// lexicographical order.  Modifiers appearing later have precedence
 	// over modifiers appearing earlier.
 	wildcardModifiers []*attributeModifier
-	agentDests        map[AgentAttributeID]destinationSet
+	// patternModifiers are applied after the wildcard modifiers and
+	// before the exact match modifiers.
+	patternModifiers []*attributePatternModifier
+	agentDests       map[AgentAttributeID]destinationSet
+	redactor         *Redactor
+	// requestHeaders and responseHeaders are the configured header
+	// attributes, and headerDests contains their destinations.
+	requestHeaders  []headerAttribute
+	responseHeaders []headerAttribute
+	headerDests     map[string]destinationSet
 }
 
 type includeExclude struct {
@@ -129,6 +212,18 @@ func applyAttributeConfig(c *AttributeConfig, key string, d destinationSet) dest
 		}
 	}
 
+	// Exclude has priority over include regardless of the order of the
+	// matching patterns.
+	var patterns includeExclude
+	for _, m := range c.patternModifiers {
+		if m.re.MatchString(key) {
+			patterns.include |= m.include
+			patterns.exclude |= m.exclude
+		}
+	}
+	d |= patterns.include
+	d &^= patterns.exclude
+
 	if m, ok := c.exactMatchModifiers[key]; ok {
 		d = modifierApply(m, d)
 	}
@@ -138,10 +233,44 @@ func applyAttributeConfig(c *AttributeConfig, key string, d destinationSet) dest
 	return d
 }
 
+// attributePattern returns the regular expression of an include or exclude
+// entry, or nil if the entry is an exact match or has only a trailing '*'
+// wildcard.
+func attributePattern(match string) (*regexp.Regexp, error) {
+	if len(match) > 2 && strings.HasPrefix(match, attributeRegexDelimiter) && strings.HasSuffix(match, attributeRegexDelimiter) {
+		return regexp.Compile(match[1 : len(match)-1])
+	}
+	if idx := strings.IndexByte(match, attributeWildcardSuffix); idx >= 0 && idx < len(match)-1 {
+		parts := strings.Split(match, string(attributeWildcardSuffix))
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		return regexp.Compile("^" + strings.Join(parts, ".*") + "$")
+	}
+	return nil, nil
+}
+
+// ValidateAttributePattern returns an error if an include or exclude entry is
+// an invalid regular expression.
+func ValidateAttributePattern(match string) error {
+	_, err := attributePattern(match)
+	return err
+}
+
 func addModifier(c *AttributeConfig, match string, d includeExclude) {
 	if "" == match {
 		return
 	}
+	if re, err := attributePattern(match); nil != err {
+		// Invalid patterns are rejected by config validation.
+		return
+	} else if nil != re {
+		c.patternModifiers = append(c.patternModifiers, &attributePatternModifier{
+			re:             re,
+			includeExclude: d,
+		})
+		return
+	}
 	exactMatch := true
 	if attributeWildcardSuffix == match[len(match)-1] {
 		exactMatch = false
@@ -196,6 +325,14 @@ type AttributeConfigInput struct {
 	TransactionEvents AttributeDestinationConfig
 	BrowserMonitoring AttributeDestinationConfig
 	TransactionTracer AttributeDestinationConfig
+	SpanEvents        AttributeDestinationConfig
+	// Redactor, if non-nil, redacts user attributes and agent attributes
+	// containing URLs or header values.
+	Redactor *Redactor
+	// RequestHeaders and ResponseHeaders are the names of additional
+	// headers recorded as agent attributes.
+	RequestHeaders  []string
+	ResponseHeaders []string
 }
 
 var (
@@ -205,6 +342,7 @@ var (
 		TransactionEvents: AttributeDestinationConfig{Enabled: true},
 		TransactionTracer: AttributeDestinationConfig{Enabled: true},
 		BrowserMonitoring: AttributeDestinationConfig{Enabled: true},
+		SpanEvents:        AttributeDestinationConfig{Enabled: true},
 	}
 )
 
@@ -213,6 +351,7 @@ func CreateAttributeConfig(input AttributeConfigInput, includeEnabled bool) *Att
 	c := &AttributeConfig{
 		exactMatchModifiers: make(map[string]*attributeModifier),
 		wildcardModifiers:   make([]*attributeModifier, 0, 64),
+		redactor:            input.Redactor,
 	}
 
 	processDest(c, includeEnabled, &input.Attributes, DestAll)
@@ -220,6 +359,7 @@ func CreateAttributeConfig(input AttributeConfigInput, includeEnabled bool) *Att
 	processDest(c, includeEnabled, &input.TransactionEvents, destTxnEvent)
 	processDest(c, includeEnabled, &input.TransactionTracer, destTxnTrace)
 	processDest(c, includeEnabled, &input.BrowserMonitoring, destBrowser)
+	processDest(c, includeEnabled, &input.SpanEvents, destSpan)
 
 	sort.Sort(byMatch(c.wildcardModifiers))
 
@@ -228,9 +368,49 @@ func CreateAttributeConfig(input AttributeConfigInput, includeEnabled bool) *Att
 		c.agentDests[id] = applyAttributeConfig(c, info.name, info.defaultDests)
 	}
 
+	c.headerDests = make(map[string]destinationSet)
+	c.requestHeaders = c.headerAttributes(input.RequestHeaders, requestHeaderAttributePrefix, fixedRequestHeaders)
+	c.responseHeaders = c.headerAttributes(input.ResponseHeaders, responseHeaderAttributePrefix, fixedResponseHeaders)
+
 	return c
 }
 
+// headerAttributes creates the header attributes for the header names and
+// calculates their destinations.  Headers recorded by fixed agent attributes
+// and duplicates are skipped.
+func (c *AttributeConfig) headerAttributes(names []string, prefix string, fixed map[string]struct{}) []headerAttribute {
+	var attrs []headerAttribute
+	for _, name := range names {
+		header := http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if "" == header {
+			continue
+		}
+		if _, ok := fixed[header]; ok {
+			continue
+		}
+		key := prefix + strings.ToLower(header)
+		if _, ok := c.headerDests[key]; ok {
+			continue
+		}
+		dests := usualDests
+		if IsSensitiveHeader(header) {
+			dests = destNone
+		}
+		c.headerDests[key] = applyAttributeConfig(c, key, dests)
+		attrs = append(attrs, headerAttribute{header: header, key: key})
+	}
+	return attrs
+}
+
+// Redactor returns the Redactor used for the attributes.  nil is returned if
+// c is nil or there are no redaction rules.
+func (c *AttributeConfig) Redactor() *Redactor {
+	if nil == c {
+		return nil
+	}
+	return c.redactor
+}
+
 type userAttribute struct {
 	value interface{}
 	dests destinationSet
@@ -271,6 +451,8 @@ type Attributes struct {
 	config *AttributeConfig
 	user   map[string]userAttribute
 	Agent  agentAttributes
+	// headers contains the values of the configured header attributes.
+	headers map[string]string
 }
 
 // NewAttributes creates a new Attributes.
@@ -340,7 +522,7 @@ func ValidateUserAttribute(key string, val interface{}) (interface{}, error) {
 
 // AddUserAttribute adds a user attribute.
 func AddUserAttribute(a *Attributes, key string, val interface{}, d destinationSet) error {
-	val, err := ValidateUserAttribute(key, val)
+	val, err := ValidateUserAttribute(key, a.config.Redactor().RedactValue(val))
 	if nil != err {
 		return err
 	}
@@ -364,6 +546,44 @@ func AddUserAttribute(a *Attributes, key string, val interface{}, d destinationS
 	return nil
 }
 
+// spanAttributes are the user attributes of a segment or span.  Attribute
+// configuration is applied as they are added.
+type spanAttributes map[string]userAttribute
+
+// addSpanAttribute adds a user attribute to a segment or span.  The attributes
+// are created if attrs is nil.
+func addSpanAttribute(config *AttributeConfig, attrs *spanAttributes, key string, val interface{}) error {
+	val, err := ValidateUserAttribute(key, config.Redactor().RedactValue(val))
+	if nil != err {
+		return err
+	}
+	dests := applyAttributeConfig(config, key, destSegment)
+	if destNone == dests {
+		return nil
+	}
+	if nil == *attrs {
+		*attrs = make(spanAttributes)
+	}
+	if _, exists := (*attrs)[key]; !exists && len(*attrs) >= attributeUserLimit {
+		return userAttributeLimitErr{key}
+	}
+	(*attrs)[key] = userAttribute{
+		value: val,
+		dests: dests,
+	}
+	return nil
+}
+
+// hasDest returns true if any attribute should be sent to the destination.
+func (attrs spanAttributes) hasDest(d destinationSet) bool {
+	for _, atr := range attrs {
+		if 0 != atr.dests&d {
+			return true
+		}
+	}
+	return false
+}
+
 func writeAttributeValueJSON(w *jsonFieldsWriter, key string, val interface{}) {
 	switch v := val.(type) {
 	case string:
@@ -406,23 +626,30 @@ func writeAttributeValueJSON(w *jsonFieldsWriter, key string, val interface{}) {
 }
 
 func agentAttributesJSON(a *Attributes, buf *bytes.Buffer, d destinationSet) {
+	w := jsonFieldsWriter{buf: buf}
+	buf.WriteByte('{')
+	writeAgentAttributes(&w, a, d)
+	buf.WriteByte('}')
+}
+
+func writeAgentAttributes(w *jsonFieldsWriter, a *Attributes, d destinationSet) {
 	if nil == a {
-		buf.WriteString("{}")
 		return
 	}
-	w := jsonFieldsWriter{buf: buf}
-	buf.WriteByte('{')
 	for id, val := range a.Agent {
 		if 0 != a.config.agentDests[id]&d {
 			if val.stringVal != "" {
 				w.stringField(id.name(), val.stringVal)
 			} else {
-				writeAttributeValueJSON(&w, id.name(), val.otherVal)
+				writeAttributeValueJSON(w, id.name(), val.otherVal)
 			}
 		}
 	}
-	buf.WriteByte('}')
-
+	for key, val := range a.headers {
+		if 0 != a.config.headerDests[key]&d {
+			w.stringField(key, val)
+		}
+	}
 }
 
 func userAttributesJSON(a *Attributes, buf *bytes.Buffer, d destinationSet, extraAttributes map[string]interface{}) {
@@ -458,9 +685,10 @@ func userAttributesStringJSON(a *Attributes, d destinationSet, extraAttributes m
 // RequestAgentAttributes gathers agent attributes out of the request.
 func RequestAgentAttributes(a *Attributes, method string, h http.Header, u *url.URL) {
 	a.Agent.Add(attributeRequestMethod, method, nil)
+	redactor := a.config.Redactor()
 
 	if nil != u {
-		a.Agent.Add(attributeRequestURI, SafeURL(u), nil)
+		a.Agent.Add(attributeRequestURI, redactor.Redact(SafeURL(u)), nil)
 	}
 
 	if nil == h {
@@ -470,11 +698,48 @@ func RequestAgentAttributes(a *Attributes, method string, h http.Header, u *url.
 	a.Agent.Add(attributeRequestContentType, h.Get("Content-Type"), nil)
 	a.Agent.Add(attributeRequestHeadersHost, h.Get("Host"), nil)
 	a.Agent.Add(attributeRequestHeadersUserAgent, h.Get("User-Agent"), nil)
-	a.Agent.Add(attributeRequestHeadersReferer, SafeURLFromString(h.Get("Referer")), nil)
+	a.Agent.Add(attributeRequestHeadersReferer, redactor.Redact(SafeURLFromString(h.Get("Referer"))), nil)
 
 	if l := GetContentLengthFromHeader(h); l >= 0 {
 		a.Agent.Add(attributeRequestContentLength, "", l)
 	}
+
+	a.addHeaderAttributes(a.config.requestHeaders, h)
+}
+
+// addHeaderAttributes records the values of the header attributes.  Multiple
+// values of the same header are joined by commas.
+func (a *Attributes) addHeaderAttributes(attrs []headerAttribute, h http.Header) {
+	for _, attr := range attrs {
+		if destNone == a.config.headerDests[attr.key] {
+			continue
+		}
+		vals := h[attr.header]
+		if 0 == len(vals) {
+			continue
+		}
+		val := a.config.Redactor().Redact(strings.Join(vals, ", "))
+		if "" == val {
+			continue
+		}
+		if nil == a.headers {
+			a.headers = make(map[string]string)
+		}
+		a.headers[attr.key] = truncateStringValueIfLong(val)
+	}
+}
+
+// AddAgentAttributer allows instrumentation to add agent attributes without
+// exposing a Transaction method.
+type AddAgentAttributer interface {
+	AddAgentAttribute(id AgentAttributeID, stringVal string, otherVal interface{})
+}
+
+// AddAgentAttribute allows instrumentation packages to add agent attributes.
+func AddAgentAttribute(txn interface{}, id AgentAttributeID, stringVal string, otherVal interface{}) {
+	if aa, ok := txn.(AddAgentAttributer); ok {
+		aa.AddAgentAttribute(id, stringVal, otherVal)
+	}
 }
 
 // ResponseHeaderAttributes gather agent attributes from the response headers.
@@ -487,6 +752,8 @@ func ResponseHeaderAttributes(a *Attributes, h http.Header) {
 	if l := GetContentLengthFromHeader(h); l >= 0 {
 		a.Agent.Add(attributeResponseHeadersContentLength, "", l)
 	}
+
+	a.addHeaderAttributes(a.config.responseHeaders, h)
 }
 
 var (
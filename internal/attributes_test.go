@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"testing"
@@ -348,6 +349,80 @@ func TestIncludeDisabled(t *testing.T) {
 	}
 }
 
+func TestAttributePatterns(t *testing.T) {
+	input := sampleAttributeConfigInput
+	input.Attributes.Exclude = []string{"/^session\\.[0-9]+$/", "user.*.token"}
+	input.TransactionEvents.Include = []string{"/token$/"}
+	cfg := CreateAttributeConfig(input, true)
+
+	for key, expect := range map[string]destinationSet{
+		"session.123":    destNone,
+		"session.abc":    DestAll,
+		"user.api.token": destNone,
+		"user.token":     DestAll,
+		"other.token":    DestAll,
+	} {
+		if d := applyAttributeConfig(cfg, key, DestAll); d != expect {
+			t.Error(key, destToString(d))
+		}
+	}
+	// Exact matches have precedence over patterns.
+	input.Attributes.Include = []string{"session.456"}
+	cfg = CreateAttributeConfig(input, true)
+	if d := applyAttributeConfig(cfg, "session.456", DestAll); d != DestAll {
+		t.Error(destToString(d))
+	}
+}
+
+func TestValidateAttributePattern(t *testing.T) {
+	for _, match := range []string{"", "key", "prefix.*", "a.*.b", "/^a+$/", "/"} {
+		if err := ValidateAttributePattern(match); nil != err {
+			t.Error(match, err)
+		}
+	}
+	if err := ValidateAttributePattern("/a(/"); nil == err {
+		t.Error("invalid pattern accepted")
+	}
+}
+
+func TestRedactedAttributes(t *testing.T) {
+	redactor, err := NewRedactor([]RedactionRule{{Pattern: `[a-z]+@example\.com`}})
+	if nil != err {
+		t.Fatal(err)
+	}
+	input := sampleAttributeConfigInput
+	input.Redactor = redactor
+	cfg := CreateAttributeConfig(input, true)
+	attrs := NewAttributes(cfg)
+
+	if err := AddUserAttribute(attrs, "email", "bob@example.com", DestAll); nil != err {
+		t.Error(err)
+	}
+	if err := AddUserAttribute(attrs, "count", 3, DestAll); nil != err {
+		t.Error(err)
+	}
+	if v := attrs.user["email"].value; v != "[REDACTED]" {
+		t.Error(v)
+	}
+	if v := attrs.user["count"].value; v != 3 {
+		t.Error(v)
+	}
+
+	var span spanAttributes
+	if err := addSpanAttribute(cfg, &span, "email", "to: bob@example.com"); nil != err {
+		t.Error(err)
+	}
+	if v := span["email"].value; v != "to: [REDACTED]" {
+		t.Error(v)
+	}
+
+	u, _ := url.Parse("http://www.example.com/users/bob@example.com?token=1")
+	RequestAgentAttributes(attrs, "GET", nil, u)
+	if v, _ := attrs.GetAgentValue(attributeRequestURI, DestAll); v != "http://www.example.com/users/[REDACTED]" {
+		t.Error(v)
+	}
+}
+
 func agentAttributesMap(attrs *Attributes, d destinationSet) map[string]interface{} {
 	buf := &bytes.Buffer{}
 	agentAttributesJSON(attrs, buf, d)
@@ -396,6 +471,53 @@ func TestRequestAgentAttributesPresent(t *testing.T) {
 	})
 }
 
+func TestHeaderAttributes(t *testing.T) {
+	input := sampleAttributeConfigInput
+	input.RequestHeaders = []string{"x-tenant-id", "X-Request-ID", "Host", "Authorization", "Cookie", "X-Tenant-ID", " "}
+	input.ResponseHeaders = []string{"X-Cache", "Content-Type", "Set-Cookie"}
+	input.Attributes.Include = []string{"request.headers.cookie"}
+	input.TransactionEvents.Exclude = []string{"request.headers.x-request-id"}
+	cfg := CreateAttributeConfig(input, true)
+
+	h := make(http.Header)
+	h.Set("X-Tenant-ID", "tenant")
+	h.Add("X-Request-ID", "first")
+	h.Add("X-Request-ID", "second")
+	h.Set("Host", "the-host")
+	h.Set("Authorization", "Bearer secret")
+	h.Set("Cookie", "session=1")
+	attrs := NewAttributes(cfg)
+	RequestAgentAttributes(attrs, "GET", h, nil)
+
+	resp := make(http.Header)
+	resp.Set("X-Cache", "HIT")
+	resp.Set("Content-Type", "text/plain")
+	resp.Set("Set-Cookie", "session=2")
+	ResponseHeaderAttributes(attrs, resp)
+
+	expectAttributes(t, agentAttributesMap(attrs, destTxnEvent), map[string]interface{}{
+		"request.method":               "GET",
+		"request.headers.host":         "the-host",
+		"request.headers.x-tenant-id":  "tenant",
+		"request.headers.cookie":       "session=1",
+		"response.headers.contentType": "text/plain",
+		"response.headers.x-cache":     "HIT",
+	})
+	expectAttributes(t, agentAttributesMap(attrs, destError), map[string]interface{}{
+		"request.method":               "GET",
+		"request.headers.host":         "the-host",
+		"request.headers.x-tenant-id":  "tenant",
+		"request.headers.x-request-id": "first, second",
+		"request.headers.cookie":       "session=1",
+		"response.headers.contentType": "text/plain",
+		"response.headers.x-cache":     "HIT",
+	})
+	// Only the explicitly included header is sent to the browser.
+	expectAttributes(t, agentAttributesMap(attrs, destBrowser), map[string]interface{}{
+		"request.headers.cookie": "session=1",
+	})
+}
+
 func BenchmarkAgentAttributes(b *testing.B) {
 	cfg := CreateAttributeConfig(sampleAttributeConfigInput, true)
 
@@ -32,6 +32,10 @@ const (
 	cmdTxnTraces    = "transaction_sample_data"
 	cmdSlowSQLs     = "sql_trace_data"
 	cmdSpanEvents   = "span_event_data"
+
+	cmdAgentCommands       = "get_agent_commands"
+	cmdAgentCommandResults = "agent_command_results"
+	cmdProfileData         = "profile_data"
 )
 
 // RpmCmd contains fields specific to an individual call made to RPM.
@@ -105,6 +109,21 @@ func (resp RPMResponse) ShouldSaveHarvestData() bool {
 	}
 }
 
+// IsConnectionFailure indicates that no response was received, eg. because
+// New Relic could not be reached.
+func (resp RPMResponse) IsConnectionFailure() bool {
+	return nil != resp.Err && 0 == resp.statusCode
+}
+
+// shouldSpool indicates that the data of a failed request may be delivered
+// later, and so should be kept in the spool.
+func (resp RPMResponse) shouldSpool() bool {
+	return resp.IsConnectionFailure() ||
+		resp.ShouldSaveHarvestData() ||
+		resp.IsRestartException() ||
+		resp.IsDisconnect()
+}
+
 func rpmURL(cmd RpmCmd, cs RpmControls) string {
 	var u url.URL
 
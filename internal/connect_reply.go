@@ -2,6 +2,7 @@ package internal
 
 import (
 	"encoding/json"
+	"sort"
 	"strings"
 	"time"
 )
@@ -24,6 +25,8 @@ type PreconnectReply struct {
 type ConnectReply struct {
 	RunID             AgentRunID        `json:"agent_run_id"`
 	RequestHeadersMap map[string]string `json:"request_headers_map"`
+	// EntityGUID identifies the application entity.
+	EntityGUID string `json:"entity_guid"`
 
 	// Transaction Name Modifiers
 	SegmentTerms segmentRules `json:"transaction_segment_terms"`
@@ -72,12 +75,74 @@ type ConnectReply struct {
 	SamplingTarget                uint64 `json:"sampling_target"`
 	SamplingTargetPeriodInSeconds int    `json:"sampling_target_period_in_seconds"`
 
+	// EventData contains the event harvest period and the event reservoir
+	// sizes chosen by the collector.
+	EventData EventHarvestConfig `json:"event_harvest_config"`
+
+	// localTxnNameRules are configured by the user and are applied after
+	// TxnNameRules.
+	localTxnNameRules metricRules
+
 	// rulesCache caches the results of calling CreateFullTxnName.  It
 	// exists here in ConnectReply since it is specific to a set of rules
 	// and is shared between transactions.
 	rulesCache *rulesCache
 }
 
+// EventHarvestConfig contains the event harvest period and the event reservoir
+// sizes.  It is sent in the connect request to provide the locally configured
+// values, and it is returned in the connect reply containing the values which
+// should be used.
+type EventHarvestConfig struct {
+	ReportPeriodMs int `json:"report_period_ms,omitempty"`
+	Limits         struct {
+		TxnEvents    *uint `json:"analytic_event_data,omitempty"`
+		CustomEvents *uint `json:"custom_event_data,omitempty"`
+		ErrorEvents  *uint `json:"error_event_data,omitempty"`
+		SpanEvents   *uint `json:"span_event_data,omitempty"`
+	} `json:"harvest_limits"`
+}
+
+func uintPtr(x int) *uint {
+	u := uint(x)
+	return &u
+}
+
+// EventHarvestConfig creates the EventHarvestConfig sent in the connect
+// request.
+func (cfg HarvestConfig) EventHarvestConfig() EventHarvestConfig {
+	var e EventHarvestConfig
+	e.ReportPeriodMs = int(cfg.EventPeriod / time.Millisecond)
+	e.Limits.TxnEvents = uintPtr(cfg.MaxTxnEvents)
+	e.Limits.CustomEvents = uintPtr(cfg.MaxCustomEvents)
+	e.Limits.ErrorEvents = uintPtr(cfg.MaxErrorEvents)
+	e.Limits.SpanEvents = uintPtr(cfg.MaxSpanEvents)
+	return e
+}
+
+// HarvestConfig returns the HarvestConfig which should be used with this
+// connect reply.  local contains the locally configured values, which are
+// used when the collector does not provide a value.
+func (r *ConnectReply) HarvestConfig(local HarvestConfig) HarvestConfig {
+	cfg := local
+	if r.EventData.ReportPeriodMs > 0 {
+		cfg.EventPeriod = time.Duration(r.EventData.ReportPeriodMs) * time.Millisecond
+	}
+	if v := r.EventData.Limits.TxnEvents; nil != v {
+		cfg.MaxTxnEvents = int(*v)
+	}
+	if v := r.EventData.Limits.CustomEvents; nil != v {
+		cfg.MaxCustomEvents = int(*v)
+	}
+	if v := r.EventData.Limits.ErrorEvents; nil != v {
+		cfg.MaxErrorEvents = int(*v)
+	}
+	if v := r.EventData.Limits.SpanEvents; nil != v {
+		cfg.MaxSpanEvents = int(*v)
+	}
+	return cfg
+}
+
 type trustedAccountSet map[int]struct{}
 
 func (t *trustedAccountSet) IsTrusted(account int) bool {
@@ -120,6 +185,38 @@ func ConnectReplyDefaults() *ConnectReply {
 	}
 }
 
+// OfflineRunID is the synthetic agent run id used when the application does
+// not connect to New Relic.
+const OfflineRunID AgentRunID = "offline"
+
+// OfflineConnectReply creates the reply used in place of a connect reply when
+// the application does not connect to New Relic.  Unlike the defaults,
+// transactions are sampled.
+func OfflineConnectReply() *ConnectReply {
+	reply := ConnectReplyDefaults()
+	reply.RunID = OfflineRunID
+	reply.AdaptiveSampler = newAdaptiveSampler(adaptiveSamplerInput{
+		Period: time.Duration(reply.SamplingTargetPeriodInSeconds) * time.Second,
+		Target: reply.SamplingTarget,
+	}, time.Now())
+	reply.rulesCache = newRulesCache(txnNameCacheLimit)
+	return reply
+}
+
+// SetLocalTxnNameRules sets the transaction name rules configured by the user.
+// Invalid rules are ignored:  They should be checked beforehand using
+// ValidateLocalRules.
+func (r *ConnectReply) SetLocalTxnNameRules(rules []LocalRule) {
+	var local metricRules
+	for _, rule := range rules {
+		if compiled, err := compileLocalRules([]LocalRule{rule}); nil == err {
+			local = append(local, compiled...)
+		}
+	}
+	sort.Stable(local)
+	r.localTxnNameRules = local
+}
+
 // CalculateApdexThreshold calculates the apdex threshold.
 func CalculateApdexThreshold(c *ConnectReply, txnName string) time.Duration {
 	if t, ok := c.KeyTxnApdex[txnName]; ok {
@@ -132,21 +229,36 @@ func CalculateApdexThreshold(c *ConnectReply, txnName string) time.Duration {
 // construct the full transaction metric name from the name given by the
 // consumer.
 func CreateFullTxnName(input string, reply *ConnectReply, isWeb bool) string {
-	if name := reply.rulesCache.find(input, isWeb); "" != name {
+	return CreateFullTxnNameWithPrefix(input, TxnNamePrefix(isWeb), reply)
+}
+
+// TxnNamePrefix returns the default metric prefix of web or background
+// transactions.
+func TxnNamePrefix(isWeb bool) string {
+	if isWeb {
+		return webMetricPrefix
+	}
+	return backgroundMetricPrefix
+}
+
+// CreateFullTxnNameWithPrefix is like CreateFullTxnName, but uses the metric
+// prefix provided, eg. "OtherTransaction/Message".
+func CreateFullTxnNameWithPrefix(input, prefix string, reply *ConnectReply) string {
+	if name := reply.rulesCache.find(input, prefix); "" != name {
 		return name
 	}
-	name := constructFullTxnName(input, reply, isWeb)
+	name := constructFullTxnName(input, prefix, reply)
 	if "" != name {
 		// Note that we  don't cache situations where the rules say
 		// ignore.  It would increase complication (we would need to
 		// disambiguate not-found vs ignore).  Also, the ignore code
 		// path is probably extremely uncommon.
-		reply.rulesCache.set(input, isWeb, name)
+		reply.rulesCache.set(input, prefix, name)
 	}
 	return name
 }
 
-func constructFullTxnName(input string, reply *ConnectReply, isWeb bool) string {
+func constructFullTxnName(input, prefix string, reply *ConnectReply) string {
 	var afterURLRules string
 	if "" != input {
 		afterURLRules = reply.URLRules.Apply(input)
@@ -155,11 +267,6 @@ func constructFullTxnName(input string, reply *ConnectReply, isWeb bool) string
 		}
 	}
 
-	prefix := backgroundMetricPrefix
-	if isWeb {
-		prefix = webMetricPrefix
-	}
-
 	var beforeNameRules string
 	if strings.HasPrefix(afterURLRules, "/") {
 		beforeNameRules = prefix + afterURLRules
@@ -172,5 +279,10 @@ func constructFullTxnName(input string, reply *ConnectReply, isWeb bool) string
 		return ""
 	}
 
+	afterNameRules = reply.localTxnNameRules.Apply(afterNameRules)
+	if "" == afterNameRules {
+		return ""
+	}
+
 	return reply.SegmentTerms.apply(afterNameRules)
 }
@@ -87,7 +87,7 @@ func TestCreateFullTxnNameAllRulesWithCache(t *testing.T) {
 		t.Error("wanted:", want, "got:", out)
 	}
 	// Check that the cache was populated as expected.
-	if out := reply.rulesCache.find("/zap/zip/zep", true); out != want {
+	if out := reply.rulesCache.find("/zap/zip/zep", webMetricPrefix); out != want {
 		t.Error("wanted:", want, "got:", out)
 	}
 	// Check that the next CreateFullTxnName returns the same output.
@@ -96,6 +96,33 @@ func TestCreateFullTxnNameAllRulesWithCache(t *testing.T) {
 	}
 }
 
+func TestCreateFullTxnNameLocalRules(t *testing.T) {
+	js := `[{
+		"match_expression":"^WebTransaction/Go/users/[0-9]+$",
+		"replacement":"WebTransaction/Go/users/:id"
+	}]`
+	reply := ConnectReplyDefaults()
+	if err := json.Unmarshal([]byte(js), &reply.TxnNameRules); nil != err {
+		t.Fatal(err)
+	}
+	reply.SetLocalTxnNameRules([]LocalRule{
+		{MatchExpression: "^(.*)/:ID$", Replacement: "\\1/{id}", EvalOrder: 2},
+		{MatchExpression: "[0-9]+", Replacement: "*", EachSegment: true, EvalOrder: 1},
+		{MatchExpression: "[", Replacement: "invalid"},
+		{MatchExpression: "^WebTransaction/Go/health$", Ignore: true},
+	})
+	for input, expect := range map[string]string{
+		"/users/123":     "WebTransaction/Go/users/{id}",
+		"/orders/7/item": "WebTransaction/Go/orders/*/item",
+		"/health":        "",
+		"/about":         "WebTransaction/Go/about",
+	} {
+		if out := CreateFullTxnName(input, reply, true); out != expect {
+			t.Error(input, out)
+		}
+	}
+}
+
 func TestCalculateApdexThreshold(t *testing.T) {
 	reply := ConnectReplyDefaults()
 	threshold := CalculateApdexThreshold(reply, "WebTransaction/Go/hello")
@@ -141,6 +168,55 @@ func TestIsTrusted(t *testing.T) {
 	}
 }
 
+func TestHarvestConfigFromReply(t *testing.T) {
+	local := DefaultHarvestConfig
+	local.MaxCustomEvents = 20000
+
+	reply := ConnectReplyDefaults()
+	if cfg := reply.HarvestConfig(local); cfg != local {
+		t.Error(cfg)
+	}
+
+	js := `{"event_harvest_config":{
+		"report_period_ms":5000,
+		"harvest_limits":{
+			"analytic_event_data":833,
+			"custom_event_data":0,
+			"error_event_data":8
+		}
+	}}`
+	if err := json.Unmarshal([]byte(js), reply); nil != err {
+		t.Fatal(err)
+	}
+	cfg := reply.HarvestConfig(local)
+	if cfg.EventPeriod != 5*time.Second {
+		t.Error(cfg.EventPeriod)
+	}
+	if cfg.MaxTxnEvents != 833 {
+		t.Error(cfg.MaxTxnEvents)
+	}
+	if cfg.MaxCustomEvents != 0 {
+		t.Error(cfg.MaxCustomEvents)
+	}
+	if cfg.MaxErrorEvents != 8 {
+		t.Error(cfg.MaxErrorEvents)
+	}
+	if cfg.MaxSpanEvents != MaxSpanEvents {
+		t.Error(cfg.MaxSpanEvents)
+	}
+}
+
+func TestEventHarvestConfigJSON(t *testing.T) {
+	js, err := json.Marshal(DefaultHarvestConfig.EventHarvestConfig())
+	if nil != err {
+		t.Fatal(err)
+	}
+	expect := `{"report_period_ms":60000,"harvest_limits":{"analytic_event_data":10000,"custom_event_data":10000,"error_event_data":100,"span_event_data":1000}}`
+	if string(js) != expect {
+		t.Error(string(js))
+	}
+}
+
 func BenchmarkDefaultRules(b *testing.B) {
 	js := `{"url_rules":[
 		{
@@ -3,7 +3,10 @@ package internal
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,6 +18,13 @@ func (v distTraceVersion) minor() int { return v[1] }
 const (
 	// CallerType is the Type field's value for outbound payloads.
 	CallerType = "App"
+
+	// https://www.w3.org/TR/trace-context/
+	w3cVersion          = "00"
+	traceIDHexLength    = 32
+	parentIDHexLength   = 16
+	maxTraceStateVendor = 31
+	traceStateNRVersion = "0"
 )
 
 var (
@@ -52,6 +62,21 @@ type Payload struct {
 	Sampled           *bool           `json:"sa"`
 	Timestamp         timestampMillis `json:"ti"`
 	TransportDuration time.Duration   `json:"-"`
+
+	// HasNewRelicTraceInfo is true if the payload carried New Relic
+	// caller information: either the payload came from the Newrelic
+	// header or the tracestate header contained a trusted New Relic entry.
+	HasNewRelicTraceInfo bool `json:"-"`
+	// TrustedParentID is the span id found in the New Relic tracestate
+	// entry.
+	TrustedParentID string `json:"-"`
+	// TracingVendors is the comma separated list of the other vendor
+	// keys found in the tracestate header.
+	TracingVendors string `json:"-"`
+	// NonTrustedTraceState contains the tracestate list members other
+	// than the trusted New Relic entry.  They are propagated on outbound
+	// requests.
+	NonTrustedTraceState string `json:"-"`
 }
 
 type payloadCaller struct {
@@ -118,6 +143,205 @@ func (p Payload) HTTPSafe() string {
 	return base64.StdEncoding.EncodeToString(t)
 }
 
+// W3CTraceParent returns the value of the W3C traceparent header for this
+// payload.
+func (p Payload) W3CTraceParent() string {
+	flags := "00"
+	if nil != p.Sampled && *p.Sampled {
+		flags = "01"
+	}
+	traceID := strings.ToLower(p.TracedID)
+	if n := len(traceID); n < traceIDHexLength {
+		traceID = strings.Repeat("0", traceIDHexLength-n) + traceID
+	} else if n > traceIDHexLength {
+		traceID = traceID[n-traceIDHexLength:]
+	}
+	// The parent id must always be present: use the transaction id when
+	// no span id is available.
+	parentID := p.ID
+	if "" == parentID {
+		parentID = p.TransactionID
+	}
+	return w3cVersion + "-" + traceID + "-" + parentID + "-" + flags
+}
+
+// W3CTraceState returns the value of the W3C tracestate header for this
+// payload.  The New Relic entry is added first, followed by the entries of
+// other vendors that were received inbound.
+func (p Payload) W3CTraceState() string {
+	trustKey := p.TrustedAccountKey
+	if "" == trustKey {
+		trustKey = p.Account
+	}
+	sampled := "0"
+	if nil != p.Sampled && *p.Sampled {
+		sampled = "1"
+	}
+	state := trustKey + "@nr=" + strings.Join([]string{
+		traceStateNRVersion,
+		traceStateParentTypes[p.Type],
+		p.Account,
+		p.App,
+		p.ID,
+		p.TransactionID,
+		sampled,
+		fmt.Sprintf(priorityFormat, p.Priority),
+		strconv.FormatUint(TimeToUnixMilliseconds(p.Timestamp.Time()), 10),
+	}, "-")
+	if "" != p.NonTrustedTraceState {
+		state += "," + p.NonTrustedTraceState
+	}
+	return state
+}
+
+var (
+	traceStateParentTypes = map[string]string{
+		"App":     "0",
+		"Browser": "1",
+		"Mobile":  "2",
+	}
+	traceStateParentTypeNames = map[string]string{
+		"0": "App",
+		"1": "Browser",
+		"2": "Mobile",
+	}
+
+	// ErrTraceStateNoNewRelicEntry indicates that the tracestate header did
+	// not contain a New Relic entry for the trusted account key.
+	ErrTraceStateNoNewRelicEntry = errors.New("tracestate has no trusted New Relic entry")
+	// ErrTraceStateInvalidNewRelicEntry indicates that the New Relic
+	// tracestate entry was malformed.
+	ErrTraceStateInvalidNewRelicEntry = errors.New("tracestate has an invalid New Relic entry")
+)
+
+func isLowerHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(('0' <= c && c <= '9') || ('a' <= c && c <= 'f')) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAllZeros(s string) bool {
+	return "" == strings.Trim(s, "0")
+}
+
+// ParseTraceParent parses the W3C traceparent header.  The returned payload
+// contains only the trace id and the parent id: New Relic caller information
+// is added by ParseTraceState.
+func ParseTraceParent(traceParent string) (*Payload, error) {
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 {
+		return nil, ErrPayloadParse{err: fmt.Errorf("traceparent has too few fields: %q", traceParent)}
+	}
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+	if !isLowerHex(version, 2) || "ff" == version {
+		return nil, ErrPayloadParse{err: fmt.Errorf("invalid traceparent version: %q", version)}
+	}
+	if w3cVersion == version && 4 != len(parts) {
+		return nil, ErrPayloadParse{err: fmt.Errorf("traceparent has too many fields: %q", traceParent)}
+	}
+	if !isLowerHex(traceID, traceIDHexLength) || isAllZeros(traceID) {
+		return nil, ErrPayloadParse{err: fmt.Errorf("invalid traceparent trace id: %q", traceID)}
+	}
+	if !isLowerHex(parentID, parentIDHexLength) || isAllZeros(parentID) {
+		return nil, ErrPayloadParse{err: fmt.Errorf("invalid traceparent parent id: %q", parentID)}
+	}
+	if !isLowerHex(flags, 2) {
+		return nil, ErrPayloadParse{err: fmt.Errorf("invalid traceparent flags: %q", flags)}
+	}
+	return &Payload{
+		TracedID: traceID,
+		ID:       parentID,
+	}, nil
+}
+
+// ParseTraceState parses the W3C tracestate header and adds the New Relic
+// entry for the trusted account key to the payload.  The entries of other
+// vendors are always recorded, even if an error is returned.
+func (p *Payload) ParseTraceState(traceState, trustedAccountKey string) error {
+	nrKey := trustedAccountKey + "@nr"
+	var nrEntry string
+	var found bool
+	var vendors, others []string
+	for _, member := range strings.Split(traceState, ",") {
+		member = strings.TrimSpace(member)
+		eq := strings.IndexByte(member, '=')
+		if eq <= 0 {
+			// Empty and malformed list members are dropped.
+			continue
+		}
+		key := member[:eq]
+		if key == nrKey {
+			if !found {
+				found = true
+				nrEntry = member[eq+1:]
+			}
+			continue
+		}
+		vendors = append(vendors, key)
+		if len(others) < maxTraceStateVendor {
+			others = append(others, member)
+		}
+	}
+	p.TracingVendors = strings.Join(vendors, ",")
+	p.NonTrustedTraceState = strings.Join(others, ",")
+
+	if !found {
+		return ErrTraceStateNoNewRelicEntry
+	}
+	return p.parseNewRelicTraceState(nrEntry, trustedAccountKey)
+}
+
+func (p *Payload) parseNewRelicTraceState(entry, trustedAccountKey string) error {
+	fields := strings.Split(entry, "-")
+	if len(fields) < 9 {
+		return ErrTraceStateInvalidNewRelicEntry
+	}
+	parentType, ok := traceStateParentTypeNames[fields[1]]
+	if !ok {
+		return ErrTraceStateInvalidNewRelicEntry
+	}
+	account, app := fields[2], fields[3]
+	if "" == account || "" == app {
+		return ErrTraceStateInvalidNewRelicEntry
+	}
+	millis, err := strconv.ParseUint(fields[8], 10, 64)
+	if nil != err {
+		return ErrTraceStateInvalidNewRelicEntry
+	}
+	var priority Priority
+	if s := fields[7]; "" != s {
+		f, err := strconv.ParseFloat(s, 32)
+		if nil != err {
+			return ErrTraceStateInvalidNewRelicEntry
+		}
+		priority = Priority(f)
+	}
+	switch fields[6] {
+	case "1", "true":
+		p.SetSampled(true)
+	case "0", "false":
+		p.SetSampled(false)
+	}
+
+	p.Type = parentType
+	p.Account = account
+	p.App = app
+	p.TrustedAccountKey = trustedAccountKey
+	p.TrustedParentID = fields[4]
+	p.TransactionID = fields[5]
+	p.Priority = priority
+	p.Timestamp.Set(timeFromUnixMilliseconds(millis))
+	p.HasNewRelicTraceInfo = true
+	return nil
+}
+
 // SetSampled lets us set a value for our *bool,
 // which we can't do directly since a pointer
 // needs something to point at.
@@ -198,6 +422,7 @@ func AcceptPayload(p interface{}) (*Payload, error) {
 	// want to change it, it could be used multiple times.
 	alloc := new(Payload)
 	*alloc = payload
+	alloc.HasNewRelicTraceInfo = true
 
 	return alloc, nil
 }
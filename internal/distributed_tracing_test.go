@@ -2,12 +2,15 @@ package internal
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 )
 
 var (
 	samplePayload = Payload{
+		HasNewRelicTraceInfo: true,
 		payloadCaller: payloadCaller{
 			Type:    CallerType,
 			Account: "123",
@@ -330,3 +333,149 @@ func TestRequiredFieldsZeroTimestamp(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestW3CTraceParent(t *testing.T) {
+	p := Payload{
+		TracedID:      "d6b4ba0c3a712ca",
+		ID:            "7d3efb1b173fecfa",
+		TransactionID: "e8b91a159289ff74",
+	}
+	if tp := p.W3CTraceParent(); tp != "00-00000000000000000d6b4ba0c3a712ca-7d3efb1b173fecfa-00" {
+		t.Error(tp)
+	}
+	p.SetSampled(true)
+	p.ID = ""
+	if tp := p.W3CTraceParent(); tp != "00-00000000000000000d6b4ba0c3a712ca-e8b91a159289ff74-01" {
+		t.Error(tp)
+	}
+}
+
+func TestW3CTraceState(t *testing.T) {
+	p := Payload{
+		payloadCaller: payloadCaller{
+			Type:              CallerType,
+			Account:           "123",
+			App:               "456",
+			TrustedAccountKey: "789",
+		},
+		ID:                   "7d3efb1b173fecfa",
+		TransactionID:        "e8b91a159289ff74",
+		Priority:             0.5,
+		NonTrustedTraceState: "dd=abc",
+	}
+	p.SetSampled(true)
+	p.Timestamp.Set(timeFromUnixMilliseconds(1518469636035))
+	expect := "789@nr=0-0-123-456-7d3efb1b173fecfa-e8b91a159289ff74-1-0.500000-1518469636035,dd=abc"
+	if ts := p.W3CTraceState(); ts != expect {
+		t.Error(ts)
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	p, err := ParseTraceParent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if p.TracedID != "0af7651916cd43dd8448eb211c80319c" || p.ID != "b7ad6b7169203331" {
+		t.Error(p.TracedID, p.ID)
+	}
+	if p.HasNewRelicTraceInfo || nil != p.Sampled {
+		t.Error(p.HasNewRelicTraceInfo, p.Sampled)
+	}
+	// Future versions may append fields.
+	if _, err := ParseTraceParent("01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra"); nil != err {
+		t.Error(err)
+	}
+}
+
+func TestParseTraceParentInvalid(t *testing.T) {
+	for _, tp := range []string{
+		"",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra",
+		"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"0-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"00-0AF7651916CD43DD8448EB211C80319C-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319-b7ad6b7169203331-01",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b716920333g-01",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-1",
+	} {
+		if _, err := ParseTraceParent(tp); nil == err {
+			t.Error("expected error", tp)
+		} else if _, ok := err.(ErrPayloadParse); !ok {
+			t.Error("unexpected error type", tp, err)
+		}
+	}
+}
+
+func TestParseTraceState(t *testing.T) {
+	p := &Payload{}
+	state := "dd=YzRiMTIxODk1NmVmZTE4ZQ, 33@nr=0-1-44-5043-27ddd2d8890283b4-5569065a5b1313bd-0-0.123456-1518469636025,,rojo=00f067aa0ba902b7"
+	if err := p.ParseTraceState(state, "33"); nil != err {
+		t.Fatal(err)
+	}
+	if !p.HasNewRelicTraceInfo {
+		t.Error("missing New Relic trace info")
+	}
+	if p.Type != "Browser" || p.Account != "44" || p.App != "5043" || p.TrustedAccountKey != "33" {
+		t.Error(p.payloadCaller)
+	}
+	if p.TrustedParentID != "27ddd2d8890283b4" || p.TransactionID != "5569065a5b1313bd" {
+		t.Error(p.TrustedParentID, p.TransactionID)
+	}
+	if nil == p.Sampled || *p.Sampled || p.Priority != 0.123456 {
+		t.Error(p.Sampled, p.Priority)
+	}
+	if ms := TimeToUnixMilliseconds(p.Timestamp.Time()); ms != 1518469636025 {
+		t.Error(ms)
+	}
+	if p.TracingVendors != "dd,rojo" {
+		t.Error(p.TracingVendors)
+	}
+	if p.NonTrustedTraceState != "dd=YzRiMTIxODk1NmVmZTE4ZQ,rojo=00f067aa0ba902b7" {
+		t.Error(p.NonTrustedTraceState)
+	}
+}
+
+func TestParseTraceStateNoEntry(t *testing.T) {
+	p := &Payload{}
+	err := p.ParseTraceState("44@nr=0-0-44-5043-27ddd2d8890283b4-5569065a5b1313bd-1-1.1-1518469636025", "33")
+	if err != ErrTraceStateNoNewRelicEntry {
+		t.Error(err)
+	}
+	if p.HasNewRelicTraceInfo || p.TracingVendors != "44@nr" {
+		t.Error(p.HasNewRelicTraceInfo, p.TracingVendors)
+	}
+}
+
+func TestParseTraceStateInvalidEntry(t *testing.T) {
+	for _, state := range []string{
+		"33@nr=0-0-44",
+		"33@nr=0-9-44-5043-27ddd2d8890283b4-5569065a5b1313bd-1-1.1-1518469636025",
+		"33@nr=0-0--5043-27ddd2d8890283b4-5569065a5b1313bd-1-1.1-1518469636025",
+		"33@nr=0-0-44-5043-27ddd2d8890283b4-5569065a5b1313bd-1-abc-1518469636025",
+		"33@nr=0-0-44-5043-27ddd2d8890283b4-5569065a5b1313bd-1-1.1-",
+	} {
+		p := &Payload{}
+		if err := p.ParseTraceState(state, "33"); err != ErrTraceStateInvalidNewRelicEntry {
+			t.Error(state, err)
+		}
+		if p.HasNewRelicTraceInfo {
+			t.Error(state)
+		}
+	}
+}
+
+func TestParseTraceStateVendorLimit(t *testing.T) {
+	var members []string
+	for i := 0; i < 40; i++ {
+		members = append(members, fmt.Sprintf("vendor%d=value", i))
+	}
+	p := &Payload{}
+	p.ParseTraceState(strings.Join(members, ","), "33")
+	if n := len(strings.Split(p.NonTrustedTraceState, ",")); n != maxTraceStateVendor {
+		t.Error(n)
+	}
+}
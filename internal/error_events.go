@@ -25,6 +25,9 @@ func (e *ErrorEvent) WriteJSON(buf *bytes.Buffer) {
 	w.stringField("error.message", e.Msg)
 	w.floatField("timestamp", timeToFloatSeconds(e.When))
 	w.stringField("transactionName", e.FinalName)
+	if e.Expected {
+		w.boolField("error.expected", true)
+	}
 
 	sharedTransactionIntrinsics(&e.TxnEvent, &w)
 	sharedBetterCATIntrinsics(&e.TxnEvent, &w)
@@ -33,7 +36,7 @@ func (e *ErrorEvent) WriteJSON(buf *bytes.Buffer) {
 	buf.WriteByte(',')
 	userAttributesJSON(e.Attrs, buf, destError, e.ErrorData.ExtraAttributes)
 	buf.WriteByte(',')
-	agentAttributesJSON(e.Attrs, buf, destError)
+	errorAgentAttributesJSON(e.Attrs, buf, &e.ErrorData)
 	buf.WriteByte(']')
 }
 
@@ -140,6 +140,61 @@ func TestErrorEventAttributes(t *testing.T) {
 	]`)
 }
 
+func TestErrorEventExpectedAndGroupName(t *testing.T) {
+	aci := sampleAttributeConfigInput
+	cfg := CreateAttributeConfig(aci, true)
+	attr := NewAttributes(cfg)
+	data := sampleErrorData
+	data.Expected = true
+	data.GroupName = "my-group"
+
+	testErrorEventJSON(t, &ErrorEvent{
+		ErrorData: data,
+		TxnEvent: TxnEvent{
+			FinalName: "myName",
+			Duration:  3 * time.Second,
+			Attrs:     attr,
+		},
+	}, `[
+		{
+			"type":"TransactionError",
+			"error.class":"*errors.errorString",
+			"error.message":"hello",
+			"timestamp":1.41713646e+09,
+			"transactionName":"myName",
+			"error.expected":true,
+			"duration":3
+		},
+		{},
+		{
+			"error.group.name":"my-group"
+		}
+	]`)
+
+	aci.ErrorCollector.Exclude = append(aci.ErrorCollector.Exclude, "error.group.name")
+	attr = NewAttributes(CreateAttributeConfig(aci, true))
+	testErrorEventJSON(t, &ErrorEvent{
+		ErrorData: data,
+		TxnEvent: TxnEvent{
+			FinalName: "myName",
+			Duration:  3 * time.Second,
+			Attrs:     attr,
+		},
+	}, `[
+		{
+			"type":"TransactionError",
+			"error.class":"*errors.errorString",
+			"error.message":"hello",
+			"timestamp":1.41713646e+09,
+			"transactionName":"myName",
+			"error.expected":true,
+			"duration":3
+		},
+		{},
+		{}
+	]`)
+}
+
 func TestErrorEventAttributesOldCAT(t *testing.T) {
 	aci := sampleAttributeConfigInput
 	aci.ErrorCollector.Exclude = append(aci.ErrorCollector.Exclude, "zap")
@@ -188,6 +243,7 @@ func TestErrorEventMarshalWithInboundCaller(t *testing.T) {
 
 	e.BetterCAT.Enabled = true
 	e.BetterCAT.Inbound = &Payload{
+		HasNewRelicTraceInfo: true,
 		payloadCaller: payloadCaller{
 			TransportType: "HTTP",
 			Type:          "Browser",
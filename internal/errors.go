@@ -50,6 +50,19 @@ type ErrorData struct {
 	ExtraAttributes map[string]interface{}
 	Msg             string
 	Klass           string
+	// Expected errors are recorded but do not affect error rate metrics
+	// or Apdex.
+	Expected bool
+	// GroupName is set by the error group callback when the transaction
+	// ends.
+	GroupName string
+	// Chain contains the messages of the wrapped errors, starting with
+	// the error provided to NoticeError, separated by newlines.  It is
+	// empty if the error does not wrap other errors.
+	Chain string
+	// Err is the error provided to NoticeError.  It is only retained until
+	// the transaction ends for use by the error group callback.
+	Err error
 }
 
 // TxnError combines error data with information about a transaction.  TxnError is used for
@@ -94,7 +107,7 @@ func (h *tracedError) WriteJSON(buf *bytes.Buffer) {
 	buf.WriteByte('{')
 	buf.WriteString(`"agentAttributes"`)
 	buf.WriteByte(':')
-	agentAttributesJSON(h.Attrs, buf, destError)
+	errorAgentAttributesJSON(h.Attrs, buf, &h.ErrorData)
 	buf.WriteByte(',')
 	buf.WriteString(`"userAttributes"`)
 	buf.WriteByte(':')
@@ -102,7 +115,13 @@ func (h *tracedError) WriteJSON(buf *bytes.Buffer) {
 	buf.WriteByte(',')
 	buf.WriteString(`"intrinsics"`)
 	buf.WriteByte(':')
-	intrinsicsJSON(&h.TxnEvent, buf)
+	w := jsonFieldsWriter{buf: buf}
+	buf.WriteByte('{')
+	writeIntrinsics(&h.TxnEvent, &w)
+	if h.Expected {
+		w.boolField("error.expected", true)
+	}
+	buf.WriteByte('}')
 	if nil != h.Stack {
 		buf.WriteByte(',')
 		buf.WriteString(`"stack_trace"`)
@@ -121,6 +140,23 @@ func (h *tracedError) MarshalJSON() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// errorAgentAttributesJSON writes the agent attributes of traced errors and
+// error events, which include the error group name and the error chain.
+func errorAgentAttributesJSON(a *Attributes, buf *bytes.Buffer, e *ErrorData) {
+	w := jsonFieldsWriter{buf: buf}
+	buf.WriteByte('{')
+	writeAgentAttributes(&w, a, destError)
+	if nil != a {
+		if "" != e.GroupName && 0 != a.config.agentDests[attributeErrorGroupName]&destError {
+			w.stringField(attributeErrorGroupName.name(), e.GroupName)
+		}
+		if "" != e.Chain && 0 != a.config.agentDests[attributeErrorChain]&destError {
+			w.stringField(attributeErrorChain.name(), e.Chain)
+		}
+	}
+	buf.WriteByte('}')
+}
+
 type harvestErrors []*tracedError
 
 func newHarvestErrors(max int) harvestErrors {
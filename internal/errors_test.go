@@ -68,6 +68,53 @@ func TestErrorTraceMarshal(t *testing.T) {
 	testExpectedJSON(t, expect, string(js))
 }
 
+func TestErrorTraceMarshalExpected(t *testing.T) {
+	he := &tracedError{
+		ErrorData: ErrorData{
+			When:      time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC),
+			Stack:     emptyStackTrace,
+			Msg:       "my_msg",
+			Klass:     "my_class",
+			Expected:  true,
+			GroupName: "my_group",
+		},
+		TxnEvent: TxnEvent{
+			FinalName: "my_txn_name",
+			Attrs:     NewAttributes(CreateAttributeConfig(sampleAttributeConfigInput, true)),
+			BetterCAT: BetterCAT{
+				Enabled:  true,
+				ID:       "txn-id",
+				Priority: 0.5,
+			},
+		},
+	}
+	js, err := json.Marshal(he)
+	if nil != err {
+		t.Error(err)
+	}
+
+	expect := `
+	[
+		1.41713646e+12,
+		"my_txn_name",
+		"my_msg",
+		"my_class",
+		{
+			"agentAttributes":{"error.group.name":"my_group"},
+			"userAttributes":{},
+			"intrinsics":{
+				"guid":"txn-id",
+				"traceId":"txn-id",
+				"priority":0.500000,
+				"sampled":false,
+				"error.expected":true
+			},
+			"stack_trace":[]
+		}
+	]`
+	testExpectedJSON(t, expect, string(js))
+}
+
 func TestErrorTraceMarshalOldCAT(t *testing.T) {
 	he := &tracedError{
 		ErrorData: ErrorData{
@@ -115,6 +115,22 @@ func HarvestTesting(app interface{}, replyfn func(*ConnectReply)) {
 	ta.HarvestTesting(replyfn)
 }
 
+// HarvestSwapper is implemented by the app.  It replaces the test harvest with
+// an empty harvest and returns the previous one.
+type HarvestSwapper interface {
+	SwapTestHarvest() *Harvest
+}
+
+// SwapTestHarvest allows packages outside the newrelic package to harvest the
+// test data on demand.  HarvestTesting must be called first.
+func SwapTestHarvest(app interface{}) *Harvest {
+	hs, ok := app.(HarvestSwapper)
+	if !ok {
+		panic("SwapTestHarvest type assertion failure")
+	}
+	return hs.SwapTestHarvest()
+}
+
 // WantTxn provides the expectation parameters to ExpectTxnMetrics.
 type WantTxn struct {
 	Name      string
@@ -0,0 +1,49 @@
+package internal
+
+import "time"
+
+// ExternalTiming contains the phases of an external request recorded using
+// net/http/httptrace.  Phases which did not occur, such as the DNS lookup
+// and connection when a connection is reused, are zero.
+type ExternalTiming struct {
+	DNS      time.Duration
+	Connect  time.Duration
+	TLS      time.Duration
+	Wait     time.Duration
+	Response time.Duration
+	// ConnectionReused is true if an idle connection was used.
+	ConnectionReused bool
+	// RemoteAddress is the address of the connection, eg. "10.0.0.1:443".
+	RemoteAddress string
+}
+
+// timingFieldsWriter is satisfied by both jsonFieldsWriter and
+// spanFieldsWriter so that the timing is written the same way in span events
+// and transaction trace segments.
+type timingFieldsWriter interface {
+	stringField(key string, val string)
+	floatField(key string, val float64)
+	boolField(key string, val bool)
+}
+
+func (t *ExternalTiming) writeFields(w timingFieldsWriter) {
+	durations := []struct {
+		key string
+		val time.Duration
+	}{
+		{"http.dnsDuration", t.DNS},
+		{"http.connectDuration", t.Connect},
+		{"http.tlsDuration", t.TLS},
+		{"http.waitDuration", t.Wait},
+		{"http.responseDuration", t.Response},
+	}
+	for _, d := range durations {
+		if d.val > 0 {
+			w.floatField(d.key, d.val.Seconds())
+		}
+	}
+	w.boolField("http.connectionReused", t.ConnectionReused)
+	if "" != t.RemoteAddress {
+		w.stringField("peer.address", t.RemoteAddress)
+	}
+}
@@ -11,8 +11,56 @@ type Harvestable interface {
 	MergeIntoHarvest(h *Harvest)
 }
 
+// HarvestTypes is a bit set used to indicate which data types are harvested
+// together.
+type HarvestTypes uint
+
+const (
+	// HarvestMetricsTraces is the metrics, traced errors, transaction
+	// traces, slow queries, and profiles.  These are always harvested each
+	// HarvestPeriod.
+	HarvestMetricsTraces HarvestTypes = 1 << iota
+	// HarvestSpanEvents is the span events.
+	HarvestSpanEvents
+	// HarvestCustomEvents is the custom events.
+	HarvestCustomEvents
+	// HarvestTxnEvents is the transaction events.
+	HarvestTxnEvents
+	// HarvestErrorEvents is the error events.
+	HarvestErrorEvents
+)
+
+const (
+	// HarvestTypesEvents is all event types.  They are harvested each
+	// HarvestConfig.EventPeriod.
+	HarvestTypesEvents = HarvestSpanEvents | HarvestCustomEvents | HarvestTxnEvents | HarvestErrorEvents
+	// HarvestTypesAll is all data types.
+	HarvestTypesAll = HarvestMetricsTraces | HarvestTypesEvents
+)
+
+// HarvestConfig contains the event harvest period and the event reservoir
+// sizes.  Use ConnectReply.HarvestConfig to create it.
+type HarvestConfig struct {
+	EventPeriod     time.Duration
+	MaxTxnEvents    int
+	MaxCustomEvents int
+	MaxErrorEvents  int
+	MaxSpanEvents   int
+}
+
+// DefaultHarvestConfig is used when the application is not connected.
+var DefaultHarvestConfig = HarvestConfig{
+	EventPeriod:     HarvestPeriod,
+	MaxTxnEvents:    MaxTxnEvents,
+	MaxCustomEvents: MaxCustomEvents,
+	MaxErrorEvents:  MaxErrorEvents,
+	MaxSpanEvents:   MaxSpanEvents,
+}
+
 // Harvest contains collected data.
 type Harvest struct {
+	config HarvestConfig
+
 	Metrics      *metricTable
 	CustomEvents *customEvents
 	TxnEvents    *txnEvents
@@ -21,6 +69,7 @@ type Harvest struct {
 	TxnTraces    *harvestTraces
 	SlowSQLs     *slowQueries
 	SpanEvents   *spanEvents
+	Profiles     harvestProfiles
 }
 
 const (
@@ -29,36 +78,102 @@ const (
 	txnEventPayloadlimit = 5000
 )
 
+// Ready returns a new Harvest which contains the data types provided.  The
+// data types are replaced with empty data in h.  The event supportability
+// metrics are recorded in h's metrics table when the events are removed, so
+// the events should be taken no later than the metrics.
+func (h *Harvest) Ready(types HarvestTypes, now time.Time) *Harvest {
+	ready := &Harvest{config: h.config}
+
+	if 0 != types&HarvestCustomEvents {
+		h.Metrics.addCount(customEventsSeen, h.CustomEvents.numSeen(), forced)
+		h.Metrics.addCount(customEventsSent, h.CustomEvents.numSaved(), forced)
+		ready.CustomEvents = h.CustomEvents
+		h.CustomEvents = newCustomEvents(h.config.MaxCustomEvents)
+	}
+	if 0 != types&HarvestTxnEvents {
+		h.Metrics.addCount(txnEventsSeen, h.TxnEvents.numSeen(), forced)
+		h.Metrics.addCount(txnEventsSent, h.TxnEvents.numSaved(), forced)
+		ready.TxnEvents = h.TxnEvents
+		h.TxnEvents = newTxnEvents(h.config.MaxTxnEvents)
+	}
+	if 0 != types&HarvestErrorEvents {
+		h.Metrics.addCount(errorEventsSeen, h.ErrorEvents.numSeen(), forced)
+		h.Metrics.addCount(errorEventsSent, h.ErrorEvents.numSaved(), forced)
+		ready.ErrorEvents = h.ErrorEvents
+		h.ErrorEvents = newErrorEvents(h.config.MaxErrorEvents)
+	}
+	if 0 != types&HarvestSpanEvents {
+		h.Metrics.addCount(spanEventsSeen, h.SpanEvents.numSeen(), forced)
+		h.Metrics.addCount(spanEventsSent, h.SpanEvents.numSaved(), forced)
+		ready.SpanEvents = h.SpanEvents
+		h.SpanEvents = newSpanEvents(h.config.MaxSpanEvents)
+	}
+	if 0 != types&HarvestMetricsTraces {
+		ready.Metrics = h.Metrics
+		ready.ErrorTraces = h.ErrorTraces
+		ready.TxnTraces = h.TxnTraces
+		ready.SlowSQLs = h.SlowSQLs
+		ready.Profiles = h.Profiles
+		h.Metrics = newMetricTable(maxMetrics, now)
+		h.ErrorTraces = newHarvestErrors(maxHarvestErrors)
+		h.TxnTraces = newHarvestTraces()
+		h.SlowSQLs = newSlowQueries(maxHarvestSlowSQLs)
+		h.Profiles = nil
+	}
+	return ready
+}
+
 // Payloads returns a map from expected collector method name to data type.
+// Data types which are not present in the harvest are omitted.
 func (h *Harvest) Payloads(splitLargeTxnEvents bool) []PayloadCreator {
-	ps := []PayloadCreator{
-		h.Metrics,
-		h.CustomEvents,
-		h.ErrorEvents,
-		h.ErrorTraces,
-		h.TxnTraces,
-		h.SlowSQLs,
-		h.SpanEvents,
-	}
-	if splitLargeTxnEvents {
-		ps = append(ps, h.TxnEvents.payloads(txnEventPayloadlimit)...)
-	} else {
-		ps = append(ps, h.TxnEvents)
+	var ps []PayloadCreator
+	if nil != h.Metrics {
+		ps = append(ps, h.Metrics)
+	}
+	if nil != h.CustomEvents {
+		ps = append(ps, h.CustomEvents)
+	}
+	if nil != h.ErrorEvents {
+		ps = append(ps, h.ErrorEvents)
+	}
+	if nil != h.ErrorTraces {
+		ps = append(ps, h.ErrorTraces)
+	}
+	if nil != h.TxnTraces {
+		ps = append(ps, h.TxnTraces)
+	}
+	if nil != h.SlowSQLs {
+		ps = append(ps, h.SlowSQLs)
+	}
+	if nil != h.SpanEvents {
+		ps = append(ps, h.SpanEvents)
+	}
+	if len(h.Profiles) > 0 {
+		ps = append(ps, h.Profiles)
+	}
+	if nil != h.TxnEvents {
+		if splitLargeTxnEvents {
+			ps = append(ps, h.TxnEvents.payloads(txnEventPayloadlimit)...)
+		} else {
+			ps = append(ps, h.TxnEvents)
+		}
 	}
 	return ps
 }
 
 // NewHarvest returns a new Harvest.
-func NewHarvest(now time.Time) *Harvest {
+func NewHarvest(now time.Time, config HarvestConfig) *Harvest {
 	return &Harvest{
+		config:       config,
 		Metrics:      newMetricTable(maxMetrics, now),
-		CustomEvents: newCustomEvents(maxCustomEvents),
-		TxnEvents:    newTxnEvents(maxTxnEvents),
-		ErrorEvents:  newErrorEvents(maxErrorEvents),
+		CustomEvents: newCustomEvents(config.MaxCustomEvents),
+		TxnEvents:    newTxnEvents(config.MaxTxnEvents),
+		ErrorEvents:  newErrorEvents(config.MaxErrorEvents),
 		ErrorTraces:  newHarvestErrors(maxHarvestErrors),
 		TxnTraces:    newHarvestTraces(),
 		SlowSQLs:     newSlowQueries(maxHarvestSlowSQLs),
-		SpanEvents:   newSpanEvents(maxSpanEvents),
+		SpanEvents:   newSpanEvents(config.MaxSpanEvents),
 	}
 }
 
@@ -85,22 +200,15 @@ func createTrackUsageMetrics(metrics *metricTable) {
 	}
 }
 
-// CreateFinalMetrics creates extra metrics at harvest time.
+// CreateFinalMetrics creates extra metrics at harvest time.  The event
+// supportability metrics are created by Ready.  Nothing is done if the harvest
+// does not contain metrics.
 func (h *Harvest) CreateFinalMetrics() {
+	if nil == h.Metrics {
+		return
+	}
 	h.Metrics.addSingleCount(instanceReporting, forced)
 
-	h.Metrics.addCount(customEventsSeen, h.CustomEvents.numSeen(), forced)
-	h.Metrics.addCount(customEventsSent, h.CustomEvents.numSaved(), forced)
-
-	h.Metrics.addCount(txnEventsSeen, h.TxnEvents.numSeen(), forced)
-	h.Metrics.addCount(txnEventsSent, h.TxnEvents.numSaved(), forced)
-
-	h.Metrics.addCount(errorEventsSeen, h.ErrorEvents.numSeen(), forced)
-	h.Metrics.addCount(errorEventsSent, h.ErrorEvents.numSaved(), forced)
-
-	h.Metrics.addCount(spanEventsSeen, h.SpanEvents.numSeen(), forced)
-	h.Metrics.addCount(spanEventsSent, h.SpanEvents.numSaved(), forced)
-
 	if h.Metrics.numDropped > 0 {
 		h.Metrics.addCount(supportabilityDropped, float64(h.Metrics.numDropped), forced)
 	}
@@ -145,14 +253,20 @@ func CreateTxnMetrics(args *TxnData, metrics *metricTable) {
 	if cat := args.BetterCAT; cat.Enabled {
 		caller := callerUnknown
 		if nil != cat.Inbound {
-			caller = cat.Inbound.payloadCaller
+			if cat.Inbound.HasNewRelicTraceInfo {
+				caller = cat.Inbound.payloadCaller
+			} else {
+				// W3C trace context without a trusted New Relic entry
+				// still carries the transport type.
+				caller.TransportType = cat.Inbound.TransportType
+			}
 		}
 		m := durationByCallerMetric(caller)
 		metrics.addDuration(m.all, "", args.Duration, args.Duration, unforced)
 		metrics.addDuration(m.webOrOther(args.IsWeb), "", args.Duration, args.Duration, unforced)
 
 		// Transport Duration Metric
-		if nil != cat.Inbound {
+		if nil != cat.Inbound && cat.Inbound.HasNewRelicTraceInfo {
 			d := cat.Inbound.TransportDuration
 			m = transportDurationMetric(caller)
 			metrics.addDuration(m.all, "", d, d, unforced)
@@ -176,6 +290,11 @@ func CreateTxnMetrics(args *TxnData, metrics *metricTable) {
 		supportMetric(metrics, args.AcceptPayloadNullPayload, supportTracingAcceptNull)
 		supportMetric(metrics, args.CreatePayloadSuccess, supportTracingCreatePayloadSuccess)
 		supportMetric(metrics, args.CreatePayloadException, supportTracingCreatePayloadException)
+		supportMetric(metrics, args.TraceContextAcceptSuccess, supportTraceContextAcceptSuccess)
+		supportMetric(metrics, args.TraceContextParentParseException, supportTraceContextParentParseException)
+		supportMetric(metrics, args.TraceContextStateNoNrEntry, supportTraceContextStateNoNrEntry)
+		supportMetric(metrics, args.TraceContextStateInvalidNrEntry, supportTraceContextStateInvalidNrEntry)
+		supportMetric(metrics, args.TraceContextCreateSuccess, supportTraceContextCreateSuccess)
 	}
 
 	// Apdex Metrics
@@ -192,6 +311,9 @@ func CreateTxnMetrics(args *TxnData, metrics *metricTable) {
 		metrics.addSingleCount(errorsRollupMetric.webOrOther(args.IsWeb), forced)
 		metrics.addSingleCount(errorsPrefix+args.FinalName, forced)
 	}
+	if args.HasExpectedErrors() {
+		metrics.addSingleCount(expectedErrorsRollup, forced)
+	}
 
 	// Queueing Metrics
 	if args.Queuing > 0 {
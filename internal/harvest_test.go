@@ -8,9 +8,10 @@ import (
 func TestCreateFinalMetrics(t *testing.T) {
 	now := time.Now()
 
-	h := NewHarvest(now)
-	h.CreateFinalMetrics()
-	ExpectMetrics(t, h.Metrics, []WantMetric{
+	h := NewHarvest(now, DefaultHarvestConfig)
+	ready := h.Ready(HarvestTypesAll, now)
+	ready.CreateFinalMetrics()
+	ExpectMetrics(t, ready.Metrics, []WantMetric{
 		{instanceReporting, "", true, []float64{1, 0, 0, 0, 0, 0}},
 		{customEventsSeen, "", true, []float64{0, 0, 0, 0, 0, 0}},
 		{customEventsSent, "", true, []float64{0, 0, 0, 0, 0, 0}},
@@ -22,7 +23,7 @@ func TestCreateFinalMetrics(t *testing.T) {
 		{spanEventsSent, "", true, []float64{0, 0, 0, 0, 0, 0}},
 	})
 
-	h = NewHarvest(now)
+	h = NewHarvest(now, DefaultHarvestConfig)
 	h.Metrics = newMetricTable(0, now)
 	h.CustomEvents = newCustomEvents(1)
 	h.TxnEvents = newTxnEvents(1)
@@ -48,8 +49,9 @@ func TestCreateFinalMetrics(t *testing.T) {
 	h.ErrorEvents.Add(&ErrorEvent{}, 0)
 	h.ErrorEvents.Add(&ErrorEvent{}, 0)
 
-	h.CreateFinalMetrics()
-	ExpectMetrics(t, h.Metrics, []WantMetric{
+	ready = h.Ready(HarvestTypesAll, now)
+	ready.CreateFinalMetrics()
+	ExpectMetrics(t, ready.Metrics, []WantMetric{
 		{instanceReporting, "", true, []float64{1, 0, 0, 0, 0, 0}},
 		{customEventsSeen, "", true, []float64{2, 0, 0, 0, 0, 0}},
 		{customEventsSent, "", true, []float64{1, 0, 0, 0, 0, 0}},
@@ -63,8 +65,66 @@ func TestCreateFinalMetrics(t *testing.T) {
 	})
 }
 
+func TestHarvestReadyEvents(t *testing.T) {
+	now := time.Now()
+	h := NewHarvest(now, DefaultHarvestConfig)
+	customE, err := CreateCustomEvent("my event type", map[string]interface{}{"zip": 1}, now)
+	if nil != err {
+		t.Fatal(err)
+	}
+	h.CustomEvents.Add(customE)
+	h.Metrics.addSingleCount("my metric", unforced)
+
+	ready := h.Ready(HarvestCustomEvents, now)
+	if nil != ready.Metrics || nil != ready.TxnEvents || nil != ready.ErrorEvents ||
+		nil != ready.SpanEvents || nil != ready.ErrorTraces ||
+		nil != ready.TxnTraces || nil != ready.SlowSQLs {
+		t.Error("only custom events should be ready", ready)
+	}
+	if ps := ready.Payloads(true); len(ps) != 1 {
+		t.Error(len(ps))
+	}
+	ExpectCustomEvents(t, ready.CustomEvents, []WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"type":      "my event type",
+			"timestamp": MatchAnything,
+		},
+		UserAttributes: map[string]interface{}{"zip": 1},
+	}})
+	ExpectCustomEvents(t, h.CustomEvents, []WantEvent{})
+	if c := cap(h.CustomEvents.events.events); c != MaxCustomEvents {
+		t.Error(c)
+	}
+	// The custom event supportability metrics are recorded in the
+	// remaining harvest.
+	ExpectMetrics(t, h.Metrics, []WantMetric{
+		{"my metric", "", false, []float64{1, 0, 0, 0, 0, 0}},
+		{customEventsSeen, "", true, []float64{1, 0, 0, 0, 0, 0}},
+		{customEventsSent, "", true, []float64{1, 0, 0, 0, 0, 0}},
+	})
+}
+
+func TestHarvestConfigLimits(t *testing.T) {
+	cfg := DefaultHarvestConfig
+	cfg.MaxCustomEvents = 20
+	cfg.MaxTxnEvents = 0
+	h := NewHarvest(time.Now(), cfg)
+	if c := cap(h.CustomEvents.events.events); c != 20 {
+		t.Error(c)
+	}
+	// Events should be dropped rather than panic when the reservoir size
+	// is zero.
+	h.TxnEvents.AddTxnEvent(&TxnEvent{}, 0)
+	if n := h.TxnEvents.numSeen(); n != 1 {
+		t.Error(n)
+	}
+	if n := h.TxnEvents.numSaved(); n != 0 {
+		t.Error(n)
+	}
+}
+
 func TestEmptyPayloads(t *testing.T) {
-	h := NewHarvest(time.Now())
+	h := NewHarvest(time.Now(), DefaultHarvestConfig)
 	payloads := h.Payloads(true)
 	for _, p := range payloads {
 		d, err := p.Data("agentRunID", time.Now())
@@ -78,7 +138,7 @@ func TestMergeFailedHarvest(t *testing.T) {
 	start1 := time.Now()
 	start2 := start1.Add(1 * time.Minute)
 
-	h := NewHarvest(start1)
+	h := NewHarvest(start1, DefaultHarvestConfig)
 	h.Metrics.addCount("zip", 1, forced)
 	h.TxnEvents.AddTxnEvent(&TxnEvent{
 		FinalName: "finalName",
@@ -176,7 +236,7 @@ func TestMergeFailedHarvest(t *testing.T) {
 		Caller:  "internal.TestMergeFailedHarvest",
 	}})
 
-	nextHarvest := NewHarvest(start2)
+	nextHarvest := NewHarvest(start2, DefaultHarvestConfig)
 	if start2 != nextHarvest.Metrics.metricPeriodStart {
 		t.Error(nextHarvest.Metrics.metricPeriodStart)
 	}
@@ -325,8 +385,8 @@ func TestCreateTxnMetrics(t *testing.T) {
 
 func TestHarvestSplitTxnEvents(t *testing.T) {
 	now := time.Now()
-	h := NewHarvest(now)
-	for i := 0; i < maxTxnEvents; i++ {
+	h := NewHarvest(now, DefaultHarvestConfig)
+	for i := 0; i < MaxTxnEvents; i++ {
 		h.TxnEvents.AddTxnEvent(&TxnEvent{}, Priority(float32(i)))
 	}
 
@@ -410,3 +470,27 @@ func TestCreateTxnMetricsOldCAT(t *testing.T) {
 		{backgroundRollup, "", true, []float64{1, 123, 109, 123, 123, 123 * 123}},
 	})
 }
+
+func TestHarvestReadyProfiles(t *testing.T) {
+	now := time.Now()
+	h := NewHarvest(now, DefaultHarvestConfig)
+	harvestProfiles{{id: 1, start: now, stop: now}}.MergeIntoHarvest(h)
+
+	ready := h.Ready(HarvestTypesEvents, now)
+	if nil != ready.Profiles {
+		t.Error(ready.Profiles)
+	}
+	ready = h.Ready(HarvestMetricsTraces, now)
+	if len(ready.Profiles) != 1 || nil != h.Profiles {
+		t.Error(ready.Profiles, h.Profiles)
+	}
+	var found bool
+	for _, p := range ready.Payloads(false) {
+		if p.EndpointMethod() == "profile_data" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("profile payload missing")
+	}
+}
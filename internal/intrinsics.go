@@ -14,7 +14,11 @@ func intrinsicsJSON(e *TxnEvent, buf *bytes.Buffer) {
 	w := jsonFieldsWriter{buf: buf}
 
 	buf.WriteByte('{')
+	writeIntrinsics(e, &w)
+	buf.WriteByte('}')
+}
 
+func writeIntrinsics(e *TxnEvent, w *jsonFieldsWriter) {
 	if e.BetterCAT.Enabled {
 		w.stringField("guid", e.BetterCAT.ID)
 		w.stringField("traceId", e.BetterCAT.TraceID())
@@ -23,17 +27,15 @@ func intrinsicsJSON(e *TxnEvent, buf *bytes.Buffer) {
 	}
 
 	if e.CrossProcess.Used() {
-		addOptionalStringField(&w, "client_cross_process_id", e.CrossProcess.ClientID)
-		addOptionalStringField(&w, "trip_id", e.CrossProcess.TripID)
-		addOptionalStringField(&w, "path_hash", e.CrossProcess.PathHash)
-		addOptionalStringField(&w, "referring_transaction_guid", e.CrossProcess.ReferringTxnGUID)
+		addOptionalStringField(w, "client_cross_process_id", e.CrossProcess.ClientID)
+		addOptionalStringField(w, "trip_id", e.CrossProcess.TripID)
+		addOptionalStringField(w, "path_hash", e.CrossProcess.PathHash)
+		addOptionalStringField(w, "referring_transaction_guid", e.CrossProcess.ReferringTxnGUID)
 	}
 
 	if e.CrossProcess.IsSynthetics() {
-		addOptionalStringField(&w, "synthetics_resource_id", e.CrossProcess.Synthetics.ResourceID)
-		addOptionalStringField(&w, "synthetics_job_id", e.CrossProcess.Synthetics.JobID)
-		addOptionalStringField(&w, "synthetics_monitor_id", e.CrossProcess.Synthetics.MonitorID)
+		addOptionalStringField(w, "synthetics_resource_id", e.CrossProcess.Synthetics.ResourceID)
+		addOptionalStringField(w, "synthetics_job_id", e.CrossProcess.Synthetics.JobID)
+		addOptionalStringField(w, "synthetics_monitor_id", e.CrossProcess.Synthetics.MonitorID)
 	}
-
-	buf.WriteByte('}')
 }
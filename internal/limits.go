@@ -34,14 +34,38 @@ const (
 
 	// harvest data
 	maxMetrics          = 2 * 1000
-	maxCustomEvents     = 10 * 1000
-	maxTxnEvents        = 10 * 1000
 	maxRegularTraces    = 1
 	maxSyntheticsTraces = 20
-	maxErrorEvents      = 100
 	maxHarvestErrors    = 20
 	maxHarvestSlowSQLs  = 10
-	maxSpanEvents       = 1000
+
+	// MaxTxnEvents is the default transaction event reservoir size.
+	MaxTxnEvents = 10 * 1000
+	// MaxCustomEvents is the default custom event reservoir size.
+	MaxCustomEvents = 10 * 1000
+	// MaxErrorEvents is the default error event reservoir size.
+	MaxErrorEvents = 100
+	// MaxSpanEvents is the default span event reservoir size.
+	MaxSpanEvents = 1000
+
+	// TraceObserverQueueSize is the default number of span events queued
+	// for the trace observer.
+	TraceObserverQueueSize = 10 * 1000
+	// TraceObserverShutdownTimeout limits the time spent sending queued
+	// span events to the trace observer when the application shuts down.
+	TraceObserverShutdownTimeout = 5 * time.Second
+	// The wait after a trace observer connect or stream failure is doubled
+	// until traceObserverBackoffLimit is reached.
+	traceObserverBackoffStart = 15 * time.Second
+	traceObserverBackoffLimit = 300 * time.Second
+
+	// The profiler samples goroutines every profilerDefaultSamplePeriod
+	// unless the start_profiler command requests a different period, which
+	// may not be less than profilerMinSamplePeriod.  The call tree is
+	// limited to profilerMaxNodes nodes.
+	profilerDefaultSamplePeriod = 100 * time.Millisecond
+	profilerMinSamplePeriod     = 10 * time.Millisecond
+	profilerMaxNodes            = 20 * 1000
 
 	// attributes
 	attributeKeyLengthLimit   = 255
@@ -53,6 +77,12 @@ const (
 	attributeAgentLimit       = 255 - (attributeUserLimit + AttributeErrorLimit)
 	customEventAttributeLimit = 64
 
+	// ErrorChainLimit limits the number of wrapped errors examined when
+	// noticing an error, and ErrorChainByteLimit limits the length of the
+	// error chain attribute.
+	ErrorChainLimit     = 20
+	ErrorChainByteLimit = 4096
+
 	// Limits affecting Config validation are found in the config package.
 
 	// RuntimeSamplerPeriod is the period of the runtime sampler.  Runtime
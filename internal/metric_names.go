@@ -9,6 +9,10 @@ const (
 
 	errorsPrefix = "Errors/"
 
+	// expectedErrorsRollup counts the transactions with expected errors.
+	// Expected errors are excluded from the Errors/ metrics.
+	expectedErrorsRollup = "ErrorsExpected/all"
+
 	// "HttpDispatcher" metric is used for the overview graph, and
 	// therefore should only be made for web transactions.
 	dispatcherMetric = "HttpDispatcher"
@@ -18,6 +22,9 @@ const (
 	webMetricPrefix        = "WebTransaction/Go"
 	backgroundMetricPrefix = "OtherTransaction/Go"
 
+	// MessageMetricPrefix is the prefix of message consumer transactions.
+	MessageMetricPrefix = "OtherTransaction/Message"
+
 	instanceReporting = "Instance/Reporting"
 
 	// https://newrelic.atlassian.net/wiki/display/eng/Custom+Events+in+New+Relic+Agents
@@ -38,6 +45,21 @@ const (
 
 	supportabilityDropped = "Supportability/MetricsDropped"
 
+	// Infinite Tracing Supportability Metrics
+	traceObserverSpansSeen     = "Supportability/InfiniteTracing/Span/Seen"
+	traceObserverSpansSent     = "Supportability/InfiniteTracing/Span/Sent"
+	traceObserverQueueDumped   = "Supportability/InfiniteTracing/Span/AgentQueueDumped"
+	traceObserverResponseError = "Supportability/InfiniteTracing/Span/Response/Error"
+
+	// Spool Supportability Metrics
+	spoolSpooledBytes   = "Supportability/Go/Spool/Spooled/Bytes"
+	spoolReplayedBytes  = "Supportability/Go/Spool/Replayed/Bytes"
+	spoolDiscardedBytes = "Supportability/Go/Spool/Discarded/Bytes"
+
+	// txnNamesLimitedPrefix is followed by the prefix of the transaction
+	// names which were collapsed by the TxnNameLimiter.
+	txnNamesLimitedPrefix = "Supportability/Go/TransactionNames/Limited/"
+
 	// Runtime/System Metrics
 	memoryPhysical       = "Memory/Physical"
 	heapObjectsAllocated = "Memory/Heap/AllocatedObjects"
@@ -60,6 +82,13 @@ const (
 	supportTracingAcceptNull             = "Supportability/DistributedTrace/AcceptPayload/Ignored/Null"
 	supportTracingCreatePayloadSuccess   = "Supportability/DistributedTrace/CreatePayload/Success"
 	supportTracingCreatePayloadException = "Supportability/DistributedTrace/CreatePayload/Exception"
+
+	// W3C Trace Context Supportability Metrics
+	supportTraceContextAcceptSuccess        = "Supportability/TraceContext/Accept/Success"
+	supportTraceContextParentParseException = "Supportability/TraceContext/TraceParent/Parse/Exception"
+	supportTraceContextStateNoNrEntry       = "Supportability/TraceContext/TraceState/NoNrEntry"
+	supportTraceContextStateInvalidNrEntry  = "Supportability/TraceContext/TraceState/InvalidNrEntry"
+	supportTraceContextCreateSuccess        = "Supportability/TraceContext/Create/Success"
 )
 
 // DistributedTracingSupport is used to track distributed tracing activity for
@@ -75,6 +104,12 @@ type DistributedTracingSupport struct {
 	AcceptPayloadNullPayload        bool // AcceptPayload was ignored because the payload was nil
 	CreatePayloadSuccess            bool // CreatePayload was called successfully
 	CreatePayloadException          bool // CreatePayload had a generic exception
+
+	TraceContextAcceptSuccess        bool // W3C trace context headers were accepted
+	TraceContextParentParseException bool // the traceparent header could not be parsed
+	TraceContextStateNoNrEntry       bool // the tracestate header had no trusted New Relic entry
+	TraceContextStateInvalidNrEntry  bool // the trusted New Relic tracestate entry was invalid
+	TraceContextCreateSuccess        bool // W3C trace context headers were created
 }
 
 type rollupMetric struct {
@@ -153,6 +188,47 @@ type DatastoreMetricKey struct {
 	PortPathOrID string
 }
 
+// MessageMetricKey contains the fields by which message producer metrics are
+// aggregated.
+type MessageMetricKey struct {
+	Library         string
+	DestinationType string
+	DestinationName string
+	DestinationTemp bool
+}
+
+// destination returns "{library}/{destinationType}/{action}/Named/{destinationName}",
+// or "{library}/{destinationType}/{action}/Temp" for temporary destinations.
+// The action is omitted if empty.
+func (key MessageMetricKey) destination(action string) string {
+	library := key.Library
+	if "" == library {
+		library = "Unknown"
+	}
+	destType := key.DestinationType
+	if "" == destType {
+		destType = "Unknown"
+	}
+	name := library + "/" + destType + "/"
+	if "" != action {
+		name += action + "/"
+	}
+	if key.DestinationTemp {
+		return name + "Temp"
+	}
+	if "" == key.DestinationName {
+		return name + "Named/Unknown"
+	}
+	return name + "Named/" + key.DestinationName
+}
+
+// TxnName returns the name given to message consumer transactions, without
+// the MessageMetricPrefix:
+// {library}/{destinationType}/Named/{destinationName}
+func (key MessageMetricKey) TxnName() string {
+	return key.destination("")
+}
+
 type externalMetricKey struct {
 	Host                    string
 	ExternalCrossProcessID  string
@@ -235,3 +311,9 @@ func errorsByCallerMetric(c payloadCaller) rollupMetric {
 func transportDurationMetric(c payloadCaller) rollupMetric {
 	return newRollupMetric("TransportDuration" + callerFields(c))
 }
+
+// MessageBroker/{library}/{destinationType}/Produce/Named/{destinationName}
+// MessageBroker/{library}/{destinationType}/Produce/Temp
+func messageProduceMetric(key MessageMetricKey) string {
+	return "MessageBroker/" + key.destination("Produce")
+}
@@ -2,6 +2,8 @@ package internal
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"regexp"
 	"sort"
 	"strings"
@@ -56,8 +58,7 @@ func (rules *metricRules) UnmarshalJSON(data []byte) (err error) {
 	valid := make(metricRules, 0, len(raw))
 
 	for _, r := range raw {
-		re, err := regexp.Compile("(?i)" + r.RawExpr)
-		if err != nil {
+		if err := r.compile(); nil != err {
 			// TODO
 			// Warn("unable to compile rule", {
 			// 	"match_expression": r.RawExpr,
@@ -65,19 +66,6 @@ func (rules *metricRules) UnmarshalJSON(data []byte) (err error) {
 			// })
 			continue
 		}
-
-		if transformReplacementAmbiguous.MatchString(r.OriginalReplacement) {
-			// TODO
-			// Warn("unable to transform replacement", {
-			// 	"match_expression": r.RawExpr,
-			// 	"replacement":      r.OriginalReplacement,
-			// })
-			continue
-		}
-
-		r.re = re
-		r.TransformedReplacement = transformReplacementRegex.ReplaceAllString(r.OriginalReplacement,
-			transformReplacementReplacement)
 		valid = append(valid, r)
 	}
 
@@ -87,6 +75,64 @@ func (rules *metricRules) UnmarshalJSON(data []byte) (err error) {
 	return nil
 }
 
+var errAmbiguousReplacement = errors.New("ambiguous replacement backreference")
+
+// compile prepares the rule's expression and replacement.
+func (r *metricRule) compile() error {
+	re, err := regexp.Compile("(?i)" + r.RawExpr)
+	if nil != err {
+		return err
+	}
+	if transformReplacementAmbiguous.MatchString(r.OriginalReplacement) {
+		return errAmbiguousReplacement
+	}
+	r.re = re
+	r.TransformedReplacement = transformReplacementRegex.ReplaceAllString(r.OriginalReplacement,
+		transformReplacementReplacement)
+	return nil
+}
+
+// LocalRule is a transaction name rule configured by the user rather than
+// sent by the collector.  The fields have the same meaning as the fields of
+// the collector's "transaction_name_rules".
+type LocalRule struct {
+	MatchExpression string
+	Replacement     string
+	Ignore          bool
+	EachSegment     bool
+	ReplaceAll      bool
+	TerminateChain  bool
+	EvalOrder       int
+}
+
+func compileLocalRules(input []LocalRule) (metricRules, error) {
+	rules := make(metricRules, 0, len(input))
+	for _, in := range input {
+		r := &metricRule{
+			Ignore:              in.Ignore,
+			EachSegment:         in.EachSegment,
+			ReplaceAll:          in.ReplaceAll,
+			Terminate:           in.TerminateChain,
+			Order:               in.EvalOrder,
+			OriginalReplacement: in.Replacement,
+			RawExpr:             in.MatchExpression,
+		}
+		if err := r.compile(); nil != err {
+			return nil, fmt.Errorf("invalid rule %q: %v", in.MatchExpression, err)
+		}
+		rules = append(rules, r)
+	}
+	sort.Stable(rules)
+	return rules, nil
+}
+
+// ValidateLocalRules returns an error if any of the rules has an invalid
+// expression or replacement.
+func ValidateLocalRules(rules []LocalRule) error {
+	_, err := compileLocalRules(rules)
+	return err
+}
+
 func (rules metricRules) Len() int {
 	return len(rules)
 }
@@ -94,3 +94,18 @@ func TestBadMetricRulesJSON(t *testing.T) {
 		t.Fatal("missing bad json error")
 	}
 }
+
+func TestValidateLocalRules(t *testing.T) {
+	if err := ValidateLocalRules(nil); nil != err {
+		t.Error(err)
+	}
+	if err := ValidateLocalRules([]LocalRule{{MatchExpression: "^/users/[0-9]+$", Replacement: `/users/\1`}}); nil != err {
+		t.Error(err)
+	}
+	if err := ValidateLocalRules([]LocalRule{{MatchExpression: "["}}); nil == err {
+		t.Error("invalid expression accepted")
+	}
+	if err := ValidateLocalRules([]LocalRule{{MatchExpression: "a", Replacement: `\\1`}}); nil == err {
+		t.Error("ambiguous replacement accepted")
+	}
+}
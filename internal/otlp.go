@@ -0,0 +1,481 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OTLPResource describes the application in OTLP requests.
+type OTLPResource struct {
+	ServiceName  string
+	AgentVersion string
+}
+
+const (
+	// OTLPTracesPath, OTLPLogsPath, and OTLPMetricsPath are the OTLP/HTTP
+	// paths relative to the endpoint.
+	OTLPTracesPath  = "/v1/traces"
+	OTLPLogsPath    = "/v1/logs"
+	OTLPMetricsPath = "/v1/metrics"
+
+	otlpScopeName = "github.com/newrelic/go-agent"
+
+	// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+	otlpSpanKindInternal = 1
+	otlpSpanKindServer   = 2
+	otlpSpanKindClient   = 3
+	otlpStatusCodeError  = 2
+
+	// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/logs/v1/logs.proto
+	otlpSeverityNumberError = 17
+)
+
+var errOTLPPayload = errors.New("unexpected payload format")
+
+// otlpAttributeNames maps New Relic attribute names to OpenTelemetry semantic
+// convention names.
+var otlpAttributeNames = map[string]string{
+	"request.method":             "http.method",
+	"request.uri":                "http.target",
+	"request.headers.host":       "http.host",
+	"request.headers.User-Agent": "http.user_agent",
+	"httpResponseCode":           "http.status_code",
+	"db.instance":                "db.name",
+	"peer.hostname":              "net.peer.name",
+	"error.class":                "exception.type",
+	"error.message":              "exception.message",
+}
+
+// OTLPRequest translates a harvest payload into the protobuf body of an
+// OTLP/HTTP request.  Span events become spans, transaction, error, and
+// custom events become log records, and metrics become summaries.  The path
+// returned is relative to the OTLP endpoint, and is empty if the payload has
+// no OTLP equivalent.
+func OTLPRequest(cmd string, data []byte, res OTLPResource) (string, []byte, error) {
+	switch cmd {
+	case cmdSpanEvents:
+		body, err := otlpTraces(data, res)
+		return OTLPTracesPath, body, err
+	case cmdTxnEvents, cmdErrorEvents, cmdCustomEvents:
+		body, err := otlpLogs(data, res)
+		return OTLPLogsPath, body, err
+	case cmdMetrics:
+		body, err := otlpMetrics(data, res)
+		return OTLPMetricsPath, body, err
+	}
+	return "", nil, nil
+}
+
+func decodeJSONNumbers(data []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+// otlpEvent is an event from an event payload.
+type otlpEvent struct {
+	intrinsics map[string]interface{}
+	user       map[string]interface{}
+	agent      map[string]interface{}
+}
+
+// parseEventPayload parses payloads with the format
+// [runID, {"reservoir_size":N,"events_seen":M}, [[intrinsics, user, agent]]].
+func parseEventPayload(data []byte) ([]otlpEvent, error) {
+	var payload []json.RawMessage
+	if err := json.Unmarshal(data, &payload); nil != err {
+		return nil, err
+	}
+	if len(payload) != 3 {
+		return nil, errOTLPPayload
+	}
+	var raw [][]map[string]interface{}
+	if err := decodeJSONNumbers(payload[2], &raw); nil != err {
+		return nil, err
+	}
+	events := make([]otlpEvent, 0, len(raw))
+	for _, r := range raw {
+		if len(r) != 3 {
+			return nil, errOTLPPayload
+		}
+		events = append(events, otlpEvent{intrinsics: r[0], user: r[1], agent: r[2]})
+	}
+	return events, nil
+}
+
+// attributes merges the attributes of the event using semantic convention
+// names.  Intrinsics take precedence over agent attributes, which take
+// precedence over user attributes.
+func (e otlpEvent) attributes() map[string]interface{} {
+	attrs := make(map[string]interface{}, len(e.intrinsics)+len(e.user)+len(e.agent))
+	for _, m := range []map[string]interface{}{e.user, e.agent, e.intrinsics} {
+		for key, val := range m {
+			if name, ok := otlpAttributeNames[key]; ok {
+				key = name
+			}
+			attrs[key] = val
+		}
+	}
+	if code, ok := attrs["http.status_code"].(string); ok {
+		if i, err := strconv.Atoi(code); nil == err {
+			attrs["http.status_code"] = int64(i)
+		}
+	}
+	return attrs
+}
+
+func otlpNumber(v interface{}) float64 {
+	switch n := v.(type) {
+	case json.Number:
+		f, _ := n.Float64()
+		return f
+	case float64:
+		return n
+	case int64:
+		return float64(n)
+	}
+	return 0
+}
+
+func otlpString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func otlpSecondsToNanos(s float64) uint64 {
+	if s <= 0 {
+		return 0
+	}
+	return uint64(math.Floor(s*1e9 + 0.5))
+}
+
+// otlpID decodes a hex id, left padding it with zeros to the size required.
+// nil is returned if the id is invalid.
+func otlpID(id string, size int) []byte {
+	b, err := hex.DecodeString(id)
+	if nil != err || 0 == len(b) || len(b) > size {
+		return nil
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
+
+func writeOTLPValue(b *protoBuffer, v interface{}) {
+	switch val := v.(type) {
+	case string:
+		b.stringField(1, val)
+	case bool:
+		b.boolField(2, val)
+	case int64:
+		b.varintField(3, uint64(val))
+	case float64:
+		b.doubleField(4, val)
+	case json.Number:
+		if i, err := val.Int64(); nil == err {
+			b.varintField(3, uint64(i))
+		} else {
+			f, _ := val.Float64()
+			b.doubleField(4, f)
+		}
+	default:
+		js, _ := json.Marshal(val)
+		b.stringField(1, string(js))
+	}
+}
+
+// writeOTLPAttributes writes the attributes as repeated KeyValue messages.
+// Keys are sorted so that the output is deterministic.
+func writeOTLPAttributes(b *protoBuffer, field int, attrs map[string]interface{}) {
+	keys := make([]string, 0, len(attrs))
+	for key, val := range attrs {
+		if nil != val {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		val := attrs[key]
+		b.messageField(field, func(kv *protoBuffer) {
+			kv.stringField(1, key)
+			kv.messageField(2, func(v *protoBuffer) { writeOTLPValue(v, val) })
+		})
+	}
+}
+
+func writeOTLPResource(b *protoBuffer, res OTLPResource) {
+	b.messageField(1, func(r *protoBuffer) {
+		writeOTLPAttributes(r, 1, map[string]interface{}{
+			"service.name":           res.ServiceName,
+			"telemetry.sdk.name":     "newrelic",
+			"telemetry.sdk.language": "go",
+			"telemetry.sdk.version":  res.AgentVersion,
+		})
+	})
+}
+
+func writeOTLPScope(b *protoBuffer, res OTLPResource) {
+	b.messageField(1, func(s *protoBuffer) {
+		s.stringField(1, otlpScopeName)
+		s.stringField(2, res.AgentVersion)
+	})
+}
+
+// writeOTLPData writes the resource message (ResourceSpans, ResourceLogs, or
+// ResourceMetrics) of an export request, and its single scope message.
+func writeOTLPData(res OTLPResource, fn func(scope *protoBuffer)) []byte {
+	var b protoBuffer
+	b.messageField(1, func(r *protoBuffer) {
+		writeOTLPResource(r, res)
+		r.messageField(2, func(s *protoBuffer) {
+			writeOTLPScope(s, res)
+			fn(s)
+		})
+	})
+	return b.buf
+}
+
+// spanAttributes returns the attributes of a span event.  Intrinsics which are
+// fields of the OTLP span are removed, and datastore and external intrinsics
+// are given semantic convention names.
+func (e otlpEvent) spanAttributes() map[string]interface{} {
+	attrs := e.attributes()
+	for _, key := range []string{"type", "traceId", "guid", "parentId",
+		"timestamp", "duration", "name", "span.kind", "nr.entryPoint",
+		"sampled", "priority", "trustedParentId", "tracingVendors"} {
+		delete(attrs, key)
+	}
+	if id, ok := attrs["transactionId"]; ok {
+		attrs["nr.transactionId"] = id
+		delete(attrs, "transactionId")
+	}
+	category := otlpString(attrs["category"])
+	delete(attrs, "category")
+	if "" != category {
+		attrs["nr.category"] = category
+	}
+	component := otlpString(attrs["component"])
+	delete(attrs, "component")
+	if spanCategoryDatastore == category && "" != component {
+		attrs["db.system"] = strings.ToLower(component)
+	}
+	if addr := otlpString(attrs["peer.address"]); "" != addr {
+		delete(attrs, "peer.address")
+		if _, port, err := net.SplitHostPort(addr); nil == err {
+			if p, err := strconv.Atoi(port); nil == err {
+				attrs["net.peer.port"] = int64(p)
+			}
+		}
+	}
+	return attrs
+}
+
+func otlpTraces(data []byte, res OTLPResource) ([]byte, error) {
+	events, err := parseEventPayload(data)
+	if nil != err {
+		return nil, err
+	}
+	return writeOTLPData(res, func(scope *protoBuffer) {
+		for _, e := range events {
+			traceID := otlpID(otlpString(e.intrinsics["traceId"]), 16)
+			spanID := otlpID(otlpString(e.intrinsics["guid"]), 8)
+			if nil == traceID || nil == spanID {
+				continue
+			}
+			scope.messageField(2, func(s *protoBuffer) {
+				writeOTLPSpan(s, e, traceID, spanID)
+			})
+		}
+	}), nil
+}
+
+func writeOTLPSpan(s *protoBuffer, e otlpEvent, traceID, spanID []byte) {
+	s.bytesField(1, traceID)
+	s.bytesField(2, spanID)
+	if parentID := otlpID(otlpString(e.intrinsics["parentId"]), 8); nil != parentID {
+		s.bytesField(4, parentID)
+	}
+	s.stringField(5, otlpString(e.intrinsics["name"]))
+
+	kind := otlpSpanKindInternal
+	if isEntry, _ := e.intrinsics["nr.entryPoint"].(bool); isEntry {
+		kind = otlpSpanKindServer
+	} else if "client" == otlpString(e.intrinsics["span.kind"]) {
+		kind = otlpSpanKindClient
+	}
+	s.varintField(6, uint64(kind))
+
+	// The span timestamp is in milliseconds and the duration in seconds.
+	start := otlpSecondsToNanos(otlpNumber(e.intrinsics["timestamp"]) / 1000)
+	s.fixed64Field(7, start)
+	s.fixed64Field(8, start+otlpSecondsToNanos(otlpNumber(e.intrinsics["duration"])))
+
+	attrs := e.spanAttributes()
+	writeOTLPAttributes(s, 9, attrs)
+	if class := otlpString(attrs["exception.type"]); "" != class {
+		s.messageField(15, func(st *protoBuffer) {
+			if msg := otlpString(attrs["exception.message"]); "" != msg {
+				st.stringField(2, msg)
+			}
+			st.varintField(3, otlpStatusCodeError)
+		})
+	}
+}
+
+func otlpLogs(data []byte, res OTLPResource) ([]byte, error) {
+	events, err := parseEventPayload(data)
+	if nil != err {
+		return nil, err
+	}
+	return writeOTLPData(res, func(scope *protoBuffer) {
+		for _, e := range events {
+			scope.messageField(2, func(l *protoBuffer) {
+				writeOTLPLogRecord(l, e)
+			})
+		}
+	}), nil
+}
+
+// writeOTLPLogRecord writes an event as a log record.  The event type is
+// recorded as the "event.name" attribute, and the timestamp, which is in
+// seconds, as the time of the record.
+func writeOTLPLogRecord(l *protoBuffer, e otlpEvent) {
+	l.fixed64Field(1, otlpSecondsToNanos(otlpNumber(e.intrinsics["timestamp"])))
+
+	attrs := e.attributes()
+	eventType := otlpString(attrs["type"])
+	delete(attrs, "type")
+	delete(attrs, "timestamp")
+	attrs["event.name"] = eventType
+
+	if "TransactionError" == eventType {
+		l.varintField(2, otlpSeverityNumberError)
+		l.stringField(3, "ERROR")
+		if msg := otlpString(attrs["exception.message"]); "" != msg {
+			l.messageField(5, func(v *protoBuffer) { writeOTLPValue(v, msg) })
+		}
+	}
+	writeOTLPAttributes(l, 6, attrs)
+	if traceID := otlpID(otlpString(e.intrinsics["traceId"]), 16); nil != traceID {
+		l.bytesField(9, traceID)
+	}
+}
+
+// otlpMetric is a metric from a metric payload.
+type otlpMetric struct {
+	Name  string `json:"name"`
+	Scope string `json:"scope"`
+	data  []float64
+}
+
+type otlpMetricsByScope []otlpMetric
+
+func (ms otlpMetricsByScope) Len() int           { return len(ms) }
+func (ms otlpMetricsByScope) Swap(i, j int)      { ms[i], ms[j] = ms[j], ms[i] }
+func (ms otlpMetricsByScope) Less(i, j int) bool { return ms[i].Scope < ms[j].Scope }
+
+// parseMetricPayload parses payloads with the format
+// [runID, start, end, [[{"name":N,"scope":S}, [count, total, exclusive, min, max, sumSquares]]]].
+func parseMetricPayload(data []byte) (start, end float64, metrics []otlpMetric, err error) {
+	var payload []json.RawMessage
+	if err = json.Unmarshal(data, &payload); nil != err {
+		return
+	}
+	if len(payload) != 4 {
+		err = errOTLPPayload
+		return
+	}
+	if err = json.Unmarshal(payload[1], &start); nil != err {
+		return
+	}
+	if err = json.Unmarshal(payload[2], &end); nil != err {
+		return
+	}
+	var raw [][]json.RawMessage
+	if err = json.Unmarshal(payload[3], &raw); nil != err {
+		return
+	}
+	for _, r := range raw {
+		var m otlpMetric
+		if len(r) != 2 {
+			err = errOTLPPayload
+			return
+		}
+		if err = json.Unmarshal(r[0], &m); nil != err {
+			return
+		}
+		if err = json.Unmarshal(r[1], &m.data); nil != err {
+			return
+		}
+		if len(m.data) != 6 {
+			err = errOTLPPayload
+			return
+		}
+		metrics = append(metrics, m)
+	}
+	return
+}
+
+// otlpMetrics translates the metrics into summaries with the count, the
+// total as the sum, and the min and max as the 0 and 1 quantiles.  Scoped
+// metrics have a "scope" attribute.  Apdex metrics are omitted since their
+// fields are counts of satisfied, tolerated, and frustrated transactions.
+func otlpMetrics(data []byte, res OTLPResource) ([]byte, error) {
+	start, end, metrics, err := parseMetricPayload(data)
+	if nil != err {
+		return nil, err
+	}
+	byName := make(map[string][]otlpMetric)
+	var names []string
+	for _, m := range metrics {
+		if strings.HasPrefix(m.Name, "Apdex") {
+			continue
+		}
+		if _, ok := byName[m.Name]; !ok {
+			names = append(names, m.Name)
+		}
+		byName[m.Name] = append(byName[m.Name], m)
+	}
+	sort.Strings(names)
+
+	return writeOTLPData(res, func(scope *protoBuffer) {
+		for _, name := range names {
+			points := byName[name]
+			sort.Sort(otlpMetricsByScope(points))
+			scope.messageField(2, func(m *protoBuffer) {
+				m.stringField(1, name)
+				m.messageField(11, func(summary *protoBuffer) {
+					for _, p := range points {
+						summary.messageField(1, func(dp *protoBuffer) {
+							writeOTLPSummaryDataPoint(dp, p, start, end)
+						})
+					}
+				})
+			})
+		}
+	}), nil
+}
+
+func writeOTLPSummaryDataPoint(dp *protoBuffer, m otlpMetric, start, end float64) {
+	dp.fixed64Field(2, otlpSecondsToNanos(start))
+	dp.fixed64Field(3, otlpSecondsToNanos(end))
+	dp.fixed64Field(4, uint64(m.data[0]))
+	dp.doubleField(5, m.data[1])
+	for i, q := range []float64{0, 1} {
+		val := m.data[3+i]
+		dp.messageField(6, func(vq *protoBuffer) {
+			vq.doubleField(1, q)
+			vq.doubleField(2, val)
+		})
+	}
+	if "" != m.Scope {
+		writeOTLPAttributes(dp, 7, map[string]interface{}{"scope": m.Scope})
+	}
+}
@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// protoBuffer encodes protocol buffer messages.  Only the wire types used by
+// OTLP are supported.  Fields with default values should be omitted by the
+// caller, except within a oneof.
+type protoBuffer struct {
+	buf []byte
+}
+
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+)
+
+func (b *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		b.buf = append(b.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	b.buf = append(b.buf, byte(v))
+}
+
+func (b *protoBuffer) key(field int, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b *protoBuffer) varintField(field int, v uint64) {
+	b.key(field, protoWireVarint)
+	b.varint(v)
+}
+
+func (b *protoBuffer) boolField(field int, v bool) {
+	var i uint64
+	if v {
+		i = 1
+	}
+	b.varintField(field, i)
+}
+
+func (b *protoBuffer) fixed64Field(field int, v uint64) {
+	b.key(field, protoWireFixed64)
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], v)
+	b.buf = append(b.buf, tmp[:]...)
+}
+
+func (b *protoBuffer) doubleField(field int, v float64) {
+	b.fixed64Field(field, math.Float64bits(v))
+}
+
+func (b *protoBuffer) bytesField(field int, v []byte) {
+	b.key(field, protoWireBytes)
+	b.varint(uint64(len(v)))
+	b.buf = append(b.buf, v...)
+}
+
+func (b *protoBuffer) stringField(field int, v string) {
+	b.key(field, protoWireBytes)
+	b.varint(uint64(len(v)))
+	b.buf = append(b.buf, v...)
+}
+
+// messageField encodes the embedded message written by fn.
+func (b *protoBuffer) messageField(field int, fn func(*protoBuffer)) {
+	var m protoBuffer
+	fn(&m)
+	b.bytesField(field, m.buf)
+}
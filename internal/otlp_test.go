@@ -0,0 +1,400 @@
+package internal
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// protoField is a decoded protocol buffer field.  Varint and fixed64 values
+// are stored in u, and length delimited values in b.
+type protoField struct {
+	num int
+	u   uint64
+	b   []byte
+}
+
+type protoMessage []protoField
+
+func protoVarint(t *testing.T, buf []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(buf) && i < 10; i++ {
+		v |= uint64(buf[i]&0x7f) << (7 * uint(i))
+		if buf[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	t.Fatal("invalid varint")
+	return 0, 0
+}
+
+func decodeProto(t *testing.T, buf []byte) protoMessage {
+	var m protoMessage
+	for len(buf) > 0 {
+		key, n := protoVarint(t, buf)
+		buf = buf[n:]
+		f := protoField{num: int(key >> 3)}
+		switch key & 7 {
+		case protoWireVarint:
+			f.u, n = protoVarint(t, buf)
+			buf = buf[n:]
+		case protoWireFixed64:
+			if len(buf) < 8 {
+				t.Fatal("truncated fixed64")
+			}
+			f.u = binary.LittleEndian.Uint64(buf)
+			buf = buf[8:]
+		case protoWireBytes:
+			size, n := protoVarint(t, buf)
+			buf = buf[n:]
+			if uint64(len(buf)) < size {
+				t.Fatal("truncated bytes")
+			}
+			f.b = buf[:size]
+			buf = buf[size:]
+		default:
+			t.Fatal("unexpected wire type", key&7)
+		}
+		m = append(m, f)
+	}
+	return m
+}
+
+func (m protoMessage) all(num int) []protoField {
+	var fs []protoField
+	for _, f := range m {
+		if f.num == num {
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
+
+func (m protoMessage) one(t *testing.T, num int) protoField {
+	fs := m.all(num)
+	if len(fs) != 1 {
+		t.Fatalf("field %d occurs %d times", num, len(fs))
+	}
+	return fs[0]
+}
+
+func (m protoMessage) message(t *testing.T, num int) protoMessage {
+	return decodeProto(t, m.one(t, num).b)
+}
+
+// decodeOTLPAttributes decodes the repeated KeyValue field num.
+func decodeOTLPAttributes(t *testing.T, m protoMessage, num int) map[string]interface{} {
+	attrs := make(map[string]interface{})
+	for _, f := range m.all(num) {
+		kv := decodeProto(t, f.b)
+		val := kv.message(t, 2)
+		if len(val) != 1 {
+			t.Fatal("invalid AnyValue", val)
+		}
+		var v interface{}
+		switch val[0].num {
+		case 1:
+			v = string(val[0].b)
+		case 2:
+			v = val[0].u == 1
+		case 3:
+			v = int64(val[0].u)
+		case 4:
+			v = math.Float64frombits(val[0].u)
+		}
+		attrs[string(kv.one(t, 1).b)] = v
+	}
+	return attrs
+}
+
+// decodeOTLPScope decodes an export request and returns the resource and the
+// scope message.
+func decodeOTLPScope(t *testing.T, body []byte) (map[string]interface{}, protoMessage) {
+	req := decodeProto(t, body)
+	rs := req.message(t, 1)
+	resource := decodeOTLPAttributes(t, rs.message(t, 1), 1)
+	scope := rs.message(t, 2)
+	s := scope.message(t, 1)
+	if name := string(s.one(t, 1).b); name != otlpScopeName {
+		t.Error(name)
+	}
+	return resource, scope
+}
+
+var testOTLPResource = OTLPResource{ServiceName: "my app", AgentVersion: "1.2.3"}
+
+func mustHex(s string) []byte {
+	b, _ := hex.DecodeString(s)
+	return b
+}
+
+func TestOTLPTraces(t *testing.T) {
+	events := newSpanEvents(10)
+	common := SpanEvent{
+		TraceID:       "0af7651916cd43dd8448eb211c80319c",
+		TransactionID: "txn",
+		Sampled:       true,
+		Priority:      0.5,
+	}
+	root := common
+	root.GUID = "00f067aa0ba902b7"
+	root.Timestamp = time.Unix(1000, 0)
+	root.Duration = 3 * time.Second
+	root.Name = "WebTransaction/Go/hello"
+	root.Category = spanCategoryGeneric
+	root.IsEntrypoint = true
+	events.addEventPopulated(&root)
+
+	datastore := common
+	datastore.GUID = "b7ad6b7169203331"
+	datastore.ParentID = "00f067aa0ba902b7"
+	datastore.Timestamp = time.Unix(1001, 0)
+	datastore.Duration = 500 * time.Millisecond
+	datastore.Name = "Datastore/statement/MySQL/users/select"
+	datastore.Category = spanCategoryDatastore
+	datastore.DatastoreExtras = &spanDatastoreExtras{
+		Component: "MySQL",
+		Statement: "SELECT * FROM users",
+		Instance:  "mydb",
+		Address:   "db.example.com:3306",
+		Hostname:  "db.example.com",
+	}
+	events.addEventPopulated(&datastore)
+
+	external := common
+	external.GUID = "c7ad6b7169203331"
+	external.ParentID = "00f067aa0ba902b7"
+	external.Timestamp = time.Unix(1002, 0)
+	external.Duration = time.Second
+	external.Name = "External/example.com/http/GET"
+	external.Category = spanCategoryHTTP
+	external.ExternalExtras = &spanExternalExtras{
+		URL:    "http://example.com/path",
+		Method: "GET",
+	}
+	events.addEventPopulated(&external)
+
+	invalid := common
+	invalid.GUID = "not hex"
+	events.addEventPopulated(&invalid)
+
+	data, err := events.Data("run", time.Now())
+	if nil != err {
+		t.Fatal(err)
+	}
+	path, body, err := OTLPRequest(cmdSpanEvents, data, testOTLPResource)
+	if nil != err || path != OTLPTracesPath {
+		t.Fatal(path, err)
+	}
+	resource, scope := decodeOTLPScope(t, body)
+	if !reflect.DeepEqual(resource, map[string]interface{}{
+		"service.name":           "my app",
+		"telemetry.sdk.name":     "newrelic",
+		"telemetry.sdk.language": "go",
+		"telemetry.sdk.version":  "1.2.3",
+	}) {
+		t.Error(resource)
+	}
+
+	spans := make(map[string]protoMessage)
+	for _, f := range scope.all(2) {
+		s := decodeProto(t, f.b)
+		if tid := s.one(t, 1).b; !reflect.DeepEqual(tid, mustHex(common.TraceID)) {
+			t.Error(tid)
+		}
+		spans[hex.EncodeToString(s.one(t, 2).b)] = s
+	}
+	if len(spans) != 3 {
+		t.Fatal(len(spans))
+	}
+
+	s := spans[root.GUID]
+	if kind := s.one(t, 6).u; kind != otlpSpanKindServer {
+		t.Error(kind)
+	}
+	if start, end := s.one(t, 7).u, s.one(t, 8).u; start != 1000e9 || end != 1003e9 {
+		t.Error(start, end)
+	}
+	if len(s.all(4)) != 0 {
+		t.Error("root span has a parent")
+	}
+	if attrs := decodeOTLPAttributes(t, s, 9); !reflect.DeepEqual(attrs, map[string]interface{}{
+		"nr.category":      "generic",
+		"nr.transactionId": "txn",
+	}) {
+		t.Error(attrs)
+	}
+
+	s = spans[datastore.GUID]
+	if name := string(s.one(t, 5).b); name != datastore.Name {
+		t.Error(name)
+	}
+	if kind := s.one(t, 6).u; kind != otlpSpanKindClient {
+		t.Error(kind)
+	}
+	if parent := s.one(t, 4).b; !reflect.DeepEqual(parent, mustHex(root.GUID)) {
+		t.Error(parent)
+	}
+	if start, end := s.one(t, 7).u, s.one(t, 8).u; start != 1001e9 || end != 1001.5e9 {
+		t.Error(start, end)
+	}
+	if attrs := decodeOTLPAttributes(t, s, 9); !reflect.DeepEqual(attrs, map[string]interface{}{
+		"db.name":          "mydb",
+		"db.statement":     "SELECT * FROM users",
+		"db.system":        "mysql",
+		"net.peer.name":    "db.example.com",
+		"net.peer.port":    int64(3306),
+		"nr.category":      "datastore",
+		"nr.transactionId": "txn",
+	}) {
+		t.Error(attrs)
+	}
+
+	s = spans[external.GUID]
+	if attrs := decodeOTLPAttributes(t, s, 9); !reflect.DeepEqual(attrs, map[string]interface{}{
+		"http.method":      "GET",
+		"http.url":         "http://example.com/path",
+		"nr.category":      "http",
+		"nr.transactionId": "txn",
+	}) {
+		t.Error(attrs)
+	}
+}
+
+func TestOTLPLogs(t *testing.T) {
+	data := []byte(`["run",{"reservoir_size":10,"events_seen":2},[` +
+		`[{"type":"TransactionError","error.class":"*errors.errorString","error.message":"oops",` +
+		`"timestamp":1.5e+09,"transactionName":"WebTransaction/Go/hello",` +
+		`"traceId":"0af7651916cd43dd8448eb211c80319c"},` +
+		`{"user":1},{"httpResponseCode":"500","request.method":"GET"}],` +
+		`[{"type":"Transaction","name":"WebTransaction/Go/hello","timestamp":1.25e+09,"duration":0.5,"error":true},{},{}]]]`)
+	path, body, err := OTLPRequest(cmdErrorEvents, data, testOTLPResource)
+	if nil != err || path != OTLPLogsPath {
+		t.Fatal(path, err)
+	}
+	_, scope := decodeOTLPScope(t, body)
+	records := scope.all(2)
+	if len(records) != 2 {
+		t.Fatal(len(records))
+	}
+
+	r := decodeProto(t, records[0].b)
+	if ts := r.one(t, 1).u; ts != 1.5e18 {
+		t.Error(ts)
+	}
+	if sev, text := r.one(t, 2).u, string(r.one(t, 3).b); sev != otlpSeverityNumberError || text != "ERROR" {
+		t.Error(sev, text)
+	}
+	if b := r.message(t, 5); string(b.one(t, 1).b) != "oops" {
+		t.Error(b)
+	}
+	if tid := r.one(t, 9).b; !reflect.DeepEqual(tid, mustHex("0af7651916cd43dd8448eb211c80319c")) {
+		t.Error(tid)
+	}
+	if attrs := decodeOTLPAttributes(t, r, 6); !reflect.DeepEqual(attrs, map[string]interface{}{
+		"event.name":        "TransactionError",
+		"exception.message": "oops",
+		"exception.type":    "*errors.errorString",
+		"http.method":       "GET",
+		"http.status_code":  int64(500),
+		"traceId":           "0af7651916cd43dd8448eb211c80319c",
+		"transactionName":   "WebTransaction/Go/hello",
+		"user":              int64(1),
+	}) {
+		t.Error(attrs)
+	}
+
+	r = decodeProto(t, records[1].b)
+	if ts := r.one(t, 1).u; ts != 1.25e18 {
+		t.Error(ts)
+	}
+	if len(r.all(2)) != 0 || len(r.all(5)) != 0 || len(r.all(9)) != 0 {
+		t.Error(r)
+	}
+	if attrs := decodeOTLPAttributes(t, r, 6); !reflect.DeepEqual(attrs, map[string]interface{}{
+		"duration":   0.5,
+		"error":      true,
+		"event.name": "Transaction",
+		"name":       "WebTransaction/Go/hello",
+	}) {
+		t.Error(attrs)
+	}
+}
+
+func TestOTLPMetrics(t *testing.T) {
+	mt := newMetricTable(100, time.Unix(1000, 0))
+	mt.addDuration("WebTransaction", "", 2*time.Second, time.Second, forced)
+	mt.addDuration("WebTransaction", "", 4*time.Second, time.Second, forced)
+	mt.addDuration("Datastore/all", "", time.Second, time.Second, forced)
+	mt.addDuration("Datastore/all", "WebTransaction/Go/hello", time.Second, time.Second, forced)
+	mt.addApdex("Apdex", "", time.Second, ApdexSatisfying, forced)
+	data, err := mt.CollectorJSON("run", time.Unix(1060, 0))
+	if nil != err {
+		t.Fatal(err)
+	}
+	path, body, err := OTLPRequest(cmdMetrics, data, testOTLPResource)
+	if nil != err || path != OTLPMetricsPath {
+		t.Fatal(path, err)
+	}
+	_, scope := decodeOTLPScope(t, body)
+	metrics := scope.all(2)
+	if len(metrics) != 2 {
+		t.Fatal(len(metrics))
+	}
+
+	m := decodeProto(t, metrics[0].b)
+	if name := string(m.one(t, 1).b); name != "Datastore/all" {
+		t.Error(name)
+	}
+	points := m.message(t, 11).all(1)
+	if len(points) != 2 {
+		t.Fatal(len(points))
+	}
+	if attrs := decodeOTLPAttributes(t, decodeProto(t, points[0].b), 7); len(attrs) != 0 {
+		t.Error(attrs)
+	}
+	if attrs := decodeOTLPAttributes(t, decodeProto(t, points[1].b), 7); !reflect.DeepEqual(attrs, map[string]interface{}{
+		"scope": "WebTransaction/Go/hello",
+	}) {
+		t.Error(attrs)
+	}
+
+	m = decodeProto(t, metrics[1].b)
+	if name := string(m.one(t, 1).b); name != "WebTransaction" {
+		t.Error(name)
+	}
+	dp := m.message(t, 11).message(t, 1)
+	if start, end := dp.one(t, 2).u, dp.one(t, 3).u; start != 1000e9 || end != 1060e9 {
+		t.Error(start, end)
+	}
+	if count, sum := dp.one(t, 4).u, math.Float64frombits(dp.one(t, 5).u); count != 2 || sum != 6 {
+		t.Error(count, sum)
+	}
+	var quantiles [][2]float64
+	for _, f := range dp.all(6) {
+		q := decodeProto(t, f.b)
+		quantiles = append(quantiles, [2]float64{
+			math.Float64frombits(q.one(t, 1).u),
+			math.Float64frombits(q.one(t, 2).u),
+		})
+	}
+	if !reflect.DeepEqual(quantiles, [][2]float64{{0, 2}, {1, 4}}) {
+		t.Error(quantiles)
+	}
+}
+
+func TestOTLPUnsupportedPayloads(t *testing.T) {
+	path, body, err := OTLPRequest(cmdTxnTraces, []byte(`["run",[]]`), testOTLPResource)
+	if "" != path || nil != body || nil != err {
+		t.Error(path, body, err)
+	}
+	if _, _, err := OTLPRequest(cmdSpanEvents, []byte(`["run",[]]`), testOTLPResource); nil == err {
+		t.Error("invalid payload translated")
+	}
+	if _, _, err := OTLPRequest(cmdMetrics, []byte(`{}`), testOTLPResource); nil == err {
+		t.Error("invalid payload translated")
+	}
+}
@@ -0,0 +1,489 @@
+package internal
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/newrelic/go-agent/internal/logger"
+)
+
+// The profiler implements the start_profiler and stop_profiler agent
+// commands.  While a profile session is running, the stack of every goroutine
+// is sampled periodically and the stacks are aggregated into call trees which
+// are sent to the collector using the profile_data command.
+
+const (
+	// Goroutines are grouped into these categories in the profile.
+	profileCategoryRequest = "REQUEST"
+	profileCategoryAgent   = "AGENT"
+	profileCategoryOther   = "OTHER"
+
+	agentPackagePrefix = "github.com/newrelic/go-agent"
+	httpServeFunction  = "net/http.(*conn).serve"
+)
+
+var (
+	errProfilerRunning    = errors.New("profiler already running")
+	errProfilerNotRunning = errors.New("profiler not running")
+	errProfileIDMismatch  = errors.New("profile id does not match the running profile")
+	errProfileDuration    = errors.New("profile duration must be positive")
+)
+
+// ProfilerConfig contains the settings used by NewProfiler.
+type ProfilerConfig struct {
+	Logger logger.Logger
+	// CPUProfileDir, if non-empty, is the directory in which a
+	// runtime/pprof CPU profile is written for each profile session.
+	CPUProfileDir string
+}
+
+// Profiler runs the profile sessions requested by the collector.  Only one
+// session may run at a time.  Profiler is safe for concurrent use.
+type Profiler struct {
+	logger        logger.Logger
+	cpuProfileDir string
+	// sample returns the stacks of the goroutines.  It is replaced in
+	// tests.
+	sample func() [][]runtime.Frame
+
+	sync.Mutex
+	session  *profileSession
+	finished harvestProfiles
+}
+
+// NewProfiler creates a Profiler.
+func NewProfiler(cfg ProfilerConfig) *Profiler {
+	return &Profiler{
+		logger:        cfg.Logger,
+		cpuProfileDir: cfg.CPUProfileDir,
+		sample:        sampleGoroutines,
+	}
+}
+
+// profileArguments contains the arguments of the start_profiler and
+// stop_profiler commands.  Goroutine state is not available, so the
+// only_runnable_threads argument is not supported.
+type profileArguments struct {
+	ProfileID          int64   `json:"profile_id"`
+	SamplePeriod       float64 `json:"sample_period"`
+	Duration           float64 `json:"duration"`
+	OnlyRequestThreads bool    `json:"only_request_threads"`
+	ProfileAgentCode   bool    `json:"profile_agent_code"`
+	ReportData         bool    `json:"report_data"`
+}
+
+func (args profileArguments) samplePeriod() time.Duration {
+	if args.SamplePeriod <= 0 {
+		return profilerDefaultSamplePeriod
+	}
+	period := time.Duration(args.SamplePeriod * float64(time.Second))
+	if period < profilerMinSamplePeriod {
+		return profilerMinSamplePeriod
+	}
+	return period
+}
+
+type profileSession struct {
+	args  profileArguments
+	start time.Time
+	// stop receives the report_data argument of the stop_profiler
+	// command.  done is closed once the session has finished.
+	stop chan bool
+	done chan struct{}
+
+	numSamples int
+	// maxGoroutines is the largest number of goroutines in a sample.
+	// It is reported as the thread count.
+	maxGoroutines int
+	numNodes      int
+	trees         map[string]*profileNode
+}
+
+// StartProfiler starts a profile session.  Nothing happens and an error is
+// returned if p is nil.
+func (p *Profiler) StartProfiler(arguments json.RawMessage, now time.Time) error {
+	if nil == p {
+		return errProfilerDisabled
+	}
+	var args profileArguments
+	if err := json.Unmarshal(arguments, &args); nil != err {
+		return err
+	}
+	if args.Duration <= 0 {
+		return errProfileDuration
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if nil != p.session {
+		return errProfilerRunning
+	}
+	s := &profileSession{
+		args:  args,
+		start: now,
+		stop:  make(chan bool, 1),
+		done:  make(chan struct{}),
+		trees: make(map[string]*profileNode),
+	}
+	p.session = s
+	go p.run(s)
+	return nil
+}
+
+// StopProfiler stops the profile session, waiting until it has finished.
+// Nothing happens and an error is returned if p is nil.
+func (p *Profiler) StopProfiler(arguments json.RawMessage) error {
+	if nil == p {
+		return errProfilerDisabled
+	}
+	var args profileArguments
+	if err := json.Unmarshal(arguments, &args); nil != err {
+		return err
+	}
+
+	p.Lock()
+	s := p.session
+	p.Unlock()
+
+	if nil == s {
+		return errProfilerNotRunning
+	}
+	if s.args.ProfileID != args.ProfileID {
+		return errProfileIDMismatch
+	}
+	s.finish(args.ReportData)
+	return nil
+}
+
+// Shutdown stops the running profile session, if any, and keeps its data.
+// Nothing happens if p is nil.
+func (p *Profiler) Shutdown() {
+	if nil == p {
+		return
+	}
+	p.Lock()
+	s := p.session
+	p.Unlock()
+
+	if nil != s {
+		s.finish(true)
+	}
+}
+
+// MergeIntoHarvest adds the profiles of the finished sessions to the harvest.
+// Nothing happens if p is nil.
+func (p *Profiler) MergeIntoHarvest(h *Harvest) {
+	if nil == p {
+		return
+	}
+	p.Lock()
+	finished := p.finished
+	p.finished = nil
+	p.Unlock()
+
+	finished.MergeIntoHarvest(h)
+}
+
+func (s *profileSession) finish(reportData bool) {
+	select {
+	case s.stop <- reportData:
+	default:
+		// The session is already stopping.
+	}
+	<-s.done
+}
+
+func (p *Profiler) startCPUProfile(id int64) *os.File {
+	if "" == p.cpuProfileDir {
+		return nil
+	}
+	path := filepath.Join(p.cpuProfileDir, fmt.Sprintf("cpu-%d.pprof", id))
+	f, err := os.Create(path)
+	if nil != err {
+		p.logger.Warn("unable to create cpu profile", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return nil
+	}
+	if err := pprof.StartCPUProfile(f); nil != err {
+		p.logger.Warn("unable to start cpu profile", map[string]interface{}{
+			"error": err.Error(),
+		})
+		f.Close()
+		os.Remove(path)
+		return nil
+	}
+	return f
+}
+
+func (p *Profiler) run(s *profileSession) {
+	defer close(s.done)
+
+	if f := p.startCPUProfile(s.args.ProfileID); nil != f {
+		defer func() {
+			pprof.StopCPUProfile()
+			f.Close()
+		}()
+	}
+
+	ticker := time.NewTicker(s.args.samplePeriod())
+	defer ticker.Stop()
+	timer := time.NewTimer(time.Duration(s.args.Duration * float64(time.Second)))
+	defer timer.Stop()
+
+	reportData := true
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			s.addSample(p.sample())
+		case <-timer.C:
+			break loop
+		case reportData = <-s.stop:
+			break loop
+		}
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	p.session = nil
+	if reportData {
+		p.finished = append(p.finished, s.profile(time.Now()))
+	}
+}
+
+// sampleGoroutines returns the stack of every goroutine.  The frames of each
+// stack are ordered from the innermost call to the goroutine's entry function.
+func sampleGoroutines() [][]runtime.Frame {
+	var records []runtime.StackRecord
+	n := runtime.NumGoroutine()
+	for {
+		// Extra room is added in case goroutines are created.
+		records = make([]runtime.StackRecord, n+10)
+		var ok bool
+		if n, ok = runtime.GoroutineProfile(records); ok {
+			records = records[0:n]
+			break
+		}
+	}
+	stacks := make([][]runtime.Frame, 0, len(records))
+	for _, r := range records {
+		var stack []runtime.Frame
+		frames := runtime.CallersFrames(r.Stack())
+		for {
+			frame, more := frames.Next()
+			stack = append(stack, frame)
+			if !more {
+				break
+			}
+		}
+		stacks = append(stacks, stack)
+	}
+	return stacks
+}
+
+// goroutineCategory returns the category of the goroutine.  Goroutines whose
+// entry function belongs to the agent are agent goroutines, and goroutines
+// handling a net/http request are request goroutines.
+func goroutineCategory(stack []runtime.Frame) string {
+	if n := len(stack); n > 0 && strings.HasPrefix(stack[n-1].Function, agentPackagePrefix) {
+		return profileCategoryAgent
+	}
+	for _, frame := range stack {
+		if httpServeFunction == frame.Function {
+			return profileCategoryRequest
+		}
+	}
+	return profileCategoryOther
+}
+
+func (s *profileSession) addSample(stacks [][]runtime.Frame) {
+	s.numSamples++
+	if len(stacks) > s.maxGoroutines {
+		s.maxGoroutines = len(stacks)
+	}
+	for _, stack := range stacks {
+		category := goroutineCategory(stack)
+		if profileCategoryAgent == category && !s.args.ProfileAgentCode {
+			continue
+		}
+		if profileCategoryRequest != category && s.args.OnlyRequestThreads {
+			continue
+		}
+		root, ok := s.trees[category]
+		if !ok {
+			root = &profileNode{}
+			s.trees[category] = root
+		}
+		// The tree begins at the entry function.
+		node := root
+		for i := len(stack) - 1; i >= 0 && nil != node; i-- {
+			node = node.child(stack[i], s)
+			if nil != node {
+				node.callCount++
+			}
+		}
+	}
+}
+
+func (s *profileSession) profile(stop time.Time) *profile {
+	return &profile{
+		id:            s.args.ProfileID,
+		start:         s.start,
+		stop:          stop,
+		numSamples:    s.numSamples,
+		numGoroutines: s.maxGoroutines,
+		trees:         s.trees,
+	}
+}
+
+type profileFrame struct {
+	file     string
+	function string
+	line     int
+}
+
+type profileNode struct {
+	frame     profileFrame
+	callCount int
+	children  map[profileFrame]*profileNode
+}
+
+// child returns the child node of the frame, creating it if necessary.  nil is
+// returned if the session's node limit has been reached.
+func (n *profileNode) child(f runtime.Frame, s *profileSession) *profileNode {
+	key := profileFrame{file: f.File, function: f.Function, line: f.Line}
+	if c, ok := n.children[key]; ok {
+		return c
+	}
+	if s.numNodes >= profilerMaxNodes {
+		return nil
+	}
+	s.numNodes++
+	if nil == n.children {
+		n.children = make(map[profileFrame]*profileNode)
+	}
+	c := &profileNode{frame: key}
+	n.children[key] = c
+	return c
+}
+
+type byCallCount []*profileNode
+
+func (c byCallCount) Len() int      { return len(c) }
+func (c byCallCount) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c byCallCount) Less(i, j int) bool {
+	if c[i].callCount != c[j].callCount {
+		return c[i].callCount > c[j].callCount
+	}
+	if c[i].frame.function != c[j].frame.function {
+		return c[i].frame.function < c[j].frame.function
+	}
+	return c[i].frame.line < c[j].frame.line
+}
+
+// childrenJSON returns the children of the node in the format expected by the
+// collector:
+//
+//	[[file, function, line], call count, 0, [children]]
+//
+// The children are sorted by call count so that the output is deterministic.
+func (n *profileNode) childrenJSON() []interface{} {
+	children := make(byCallCount, 0, len(n.children))
+	for _, c := range n.children {
+		children = append(children, c)
+	}
+	sort.Sort(children)
+	out := make([]interface{}, 0, len(children))
+	for _, c := range children {
+		out = append(out, []interface{}{
+			[]interface{}{c.frame.file, c.frame.function, c.frame.line},
+			c.callCount,
+			0,
+			c.childrenJSON(),
+		})
+	}
+	return out
+}
+
+type profile struct {
+	id            int64
+	start         time.Time
+	stop          time.Time
+	numSamples    int
+	numGoroutines int
+	trees         map[string]*profileNode
+}
+
+// encodedTree returns the call trees as compressed and base64 encoded JSON.
+func (p *profile) encodedTree() (string, error) {
+	trees := make(map[string]interface{}, len(p.trees))
+	for category, root := range p.trees {
+		trees[category] = root.childrenJSON()
+	}
+	js, err := json.Marshal(trees)
+	if nil != err {
+		return "", err
+	}
+	compressed, err := compress(js)
+	if nil != err {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(compressed.Bytes()), nil
+}
+
+// harvestProfiles contains the profiles of the finished profile sessions.
+type harvestProfiles []*profile
+
+// MergeIntoHarvest implements Harvestable.
+func (profiles harvestProfiles) MergeIntoHarvest(h *Harvest) {
+	h.Profiles = append(h.Profiles, profiles...)
+}
+
+func timeToMillis(t time.Time) int64 {
+	return t.UnixNano() / (1000 * 1000)
+}
+
+// Data prepares the profile_data JSON.  Each profile is an array:
+//
+//	[id, start ms, stop ms, sample count, encoded tree, thread count, 0, null]
+func (profiles harvestProfiles) Data(agentRunID string, harvestStart time.Time) ([]byte, error) {
+	if 0 == len(profiles) {
+		return nil, nil
+	}
+	data := make([]interface{}, 0, len(profiles))
+	for _, p := range profiles {
+		tree, err := p.encodedTree()
+		if nil != err {
+			return nil, err
+		}
+		data = append(data, []interface{}{
+			p.id,
+			timeToMillis(p.start),
+			timeToMillis(p.stop),
+			p.numSamples,
+			tree,
+			p.numGoroutines,
+			0,
+			nil,
+		})
+	}
+	return json.Marshal([]interface{}{agentRunID, data})
+}
+
+// EndpointMethod implements PayloadCreator.
+func (profiles harvestProfiles) EndpointMethod() string {
+	return cmdProfileData
+}
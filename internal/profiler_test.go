@@ -0,0 +1,297 @@
+package internal
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/internal/logger"
+)
+
+var (
+	requestStack = []runtime.Frame{
+		{Function: "main.handler", File: "main.go", Line: 10},
+		{Function: "net/http.(*conn).serve", File: "server.go", Line: 1800},
+	}
+	agentStack = []runtime.Frame{
+		{Function: "time.Sleep", File: "time.go", Line: 1},
+		{Function: "github.com/newrelic/go-agent.(*app).process", File: "internal_app.go", Line: 300},
+	}
+	otherStack = []runtime.Frame{
+		{Function: "main.worker", File: "main.go", Line: 20},
+		{Function: "main.main", File: "main.go", Line: 5},
+	}
+)
+
+// testProfiler returns a profiler whose samples contain the stacks above.
+// Each sample is sent on the channel returned.
+func testProfiler() (*Profiler, chan int) {
+	p := NewProfiler(ProfilerConfig{Logger: logger.ShimLogger{}})
+	sampled := make(chan int, 100)
+	count := 0
+	p.sample = func() [][]runtime.Frame {
+		count++
+		select {
+		case sampled <- count:
+		default:
+		}
+		return [][]runtime.Frame{requestStack, agentStack, otherStack}
+	}
+	return p, sampled
+}
+
+func decodeProfileData(t *testing.T, h *Harvest) ([]interface{}, map[string]interface{}) {
+	js, err := h.Profiles.Data("run-id", time.Now())
+	if nil != err {
+		t.Fatal(err)
+	}
+	var payload []interface{}
+	if err := json.Unmarshal(js, &payload); nil != err {
+		t.Fatal(err)
+	}
+	if payload[0] != "run-id" {
+		t.Error(payload[0])
+	}
+	profile := payload[1].([]interface{})[0].([]interface{})
+	compressed, err := base64.StdEncoding.DecodeString(profile[4].(string))
+	if nil != err {
+		t.Fatal(err)
+	}
+	r, err := zlib.NewReader(bytes.NewReader(compressed))
+	if nil != err {
+		t.Fatal(err)
+	}
+	treeJSON, err := ioutil.ReadAll(r)
+	if nil != err {
+		t.Fatal(err)
+	}
+	var trees map[string]interface{}
+	if err := json.Unmarshal(treeJSON, &trees); nil != err {
+		t.Fatal(err)
+	}
+	return profile, trees
+}
+
+func TestProfilerSession(t *testing.T) {
+	p, sampled := testProfiler()
+	if err := p.StartProfiler([]byte(`{"profile_id":42,"sample_period":0.01,"duration":600}`), time.Now()); nil != err {
+		t.Fatal(err)
+	}
+	for n := 0; n < 2; n = <-sampled {
+	}
+	if err := p.StopProfiler([]byte(`{"profile_id":42,"report_data":true}`)); nil != err {
+		t.Fatal(err)
+	}
+	h := NewHarvest(time.Now(), DefaultHarvestConfig)
+	p.MergeIntoHarvest(h)
+	if len(h.Profiles) != 1 {
+		t.Fatal(h.Profiles)
+	}
+
+	profile, trees := decodeProfileData(t, h)
+	numSamples := profile[3].(float64)
+	if profile[0].(float64) != 42 || numSamples < 2 || profile[5].(float64) != 3 {
+		t.Error(profile)
+	}
+	if _, ok := trees["AGENT"]; ok {
+		t.Error("agent goroutines included", trees)
+	}
+	request := trees["REQUEST"].([]interface{})
+	if len(request) != 1 {
+		t.Fatal(request)
+	}
+	// The tree begins with the goroutine's entry function.
+	serve := request[0].([]interface{})
+	frame := serve[0].([]interface{})
+	if frame[0] != "server.go" || frame[1] != "net/http.(*conn).serve" || frame[2].(float64) != 1800 {
+		t.Error(frame)
+	}
+	if serve[1].(float64) != numSamples {
+		t.Error(serve[1], numSamples)
+	}
+	handler := serve[3].([]interface{})[0].([]interface{})
+	if handler[0].([]interface{})[1] != "main.handler" || handler[1].(float64) != numSamples {
+		t.Error(handler)
+	}
+	if other := trees["OTHER"].([]interface{}); len(other) != 1 {
+		t.Error(other)
+	}
+
+	h = NewHarvest(time.Now(), DefaultHarvestConfig)
+	p.MergeIntoHarvest(h)
+	if len(h.Profiles) != 0 {
+		t.Error(h.Profiles)
+	}
+}
+
+func TestProfilerOnlyRequestThreads(t *testing.T) {
+	p, sampled := testProfiler()
+	if err := p.StartProfiler([]byte(`{"profile_id":1,"sample_period":0.01,"duration":600,"only_request_threads":true}`), time.Now()); nil != err {
+		t.Fatal(err)
+	}
+	<-sampled
+	p.Shutdown()
+	h := NewHarvest(time.Now(), DefaultHarvestConfig)
+	p.MergeIntoHarvest(h)
+	_, trees := decodeProfileData(t, h)
+	if _, ok := trees["REQUEST"]; !ok || len(trees) != 1 {
+		t.Error(trees)
+	}
+}
+
+func TestProfilerAgentCode(t *testing.T) {
+	p, sampled := testProfiler()
+	if err := p.StartProfiler([]byte(`{"profile_id":1,"sample_period":0.01,"duration":600,"profile_agent_code":true}`), time.Now()); nil != err {
+		t.Fatal(err)
+	}
+	<-sampled
+	p.Shutdown()
+	h := NewHarvest(time.Now(), DefaultHarvestConfig)
+	p.MergeIntoHarvest(h)
+	_, trees := decodeProfileData(t, h)
+	if len(trees) != 3 {
+		t.Error(trees)
+	}
+}
+
+func TestProfilerDurationElapsed(t *testing.T) {
+	p, _ := testProfiler()
+	if err := p.StartProfiler([]byte(`{"profile_id":1,"sample_period":0.01,"duration":0.05}`), time.Now()); nil != err {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	h := NewHarvest(time.Now(), DefaultHarvestConfig)
+	for len(h.Profiles) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		p.MergeIntoHarvest(h)
+	}
+	if len(h.Profiles) != 1 {
+		t.Fatal(h.Profiles)
+	}
+	if err := p.StopProfiler([]byte(`{"profile_id":1}`)); errProfilerNotRunning != err {
+		t.Error(err)
+	}
+}
+
+func TestProfilerStopWithoutData(t *testing.T) {
+	p, _ := testProfiler()
+	if err := p.StartProfiler([]byte(`{"profile_id":1,"duration":600}`), time.Now()); nil != err {
+		t.Fatal(err)
+	}
+	if err := p.StopProfiler([]byte(`{"profile_id":1,"report_data":false}`)); nil != err {
+		t.Error(err)
+	}
+	h := NewHarvest(time.Now(), DefaultHarvestConfig)
+	p.MergeIntoHarvest(h)
+	if len(h.Profiles) != 0 {
+		t.Error(h.Profiles)
+	}
+	for _, p := range h.Payloads(false) {
+		if p.EndpointMethod() == cmdProfileData {
+			t.Error("unexpected profile payload")
+		}
+	}
+}
+
+func TestProfilerErrors(t *testing.T) {
+	p, _ := testProfiler()
+	if err := p.StartProfiler([]byte(`{"profile_id":1,"duration":0}`), time.Now()); errProfileDuration != err {
+		t.Error(err)
+	}
+	if err := p.StartProfiler([]byte(`{`), time.Now()); nil == err {
+		t.Error("malformed arguments accepted")
+	}
+	if err := p.StopProfiler([]byte(`{"profile_id":1}`)); errProfilerNotRunning != err {
+		t.Error(err)
+	}
+	if err := p.StartProfiler([]byte(`{"profile_id":1,"duration":600}`), time.Now()); nil != err {
+		t.Error(err)
+	}
+	if err := p.StartProfiler([]byte(`{"profile_id":2,"duration":600}`), time.Now()); errProfilerRunning != err {
+		t.Error(err)
+	}
+	if err := p.StopProfiler([]byte(`{"profile_id":2}`)); errProfileIDMismatch != err {
+		t.Error(err)
+	}
+	p.Shutdown()
+}
+
+func TestProfilerNil(t *testing.T) {
+	var p *Profiler
+	if err := p.StartProfiler([]byte(`{"profile_id":1,"duration":600}`), time.Now()); errProfilerDisabled != err {
+		t.Error(err)
+	}
+	if err := p.StopProfiler([]byte(`{"profile_id":1}`)); errProfilerDisabled != err {
+		t.Error(err)
+	}
+	p.Shutdown()
+	p.MergeIntoHarvest(NewHarvest(time.Now(), DefaultHarvestConfig))
+}
+
+func TestSamplePeriod(t *testing.T) {
+	for _, tc := range []struct {
+		input  float64
+		expect time.Duration
+	}{
+		{input: 0, expect: profilerDefaultSamplePeriod},
+		{input: 0.001, expect: profilerMinSamplePeriod},
+		{input: 0.5, expect: 500 * time.Millisecond},
+	} {
+		if p := (profileArguments{SamplePeriod: tc.input}).samplePeriod(); p != tc.expect {
+			t.Error(tc.input, p)
+		}
+	}
+}
+
+func TestGoroutineCategory(t *testing.T) {
+	if c := goroutineCategory(requestStack); c != profileCategoryRequest {
+		t.Error(c)
+	}
+	if c := goroutineCategory(agentStack); c != profileCategoryAgent {
+		t.Error(c)
+	}
+	if c := goroutineCategory(otherStack); c != profileCategoryOther {
+		t.Error(c)
+	}
+}
+
+func TestSampleGoroutines(t *testing.T) {
+	var found bool
+	for _, stack := range sampleGoroutines() {
+		for _, frame := range stack {
+			if strings.HasSuffix(frame.Function, "TestSampleGoroutines") {
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Error("current goroutine not sampled")
+	}
+}
+
+func TestProfilerCPUProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profiler")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p, sampled := testProfiler()
+	p.cpuProfileDir = dir
+	if err := p.StartProfiler([]byte(`{"profile_id":7,"sample_period":0.01,"duration":600}`), time.Now()); nil != err {
+		t.Fatal(err)
+	}
+	<-sampled
+	p.Shutdown()
+	if info, err := os.Stat(filepath.Join(dir, "cpu-7.pprof")); nil != err || 0 == info.Size() {
+		t.Error(info, err)
+	}
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+)
+
+const (
+	// RedactionReplacement replaces the matches of a redaction rule which
+	// does not have a replacement.
+	RedactionReplacement = "[REDACTED]"
+	// redactionHashPrefix precedes the hash of a match when a redaction
+	// rule hashes matches.
+	redactionHashPrefix = "sha256:"
+	// redactionHashBytes is the number of bytes of the SHA-256 sum used.
+	redactionHashBytes = 8
+)
+
+// RedactionRule matches newrelic.RedactionRule to avoid circular dependency
+// issues.
+type RedactionRule struct {
+	Pattern     string
+	Replacement string
+	Hash        bool
+}
+
+type redactionRule struct {
+	re          *regexp.Regexp
+	replacement string
+	hash        bool
+}
+
+// Redactor masks the parts of values matching the redaction rules.  A nil
+// Redactor leaves values unchanged.
+type Redactor struct {
+	rules []redactionRule
+}
+
+// NewRedactor compiles the rules.  nil is returned if there are no rules.
+func NewRedactor(rules []RedactionRule) (*Redactor, error) {
+	if 0 == len(rules) {
+		return nil, nil
+	}
+	r := &Redactor{rules: make([]redactionRule, 0, len(rules))}
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if nil != err {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %v", rule.Pattern, err)
+		}
+		replacement := rule.Replacement
+		if "" == replacement {
+			replacement = RedactionReplacement
+		}
+		r.rules = append(r.rules, redactionRule{
+			re:          re,
+			replacement: replacement,
+			hash:        rule.Hash,
+		})
+	}
+	return r, nil
+}
+
+func redactionHash(match string) string {
+	sum := sha256.Sum256([]byte(match))
+	return redactionHashPrefix + hex.EncodeToString(sum[:redactionHashBytes])
+}
+
+// Redact applies the rules, in order, to the string.
+func (r *Redactor) Redact(s string) string {
+	if nil == r || "" == s {
+		return s
+	}
+	for _, rule := range r.rules {
+		if rule.hash {
+			s = rule.re.ReplaceAllStringFunc(s, redactionHash)
+		} else {
+			s = rule.re.ReplaceAllString(s, rule.replacement)
+		}
+	}
+	return s
+}
+
+// RedactValue redacts the value if it is a string.
+func (r *Redactor) RedactValue(val interface{}) interface{} {
+	if str, ok := val.(string); ok && nil != r {
+		return r.Redact(str)
+	}
+	return val
+}
+
+// RedactParams returns the params with their string values redacted.  The
+// params are copied rather than modified, and are returned unchanged if r is
+// nil.
+func (r *Redactor) RedactParams(params map[string]interface{}) map[string]interface{} {
+	if nil == r || nil == params {
+		return params
+	}
+	redacted := make(map[string]interface{}, len(params))
+	for key, val := range params {
+		redacted[key] = r.RedactValue(val)
+	}
+	return redacted
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactorNoRules(t *testing.T) {
+	r, err := NewRedactor(nil)
+	if nil != r || nil != err {
+		t.Fatal(r, err)
+	}
+	if out := r.Redact("bob@example.com"); out != "bob@example.com" {
+		t.Error(out)
+	}
+	params := map[string]interface{}{"email": "bob@example.com"}
+	if out := r.RedactParams(params); !reflect.DeepEqual(out, params) {
+		t.Error(out)
+	}
+}
+
+func TestRedactorInvalidPattern(t *testing.T) {
+	if _, err := NewRedactor([]RedactionRule{{Pattern: "a("}}); nil == err {
+		t.Error("invalid pattern accepted")
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	r, err := NewRedactor([]RedactionRule{
+		{Pattern: `[a-z]+@example\.com`},
+		{Pattern: `(token=)[a-z0-9]+`, Replacement: "${1}xxx"},
+		{Pattern: `user-[0-9]+`, Hash: true},
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	for input, expect := range map[string]string{
+		"":                                       "",
+		"nothing to see":                         "nothing to see",
+		"from bob@example.com to al@example.com": "from [REDACTED] to [REDACTED]",
+		"/login?token=abc123":                    "/login?token=xxx",
+		"user-123":                               redactionHash("user-123"),
+	} {
+		if out := r.Redact(input); out != expect {
+			t.Error(input, out)
+		}
+	}
+	if h := redactionHash("user-123"); len(h) != len(redactionHashPrefix)+2*redactionHashBytes || h == redactionHash("user-124") {
+		t.Error(h)
+	}
+
+	params := map[string]interface{}{"email": "bob@example.com", "count": 1}
+	out := r.RedactParams(params)
+	if !reflect.DeepEqual(out, map[string]interface{}{"email": RedactionReplacement, "count": 1}) {
+		t.Error(out)
+	}
+	if params["email"] != "bob@example.com" {
+		t.Error("params modified", params)
+	}
+}
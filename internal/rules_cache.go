@@ -11,7 +11,7 @@ type rulesCache struct {
 }
 
 type rulesCacheKey struct {
-	isWeb     bool
+	prefix    string
 	inputName string
 }
 
@@ -22,7 +22,7 @@ func newRulesCache(maxCacheSize int) *rulesCache {
 	}
 }
 
-func (cache *rulesCache) find(inputName string, isWeb bool) string {
+func (cache *rulesCache) find(inputName, prefix string) string {
 	if nil == cache {
 		return ""
 	}
@@ -31,11 +31,11 @@ func (cache *rulesCache) find(inputName string, isWeb bool) string {
 
 	return cache.cache[rulesCacheKey{
 		inputName: inputName,
-		isWeb:     isWeb,
+		prefix:    prefix,
 	}]
 }
 
-func (cache *rulesCache) set(inputName string, isWeb bool, finalName string) {
+func (cache *rulesCache) set(inputName, prefix, finalName string) {
 	if nil == cache {
 		return
 	}
@@ -47,6 +47,6 @@ func (cache *rulesCache) set(inputName string, isWeb bool, finalName string) {
 	}
 	cache.cache[rulesCacheKey{
 		inputName: inputName,
-		isWeb:     isWeb,
+		prefix:    prefix,
 	}] = finalName
 }
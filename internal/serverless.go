@@ -0,0 +1,210 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/newrelic/go-agent/internal/logger"
+)
+
+const (
+	lambdaMetadataVersion = 2
+
+	// AgentLanguage is used in the Lambda JSON.
+	AgentLanguage = "go"
+
+	serverlessMonitoringName = "NR_LAMBDA_MONITORING"
+)
+
+// ServerlessHarvest is used to store and log data when the agent is running in
+// serverless mode.
+type ServerlessHarvest struct {
+	logger          logger.Logger
+	version         string
+	awsExecutionEnv string
+
+	// The Lambda handler could be using multiple goroutines so we use a
+	// mutex to prevent race conditions.
+	sync.Mutex
+	harvest *Harvest
+}
+
+// NewServerlessHarvest creates a new ServerlessHarvest.
+func NewServerlessHarvest(logger logger.Logger, version string, getEnv func(string) string, config HarvestConfig) *ServerlessHarvest {
+	return &ServerlessHarvest{
+		logger:          logger,
+		version:         version,
+		awsExecutionEnv: getEnv("AWS_EXECUTION_ENV"),
+		harvest:         NewHarvest(time.Now(), config),
+	}
+}
+
+// Consume adds data to the harvest.
+func (sh *ServerlessHarvest) Consume(data Harvestable) {
+	if nil == sh {
+		return
+	}
+	sh.Lock()
+	defer sh.Unlock()
+
+	data.MergeIntoHarvest(sh.harvest)
+}
+
+func (sh *ServerlessHarvest) swapHarvest() *Harvest {
+	sh.Lock()
+	defer sh.Unlock()
+
+	h := sh.harvest
+	sh.harvest = NewHarvest(time.Now(), h.config)
+	return h
+}
+
+// Write logs the data in the format expected by the New Relic log-ingestion
+// Lambda:
+//
+//	[2,"NR_LAMBDA_MONITORING",{metadata},"base64(gzip(data))"]
+//
+// Nothing is written if the harvest is empty.
+func (sh *ServerlessHarvest) Write(arn string, writer io.Writer) {
+	if nil == sh {
+		return
+	}
+	harvest := sh.swapHarvest()
+	payloads := harvest.Payloads(false)
+	// Note that *json.RawMessage (instead of json.RawMessage) is used to
+	// support older Go versions: https://go-review.googlesource.com/c/go/+/21811/
+	harvestPayloads := make(map[string]*json.RawMessage, len(payloads))
+	for _, p := range payloads {
+		agentRunID := ""
+		cmd := p.EndpointMethod()
+		data, err := p.Data(agentRunID, time.Now())
+		if nil != err {
+			sh.logger.Error("error creating payload json", map[string]interface{}{
+				"command": cmd,
+				"error":   err.Error(),
+			})
+			continue
+		}
+		if nil == data {
+			continue
+		}
+		// Each payload uses a different endpoint method since the
+		// transaction events are not split.
+		d := json.RawMessage(data)
+		harvestPayloads[cmd] = &d
+	}
+
+	if len(harvestPayloads) == 0 {
+		// The harvest may not contain any data if the serverless
+		// transaction was ignored.
+		return
+	}
+
+	data, err := json.Marshal(harvestPayloads)
+	if nil != err {
+		sh.logger.Error("error creating serverless data json", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var dataBuf bytes.Buffer
+	gz := gzip.NewWriter(&dataBuf)
+	gz.Write(data)
+	gz.Close()
+
+	js, err := json.Marshal([]interface{}{
+		lambdaMetadataVersion,
+		serverlessMonitoringName,
+		serverlessMetadata{
+			MetadataVersion:      lambdaMetadataVersion,
+			ARN:                  arn,
+			ProtocolVersion:      ProcotolVersion,
+			ExecutionEnvironment: sh.awsExecutionEnv,
+			AgentVersion:         sh.version,
+			AgentLanguage:        AgentLanguage,
+		},
+		base64.StdEncoding.EncodeToString(dataBuf.Bytes()),
+	})
+	if nil != err {
+		sh.logger.Error("error creating serverless json", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	fmt.Fprintln(writer, string(js))
+}
+
+type serverlessMetadata struct {
+	MetadataVersion      int    `json:"metadata_version"`
+	ARN                  string `json:"arn,omitempty"`
+	ProtocolVersion      int    `json:"protocol_version"`
+	ExecutionEnvironment string `json:"execution_environment,omitempty"`
+	AgentVersion         string `json:"agent_version"`
+	AgentLanguage        string `json:"agent_language"`
+}
+
+var (
+	errServerlessPayloadFormat = errors.New("invalid serverless payload format")
+)
+
+// ParseServerlessPayload decodes the output of ServerlessHarvest.Write.  It
+// exists for testing.
+func ParseServerlessPayload(data []byte) (metadata, uncompressedData map[string]json.RawMessage, err error) {
+	var arr [4]json.RawMessage
+	if err = json.Unmarshal(data, &arr); nil != err {
+		return
+	}
+	var name string
+	if err = json.Unmarshal(arr[1], &name); nil != err {
+		return
+	}
+	if serverlessMonitoringName != name {
+		err = errServerlessPayloadFormat
+		return
+	}
+	if err = json.Unmarshal(arr[2], &metadata); nil != err {
+		return
+	}
+	var encoded string
+	if err = json.Unmarshal(arr[3], &encoded); nil != err {
+		return
+	}
+	compressed, err := base64.StdEncoding.DecodeString(encoded)
+	if nil != err {
+		return
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if nil != err {
+		return
+	}
+	defer gz.Close()
+	uncompressed, err := ioutil.ReadAll(gz)
+	if nil != err {
+		return
+	}
+	err = json.Unmarshal(uncompressed, &uncompressedData)
+	return
+}
+
+// ServerlessWriter is implemented by newrelic.Application.
+type ServerlessWriter interface {
+	ServerlessWrite(arn string, writer io.Writer)
+}
+
+// ServerlessWrite exists to avoid type assertion in the nrlambda integration
+// package.
+func ServerlessWrite(app interface{}, arn string, writer io.Writer) {
+	if s, ok := app.(ServerlessWriter); ok {
+		s.ServerlessWrite(arn, writer)
+	}
+}
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/internal/logger"
+)
+
+func serverlessGetenvShim(s string) string {
+	if s == "AWS_EXECUTION_ENV" {
+		return "the-execution-env"
+	}
+	return ""
+}
+
+func TestServerlessHarvest(t *testing.T) {
+	sh := NewServerlessHarvest(logger.ShimLogger{}, "the-version", serverlessGetenvShim, DefaultHarvestConfig)
+	event, err := CreateCustomEvent("myEvent", nil, time.Now())
+	if nil != err {
+		t.Fatal(err)
+	}
+	sh.Consume(event)
+	buf := &bytes.Buffer{}
+	sh.Write("arn", buf)
+	metadata, data, err := ParseServerlessPayload(buf.Bytes())
+	if nil != err {
+		t.Fatal(err)
+	}
+	if v := string(metadata["metadata_version"]); v != `2` {
+		t.Error(v)
+	}
+	if v := string(metadata["arn"]); v != `"arn"` {
+		t.Error(v)
+	}
+	if v := string(metadata["protocol_version"]); v != `17` {
+		t.Error(v)
+	}
+	if v := string(metadata["execution_environment"]); v != `"the-execution-env"` {
+		t.Error(v)
+	}
+	if v := string(metadata["agent_version"]); v != `"the-version"` {
+		t.Error(v)
+	}
+	if v := string(metadata["agent_language"]); v != `"go"` {
+		t.Error(v)
+	}
+	eventData := string(data["custom_event_data"])
+	if !strings.Contains(eventData, `"type":"myEvent"`) {
+		t.Error(eventData)
+	}
+	if len(data) != 1 {
+		t.Fatal(data)
+	}
+	// Test that the harvest was replaced with a new harvest.
+	buf = &bytes.Buffer{}
+	sh.Write("arn", buf)
+	if 0 != buf.Len() {
+		t.Error(buf.String())
+	}
+}
+
+func TestServerlessHarvestNil(t *testing.T) {
+	var sh *ServerlessHarvest
+	event, err := CreateCustomEvent("myEvent", nil, time.Now())
+	if nil != err {
+		t.Fatal(err)
+	}
+	sh.Consume(event)
+	buf := &bytes.Buffer{}
+	sh.Write("arn", buf)
+	if 0 != buf.Len() {
+		t.Error(buf.String())
+	}
+}
+
+func TestServerlessHarvestEmpty(t *testing.T) {
+	sh := NewServerlessHarvest(logger.ShimLogger{}, "the-version", serverlessGetenvShim, DefaultHarvestConfig)
+	buf := &bytes.Buffer{}
+	sh.Write("arn", buf)
+	if 0 != buf.Len() {
+		t.Error(buf.String())
+	}
+}
+
+func TestParseServerlessPayloadInvalid(t *testing.T) {
+	if _, _, err := ParseServerlessPayload([]byte(`[2,"NOT_LAMBDA",{},""]`)); err != errServerlessPayloadFormat {
+		t.Error(err)
+	}
+	if _, _, err := ParseServerlessPayload([]byte(`{}`)); nil == err {
+		t.Error("expected error")
+	}
+}
@@ -208,6 +208,7 @@ func TestSlowQueriesBetterCAT(t *testing.T) {
 	}
 
 	txnEvent.BetterCAT.Inbound = &Payload{
+		HasNewRelicTraceInfo: true,
 		payloadCaller: payloadCaller{
 			TransportType: "HTTP",
 			Type:          "Browser",
@@ -28,8 +28,12 @@ type SpanEvent struct {
 	Name            string
 	Category        spanCategory
 	IsEntrypoint    bool
+	TrustedParentID string
+	TracingVendors  string
 	DatastoreExtras *spanDatastoreExtras
 	ExternalExtras  *spanExternalExtras
+
+	userAttributes spanAttributes
 }
 
 type spanDatastoreExtras struct {
@@ -44,13 +48,34 @@ type spanExternalExtras struct {
 	URL       string
 	Method    string
 	Component string
+	Timing    *ExternalTiming
 }
 
-// WriteJSON prepares JSON in the format expected by the collector.
-func (e *SpanEvent) WriteJSON(buf *bytes.Buffer) {
-	w := jsonFieldsWriter{buf: buf}
-	buf.WriteByte('[')
-	buf.WriteByte('{')
+// spanFieldsWriter allows the span event intrinsics to be written as JSON for
+// the collector and as a map for the trace observer.
+type spanFieldsWriter interface {
+	stringField(key string, val string)
+	intField(key string, val int64)
+	floatField(key string, val float64)
+	boolField(key string, val bool)
+	priorityField(key string, val Priority)
+}
+
+type spanJSONWriter struct{ jsonFieldsWriter }
+
+func (w *spanJSONWriter) priorityField(key string, val Priority) {
+	w.writerField(key, val)
+}
+
+type spanMapWriter map[string]interface{}
+
+func (w spanMapWriter) stringField(key string, val string)     { w[key] = val }
+func (w spanMapWriter) intField(key string, val int64)         { w[key] = val }
+func (w spanMapWriter) floatField(key string, val float64)     { w[key] = val }
+func (w spanMapWriter) boolField(key string, val bool)         { w[key] = val }
+func (w spanMapWriter) priorityField(key string, val Priority) { w[key] = val.Float32() }
+
+func (e *SpanEvent) writeIntrinsics(w spanFieldsWriter) {
 	w.stringField("type", "Span")
 	w.stringField("traceId", e.TraceID)
 	w.stringField("guid", e.GUID)
@@ -59,7 +84,7 @@ func (e *SpanEvent) WriteJSON(buf *bytes.Buffer) {
 	}
 	w.stringField("transactionId", e.TransactionID)
 	w.boolField("sampled", e.Sampled)
-	w.writerField("priority", e.Priority)
+	w.priorityField("priority", e.Priority)
 	w.intField("timestamp", e.Timestamp.UnixNano()/(1000*1000)) // in milliseconds
 	w.floatField("duration", e.Duration.Seconds())
 	w.stringField("name", e.Name)
@@ -67,6 +92,12 @@ func (e *SpanEvent) WriteJSON(buf *bytes.Buffer) {
 	if e.IsEntrypoint {
 		w.boolField("nr.entryPoint", true)
 	}
+	if "" != e.TrustedParentID {
+		w.stringField("trustedParentId", e.TrustedParentID)
+	}
+	if "" != e.TracingVendors {
+		w.stringField("tracingVendors", e.TracingVendors)
+	}
 	if ex := e.DatastoreExtras; nil != ex {
 		if "" != ex.Component {
 			w.stringField("component", ex.Component)
@@ -95,11 +126,47 @@ func (e *SpanEvent) WriteJSON(buf *bytes.Buffer) {
 		}
 		w.stringField("span.kind", "client")
 		w.stringField("component", "http")
+		if nil != ex.Timing {
+			ex.Timing.writeFields(w)
+		}
 	}
+}
+
+// Intrinsics returns the span event's intrinsic attributes in the form sent to
+// the trace observer.
+func (e *SpanEvent) Intrinsics() map[string]interface{} {
+	w := make(spanMapWriter)
+	e.writeIntrinsics(w)
+	return w
+}
+
+// UserAttributes returns the user attributes of the span event which are
+// destined for span events.
+func (e *SpanEvent) UserAttributes() map[string]interface{} {
+	attrs := make(map[string]interface{}, len(e.userAttributes))
+	for key, atr := range e.userAttributes {
+		if 0 != atr.dests&destSpan {
+			attrs[key] = atr.value
+		}
+	}
+	return attrs
+}
 
+// WriteJSON prepares JSON in the format expected by the collector.
+func (e *SpanEvent) WriteJSON(buf *bytes.Buffer) {
+	w := spanJSONWriter{jsonFieldsWriter{buf: buf}}
+	buf.WriteByte('[')
+	buf.WriteByte('{')
+	e.writeIntrinsics(&w)
 	buf.WriteByte('}')
 	buf.WriteByte(',')
 	buf.WriteByte('{')
+	uw := jsonFieldsWriter{buf: buf}
+	for key, atr := range e.userAttributes {
+		if 0 != atr.dests&destSpan {
+			writeAttributeValueJSON(&uw, key, atr.value)
+		}
+	}
 	buf.WriteByte('}')
 	buf.WriteByte(',')
 	buf.WriteByte('{')
@@ -126,11 +193,17 @@ func newSpanEvents(max int) *spanEvents {
 	}
 }
 
-func (events *spanEvents) addEvent(e *SpanEvent, cat *BetterCAT) {
+// setTransactionFields populates the fields which are shared by every span
+// event of the transaction.
+func (e *SpanEvent) setTransactionFields(cat *BetterCAT) {
 	e.TraceID = cat.TraceID()
 	e.TransactionID = cat.ID
 	e.Sampled = cat.Sampled
 	e.Priority = cat.Priority
+}
+
+func (events *spanEvents) addEvent(e *SpanEvent, cat *BetterCAT) {
+	e.setTransactionFields(cat)
 	events.addEventPopulated(e)
 }
 
@@ -142,6 +215,16 @@ func (events *spanEvents) addEventPopulated(e *SpanEvent) {
 // harvest's span events.  This should only be called if the transaction was
 // sampled and span events are enabled.
 func (events *spanEvents) MergeFromTransaction(txndata *TxnData) {
+	events.addEvent(txndata.rootSpanEvent(), &txndata.BetterCAT)
+
+	for _, evt := range txndata.spanEvents {
+		events.addEvent(evt, &txndata.BetterCAT)
+	}
+}
+
+// rootSpanEvent creates the span event of the transaction itself.  It should
+// be called once the transaction has ended.
+func (txndata *TxnData) rootSpanEvent() *SpanEvent {
 	root := &SpanEvent{
 		GUID:         txndata.getRootSpanID(),
 		Timestamp:    txndata.Start,
@@ -149,15 +232,15 @@ func (events *spanEvents) MergeFromTransaction(txndata *TxnData) {
 		Name:         txndata.FinalName,
 		Category:     spanCategoryGeneric,
 		IsEntrypoint: true,
-	}
-	if nil != txndata.BetterCAT.Inbound {
-		root.ParentID = txndata.BetterCAT.Inbound.ID
-	}
-	events.addEvent(root, &txndata.BetterCAT)
 
-	for _, evt := range txndata.spanEvents {
-		events.addEvent(evt, &txndata.BetterCAT)
+		userAttributes: txndata.rootSpanAttributes,
+	}
+	if p := txndata.BetterCAT.Inbound; nil != p {
+		root.ParentID = p.ID
+		root.TrustedParentID = p.TrustedParentID
+		root.TracingVendors = p.TracingVendors
 	}
+	return root
 }
 
 func (events *spanEvents) MergeIntoHarvest(h *Harvest) {
@@ -169,6 +169,79 @@ func TestSpanEventExternalMarshal(t *testing.T) {
 	{}]`)
 }
 
+func TestSpanEventExternalTimingMarshal(t *testing.T) {
+	e := sampleSpanEvent
+	e.Category = spanCategoryHTTP
+	e.ExternalExtras = &spanExternalExtras{
+		URL:    "http://url.com",
+		Method: "GET",
+		Timing: &ExternalTiming{
+			Connect:          2 * time.Millisecond,
+			Wait:             500 * time.Millisecond,
+			Response:         time.Second,
+			ConnectionReused: false,
+			RemoteAddress:    "10.0.0.1:80",
+		},
+	}
+
+	testSpanEventJSON(t, &e, `[
+	{
+		"type":"Span",
+		"traceId":"trace-id",
+		"guid":"guid",
+		"transactionId":"txn-id",
+		"sampled":true,
+		"priority":0.500000,
+		"timestamp":1488393111000,
+		"duration":2,
+		"name":"myName",
+		"category":"http",
+		"nr.entryPoint":true,
+		"http.url":"http://url.com",
+		"http.method":"GET",
+		"span.kind":"client",
+		"component":"http",
+		"http.connectDuration":0.002,
+		"http.waitDuration":0.5,
+		"http.responseDuration":1,
+		"http.connectionReused":false,
+		"peer.address":"10.0.0.1:80"
+	},
+	{},
+	{}]`)
+}
+
+func TestSpanEventIntrinsics(t *testing.T) {
+	e := sampleSpanEvent
+	e.ExternalExtras = &sampleSpanExternalExtras
+	intrinsics := e.Intrinsics()
+	expect := map[string]interface{}{
+		"type":          "Span",
+		"traceId":       "trace-id",
+		"guid":          "guid",
+		"transactionId": "txn-id",
+		"sampled":       true,
+		"priority":      float32(0.5),
+		"timestamp":     int64(1488393111000),
+		"duration":      float64(2),
+		"name":          "myName",
+		"category":      "generic",
+		"nr.entryPoint": true,
+		"http.url":      "http://url.com",
+		"http.method":   "GET",
+		"span.kind":     "client",
+		"component":     "http",
+	}
+	if len(intrinsics) != len(expect) {
+		t.Error(intrinsics)
+	}
+	for key, val := range expect {
+		if v := intrinsics[key]; v != val {
+			t.Errorf("key=%s expect=%#v actual=%#v", key, val, v)
+		}
+	}
+}
+
 func TestSpanEventsEndpointMethod(t *testing.T) {
 	events := &spanEvents{}
 	m := events.EndpointMethod()
@@ -187,8 +260,9 @@ func TestSpanEventsMergeFromTransaction(t *testing.T) {
 	args.BetterCAT.Enabled = true
 	args.BetterCAT.ID = "txn-id"
 	args.BetterCAT.Inbound = &Payload{
-		ID:       "inbound-id",
-		TracedID: "inbound-trace-id",
+		HasNewRelicTraceInfo: true,
+		ID:                   "inbound-id",
+		TracedID:             "inbound-trace-id",
 	}
 	args.rootSpanID = "root-span-id"
 
@@ -0,0 +1,365 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/newrelic/go-agent/internal/logger"
+)
+
+const (
+	// SpoolMaxBytes is the default limit of the total size of the spooled
+	// payloads.
+	SpoolMaxBytes = 16 * 1024 * 1024
+	// SpoolMaxAge is the default age after which spooled payloads are
+	// discarded rather than sent.
+	SpoolMaxAge = 4 * time.Hour
+
+	spoolFileSuffix = ".json"
+)
+
+// spoolEntry is the content of a spool file.
+type spoolEntry struct {
+	RunID string          `json:"run_id"`
+	Data  json.RawMessage `json:"data"`
+}
+
+type spoolSupportability struct {
+	spooled   float64
+	replayed  float64
+	discarded float64
+}
+
+// SpoolConfig contains the spool settings.
+type SpoolConfig struct {
+	Directory string
+	MaxBytes  int64
+	MaxAge    time.Duration
+	Logger    logger.Logger
+}
+
+// Spool stores harvest payloads which could not be sent in a directory so
+// that they can be sent once the application connects again, even after the
+// process restarts.  Each payload is a file in a subdirectory named after
+// the payload's data type, eg. "analytic_event_data".  Files are named after
+// the time they were written so that they are replayed in order.  All
+// methods are safe to use if the Spool is nil.
+type Spool struct {
+	SpoolConfig
+
+	sync.Mutex
+	// replaying prevents concurrent replays if the application
+	// reconnects while a replay is in progress.
+	replaying      bool
+	lastName       int64
+	supportability spoolSupportability
+}
+
+var errSpoolDirectoryMissing = errors.New("spool directory missing")
+
+// NewSpool creates the spool directory if necessary and returns a Spool.
+func NewSpool(cfg SpoolConfig) (*Spool, error) {
+	if "" == cfg.Directory {
+		return nil, errSpoolDirectoryMissing
+	}
+	if err := os.MkdirAll(cfg.Directory, 0700); nil != err {
+		return nil, err
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = SpoolMaxBytes
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = SpoolMaxAge
+	}
+	return &Spool{SpoolConfig: cfg}, nil
+}
+
+// spoolFile is a payload in the spool directory.
+type spoolFile struct {
+	cmd     string
+	path    string
+	size    int64
+	written time.Time
+}
+
+type spoolFilesByName []spoolFile
+
+func (fs spoolFilesByName) Len() int      { return len(fs) }
+func (fs spoolFilesByName) Swap(i, j int) { fs[i], fs[j] = fs[j], fs[i] }
+func (fs spoolFilesByName) Less(i, j int) bool {
+	return filepath.Base(fs[i].path) < filepath.Base(fs[j].path)
+}
+
+// files returns the spooled payloads, oldest first.  The spool must be
+// locked.
+func (s *Spool) files() []spoolFile {
+	var files []spoolFile
+	dirs, err := ioutil.ReadDir(s.Directory)
+	if nil != err {
+		return nil
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		entries, err := ioutil.ReadDir(filepath.Join(s.Directory, dir.Name()))
+		if nil != err {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasSuffix(e.Name(), spoolFileSuffix) {
+				continue
+			}
+			files = append(files, spoolFile{
+				cmd:     dir.Name(),
+				path:    filepath.Join(s.Directory, dir.Name(), e.Name()),
+				size:    e.Size(),
+				written: e.ModTime(),
+			})
+		}
+	}
+	sort.Sort(spoolFilesByName(files))
+	return files
+}
+
+// discard removes a spooled payload.  The spool must be locked.
+func (s *Spool) discard(f spoolFile, reason string) {
+	if err := os.Remove(f.path); nil != err {
+		return
+	}
+	s.supportability.discarded += float64(f.size)
+	if nil != s.Logger {
+		s.Logger.Debug("spooled payload discarded", map[string]interface{}{
+			"cmd":    f.cmd,
+			"bytes":  f.size,
+			"reason": reason,
+		})
+	}
+}
+
+// fileName returns a unique file name which sorts after the names of the
+// files previously written.  The spool must be locked.
+func (s *Spool) fileName(now time.Time) string {
+	name := now.UnixNano()
+	if name <= s.lastName {
+		name = s.lastName + 1
+	}
+	s.lastName = name
+	return fmt.Sprintf("%020d%s", name, spoolFileSuffix)
+}
+
+// Write stores a payload which could not be sent.  The oldest payloads are
+// discarded if the total size of the spool would exceed MaxBytes.
+func (s *Spool) Write(cmd, runID string, data []byte) error {
+	if nil == s {
+		return nil
+	}
+	js, err := json.Marshal(spoolEntry{RunID: runID, Data: data})
+	if nil != err {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	if int64(len(js)) > s.MaxBytes {
+		s.supportability.discarded += float64(len(js))
+		return fmt.Errorf("payload of %d bytes exceeds spool limit", len(js))
+	}
+	files := s.files()
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	for len(files) > 0 && total+int64(len(js)) > s.MaxBytes {
+		s.discard(files[0], "spool full")
+		total -= files[0].size
+		files = files[1:]
+	}
+
+	dir := filepath.Join(s.Directory, cmd)
+	if err := os.MkdirAll(dir, 0700); nil != err {
+		return err
+	}
+	// Write to a temporary file and rename it so that a crash does not
+	// leave a partial payload.
+	path := filepath.Join(dir, s.fileName(time.Now()))
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, js, 0600); nil != err {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); nil != err {
+		os.Remove(tmp)
+		return err
+	}
+	s.supportability.spooled += float64(len(js))
+	return nil
+}
+
+// replaceRunID replaces the agent run id if it is the first element of the
+// payload.  Slow query payloads do not contain the agent run id.
+func replaceRunID(data []json.RawMessage, oldRunID, newRunID string) {
+	if len(data) == 0 || oldRunID == newRunID {
+		return
+	}
+	var id string
+	if err := json.Unmarshal(data[0], &id); nil != err || id != oldRunID {
+		return
+	}
+	data[0], _ = json.Marshal(newRunID)
+}
+
+// eventLimit returns the reservoir size of event payloads, or zero for other
+// payloads.
+func eventLimit(cmd string, cfg HarvestConfig) int {
+	switch cmd {
+	case cmdTxnEvents:
+		return cfg.MaxTxnEvents
+	case cmdCustomEvents:
+		return cfg.MaxCustomEvents
+	case cmdErrorEvents:
+		return cfg.MaxErrorEvents
+	case cmdSpanEvents:
+		return cfg.MaxSpanEvents
+	}
+	return 0
+}
+
+// limitEvents removes the events of an event payload which exceed the
+// reservoir size of the current run.  Event payloads have the form
+// [runID, {"reservoir_size":N,"events_seen":M}, [events]].  The number of
+// events seen is retained so that the counts can be extrapolated.
+func limitEvents(data []json.RawMessage, limit int) error {
+	if len(data) != 3 || limit <= 0 {
+		return nil
+	}
+	var events []json.RawMessage
+	if err := json.Unmarshal(data[2], &events); nil != err {
+		return err
+	}
+	if len(events) <= limit {
+		return nil
+	}
+	var info map[string]interface{}
+	if err := json.Unmarshal(data[1], &info); nil != err {
+		return err
+	}
+	info["reservoir_size"] = limit
+	var err error
+	if data[1], err = json.Marshal(info); nil != err {
+		return err
+	}
+	data[2], err = json.Marshal(events[:limit])
+	return err
+}
+
+// preparePayload updates a spooled payload for the current run.
+func preparePayload(cmd string, e spoolEntry, runID string, cfg HarvestConfig) ([]byte, error) {
+	var data []json.RawMessage
+	if err := json.Unmarshal(e.Data, &data); nil != err {
+		return nil, err
+	}
+	replaceRunID(data, e.RunID, runID)
+	if err := limitEvents(data, eventLimit(cmd, cfg)); nil != err {
+		return nil, err
+	}
+	return json.Marshal(data)
+}
+
+// Replay sends the spooled payloads, oldest first, using the send function
+// provided.  Payloads older than MaxAge are discarded.  Payloads are removed
+// once sent or if New Relic rejects them.  Replay stops when the payload
+// could not be delivered so that the remaining payloads are retried after
+// the next connect.
+func (s *Spool) Replay(runID string, cfg HarvestConfig, now time.Time, send func(cmd string, data []byte) RPMResponse) {
+	if nil == s {
+		return
+	}
+	s.Lock()
+	if s.replaying {
+		s.Unlock()
+		return
+	}
+	s.replaying = true
+	files := s.files()
+	s.Unlock()
+
+	defer func() {
+		s.Lock()
+		s.replaying = false
+		s.Unlock()
+	}()
+
+	for _, f := range files {
+		s.Lock()
+		if now.Sub(f.written) > s.MaxAge {
+			s.discard(f, "expired")
+			s.Unlock()
+			continue
+		}
+		js, err := ioutil.ReadFile(f.path)
+		var payload []byte
+		if nil == err {
+			var e spoolEntry
+			if err = json.Unmarshal(js, &e); nil == err {
+				payload, err = preparePayload(f.cmd, e, runID, cfg)
+			}
+		}
+		if nil != err {
+			s.discard(f, err.Error())
+		}
+		s.Unlock()
+		if nil == payload {
+			continue
+		}
+
+		resp := send(f.cmd, payload)
+		if nil != resp.Err && resp.shouldSpool() {
+			if nil != s.Logger {
+				s.Logger.Warn("unable to replay spooled payload", map[string]interface{}{
+					"cmd":   f.cmd,
+					"error": resp.Err.Error(),
+				})
+			}
+			return
+		}
+
+		s.Lock()
+		if nil != resp.Err {
+			s.discard(f, resp.Err.Error())
+		} else if err := os.Remove(f.path); nil == err {
+			s.supportability.replayed += float64(f.size)
+		}
+		s.Unlock()
+	}
+}
+
+// MergeIntoHarvest adds the supportability metrics recorded since the last
+// harvest.  Nothing happens if s is nil.
+func (s *Spool) MergeIntoHarvest(h *Harvest) {
+	if nil == s {
+		return
+	}
+	s.Lock()
+	sup := s.supportability
+	s.supportability = spoolSupportability{}
+	s.Unlock()
+
+	if sup.spooled > 0 {
+		h.Metrics.addValue(spoolSpooledBytes, "", sup.spooled, forced)
+	}
+	if sup.replayed > 0 {
+		h.Metrics.addValue(spoolReplayedBytes, "", sup.replayed, forced)
+	}
+	if sup.discarded > 0 {
+		h.Metrics.addValue(spoolDiscardedBytes, "", sup.discarded, forced)
+	}
+}
@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testSpool(t *testing.T, maxBytes int64) (*Spool, func()) {
+	dir, err := ioutil.TempDir("", "spool")
+	if nil != err {
+		t.Fatal(err)
+	}
+	s, err := NewSpool(SpoolConfig{
+		Directory: filepath.Join(dir, "spool"),
+		MaxBytes:  maxBytes,
+		MaxAge:    time.Hour,
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	return s, func() { os.RemoveAll(dir) }
+}
+
+type replayed struct {
+	cmd  string
+	data string
+}
+
+func replayAll(s *Spool, runID string, cfg HarvestConfig, now time.Time, resp RPMResponse) []replayed {
+	var sent []replayed
+	s.Replay(runID, cfg, now, func(cmd string, data []byte) RPMResponse {
+		sent = append(sent, replayed{cmd: cmd, data: string(data)})
+		return resp
+	})
+	return sent
+}
+
+func TestSpoolNil(t *testing.T) {
+	var s *Spool
+	if err := s.Write(cmdErrorData, "run", []byte(`[]`)); nil != err {
+		t.Error(err)
+	}
+	s.Replay("run", DefaultHarvestConfig, time.Now(), func(cmd string, data []byte) RPMResponse {
+		t.Error("send called")
+		return RPMResponse{}
+	})
+	s.MergeIntoHarvest(NewHarvest(time.Now(), DefaultHarvestConfig))
+}
+
+func TestNewSpoolMissingDirectory(t *testing.T) {
+	s, err := NewSpool(SpoolConfig{})
+	if nil != s || errSpoolDirectoryMissing != err {
+		t.Error(s, err)
+	}
+}
+
+func TestSpoolReplay(t *testing.T) {
+	s, cleanup := testSpool(t, SpoolMaxBytes)
+	defer cleanup()
+
+	if err := s.Write(cmdErrorData, "old", []byte(`["old",[["error"]]]`)); nil != err {
+		t.Fatal(err)
+	}
+	if err := s.Write(cmdSlowSQLs, "old", []byte(`[[["sql"]]]`)); nil != err {
+		t.Fatal(err)
+	}
+	// A new spool using the same directory, as after a restart, replays
+	// the payloads written previously.
+	s2, err := NewSpool(s.SpoolConfig)
+	if nil != err {
+		t.Fatal(err)
+	}
+	sent := replayAll(s2, "new", DefaultHarvestConfig, time.Now(), RPMResponse{})
+	if len(sent) != 2 ||
+		sent[0] != (replayed{cmd: cmdErrorData, data: `["new",[["error"]]]`}) ||
+		sent[1] != (replayed{cmd: cmdSlowSQLs, data: `[[["sql"]]]`}) {
+		t.Fatal(sent)
+	}
+	if sent := replayAll(s2, "new", DefaultHarvestConfig, time.Now(), RPMResponse{}); len(sent) != 0 {
+		t.Error(sent)
+	}
+
+	h := NewHarvest(time.Now(), DefaultHarvestConfig)
+	s.MergeIntoHarvest(h)
+	s2.MergeIntoHarvest(h)
+	ExpectMetrics(t, h.Metrics, []WantMetric{
+		{spoolSpooledBytes, "", true, nil},
+		{spoolReplayedBytes, "", true, nil},
+	})
+	spooled := h.Metrics.metrics[metricID{Name: spoolSpooledBytes}].data.totalTolerated
+	replayedBytes := h.Metrics.metrics[metricID{Name: spoolReplayedBytes}].data.totalTolerated
+	if spooled <= 0 || spooled != replayedBytes {
+		t.Error(spooled, replayedBytes)
+	}
+
+	h = NewHarvest(time.Now(), DefaultHarvestConfig)
+	s2.MergeIntoHarvest(h)
+	ExpectMetrics(t, h.Metrics, []WantMetric{})
+}
+
+func TestSpoolReplayFailure(t *testing.T) {
+	s, cleanup := testSpool(t, SpoolMaxBytes)
+	defer cleanup()
+
+	s.Write(cmdErrorData, "run", []byte(`["run",[1]]`))
+	s.Write(cmdErrorData, "run", []byte(`["run",[2]]`))
+
+	// Replay stops when New Relic cannot be reached.
+	unreachable := RPMResponse{Err: errors.New("unreachable")}
+	if sent := replayAll(s, "run", DefaultHarvestConfig, time.Now(), unreachable); len(sent) != 1 {
+		t.Error(sent)
+	}
+	retry := newRPMResponse(503)
+	if sent := replayAll(s, "run", DefaultHarvestConfig, time.Now(), retry); len(sent) != 1 {
+		t.Error(sent)
+	}
+	// Rejected payloads are discarded.
+	rejected := newRPMResponse(413)
+	if sent := replayAll(s, "run", DefaultHarvestConfig, time.Now(), rejected); len(sent) != 2 {
+		t.Error(sent)
+	}
+	if sent := replayAll(s, "run", DefaultHarvestConfig, time.Now(), RPMResponse{}); len(sent) != 0 {
+		t.Error(sent)
+	}
+
+	h := NewHarvest(time.Now(), DefaultHarvestConfig)
+	s.MergeIntoHarvest(h)
+	ExpectMetrics(t, h.Metrics, []WantMetric{
+		{spoolSpooledBytes, "", true, nil},
+		{spoolDiscardedBytes, "", true, nil},
+	})
+}
+
+func TestSpoolExpired(t *testing.T) {
+	s, cleanup := testSpool(t, SpoolMaxBytes)
+	defer cleanup()
+
+	s.Write(cmdErrorData, "run", []byte(`["run",[]]`))
+	later := time.Now().Add(2 * time.Hour)
+	if sent := replayAll(s, "run", DefaultHarvestConfig, later, RPMResponse{}); len(sent) != 0 {
+		t.Error(sent)
+	}
+	if files := s.files(); len(files) != 0 {
+		t.Error(files)
+	}
+}
+
+func TestSpoolMaxBytes(t *testing.T) {
+	s, cleanup := testSpool(t, 100)
+	defer cleanup()
+
+	payload := []byte(`["run",[1,2,3,4,5,6,7,8,9,10]]`)
+	for i := 0; i < 5; i++ {
+		if err := s.Write(cmdErrorData, "run", payload); nil != err {
+			t.Fatal(err)
+		}
+	}
+	var total int64
+	for _, f := range s.files() {
+		total += f.size
+	}
+	if total > 100 || total == 0 {
+		t.Error(total)
+	}
+	if err := s.Write(cmdErrorData, "run", make([]byte, 200)); nil == err {
+		t.Error("oversized payload spooled")
+	}
+
+	h := NewHarvest(time.Now(), DefaultHarvestConfig)
+	s.MergeIntoHarvest(h)
+	ExpectMetrics(t, h.Metrics, []WantMetric{
+		{spoolSpooledBytes, "", true, nil},
+		{spoolDiscardedBytes, "", true, nil},
+	})
+}
+
+func TestSpoolReplayLimitsEvents(t *testing.T) {
+	s, cleanup := testSpool(t, SpoolMaxBytes)
+	defer cleanup()
+
+	s.Write(cmdCustomEvents, "old", []byte(`["old",{"reservoir_size":10,"events_seen":5},[1,2,3,4,5]]`))
+	s.Write(cmdTxnEvents, "old", []byte(`["old",{"reservoir_size":10,"events_seen":5},[1,2,3,4,5]]`))
+
+	cfg := DefaultHarvestConfig
+	cfg.MaxCustomEvents = 2
+	sent := replayAll(s, "new", cfg, time.Now(), RPMResponse{})
+	if len(sent) != 2 ||
+		sent[0] != (replayed{cmd: cmdCustomEvents, data: `["new",{"events_seen":5,"reservoir_size":2},[1,2]]`}) ||
+		sent[1] != (replayed{cmd: cmdTxnEvents, data: `["new",{"reservoir_size":10,"events_seen":5},[1,2,3,4,5]]`}) {
+		t.Error(sent)
+	}
+}
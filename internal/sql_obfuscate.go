@@ -0,0 +1,356 @@
+package internal
+
+import (
+	"strings"
+)
+
+// SQL obfuscation replaces the literal values in a query with '?'.  The
+// approach is shared with the other New Relic agents: each dialect has a list
+// of literal components (quoted strings, numbers, comments, etc) which are
+// matched at each position of the query in order.  Go's regexp package does
+// not support the lookaheads and backreferences of the regular expressions used
+// by the other agents, so the components are matched by hand.
+//
+// If the query still contains quotes or comment delimiters after obfuscation
+// then it is malformed (for example, it has an unterminated string literal)
+// and literal values cannot be reliably found.  In this case the entire query
+// is replaced.
+
+// sqlDialect determines which literal components are recognized.
+type sqlDialect int
+
+const (
+	sqlDialectFallback sqlDialect = iota
+	sqlDialectMySQL
+	sqlDialectPostgres
+	sqlDialectSQLite
+	sqlDialectOracle
+	sqlDialectCassandra
+)
+
+const (
+	obfuscatedPlaceholder = "?"
+)
+
+// sqlComponent returns the end of the literal beginning at position i, or -1
+// if there is no literal at position i.
+type sqlComponent func(query string, i int) int
+
+var (
+	sqlDialectComponents = map[sqlDialect][]sqlComponent{
+		sqlDialectFallback: {
+			matchSingleQuotes, matchDoubleQuotes, matchDollarQuotes,
+			matchUUID, matchNumber, matchBoolean, matchHex,
+			matchLineComment, matchMultiLineComment, matchOracleQuotes,
+		},
+		sqlDialectMySQL: {
+			matchSingleQuotes, matchDoubleQuotes, matchNumber,
+			matchBoolean, matchHex, matchLineComment,
+			matchMultiLineComment,
+		},
+		sqlDialectPostgres: {
+			matchSingleQuotes, matchDollarQuotes, matchUUID,
+			matchNumber, matchBoolean, matchLineComment,
+			matchMultiLineComment,
+		},
+		sqlDialectSQLite: {
+			matchSingleQuotes, matchNumber, matchBoolean, matchHex,
+			matchLineComment, matchMultiLineComment,
+		},
+		sqlDialectOracle: {
+			matchSingleQuotes, matchOracleQuotes, matchNumber,
+			matchLineComment, matchMultiLineComment,
+		},
+		sqlDialectCassandra: {
+			matchSingleQuotes, matchUUID, matchNumber, matchBoolean,
+			matchHex, matchLineComment, matchMultiLineComment,
+		},
+	}
+)
+
+func sqlDialectForProduct(product string) sqlDialect {
+	switch product {
+	case "MySQL":
+		return sqlDialectMySQL
+	case "Postgres":
+		return sqlDialectPostgres
+	case "SQLite":
+		return sqlDialectSQLite
+	case "Oracle":
+		return sqlDialectOracle
+	case "Cassandra":
+		return sqlDialectCassandra
+	default:
+		return sqlDialectFallback
+	}
+}
+
+// ObfuscateSQL replaces the literal values in the query with '?'.  The product
+// is the datastore product, eg. "MySQL" or "Postgres", and is used to determine
+// the quoting rules.  If the query is malformed then "?" is returned.
+func ObfuscateSQL(query string, product string) string {
+	return obfuscateSQL(query, sqlDialectForProduct(product))
+}
+
+func obfuscateSQL(query string, dialect sqlDialect) string {
+	components := sqlDialectComponents[dialect]
+	buf := make([]byte, 0, len(query))
+	for i := 0; i < len(query); {
+		end := -1
+		for _, match := range components {
+			if end = match(query, i); end > i {
+				break
+			}
+		}
+		if end > i {
+			buf = append(buf, obfuscatedPlaceholder...)
+			i = end
+		} else {
+			buf = append(buf, query[i])
+			i++
+		}
+	}
+	obfuscated := string(buf)
+	if sqlMalformed(obfuscated, dialect) {
+		return obfuscatedPlaceholder
+	}
+	return obfuscated
+}
+
+// sqlMalformed returns true if the obfuscated query contains quotes or
+// comment delimiters.
+func sqlMalformed(obfuscated string, dialect sqlDialect) bool {
+	if strings.ContainsAny(obfuscated, "'") ||
+		strings.Contains(obfuscated, "/*") ||
+		strings.Contains(obfuscated, "*/") {
+		return true
+	}
+	switch dialect {
+	case sqlDialectMySQL, sqlDialectFallback:
+		return strings.Contains(obfuscated, `"`)
+	case sqlDialectPostgres:
+		// Dollar signs are only expected in front of numbered
+		// parameters, which have been replaced.
+		for i := 0; i < len(obfuscated); i++ {
+			if '$' == obfuscated[i] && (i+1 == len(obfuscated) || '?' != obfuscated[i+1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isSQLWordChar(c byte) bool {
+	return ('a' <= c && c <= 'z') ||
+		('A' <= c && c <= 'Z') ||
+		('0' <= c && c <= '9') ||
+		'_' == c
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func skipDigits(query string, i int) int {
+	for i < len(query) && isDigit(query[i]) {
+		i++
+	}
+	return i
+}
+
+// endOfLine returns the position of the next line break, or the end of the
+// query.
+func endOfLine(query string, i int) int {
+	if idx := strings.IndexAny(query[i:], "\r\n"); idx >= 0 {
+		return i + idx
+	}
+	return len(query)
+}
+
+// matchQuoted matches a string quoted with q.  Twin quotes are an escaped
+// quote.  A backslash escaped quote may or may not end the string depending on
+// the database settings, and so the rest of the line is treated as part of the
+// string.
+func matchQuoted(query string, i int, q byte) int {
+	if query[i] != q {
+		return -1
+	}
+	for j := i + 1; j < len(query); j++ {
+		switch query[j] {
+		case '\\':
+			if j+1 < len(query) && q == query[j+1] {
+				return endOfLine(query, j+2)
+			}
+		case q:
+			if j+1 < len(query) && q == query[j+1] {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return -1
+}
+
+func matchSingleQuotes(query string, i int) int { return matchQuoted(query, i, '\'') }
+func matchDoubleQuotes(query string, i int) int { return matchQuoted(query, i, '"') }
+
+// matchDollarQuotes matches Postgres dollar quoted strings such as
+// "$tag$contents$tag$".  Numbered parameters such as "$1" are not matched.
+func matchDollarQuotes(query string, i int) int {
+	if '$' != query[i] || (i > 0 && isSQLWordChar(query[i-1])) {
+		return -1
+	}
+	j := i + 1
+	if j < len(query) && isDigit(query[j]) {
+		return -1
+	}
+	for j < len(query) && isSQLWordChar(query[j]) {
+		j++
+	}
+	if j >= len(query) || '$' != query[j] {
+		return -1
+	}
+	tag := query[i : j+1]
+	idx := strings.Index(query[j+1:], tag)
+	if idx < 0 {
+		return -1
+	}
+	return j + 1 + idx + len(tag)
+}
+
+// matchUUID matches 32 hex digits separated by any number of dashes, with
+// optional surrounding braces.
+func matchUUID(query string, i int) int {
+	j := i
+	if '{' == query[j] {
+		j++
+	}
+	for n := 0; n < 32; n++ {
+		if j >= len(query) || !isHexDigit(query[j]) {
+			return -1
+		}
+		j++
+		for j < len(query) && '-' == query[j] {
+			j++
+		}
+	}
+	if j < len(query) && '}' == query[j] {
+		j++
+	}
+	return j
+}
+
+// matchNumber matches integer, decimal, and exponential numeric literals which
+// are not part of an identifier, with an optional leading minus sign.
+func matchNumber(query string, i int) int {
+	j := i
+	if '-' == query[j] {
+		j++
+	} else if i > 0 && isSQLWordChar(query[i-1]) {
+		return -1
+	}
+	if j >= len(query) || !isDigit(query[j]) {
+		return -1
+	}
+	j = skipDigits(query, j)
+	if j+1 < len(query) && '.' == query[j] && isDigit(query[j+1]) {
+		if end := matchExponent(query, skipDigits(query, j+1)); end > 0 {
+			return end
+		}
+	}
+	return matchExponent(query, j)
+}
+
+// matchExponent matches an optional exponent which must be followed by a word
+// boundary.
+func matchExponent(query string, j int) int {
+	if j < len(query) && ('e' == query[j] || 'E' == query[j]) {
+		k := j + 1
+		if k < len(query) && ('+' == query[k] || '-' == query[k]) {
+			k++
+		}
+		if k < len(query) && isDigit(query[k]) {
+			k = skipDigits(query, k)
+			if k == len(query) || !isSQLWordChar(query[k]) {
+				return k
+			}
+		}
+	}
+	if j == len(query) || !isSQLWordChar(query[j]) {
+		return j
+	}
+	return -1
+}
+
+var (
+	sqlBooleans = []string{"true", "false", "null"}
+)
+
+func matchBoolean(query string, i int) int {
+	if i > 0 && isSQLWordChar(query[i-1]) {
+		return -1
+	}
+	for _, b := range sqlBooleans {
+		end := i + len(b)
+		if end <= len(query) &&
+			strings.EqualFold(query[i:end], b) &&
+			(end == len(query) || !isSQLWordChar(query[end])) {
+			return end
+		}
+	}
+	return -1
+}
+
+func matchHex(query string, i int) int {
+	if !strings.HasPrefix(query[i:], "0x") {
+		return -1
+	}
+	j := i + 2
+	for j < len(query) && isHexDigit(query[j]) {
+		j++
+	}
+	if j == i+2 {
+		return -1
+	}
+	return j
+}
+
+func matchLineComment(query string, i int) int {
+	if '#' == query[i] || strings.HasPrefix(query[i:], "--") {
+		return endOfLine(query, i)
+	}
+	return -1
+}
+
+func matchMultiLineComment(query string, i int) int {
+	if !strings.HasPrefix(query[i:], "/*") {
+		return -1
+	}
+	if idx := strings.Index(query[i+2:], "*/"); idx >= 0 {
+		return i + 2 + idx + 2
+	}
+	return -1
+}
+
+var (
+	oracleQuoteClosers = map[byte]byte{'[': ']', '{': '}', '<': '>', '(': ')'}
+)
+
+// matchOracleQuotes matches Oracle alternative quoting such as q'[it's]'.
+func matchOracleQuotes(query string, i int) int {
+	if i+2 >= len(query) || ('q' != query[i] && 'Q' != query[i]) || '\'' != query[i+1] {
+		return -1
+	}
+	closer, ok := oracleQuoteClosers[query[i+2]]
+	if !ok {
+		return -1
+	}
+	end := endOfLine(query, i+3)
+	if idx := strings.Index(query[i+3:end], string([]byte{closer, '\''})); idx >= 0 {
+		return i + 3 + idx + 2
+	}
+	return end
+}
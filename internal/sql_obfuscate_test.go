@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/newrelic/go-agent/internal/crossagent"
+)
+
+func TestCrossAgentSQLObfuscation(t *testing.T) {
+	var tcs []struct {
+		Name       string   `json:"name"`
+		SQL        string   `json:"sql"`
+		Obfuscated []string `json:"obfuscated"`
+		Dialects   []string `json:"dialects"`
+	}
+	if err := crossagent.ReadJSON("sql_obfuscation/sql_obfuscation.json", &tcs); err != nil {
+		t.Fatal(err)
+	}
+
+	dialects := map[string]sqlDialect{
+		"mysql":     sqlDialectMySQL,
+		"postgres":  sqlDialectPostgres,
+		"sqlite":    sqlDialectSQLite,
+		"oracle":    sqlDialectOracle,
+		"cassandra": sqlDialectCassandra,
+	}
+
+	for _, tc := range tcs {
+		for _, name := range tc.Dialects {
+			dialect, ok := dialects[name]
+			if !ok {
+				t.Fatal(tc.Name, "unknown dialect", name)
+			}
+			out := obfuscateSQL(tc.SQL, dialect)
+			found := false
+			for _, expect := range tc.Obfuscated {
+				if out == expect {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Errorf("%s (%s): got %q, expected one of %q", tc.Name, name, out, tc.Obfuscated)
+			}
+		}
+	}
+}
+
+func TestObfuscateSQL(t *testing.T) {
+	testcases := []struct {
+		product string
+		input   string
+		expect  string
+	}{
+		{product: "MySQL", input: "SELECT * FROM users WHERE id = 123", expect: "SELECT * FROM users WHERE id = ?"},
+		{product: "MySQL", input: `SELECT * FROM users WHERE name = "bob"`, expect: "SELECT * FROM users WHERE name = ?"},
+		{product: "MySQL", input: "SELECT * FROM users WHERE id = ?", expect: "SELECT * FROM users WHERE id = ?"},
+		{product: "Postgres", input: `SELECT * FROM "users" WHERE id = $1`, expect: `SELECT * FROM "users" WHERE id = $?`},
+		{product: "Postgres", input: "SELECT $$multi\nline$$", expect: "SELECT ?"},
+		{product: "Postgres", input: "SELECT $tag$unterminated", expect: "?"},
+		{product: "SQLite", input: "SELECT * FROM t WHERE a = 1.5e10", expect: "SELECT * FROM t WHERE a = ?"},
+		{product: "Oracle", input: "SELECT * FROM t WHERE a = q'[unterminated", expect: "SELECT * FROM t WHERE a = ?"},
+		{product: "MongoDB", input: `SELECT * FROM t WHERE a = "b" AND c = 'd'`, expect: "SELECT * FROM t WHERE a = ? AND c = ?"},
+		{product: "", input: `SELECT * FROM t WHERE a = "unterminated`, expect: "?"},
+		{product: "MySQL", input: "SELECT * FROM t /* unterminated", expect: "?"},
+		{product: "MySQL", input: "SELECT * FROM t */", expect: "?"},
+		{product: "MySQL", input: "SELECT col1, t2.col2 FROM t2", expect: "SELECT col1, t2.col2 FROM t2"},
+		{product: "MySQL", input: "SELECT * FROM t WHERE a = 123abc", expect: "SELECT * FROM t WHERE a = 123abc"},
+		{product: "MySQL", input: "", expect: ""},
+	}
+
+	for _, tc := range testcases {
+		if out := ObfuscateSQL(tc.input, tc.product); out != tc.expect {
+			t.Errorf("product=%q input=%q got=%q expect=%q", tc.product, tc.input, out, tc.expect)
+		}
+	}
+}
+
+func BenchmarkObfuscateSQL(b *testing.B) {
+	query := "SELECT * FROM users WHERE name = 'bob' AND age > 21 /* comment */ AND id IN (1, 2, 3)"
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ObfuscateSQL(query, "MySQL")
+	}
+}
@@ -0,0 +1,97 @@
+// Package sqlparse extracts the operation and collection from SQL queries for
+// the database/sql driver integrations.
+package sqlparse
+
+import (
+	"regexp"
+	"strings"
+
+	newrelic "github.com/newrelic/go-agent"
+)
+
+const (
+	// identifierPattern matches a table name, which may be schema
+	// qualified and quoted.  The quotes are removed by quoteReplacer.
+	identifierPattern = "([`\"\\[\\]a-zA-Z0-9_$.]+)"
+	// tablePattern matches the table following a keyword.  Subqueries
+	// such as "FROM (SELECT ...)" do not match, so the search continues
+	// to the inner table.
+	tablePattern = `\s+` + identifierPattern
+)
+
+var (
+	cCommentRegex    = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	lineCommentRegex = regexp.MustCompile(`(?m)--.*$`)
+	// mysqlLineCommentRegex also matches MySQL's "#" comments.  Other
+	// databases use "#" as an operator, such as Postgres's bitwise XOR.
+	mysqlLineCommentRegex = regexp.MustCompile(`(?m)(?:--|#).*$`)
+	firstWordRegex        = regexp.MustCompile(`^[\s;(]*([a-zA-Z]+)`)
+	quoteReplacer         = strings.NewReplacer("`", "", `"`, "", "[", "", "]", "")
+
+	sqlOperations = map[string]*regexp.Regexp{
+		"select":   regexp.MustCompile(`(?is)\sfrom` + tablePattern),
+		"delete":   regexp.MustCompile(`(?is)\sfrom` + tablePattern),
+		"insert":   regexp.MustCompile(`(?is)\sinto` + tablePattern),
+		"replace":  regexp.MustCompile(`(?is)\sinto` + tablePattern),
+		"update":   regexp.MustCompile(`(?is)^\s*update(?:\s+(?:low_priority|ignore|only|or\s+(?:rollback|abort|replace|fail|ignore)))*` + tablePattern),
+		"call":     regexp.MustCompile(`(?is)^\s*call` + tablePattern),
+		"exec":     regexp.MustCompile(`(?is)^\s*exec(?:ute)?` + tablePattern),
+		"execute":  regexp.MustCompile(`(?is)^\s*exec(?:ute)?` + tablePattern),
+		"create":   nil,
+		"drop":     nil,
+		"alter":    nil,
+		"truncate": regexp.MustCompile(`(?is)^\s*truncate(?:\s+table)?` + tablePattern),
+		"show":     nil,
+		"set":      nil,
+		"begin":    nil,
+		"commit":   nil,
+		"rollback": nil,
+		"with":     nil,
+	}
+)
+
+// ParseQuery populates the Operation and Collection fields of the segment
+// using the query.  The operation is the lower case first keyword of the
+// query, or "other" if it is not recognized.  The collection is the table
+// being operated on, if it can be found.
+//
+// ParseQuery is designed to be used as the ParseQuery field of
+// newrelic.SQLDriverSegmentBuilder.
+func ParseQuery(segment *newrelic.DatastoreSegment, query string) {
+	parseQuery(segment, query, lineCommentRegex)
+}
+
+// ParseMySQLQuery is ParseQuery for MySQL queries, which may also contain
+// "#" line comments.
+func ParseMySQLQuery(segment *newrelic.DatastoreSegment, query string) {
+	parseQuery(segment, query, mysqlLineCommentRegex)
+}
+
+func parseQuery(segment *newrelic.DatastoreSegment, query string, lineComment *regexp.Regexp) {
+	s := cCommentRegex.ReplaceAllString(query, "")
+	s = lineComment.ReplaceAllString(s, "")
+
+	m := firstWordRegex.FindStringSubmatch(s)
+	if nil == m {
+		segment.Operation = "other"
+		return
+	}
+	op := strings.ToLower(m[1])
+	rgx, ok := sqlOperations[op]
+	if !ok {
+		segment.Operation = "other"
+		return
+	}
+	if "with" == op {
+		// Common table expressions are usually selects, but the
+		// table cannot be reliably found.
+		op = "select"
+	}
+	segment.Operation = op
+	if nil == rgx {
+		return
+	}
+	if m := rgx.FindStringSubmatch(s); nil != m {
+		segment.Collection = quoteReplacer.Replace(m[1])
+	}
+}
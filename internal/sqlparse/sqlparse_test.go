@@ -0,0 +1,79 @@
+package sqlparse
+
+import (
+	"testing"
+
+	newrelic "github.com/newrelic/go-agent"
+)
+
+func TestParseQuery(t *testing.T) {
+	testcases := []struct {
+		query      string
+		operation  string
+		collection string
+	}{
+		{query: "SELECT * FROM users WHERE id = ?", operation: "select", collection: "users"},
+		{query: "select name\nfrom\tusers", operation: "select", collection: "users"},
+		{query: "SELECT a.id FROM `my_db`.`users` a", operation: "select", collection: "my_db.users"},
+		{query: `SELECT * FROM "users"`, operation: "select", collection: "users"},
+		{query: "SELECT * FROM [users]", operation: "select", collection: "users"},
+		{query: "SELECT * FROM public.users", operation: "select", collection: "public.users"},
+		{query: "SELECT * FROM (SELECT id FROM users) AS u", operation: "select", collection: "users"},
+		{query: "SELECT 1", operation: "select", collection: ""},
+		{query: "/* comment */ SELECT * FROM users", operation: "select", collection: "users"},
+		{query: "-- comment\nSELECT * FROM users", operation: "select", collection: "users"},
+		{query: "SELECT * /* from comments */ FROM users", operation: "select", collection: "users"},
+		{query: "SELECT a # b FROM users", operation: "select", collection: "users"},
+		{query: "(SELECT * FROM users)", operation: "select", collection: "users"},
+		{query: "INSERT INTO users (name) VALUES (?)", operation: "insert", collection: "users"},
+		{query: "insert into users(name) values ($1)", operation: "insert", collection: "users"},
+		{query: "REPLACE INTO users VALUES (?)", operation: "replace", collection: "users"},
+		{query: "UPDATE users SET name = ?", operation: "update", collection: "users"},
+		{query: "UPDATE LOW_PRIORITY IGNORE users SET name = ?", operation: "update", collection: "users"},
+		{query: "UPDATE OR REPLACE users SET name = ?", operation: "update", collection: "users"},
+		{query: "DELETE FROM users WHERE id = ?", operation: "delete", collection: "users"},
+		{query: "CALL get_users(?)", operation: "call", collection: "get_users"},
+		{query: "EXEC get_users", operation: "exec", collection: "get_users"},
+		{query: "TRUNCATE TABLE users", operation: "truncate", collection: "users"},
+		{query: "CREATE TABLE users (id int)", operation: "create", collection: ""},
+		{query: "WITH u AS (SELECT * FROM users) SELECT * FROM u", operation: "select", collection: ""},
+		{query: "BEGIN", operation: "begin", collection: ""},
+		{query: "VACUUM", operation: "other", collection: ""},
+		{query: "", operation: "other", collection: ""},
+		{query: "   ", operation: "other", collection: ""},
+	}
+
+	for _, tc := range testcases {
+		s := &newrelic.DatastoreSegment{}
+		ParseQuery(s, tc.query)
+		if s.Operation != tc.operation {
+			t.Errorf("query=%q operation=%q expected=%q", tc.query, s.Operation, tc.operation)
+		}
+		if s.Collection != tc.collection {
+			t.Errorf("query=%q collection=%q expected=%q", tc.query, s.Collection, tc.collection)
+		}
+	}
+}
+
+func TestParseMySQLQuery(t *testing.T) {
+	testcases := []struct {
+		query      string
+		operation  string
+		collection string
+	}{
+		{query: "# comment\nSELECT * FROM users", operation: "select", collection: "users"},
+		{query: "SELECT * # from comment\nFROM users", operation: "select", collection: "users"},
+		{query: "-- comment\nSELECT * FROM users", operation: "select", collection: "users"},
+	}
+
+	for _, tc := range testcases {
+		s := &newrelic.DatastoreSegment{}
+		ParseMySQLQuery(s, tc.query)
+		if s.Operation != tc.operation {
+			t.Errorf("query=%q operation=%q expected=%q", tc.query, s.Operation, tc.operation)
+		}
+		if s.Collection != tc.collection {
+			t.Errorf("query=%q collection=%q expected=%q", tc.query, s.Collection, tc.collection)
+		}
+	}
+}
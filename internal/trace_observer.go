@@ -0,0 +1,258 @@
+package internal
+
+import (
+	"sync"
+	"time"
+
+	"github.com/newrelic/go-agent/internal/logger"
+)
+
+// TraceObserverStream is a long lived stream of span events to a trace
+// observer.  Send may return an error received asynchronously from the trace
+// observer, in which case the stream is closed and a new one is opened.
+type TraceObserverStream interface {
+	Send(e *SpanEvent) error
+	Close() error
+}
+
+// TraceObserverDialer opens streams to a trace observer.  It is implemented
+// by the nrinfinitetracing integration so that the agent core does not depend
+// on gRPC.
+type TraceObserverDialer interface {
+	DialTraceObserver(license string, runID AgentRunID) (TraceObserverStream, error)
+}
+
+// TraceObserverConfig contains the settings used by NewTraceObserver.
+type TraceObserverConfig struct {
+	Dialer    TraceObserverDialer
+	License   string
+	QueueSize int
+	Logger    logger.Logger
+}
+
+// TraceObserver sends every span event to a trace observer as the span ends.
+// Span events are placed in a bounded queue and sent by a single goroutine
+// over a long lived stream.  Span events are dropped when the queue is full.
+// TraceObserver is safe for concurrent use.
+type TraceObserver struct {
+	dialer  TraceObserverDialer
+	license string
+	logger  logger.Logger
+
+	queue    chan *SpanEvent
+	runIDs   chan AgentRunID
+	shutdown chan struct{}
+	done     chan struct{}
+
+	// backoff is the initial wait after a failed dial or a stream
+	// error.  It is doubled until traceObserverBackoffLimit is reached.
+	backoff time.Duration
+
+	sync.Mutex
+	supportability traceObserverSupportability
+}
+
+type traceObserverSupportability struct {
+	seen     float64
+	sent     float64
+	dropped  float64
+	restarts float64
+}
+
+// NewTraceObserver creates a TraceObserver and starts its goroutine.  Span
+// events are queued but not sent until SetRunID is called.
+func NewTraceObserver(cfg TraceObserverConfig) *TraceObserver {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = TraceObserverQueueSize
+	}
+	to := &TraceObserver{
+		dialer:   cfg.Dialer,
+		license:  cfg.License,
+		logger:   cfg.Logger,
+		queue:    make(chan *SpanEvent, cfg.QueueSize),
+		runIDs:   make(chan AgentRunID, 1),
+		shutdown: make(chan struct{}),
+		done:     make(chan struct{}),
+		backoff:  traceObserverBackoffStart,
+	}
+	go to.run()
+	return to
+}
+
+// Consume queues the span event without blocking.  The event is dropped if
+// the queue is full.
+func (to *TraceObserver) Consume(e *SpanEvent) {
+	select {
+	case to.queue <- e:
+		to.record(func(s *traceObserverSupportability) { s.seen++ })
+	default:
+		to.record(func(s *traceObserverSupportability) { s.seen++; s.dropped++ })
+	}
+}
+
+// SetRunID restarts the stream using the agent run id provided.  It should be
+// called each time the application connects.  Nothing happens if to is nil.
+func (to *TraceObserver) SetRunID(id AgentRunID) {
+	if nil == to {
+		return
+	}
+	for {
+		select {
+		case to.runIDs <- id:
+			return
+		case <-to.runIDs:
+			// Replace a run id which has not yet been used.
+		}
+	}
+}
+
+// Shutdown sends the queued span events and closes the stream.  It blocks
+// until this is complete or the timeout is reached.  Nothing happens if to is
+// nil.
+func (to *TraceObserver) Shutdown(timeout time.Duration) {
+	if nil == to {
+		return
+	}
+	select {
+	case <-to.shutdown:
+	default:
+		close(to.shutdown)
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-to.done:
+	case <-t.C:
+	}
+}
+
+func (to *TraceObserver) record(f func(*traceObserverSupportability)) {
+	to.Lock()
+	defer to.Unlock()
+	f(&to.supportability)
+}
+
+// MergeIntoHarvest adds the supportability metrics recorded since the last
+// harvest.  Nothing happens if to is nil.
+func (to *TraceObserver) MergeIntoHarvest(h *Harvest) {
+	if nil == to {
+		return
+	}
+	to.Lock()
+	s := to.supportability
+	to.supportability = traceObserverSupportability{}
+	to.Unlock()
+
+	h.Metrics.addCount(traceObserverSpansSeen, s.seen, forced)
+	h.Metrics.addCount(traceObserverSpansSent, s.sent, forced)
+	if s.dropped > 0 {
+		h.Metrics.addCount(traceObserverQueueDumped, s.dropped, forced)
+	}
+	if s.restarts > 0 {
+		h.Metrics.addCount(traceObserverResponseError, s.restarts, forced)
+	}
+}
+
+// wait sleeps for the backoff period and doubles it.  It returns false if
+// shutdown began while waiting.
+func (to *TraceObserver) wait(backoff *time.Duration) bool {
+	t := time.NewTimer(*backoff)
+	defer t.Stop()
+	if *backoff < traceObserverBackoffLimit {
+		*backoff *= 2
+	}
+	select {
+	case <-t.C:
+		return true
+	case <-to.shutdown:
+		return false
+	}
+}
+
+func (to *TraceObserver) run() {
+	defer close(to.done)
+
+	var runID AgentRunID
+	select {
+	case runID = <-to.runIDs:
+	case <-to.shutdown:
+		// The queued span events may still be sent if a run id has
+		// been provided.
+		select {
+		case runID = <-to.runIDs:
+		default:
+			return
+		}
+	}
+
+	backoff := to.backoff
+	for {
+		stream, err := to.dialer.DialTraceObserver(to.license, runID)
+		if nil != err {
+			to.logger.Warn("trace observer connect failure", map[string]interface{}{
+				"error": err.Error(),
+			})
+			if !to.wait(&backoff) {
+				return
+			}
+			continue
+		}
+
+		var restart bool
+		runID, restart, err = to.sendSpans(stream, runID, &backoff)
+		if closeErr := stream.Close(); nil == err {
+			err = closeErr
+		}
+		if !restart {
+			return
+		}
+		if nil != err {
+			to.record(func(s *traceObserverSupportability) { s.restarts++ })
+			to.logger.Warn("trace observer stream failure", map[string]interface{}{
+				"error": err.Error(),
+			})
+			if !to.wait(&backoff) {
+				return
+			}
+			continue
+		}
+		backoff = to.backoff
+	}
+}
+
+// sendSpans sends span events until the stream fails, the run id changes, or
+// shutdown begins.  It returns the run id to use for the next stream and
+// whether a new stream should be opened.  The backoff is reset once a span
+// event has been sent, so that a stream failure after a period of successful
+// sending is retried quickly.
+func (to *TraceObserver) sendSpans(stream TraceObserverStream, runID AgentRunID, backoff *time.Duration) (AgentRunID, bool, error) {
+	send := func(e *SpanEvent) error {
+		if err := stream.Send(e); nil != err {
+			return err
+		}
+		*backoff = to.backoff
+		to.record(func(s *traceObserverSupportability) { s.sent++ })
+		return nil
+	}
+	for {
+		select {
+		case e := <-to.queue:
+			if err := send(e); nil != err {
+				return runID, true, err
+			}
+		case id := <-to.runIDs:
+			return id, true, nil
+		case <-to.shutdown:
+			for {
+				select {
+				case e := <-to.queue:
+					if err := send(e); nil != err {
+						return runID, false, err
+					}
+				default:
+					return runID, false, nil
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package internal
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/internal/logger"
+)
+
+type testObserverStream struct {
+	dialer *testObserverDialer
+	runID  AgentRunID
+}
+
+func (s *testObserverStream) Send(e *SpanEvent) error {
+	s.dialer.Lock()
+	defer s.dialer.Unlock()
+
+	if nil != s.dialer.sendErr {
+		err := s.dialer.sendErr
+		s.dialer.sendErr = nil
+		return err
+	}
+	s.dialer.spans = append(s.dialer.spans, e)
+	s.dialer.spanRunIDs = append(s.dialer.spanRunIDs, s.runID)
+	return nil
+}
+
+func (s *testObserverStream) Close() error { return nil }
+
+type testObserverDialer struct {
+	sync.Mutex
+	dials     []AgentRunID
+	dialTimes []time.Time
+	licenses  []string
+	dialErr   error
+	sendErr   error
+	// dialFailures is the number of dials that fail with dialErr.  A
+	// single dial fails when it is zero.
+	dialFailures int
+	spans        []*SpanEvent
+	spanRunIDs   []AgentRunID
+}
+
+func (d *testObserverDialer) DialTraceObserver(license string, runID AgentRunID) (TraceObserverStream, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.dials = append(d.dials, runID)
+	d.dialTimes = append(d.dialTimes, time.Now())
+	d.licenses = append(d.licenses, license)
+	if nil != d.dialErr {
+		err := d.dialErr
+		if d.dialFailures--; d.dialFailures <= 0 {
+			d.dialErr = nil
+		}
+		return nil, err
+	}
+	return &testObserverStream{dialer: d, runID: runID}, nil
+}
+
+func (d *testObserverDialer) numSpans() int {
+	d.Lock()
+	defer d.Unlock()
+	return len(d.spans)
+}
+
+func waitForSpans(t *testing.T, d *testObserverDialer, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for d.numSpans() < n {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for spans", d.numSpans(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func testTraceObserver(d *testObserverDialer, queueSize int) *TraceObserver {
+	to := NewTraceObserver(TraceObserverConfig{
+		Dialer:    d,
+		License:   "license",
+		QueueSize: queueSize,
+		Logger:    logger.ShimLogger{},
+	})
+	to.backoff = time.Millisecond
+	return to
+}
+
+func TestTraceObserverSendsSpans(t *testing.T) {
+	d := &testObserverDialer{}
+	to := testTraceObserver(d, 10)
+	// Span events are queued until the run id is provided.
+	to.Consume(&SpanEvent{Name: "first"})
+	to.SetRunID("run-1")
+	to.Consume(&SpanEvent{Name: "second"})
+	waitForSpans(t, d, 2)
+	to.Shutdown(5 * time.Second)
+
+	if d.spans[0].Name != "first" || d.spans[1].Name != "second" {
+		t.Error(d.spans[0].Name, d.spans[1].Name)
+	}
+	if len(d.dials) != 1 || d.dials[0] != "run-1" || d.licenses[0] != "license" {
+		t.Error(d.dials, d.licenses)
+	}
+
+	h := NewHarvest(time.Now(), DefaultHarvestConfig)
+	to.MergeIntoHarvest(h)
+	ExpectMetrics(t, h.Metrics, []WantMetric{
+		{traceObserverSpansSeen, "", true, []float64{2, 0, 0, 0, 0, 0}},
+		{traceObserverSpansSent, "", true, []float64{2, 0, 0, 0, 0, 0}},
+	})
+	// The supportability counts are reset after each harvest.
+	h = NewHarvest(time.Now(), DefaultHarvestConfig)
+	to.MergeIntoHarvest(h)
+	ExpectMetrics(t, h.Metrics, []WantMetric{
+		{traceObserverSpansSeen, "", true, []float64{0, 0, 0, 0, 0, 0}},
+		{traceObserverSpansSent, "", true, []float64{0, 0, 0, 0, 0, 0}},
+	})
+}
+
+func TestTraceObserverQueueFull(t *testing.T) {
+	d := &testObserverDialer{}
+	to := testTraceObserver(d, 2)
+	to.Consume(&SpanEvent{})
+	to.Consume(&SpanEvent{})
+	to.Consume(&SpanEvent{})
+	to.Shutdown(5 * time.Second)
+
+	h := NewHarvest(time.Now(), DefaultHarvestConfig)
+	to.MergeIntoHarvest(h)
+	ExpectMetrics(t, h.Metrics, []WantMetric{
+		{traceObserverSpansSeen, "", true, []float64{3, 0, 0, 0, 0, 0}},
+		{traceObserverSpansSent, "", true, []float64{0, 0, 0, 0, 0, 0}},
+		{traceObserverQueueDumped, "", true, []float64{1, 0, 0, 0, 0, 0}},
+	})
+}
+
+func TestTraceObserverReconnect(t *testing.T) {
+	d := &testObserverDialer{
+		dialErr: errors.New("dial failure"),
+		sendErr: errors.New("stream failure"),
+	}
+	to := testTraceObserver(d, 10)
+	to.SetRunID("run-1")
+	to.Consume(&SpanEvent{Name: "lost"})
+	to.Consume(&SpanEvent{Name: "sent"})
+	waitForSpans(t, d, 1)
+	to.SetRunID("run-2")
+	to.Consume(&SpanEvent{Name: "restarted"})
+	waitForSpans(t, d, 2)
+	to.Shutdown(5 * time.Second)
+
+	if d.spans[0].Name != "sent" || d.spanRunIDs[0] != "run-1" {
+		t.Error(d.spans[0].Name, d.spanRunIDs[0])
+	}
+	if d.spans[1].Name != "restarted" || d.spanRunIDs[1] != "run-2" {
+		t.Error(d.spans[1].Name, d.spanRunIDs[1])
+	}
+	// The first dial fails, the second stream fails, and the third stream
+	// is replaced when the run id changes.
+	if len(d.dials) != 4 || d.dials[2] != "run-1" || d.dials[3] != "run-2" {
+		t.Error(d.dials)
+	}
+
+	h := NewHarvest(time.Now(), DefaultHarvestConfig)
+	to.MergeIntoHarvest(h)
+	ExpectMetrics(t, h.Metrics, []WantMetric{
+		{traceObserverSpansSeen, "", true, []float64{3, 0, 0, 0, 0, 0}},
+		{traceObserverSpansSent, "", true, []float64{2, 0, 0, 0, 0, 0}},
+		{traceObserverResponseError, "", true, []float64{1, 0, 0, 0, 0, 0}},
+	})
+}
+
+func (d *testObserverDialer) numDials() int {
+	d.Lock()
+	defer d.Unlock()
+	return len(d.dials)
+}
+
+func TestTraceObserverBackoffReset(t *testing.T) {
+	// Eight failed dials grow the backoff to 256ms.  Once the stream has
+	// sent a span event, a stream failure is retried after the initial
+	// 1ms backoff.
+	d := &testObserverDialer{
+		dialErr:      errors.New("dial failure"),
+		dialFailures: 8,
+	}
+	to := testTraceObserver(d, 10)
+	to.SetRunID("run-1")
+	to.Consume(&SpanEvent{Name: "sent"})
+	waitForSpans(t, d, 1)
+	d.Lock()
+	d.sendErr = errors.New("stream failure")
+	d.Unlock()
+	to.Consume(&SpanEvent{Name: "lost"})
+	deadline := time.Now().Add(5 * time.Second)
+	for d.numDials() < 10 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for dials", d.numDials())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	to.Shutdown(5 * time.Second)
+
+	if gap := d.dialTimes[9].Sub(d.dialTimes[8]); gap >= 128*time.Millisecond {
+		t.Error("backoff not reset", gap)
+	}
+}
+
+func TestTraceObserverNil(t *testing.T) {
+	var to *TraceObserver
+	to.SetRunID("run-1")
+	to.MergeIntoHarvest(NewHarvest(time.Now(), DefaultHarvestConfig))
+	to.Shutdown(time.Second)
+}
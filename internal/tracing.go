@@ -66,18 +66,25 @@ type TxnData struct {
 	ApdexThreshold time.Duration
 	Exclusive      time.Duration
 
-	finishedChildren time.Duration
-	stamp            segmentStamp
-	stack            []segmentFrame
+	stamp           segmentStamp
+	threadIDCounter uint64
 
 	LazilyCalculateSampled func() bool
 	SpanEventsEnabled      bool
 	rootSpanID             string
 	spanEvents             []*SpanEvent
+	// rootSpanAttributes are the user attributes added to the
+	// transaction's root span.
+	rootSpanAttributes spanAttributes
+
+	// TraceObserver, when non-nil, receives each span event as its segment
+	// ends in place of the span events being saved in the transaction.
+	TraceObserver *TraceObserver
 
 	customSegments    map[string]*metricData
 	datastoreSegments map[DatastoreMetricKey]*metricData
 	externalSegments  map[externalMetricKey]*metricData
+	messageSegments   map[MessageMetricKey]*metricData
 
 	TxnTrace
 
@@ -90,6 +97,25 @@ type TxnData struct {
 	DistributedTracingSupport
 }
 
+// Thread contains a segment stack that is used to track segment parenting
+// and exclusive time within a single goroutine.  Each goroutine using a
+// transaction must have its own Thread.
+type Thread struct {
+	threadID         uint64
+	finishedChildren time.Duration
+	stack            []segmentFrame
+}
+
+// NewThread returns a new Thread to track segments in a new goroutine.
+func NewThread(t *TxnData) *Thread {
+	// Each thread needs a unique identifier so that the trace nodes of
+	// different goroutines are not nested inside each other.
+	t.threadIDCounter++
+	return &Thread{
+		threadID: t.threadIDCounter,
+	}
+}
+
 type segmentStamp uint64
 
 type segmentTime struct {
@@ -106,8 +132,9 @@ type SegmentStartTime struct {
 
 type segmentFrame struct {
 	segmentTime
-	children time.Duration
-	spanID   string
+	children   time.Duration
+	spanID     string
+	attributes spanAttributes
 }
 
 type segmentEnd struct {
@@ -117,6 +144,9 @@ type segmentEnd struct {
 	exclusive time.Duration
 	SpanID    string
 	ParentID  string
+	threadID  uint64
+	// attributes are the user attributes added to the segment.
+	attributes spanAttributes
 }
 
 func (end segmentEnd) spanEvent() *SpanEvent {
@@ -129,6 +159,8 @@ func (end segmentEnd) spanEvent() *SpanEvent {
 		Timestamp:    end.start.Time,
 		Duration:     end.duration,
 		IsEntrypoint: false,
+
+		userAttributes: end.attributes,
 	}
 }
 
@@ -137,9 +169,25 @@ const (
 	datastoreOperationUnknown = "other"
 )
 
-// HasErrors indicates whether the transaction had errors.
+// HasErrors indicates whether the transaction had errors which were not
+// expected.
 func (t *TxnData) HasErrors() bool {
-	return len(t.Errors) > 0
+	for _, e := range t.Errors {
+		if !e.Expected {
+			return true
+		}
+	}
+	return false
+}
+
+// HasExpectedErrors indicates whether the transaction had expected errors.
+func (t *TxnData) HasExpectedErrors() bool {
+	for _, e := range t.Errors {
+		if e.Expected {
+			return true
+		}
+	}
+	return false
 }
 
 func (t *TxnData) time(now time.Time) segmentTime {
@@ -152,25 +200,28 @@ func (t *TxnData) time(now time.Time) segmentTime {
 }
 
 // TracerRootChildren is used to calculate a transaction's exclusive duration.
-func TracerRootChildren(t *TxnData) time.Duration {
+// Only the thread which started the transaction should be provided:  the
+// segments of other goroutines run concurrently with the transaction and
+// therefore do not reduce its exclusive time.
+func TracerRootChildren(thread *Thread) time.Duration {
 	var lostChildren time.Duration
-	for i := 0; i < len(t.stack); i++ {
-		lostChildren += t.stack[i].children
+	for i := 0; i < len(thread.stack); i++ {
+		lostChildren += thread.stack[i].children
 	}
-	return t.finishedChildren + lostChildren
+	return thread.finishedChildren + lostChildren
 }
 
 // StartSegment begins a segment.
-func StartSegment(t *TxnData, now time.Time) SegmentStartTime {
+func StartSegment(t *TxnData, thread *Thread, now time.Time) SegmentStartTime {
 	tm := t.time(now)
-	t.stack = append(t.stack, segmentFrame{
+	thread.stack = append(thread.stack, segmentFrame{
 		segmentTime: tm,
 		children:    0,
 	})
 
 	return SegmentStartTime{
 		Stamp: tm.Stamp,
-		Depth: len(t.stack) - 1,
+		Depth: len(thread.stack) - 1,
 	}
 }
 
@@ -189,52 +240,96 @@ func (t *TxnData) getRootSpanID() string {
 }
 
 // CurrentSpanIdentifier returns the identifier of the span at the top of the
-// segment stack.
-func (t *TxnData) CurrentSpanIdentifier() string {
-	if 0 == len(t.stack) {
+// thread's segment stack.  If the stack is empty, the identifier of the
+// transaction's root span is returned.
+func (t *TxnData) CurrentSpanIdentifier(thread *Thread) string {
+	if 0 == len(thread.stack) {
 		return t.getRootSpanID()
 	}
-	if "" == t.stack[len(t.stack)-1].spanID {
-		t.stack[len(t.stack)-1].spanID = NewSpanID()
+	if "" == thread.stack[len(thread.stack)-1].spanID {
+		thread.stack[len(thread.stack)-1].spanID = NewSpanID()
 	}
-	return t.stack[len(t.stack)-1].spanID
+	return thread.stack[len(thread.stack)-1].spanID
 }
 
 func (t *TxnData) saveSpanEvent(e *SpanEvent) {
-	if len(t.spanEvents) < maxSpanEvents {
+	if nil != t.TraceObserver {
+		e.setTransactionFields(&t.BetterCAT)
+		t.TraceObserver.Consume(e)
+		return
+	}
+	if len(t.spanEvents) < MaxSpanEvents {
 		t.spanEvents = append(t.spanEvents, e)
 	}
 }
 
+// ObserveRootSpanEvent sends the span event of the transaction itself to the
+// trace observer.  It should be called once the transaction has ended if the
+// transaction is sampled and span events are enabled.
+func (t *TxnData) ObserveRootSpanEvent() {
+	if nil == t.TraceObserver {
+		return
+	}
+	e := t.rootSpanEvent()
+	e.setTransactionFields(&t.BetterCAT)
+	t.TraceObserver.Consume(e)
+}
+
+// AddSpanAttribute adds a user attribute to the span at the top of the
+// thread's segment stack.  If the stack is empty, the attribute is added to the
+// transaction's root span.
+func AddSpanAttribute(t *TxnData, thread *Thread, key string, val interface{}) error {
+	attrs := &t.rootSpanAttributes
+	if n := len(thread.stack); n > 0 {
+		attrs = &thread.stack[n-1].attributes
+	}
+	return addSpanAttribute(t.Attrs.config, attrs, key, val)
+}
+
+// AddSegmentAttribute adds a user attribute to the segment which began at
+// start.  The segment must not have ended.
+func AddSegmentAttribute(t *TxnData, thread *Thread, start SegmentStartTime, key string, val interface{}) error {
+	if 0 == start.Stamp || start.Depth < 0 {
+		return errMalformedSegment
+	}
+	if start.Depth >= len(thread.stack) || start.Stamp != thread.stack[start.Depth].Stamp {
+		return errSegmentEnded
+	}
+	return addSpanAttribute(t.Attrs.config, &thread.stack[start.Depth].attributes, key, val)
+}
+
 var (
 	errMalformedSegment = errors.New("segment identifier malformed: perhaps unsafe code has modified it?")
+	errSegmentEnded     = errors.New("segment has already ended")
 	errSegmentOrder     = errors.New(`improper segment use: the Transaction must be used ` +
-		`in a single goroutine and segments must be ended in "last started first ended" order: ` +
+		`in a single goroutine (use Transaction.NewGoroutine for additional goroutines) ` +
+		`and segments must be ended in "last started first ended" order: ` +
 		`see https://github.com/newrelic/go-agent/blob/master/GUIDE.md#segments`)
 )
 
-func endSegment(t *TxnData, start SegmentStartTime, now time.Time) (segmentEnd, error) {
+func endSegment(t *TxnData, thread *Thread, start SegmentStartTime, now time.Time) (segmentEnd, error) {
 	if 0 == start.Stamp {
 		return segmentEnd{}, errMalformedSegment
 	}
-	if start.Depth >= len(t.stack) {
+	if start.Depth >= len(thread.stack) {
 		return segmentEnd{}, errSegmentOrder
 	}
 	if start.Depth < 0 {
 		return segmentEnd{}, errMalformedSegment
 	}
-	frame := t.stack[start.Depth]
+	frame := thread.stack[start.Depth]
 	if start.Stamp != frame.Stamp {
 		return segmentEnd{}, errSegmentOrder
 	}
 
 	var children time.Duration
-	for i := start.Depth; i < len(t.stack); i++ {
-		children += t.stack[i].children
+	for i := start.Depth; i < len(thread.stack); i++ {
+		children += thread.stack[i].children
 	}
 	s := segmentEnd{
-		stop:  t.time(now),
-		start: frame.segmentTime,
+		stop:       t.time(now),
+		start:      frame.segmentTime,
+		attributes: frame.attributes,
 	}
 	if s.stop.Time.After(s.start.Time) {
 		s.duration = s.stop.Time.Sub(s.start.Time)
@@ -243,17 +338,17 @@ func endSegment(t *TxnData, start SegmentStartTime, now time.Time) (segmentEnd,
 		s.exclusive = s.duration - children
 	}
 
-	// Note that we expect (depth == (len(t.stack) - 1)).  However, if
-	// (depth < (len(t.stack) - 1)), that's ok: could be a panic popped
+	// Note that we expect (depth == (len(thread.stack) - 1)).  However, if
+	// (depth < (len(thread.stack) - 1)), that's ok: could be a panic popped
 	// some stack frames (and the consumer was not using defer).
 
 	if 0 == start.Depth {
-		t.finishedChildren += s.duration
+		thread.finishedChildren += s.duration
 	} else {
-		t.stack[start.Depth-1].children += s.duration
+		thread.stack[start.Depth-1].children += s.duration
 	}
 
-	t.stack = t.stack[0:start.Depth]
+	thread.stack = thread.stack[0:start.Depth]
 
 	if t.SpanEventsEnabled && t.LazilyCalculateSampled() {
 		s.SpanID = frame.spanID
@@ -263,15 +358,17 @@ func endSegment(t *TxnData, start SegmentStartTime, now time.Time) (segmentEnd,
 		// Note that the current span identifier is the parent's
 		// identifier because we've already popped the segment that's
 		// ending off of the stack.
-		s.ParentID = t.CurrentSpanIdentifier()
+		s.ParentID = t.CurrentSpanIdentifier(thread)
 	}
 
+	s.threadID = thread.threadID
+
 	return s, nil
 }
 
 // EndBasicSegment ends a basic segment.
-func EndBasicSegment(t *TxnData, start SegmentStartTime, now time.Time, name string) error {
-	end, err := endSegment(t, start, now)
+func EndBasicSegment(t *TxnData, thread *Thread, start SegmentStartTime, now time.Time, name string) error {
+	end, err := endSegment(t, thread, start, now)
 	if nil != err {
 		return err
 	}
@@ -303,8 +400,15 @@ func EndBasicSegment(t *TxnData, start SegmentStartTime, now time.Time, name str
 }
 
 // EndExternalSegment ends an external segment.
-func EndExternalSegment(t *TxnData, start SegmentStartTime, now time.Time, u *url.URL, method string, resp *http.Response) error {
-	end, err := endSegment(t, start, now)
+func EndExternalSegment(t *TxnData, thread *Thread, start SegmentStartTime, now time.Time, u *url.URL, method string, resp *http.Response) error {
+	return EndExternalSegmentWithTiming(t, thread, start, now, u, method, resp, nil)
+}
+
+// EndExternalSegmentWithTiming ends an external segment and records the
+// phases of the request, if timing is non-nil, in the segment's transaction
+// trace node and span event.
+func EndExternalSegmentWithTiming(t *TxnData, thread *Thread, start SegmentStartTime, now time.Time, u *url.URL, method string, resp *http.Response, timing *ExternalTiming) error {
+	end, err := endSegment(t, thread, start, now)
 	if nil != err {
 		return err
 	}
@@ -356,6 +460,7 @@ func EndExternalSegment(t *TxnData, start SegmentStartTime, now time.Time, u *ur
 		t.TxnTrace.witnessNode(end, externalHostMetric(key), &traceNodeParams{
 			CleanURL:        SafeURL(u),
 			TransactionGUID: transactionGUID,
+			externalTiming:  timing,
 		})
 	}
 
@@ -365,6 +470,7 @@ func EndExternalSegment(t *TxnData, start SegmentStartTime, now time.Time, u *ur
 		evt.ExternalExtras = &spanExternalExtras{
 			URL:    SafeURL(u),
 			Method: method,
+			Timing: timing,
 		}
 		t.saveSpanEvent(evt)
 	}
@@ -372,9 +478,64 @@ func EndExternalSegment(t *TxnData, start SegmentStartTime, now time.Time, u *ur
 	return nil
 }
 
+// EndMessageParams contains the parameters for EndMessageSegment.
+type EndMessageParams struct {
+	Tracer          *TxnData
+	Thread          *Thread
+	Start           SegmentStartTime
+	Now             time.Time
+	Library         string
+	DestinationType string
+	DestinationName string
+	DestinationTemp bool
+}
+
+// EndMessageSegment ends a message producer segment.
+func EndMessageSegment(p EndMessageParams) error {
+	end, err := endSegment(p.Tracer, p.Thread, p.Start, p.Now)
+	if nil != err {
+		return err
+	}
+
+	key := MessageMetricKey{
+		Library:         p.Library,
+		DestinationType: p.DestinationType,
+		DestinationName: p.DestinationName,
+		DestinationTemp: p.DestinationTemp,
+	}
+	if nil == p.Tracer.messageSegments {
+		p.Tracer.messageSegments = make(map[MessageMetricKey]*metricData)
+	}
+	m := metricDataFromDuration(end.duration, end.exclusive)
+	if data, ok := p.Tracer.messageSegments[key]; ok {
+		data.aggregate(m)
+	} else {
+		// Use `new` in place of &m so that m is not
+		// automatically moved to the heap.
+		cpy := new(metricData)
+		*cpy = m
+		p.Tracer.messageSegments[key] = cpy
+	}
+
+	metric := messageProduceMetric(key)
+
+	if p.Tracer.TxnTrace.considerNode(end) {
+		p.Tracer.TxnTrace.witnessNode(end, metric, nil)
+	}
+
+	if evt := end.spanEvent(); evt != nil {
+		evt.Name = metric
+		evt.Category = spanCategoryGeneric
+		p.Tracer.saveSpanEvent(evt)
+	}
+
+	return nil
+}
+
 // EndDatastoreParams contains the parameters for EndDatastoreSegment.
 type EndDatastoreParams struct {
 	Tracer             *TxnData
+	Thread             *Thread
 	Start              SegmentStartTime
 	Now                time.Time
 	Product            string
@@ -427,7 +588,7 @@ func datastoreSpanAddress(host, portPathOrID string) string {
 
 // EndDatastoreSegment ends a datastore segment.
 func EndDatastoreSegment(p EndDatastoreParams) error {
-	end, err := endSegment(p.Tracer, p.Start, p.Now)
+	end, err := endSegment(p.Tracer, p.Thread, p.Start, p.Now)
 	if nil != err {
 		return err
 	}
@@ -567,6 +728,13 @@ func MergeBreakdownMetrics(t *TxnData, metrics *metricTable) {
 		}
 	}
 
+	// Message Segment Metrics
+	for key, data := range t.messageSegments {
+		metric := messageProduceMetric(key)
+		metrics.add(metric, "", *data, unforced)
+		metrics.add(metric, scope, *data, unforced)
+	}
+
 	// Datastore Segment Metrics
 	for key, data := range t.datastoreSegments {
 		metrics.add(datastoreRollupMetric.all, "", *data, forced)
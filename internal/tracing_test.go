@@ -14,9 +14,10 @@ func TestStartEndSegment(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 
 	tr := &TxnData{}
-	token := StartSegment(tr, start)
+	thread := &Thread{}
+	token := StartSegment(tr, thread, start)
 	stop := start.Add(1 * time.Second)
-	end, err := endSegment(tr, token, stop)
+	end, err := endSegment(tr, thread, token, stop)
 	if nil != err {
 		t.Error(err)
 	}
@@ -40,15 +41,16 @@ func TestStartEndSegment(t *testing.T) {
 func TestMultipleChildren(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 
-	t1 := StartSegment(tr, start.Add(1*time.Second))
-	t2 := StartSegment(tr, start.Add(2*time.Second))
-	end2, err2 := endSegment(tr, t2, start.Add(3*time.Second))
-	t3 := StartSegment(tr, start.Add(4*time.Second))
-	end3, err3 := endSegment(tr, t3, start.Add(5*time.Second))
-	end1, err1 := endSegment(tr, t1, start.Add(6*time.Second))
-	t4 := StartSegment(tr, start.Add(7*time.Second))
-	end4, err4 := endSegment(tr, t4, start.Add(8*time.Second))
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
+	t2 := StartSegment(tr, thread, start.Add(2*time.Second))
+	end2, err2 := endSegment(tr, thread, t2, start.Add(3*time.Second))
+	t3 := StartSegment(tr, thread, start.Add(4*time.Second))
+	end3, err3 := endSegment(tr, thread, t3, start.Add(5*time.Second))
+	end1, err1 := endSegment(tr, thread, t1, start.Add(6*time.Second))
+	t4 := StartSegment(tr, thread, start.Add(7*time.Second))
+	end4, err4 := endSegment(tr, thread, t4, start.Add(8*time.Second))
 
 	if nil != err1 || end1.duration != 5*time.Second || end1.exclusive != 3*time.Second {
 		t.Error(end1, err1)
@@ -62,22 +64,133 @@ func TestMultipleChildren(t *testing.T) {
 	if nil != err4 || end4.duration != end4.exclusive || end4.duration != time.Second {
 		t.Error(end4, err4)
 	}
-	children := TracerRootChildren(tr)
+	children := TracerRootChildren(thread)
 	if children != 6*time.Second {
 		t.Error(children)
 	}
 }
 
+//	thread1:           |----t2----|
+//	thread0:      |-----------t1-----------|
+//
+// 0    1    2    3    4    5    6    7    8
+func TestMultipleThreads(t *testing.T) {
+	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
+	tr := &TxnData{}
+	thread0 := &Thread{}
+	thread1 := NewThread(tr)
+
+	t1 := StartSegment(tr, thread0, start.Add(1*time.Second))
+	t2 := StartSegment(tr, thread1, start.Add(2*time.Second))
+	// Segments of different threads may be ended in any order.
+	end1, err1 := endSegment(tr, thread0, t1, start.Add(5*time.Second))
+	end2, err2 := endSegment(tr, thread1, t2, start.Add(4*time.Second))
+
+	if nil != err1 || end1.duration != 4*time.Second || end1.exclusive != 4*time.Second {
+		t.Error(end1, err1)
+	}
+	if nil != err2 || end2.duration != 2*time.Second || end2.exclusive != 2*time.Second {
+		t.Error(end2, err2)
+	}
+	if end1.threadID == end2.threadID {
+		t.Error(end1.threadID, end2.threadID)
+	}
+	// The concurrent segment does not reduce the root's exclusive time.
+	if children := TracerRootChildren(thread0); children != 4*time.Second {
+		t.Error(children)
+	}
+}
+
+//	thread2:                          |----c3---|
+//	thread1:                |-----------c2-----------|
+//	                             |-c4-|
+//	thread0:      |---------------------p----------------------|
+//	                                            |-c1-|
+//
+// 0    1    2    3    4    5    6    7    8    9    10
+func TestConcurrentChildrenExclusive(t *testing.T) {
+	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
+	tr := &TxnData{}
+	thread0 := &Thread{}
+	thread1 := NewThread(tr)
+	thread2 := NewThread(tr)
+
+	p := StartSegment(tr, thread0, start.Add(1*time.Second))
+	c2 := StartSegment(tr, thread1, start.Add(3*time.Second))
+	c4 := StartSegment(tr, thread1, start.Add(4*time.Second))
+	c3 := StartSegment(tr, thread2, start.Add(5*time.Second))
+	EndBasicSegment(tr, thread1, c4, start.Add(5*time.Second), "c4")
+	EndBasicSegment(tr, thread2, c3, start.Add(7*time.Second), "c3")
+	c1 := StartSegment(tr, thread0, start.Add(7*time.Second))
+	EndBasicSegment(tr, thread1, c2, start.Add(8*time.Second), "c2")
+	EndBasicSegment(tr, thread0, c1, start.Add(8*time.Second), "c1")
+	EndBasicSegment(tr, thread0, p, start.Add(10*time.Second), "p")
+
+	// Only the child on the parent's own goroutine reduces the parent's
+	// exclusive time.
+	if children := TracerRootChildren(thread0); children != 9*time.Second {
+		t.Error(children)
+	}
+	if children := TracerRootChildren(thread1); children != 5*time.Second {
+		t.Error(children)
+	}
+
+	metrics := newMetricTable(100, time.Now())
+	tr.FinalName = "WebTransaction/Go/zip"
+	tr.IsWeb = true
+	MergeBreakdownMetrics(tr, metrics)
+	ExpectMetrics(t, metrics, []WantMetric{
+		{"Custom/p", "", false, []float64{1, 9, 8, 9, 9, 81}},
+		{"Custom/c1", "", false, []float64{1, 1, 1, 1, 1, 1}},
+		{"Custom/c2", "", false, []float64{1, 5, 4, 5, 5, 25}},
+		{"Custom/c3", "", false, []float64{1, 2, 2, 2, 2, 4}},
+		{"Custom/c4", "", false, []float64{1, 1, 1, 1, 1, 1}},
+		{"Custom/p", tr.FinalName, false, []float64{1, 9, 8, 9, 9, 81}},
+		{"Custom/c1", tr.FinalName, false, []float64{1, 1, 1, 1, 1, 1}},
+		{"Custom/c2", tr.FinalName, false, []float64{1, 5, 4, 5, 5, 25}},
+		{"Custom/c3", tr.FinalName, false, []float64{1, 2, 2, 2, 2, 4}},
+		{"Custom/c4", tr.FinalName, false, []float64{1, 1, 1, 1, 1, 1}},
+	})
+}
+
+func TestNewThreadUniqueIDs(t *testing.T) {
+	tr := &TxnData{}
+	thread1 := NewThread(tr)
+	thread2 := NewThread(tr)
+	if thread1.threadID == 0 || thread2.threadID == 0 || thread1.threadID == thread2.threadID {
+		t.Error(thread1.threadID, thread2.threadID)
+	}
+}
+
+func TestThreadSegmentOrder(t *testing.T) {
+	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
+	tr := &TxnData{}
+	thread0 := &Thread{}
+	thread1 := NewThread(tr)
+
+	t1 := StartSegment(tr, thread0, start.Add(1*time.Second))
+	// Ending a segment using the wrong thread is an error.
+	end, err := endSegment(tr, thread1, t1, start.Add(2*time.Second))
+	if err != errSegmentOrder {
+		t.Error(end, err)
+	}
+	end, err = endSegment(tr, thread0, t1, start.Add(2*time.Second))
+	if nil != err {
+		t.Error(end, err)
+	}
+}
+
 func TestInvalidStart(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 
-	end, err := endSegment(tr, SegmentStartTime{}, start.Add(1*time.Second))
+	end, err := endSegment(tr, thread, SegmentStartTime{}, start.Add(1*time.Second))
 	if err != errMalformedSegment {
 		t.Error(end, err)
 	}
-	StartSegment(tr, start.Add(2*time.Second))
-	end, err = endSegment(tr, SegmentStartTime{}, start.Add(3*time.Second))
+	StartSegment(tr, thread, start.Add(2*time.Second))
+	end, err = endSegment(tr, thread, SegmentStartTime{}, start.Add(3*time.Second))
 	if err != errMalformedSegment {
 		t.Error(end, err)
 	}
@@ -86,13 +199,14 @@ func TestInvalidStart(t *testing.T) {
 func TestSegmentAlreadyEnded(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 
-	t1 := StartSegment(tr, start.Add(1*time.Second))
-	end, err := endSegment(tr, t1, start.Add(2*time.Second))
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
+	end, err := endSegment(tr, thread, t1, start.Add(2*time.Second))
 	if err != nil {
 		t.Error(end, err)
 	}
-	end, err = endSegment(tr, t1, start.Add(3*time.Second))
+	end, err = endSegment(tr, thread, t1, start.Add(3*time.Second))
 	if err != errSegmentOrder {
 		t.Error(end, err)
 	}
@@ -101,10 +215,11 @@ func TestSegmentAlreadyEnded(t *testing.T) {
 func TestSegmentBadStamp(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 
-	t1 := StartSegment(tr, start.Add(1*time.Second))
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
 	t1.Stamp++
-	end, err := endSegment(tr, t1, start.Add(2*time.Second))
+	end, err := endSegment(tr, thread, t1, start.Add(2*time.Second))
 	if err != errSegmentOrder {
 		t.Error(end, err)
 	}
@@ -113,10 +228,11 @@ func TestSegmentBadStamp(t *testing.T) {
 func TestSegmentBadDepth(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 
-	t1 := StartSegment(tr, start.Add(1*time.Second))
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
 	t1.Depth++
-	end, err := endSegment(tr, t1, start.Add(2*time.Second))
+	end, err := endSegment(tr, thread, t1, start.Add(2*time.Second))
 	if err != errSegmentOrder {
 		t.Error(end, err)
 	}
@@ -125,10 +241,11 @@ func TestSegmentBadDepth(t *testing.T) {
 func TestSegmentNegativeDepth(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 
-	t1 := StartSegment(tr, start.Add(1*time.Second))
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
 	t1.Depth = -1
-	end, err := endSegment(tr, t1, start.Add(2*time.Second))
+	end, err := endSegment(tr, thread, t1, start.Add(2*time.Second))
 	if err != errMalformedSegment {
 		t.Error(end, err)
 	}
@@ -137,15 +254,16 @@ func TestSegmentNegativeDepth(t *testing.T) {
 func TestSegmentOutOfOrder(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 
-	t1 := StartSegment(tr, start.Add(1*time.Second))
-	t2 := StartSegment(tr, start.Add(2*time.Second))
-	t3 := StartSegment(tr, start.Add(3*time.Second))
-	end2, err2 := endSegment(tr, t2, start.Add(4*time.Second))
-	end3, err3 := endSegment(tr, t3, start.Add(5*time.Second))
-	t4 := StartSegment(tr, start.Add(6*time.Second))
-	end4, err4 := endSegment(tr, t4, start.Add(7*time.Second))
-	end1, err1 := endSegment(tr, t1, start.Add(8*time.Second))
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
+	t2 := StartSegment(tr, thread, start.Add(2*time.Second))
+	t3 := StartSegment(tr, thread, start.Add(3*time.Second))
+	end2, err2 := endSegment(tr, thread, t2, start.Add(4*time.Second))
+	end3, err3 := endSegment(tr, thread, t3, start.Add(5*time.Second))
+	t4 := StartSegment(tr, thread, start.Add(6*time.Second))
+	end4, err4 := endSegment(tr, thread, t4, start.Add(7*time.Second))
+	end1, err1 := endSegment(tr, thread, t1, start.Add(8*time.Second))
 
 	if nil != err1 ||
 		end1.duration != 7*time.Second ||
@@ -163,27 +281,29 @@ func TestSegmentOutOfOrder(t *testing.T) {
 	}
 }
 
-//                                          |-t3-|    |-t4-|
-//                           |-t2-|    |-never-finished----------
-//            |-t1-|    |--never-finished------------------------
-//       |-------alpha------------------------------------------|
-//  0    1    2    3    4    5    6    7    8    9    10   11   12
+//	                                   |-t3-|    |-t4-|
+//	                    |-t2-|    |-never-finished----------
+//	     |-t1-|    |--never-finished------------------------
+//	|-------alpha------------------------------------------|
+//
+// 0    1    2    3    4    5    6    7    8    9    10   11   12
 func TestLostChildren(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
-
-	alpha := StartSegment(tr, start.Add(1*time.Second))
-	t1 := StartSegment(tr, start.Add(2*time.Second))
-	EndBasicSegment(tr, t1, start.Add(3*time.Second), "t1")
-	StartSegment(tr, start.Add(4*time.Second))
-	t2 := StartSegment(tr, start.Add(5*time.Second))
-	EndBasicSegment(tr, t2, start.Add(6*time.Second), "t2")
-	StartSegment(tr, start.Add(7*time.Second))
-	t3 := StartSegment(tr, start.Add(8*time.Second))
-	EndBasicSegment(tr, t3, start.Add(9*time.Second), "t3")
-	t4 := StartSegment(tr, start.Add(10*time.Second))
-	EndBasicSegment(tr, t4, start.Add(11*time.Second), "t4")
-	EndBasicSegment(tr, alpha, start.Add(12*time.Second), "alpha")
+	thread := &Thread{}
+
+	alpha := StartSegment(tr, thread, start.Add(1*time.Second))
+	t1 := StartSegment(tr, thread, start.Add(2*time.Second))
+	EndBasicSegment(tr, thread, t1, start.Add(3*time.Second), "t1")
+	StartSegment(tr, thread, start.Add(4*time.Second))
+	t2 := StartSegment(tr, thread, start.Add(5*time.Second))
+	EndBasicSegment(tr, thread, t2, start.Add(6*time.Second), "t2")
+	StartSegment(tr, thread, start.Add(7*time.Second))
+	t3 := StartSegment(tr, thread, start.Add(8*time.Second))
+	EndBasicSegment(tr, thread, t3, start.Add(9*time.Second), "t3")
+	t4 := StartSegment(tr, thread, start.Add(10*time.Second))
+	EndBasicSegment(tr, thread, t4, start.Add(11*time.Second), "t4")
+	EndBasicSegment(tr, thread, alpha, start.Add(12*time.Second), "alpha")
 
 	metrics := newMetricTable(100, time.Now())
 	tr.FinalName = "WebTransaction/Go/zip"
@@ -203,27 +323,29 @@ func TestLostChildren(t *testing.T) {
 	})
 }
 
-//                                          |-t3-|    |-t4-|
-//                           |-t2-|    |-never-finished----------
-//            |-t1-|    |--never-finished------------------------
-//  |-------root-------------------------------------------------
-//  0    1    2    3    4    5    6    7    8    9    10   11   12
+//	                              |-t3-|    |-t4-|
+//	               |-t2-|    |-never-finished----------
+//	|-t1-|    |--never-finished------------------------
+//
+// |-------root-------------------------------------------------
+// 0    1    2    3    4    5    6    7    8    9    10   11   12
 func TestLostChildrenRoot(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
-
-	t1 := StartSegment(tr, start.Add(2*time.Second))
-	EndBasicSegment(tr, t1, start.Add(3*time.Second), "t1")
-	StartSegment(tr, start.Add(4*time.Second))
-	t2 := StartSegment(tr, start.Add(5*time.Second))
-	EndBasicSegment(tr, t2, start.Add(6*time.Second), "t2")
-	StartSegment(tr, start.Add(7*time.Second))
-	t3 := StartSegment(tr, start.Add(8*time.Second))
-	EndBasicSegment(tr, t3, start.Add(9*time.Second), "t3")
-	t4 := StartSegment(tr, start.Add(10*time.Second))
-	EndBasicSegment(tr, t4, start.Add(11*time.Second), "t4")
-
-	children := TracerRootChildren(tr)
+	thread := &Thread{}
+
+	t1 := StartSegment(tr, thread, start.Add(2*time.Second))
+	EndBasicSegment(tr, thread, t1, start.Add(3*time.Second), "t1")
+	StartSegment(tr, thread, start.Add(4*time.Second))
+	t2 := StartSegment(tr, thread, start.Add(5*time.Second))
+	EndBasicSegment(tr, thread, t2, start.Add(6*time.Second), "t2")
+	StartSegment(tr, thread, start.Add(7*time.Second))
+	t3 := StartSegment(tr, thread, start.Add(8*time.Second))
+	EndBasicSegment(tr, thread, t3, start.Add(9*time.Second), "t3")
+	t4 := StartSegment(tr, thread, start.Add(10*time.Second))
+	EndBasicSegment(tr, thread, t4, start.Add(11*time.Second), "t4")
+
+	children := TracerRootChildren(thread)
 	if children != 4*time.Second {
 		t.Error(children)
 	}
@@ -248,9 +370,10 @@ func TestNilSpanEvent(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 
 	tr := &TxnData{}
-	token := StartSegment(tr, start)
+	thread := &Thread{}
+	token := StartSegment(tr, thread, start)
 	stop := start.Add(1 * time.Second)
-	end, err := endSegment(tr, token, stop)
+	end, err := endSegment(tr, thread, token, stop)
 	if nil != err {
 		t.Error(err)
 	}
@@ -265,9 +388,10 @@ func TestDefaultSpanEvent(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 
 	tr := &TxnData{}
-	token := StartSegment(tr, start)
+	thread := &Thread{}
+	token := StartSegment(tr, thread, start)
 	stop := start.Add(1 * time.Second)
-	end, err := endSegment(tr, token, stop)
+	end, err := endSegment(tr, thread, token, stop)
 	if nil != err {
 		t.Error(err)
 	}
@@ -306,34 +430,35 @@ func TestGetRootSpanID(t *testing.T) {
 func TestCurrentSpanIdentifier(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 	tr.rootSpanID = "0123456789ABCDEF"
-	id := tr.CurrentSpanIdentifier()
+	id := tr.CurrentSpanIdentifier(thread)
 	if id != "0123456789ABCDEF" {
 		t.Error(id)
 	}
 
 	// After starting and ending a segment, the current span id is still the root.
-	t1 := StartSegment(tr, start.Add(1*time.Second))
-	_, err1 := endSegment(tr, t1, start.Add(3*time.Second))
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
+	_, err1 := endSegment(tr, thread, t1, start.Add(3*time.Second))
 	if nil != err1 {
 		t.Error(err1)
 	}
 
-	id = tr.CurrentSpanIdentifier()
+	id = tr.CurrentSpanIdentifier(thread)
 	if id != "0123456789ABCDEF" {
 		t.Error(id)
 	}
 
 	// After starting a new segment, there should be a new current span id.
-	StartSegment(tr, start.Add(2*time.Second))
-	id2 := tr.CurrentSpanIdentifier()
+	StartSegment(tr, thread, start.Add(2*time.Second))
+	id2 := tr.CurrentSpanIdentifier(thread)
 	if id2 == "0123456789ABCDEF" ||
-		id2 != tr.stack[0].spanID {
+		id2 != thread.stack[0].spanID {
 		t.Error(id2)
 	}
 
 	// The current segment has not ended, so there should be no new current span id.
-	id = tr.CurrentSpanIdentifier()
+	id = tr.CurrentSpanIdentifier(thread)
 	if id != id2 {
 		t.Error(id)
 	}
@@ -354,17 +479,18 @@ func TestDatastoreSpanAddress(t *testing.T) {
 func TestSegmentBasic(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
-
-	t1 := StartSegment(tr, start.Add(1*time.Second))
-	t2 := StartSegment(tr, start.Add(2*time.Second))
-	EndBasicSegment(tr, t2, start.Add(3*time.Second), "t2")
-	EndBasicSegment(tr, t1, start.Add(4*time.Second), "t1")
-	t3 := StartSegment(tr, start.Add(5*time.Second))
-	t4 := StartSegment(tr, start.Add(6*time.Second))
-	EndBasicSegment(tr, t3, start.Add(7*time.Second), "t3")
-	EndBasicSegment(tr, t4, start.Add(8*time.Second), "out-of-order")
-	t5 := StartSegment(tr, start.Add(9*time.Second))
-	EndBasicSegment(tr, t5, start.Add(10*time.Second), "t1")
+	thread := &Thread{}
+
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
+	t2 := StartSegment(tr, thread, start.Add(2*time.Second))
+	EndBasicSegment(tr, thread, t2, start.Add(3*time.Second), "t2")
+	EndBasicSegment(tr, thread, t1, start.Add(4*time.Second), "t1")
+	t3 := StartSegment(tr, thread, start.Add(5*time.Second))
+	t4 := StartSegment(tr, thread, start.Add(6*time.Second))
+	EndBasicSegment(tr, thread, t3, start.Add(7*time.Second), "t3")
+	EndBasicSegment(tr, thread, t4, start.Add(8*time.Second), "out-of-order")
+	t5 := StartSegment(tr, thread, start.Add(9*time.Second))
+	EndBasicSegment(tr, thread, t5, start.Add(10*time.Second), "t1")
 
 	metrics := newMetricTable(100, time.Now())
 	tr.FinalName = "WebTransaction/Go/zip"
@@ -388,16 +514,17 @@ func parseURL(raw string) *url.URL {
 func TestSegmentExternal(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
-
-	t1 := StartSegment(tr, start.Add(1*time.Second))
-	t2 := StartSegment(tr, start.Add(2*time.Second))
-	EndExternalSegment(tr, t2, start.Add(3*time.Second), nil, "", nil)
-	EndExternalSegment(tr, t1, start.Add(4*time.Second), parseURL("http://f1.com"), "", nil)
-	t3 := StartSegment(tr, start.Add(5*time.Second))
-	EndExternalSegment(tr, t3, start.Add(6*time.Second), parseURL("http://f1.com"), "", nil)
-	t4 := StartSegment(tr, start.Add(7*time.Second))
+	thread := &Thread{}
+
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
+	t2 := StartSegment(tr, thread, start.Add(2*time.Second))
+	EndExternalSegment(tr, thread, t2, start.Add(3*time.Second), nil, "", nil)
+	EndExternalSegment(tr, thread, t1, start.Add(4*time.Second), parseURL("http://f1.com"), "", nil)
+	t3 := StartSegment(tr, thread, start.Add(5*time.Second))
+	EndExternalSegment(tr, thread, t3, start.Add(6*time.Second), parseURL("http://f1.com"), "", nil)
+	t4 := StartSegment(tr, thread, start.Add(7*time.Second))
 	t4.Stamp++
-	EndExternalSegment(tr, t4, start.Add(8*time.Second), parseURL("http://invalid-token.com"), "", nil)
+	EndExternalSegment(tr, thread, t4, start.Add(8*time.Second), parseURL("http://invalid-token.com"), "", nil)
 
 	if tr.externalCallCount != 3 {
 		t.Error(tr.externalCallCount)
@@ -432,14 +559,81 @@ func TestSegmentExternal(t *testing.T) {
 	})
 }
 
+func TestSegmentMessage(t *testing.T) {
+	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
+	tr := &TxnData{}
+	thread := &Thread{}
+
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
+	t2 := StartSegment(tr, thread, start.Add(2*time.Second))
+	EndMessageSegment(EndMessageParams{
+		Tracer:          tr,
+		Thread:          thread,
+		Start:           t2,
+		Now:             start.Add(3 * time.Second),
+		Library:         "RabbitMQ",
+		DestinationType: "Queue",
+		DestinationName: "myQueue",
+	})
+	EndMessageSegment(EndMessageParams{
+		Tracer:          tr,
+		Thread:          thread,
+		Start:           t1,
+		Now:             start.Add(4 * time.Second),
+		Library:         "RabbitMQ",
+		DestinationType: "Queue",
+		DestinationName: "myQueue",
+	})
+	t3 := StartSegment(tr, thread, start.Add(5*time.Second))
+	EndMessageSegment(EndMessageParams{
+		Tracer:          tr,
+		Thread:          thread,
+		Start:           t3,
+		Now:             start.Add(6 * time.Second),
+		Library:         "Kafka",
+		DestinationType: "Topic",
+		DestinationName: "random-1234",
+		DestinationTemp: true,
+	})
+
+	metrics := newMetricTable(100, time.Now())
+	tr.FinalName = "WebTransaction/Go/zip"
+	tr.IsWeb = true
+	MergeBreakdownMetrics(tr, metrics)
+	ExpectMetrics(t, metrics, []WantMetric{
+		{"MessageBroker/RabbitMQ/Queue/Produce/Named/myQueue", "", false, []float64{2, 4, 3, 1, 3, 10}},
+		{"MessageBroker/RabbitMQ/Queue/Produce/Named/myQueue", tr.FinalName, false, []float64{2, 4, 3, 1, 3, 10}},
+		{"MessageBroker/Kafka/Topic/Produce/Temp", "", false, []float64{1, 1, 1, 1, 1, 1}},
+		{"MessageBroker/Kafka/Topic/Produce/Temp", tr.FinalName, false, []float64{1, 1, 1, 1, 1, 1}},
+	})
+}
+
+func TestMessageMetricKeyTxnName(t *testing.T) {
+	testcases := []struct {
+		key    MessageMetricKey
+		expect string
+	}{
+		{key: MessageMetricKey{Library: "RabbitMQ", DestinationType: "Exchange", DestinationName: "ex"}, expect: "RabbitMQ/Exchange/Named/ex"},
+		{key: MessageMetricKey{Library: "JMS", DestinationType: "Queue", DestinationName: "q", DestinationTemp: true}, expect: "JMS/Queue/Temp"},
+		{key: MessageMetricKey{}, expect: "Unknown/Unknown/Named/Unknown"},
+	}
+	for _, tc := range testcases {
+		if out := tc.key.TxnName(); out != tc.expect {
+			t.Error(out, tc.expect)
+		}
+	}
+}
+
 func TestSegmentDatastore(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 
-	t1 := StartSegment(tr, start.Add(1*time.Second))
-	t2 := StartSegment(tr, start.Add(2*time.Second))
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
+	t2 := StartSegment(tr, thread, start.Add(2*time.Second))
 	EndDatastoreSegment(EndDatastoreParams{
 		Tracer:     tr,
+		Thread:     thread,
 		Start:      t2,
 		Now:        start.Add(3 * time.Second),
 		Product:    "MySQL",
@@ -448,33 +642,37 @@ func TestSegmentDatastore(t *testing.T) {
 	})
 	EndDatastoreSegment(EndDatastoreParams{
 		Tracer:    tr,
+		Thread:    thread,
 		Start:     t1,
 		Now:       start.Add(4 * time.Second),
 		Product:   "MySQL",
 		Operation: "SELECT",
 		// missing collection
 	})
-	t3 := StartSegment(tr, start.Add(5*time.Second))
+	t3 := StartSegment(tr, thread, start.Add(5*time.Second))
 	EndDatastoreSegment(EndDatastoreParams{
 		Tracer:    tr,
+		Thread:    thread,
 		Start:     t3,
 		Now:       start.Add(6 * time.Second),
 		Product:   "MySQL",
 		Operation: "SELECT",
 		// missing collection
 	})
-	t4 := StartSegment(tr, start.Add(7*time.Second))
+	t4 := StartSegment(tr, thread, start.Add(7*time.Second))
 	t4.Stamp++
 	EndDatastoreSegment(EndDatastoreParams{
 		Tracer:    tr,
+		Thread:    thread,
 		Start:     t4,
 		Now:       start.Add(8 * time.Second),
 		Product:   "MySQL",
 		Operation: "invalid-token",
 	})
-	t5 := StartSegment(tr, start.Add(9*time.Second))
+	t5 := StartSegment(tr, thread, start.Add(9*time.Second))
 	EndDatastoreSegment(EndDatastoreParams{
 		Tracer: tr,
+		Thread: thread,
 		Start:  t5,
 		Now:    start.Add(10 * time.Second),
 		// missing datastore, collection, and operation
@@ -557,9 +755,11 @@ func TestDatastoreInstancesCrossAgent(t *testing.T) {
 		}
 
 		tr := &TxnData{}
-		s := StartSegment(tr, start)
+		thread := &Thread{}
+		s := StartSegment(tr, thread, start)
 		EndDatastoreSegment(EndDatastoreParams{
 			Tracer:       tr,
+			Thread:       thread,
 			Start:        s,
 			Now:          start.Add(1 * time.Second),
 			Product:      tc.Product,
@@ -593,13 +793,14 @@ func TestDatastoreInstancesCrossAgent(t *testing.T) {
 func TestGenericSpanEventCreation(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 
 	// Enable that which is necessary to generate span events when segments are ended.
 	tr.LazilyCalculateSampled = func() bool { return true }
 	tr.SpanEventsEnabled = true
 
-	t1 := StartSegment(tr, start.Add(1*time.Second))
-	EndBasicSegment(tr, t1, start.Add(3*time.Second), "t1")
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
+	EndBasicSegment(tr, thread, t1, start.Add(3*time.Second), "t1")
 
 	// Since a basic segment has just ended, there should be exactly one generic span event in tr.spanEvents[]
 	if 1 != len(tr.spanEvents) {
@@ -610,15 +811,49 @@ func TestGenericSpanEventCreation(t *testing.T) {
 	}
 }
 
+func TestThreadSpanEventParent(t *testing.T) {
+	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
+	tr := &TxnData{}
+	tr.rootSpanID = "0123456789ABCDEF"
+	thread0 := &Thread{}
+	thread1 := NewThread(tr)
+
+	tr.LazilyCalculateSampled = func() bool { return true }
+	tr.SpanEventsEnabled = true
+
+	t1 := StartSegment(tr, thread0, start.Add(1*time.Second))
+	t2 := StartSegment(tr, thread1, start.Add(2*time.Second))
+	t3 := StartSegment(tr, thread1, start.Add(3*time.Second))
+	EndBasicSegment(tr, thread0, t1, start.Add(4*time.Second), "t1")
+	EndBasicSegment(tr, thread1, t3, start.Add(5*time.Second), "t3")
+	EndBasicSegment(tr, thread1, t2, start.Add(6*time.Second), "t2")
+
+	if 3 != len(tr.spanEvents) {
+		t.Fatal(tr.spanEvents)
+	}
+	t1Event, t3Event, t2Event := tr.spanEvents[0], tr.spanEvents[1], tr.spanEvents[2]
+	if t1Event.ParentID != "0123456789ABCDEF" {
+		t.Error(t1Event.ParentID)
+	}
+	// The top segment of the new thread is a child of the root.
+	if t2Event.ParentID != "0123456789ABCDEF" {
+		t.Error(t2Event.ParentID)
+	}
+	if t3Event.ParentID != t2Event.GUID {
+		t.Error(t3Event.ParentID, t2Event.GUID)
+	}
+}
+
 func TestSpanEventNotSampled(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 
 	tr.LazilyCalculateSampled = func() bool { return false }
 	tr.SpanEventsEnabled = true
 
-	t1 := StartSegment(tr, start.Add(1*time.Second))
-	EndBasicSegment(tr, t1, start.Add(3*time.Second), "t1")
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
+	EndBasicSegment(tr, thread, t1, start.Add(3*time.Second), "t1")
 
 	if 0 != len(tr.spanEvents) {
 		t.Error(tr.spanEvents)
@@ -628,12 +863,13 @@ func TestSpanEventNotSampled(t *testing.T) {
 func TestSpanEventNotEnabled(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 
 	tr.LazilyCalculateSampled = func() bool { return true }
 	tr.SpanEventsEnabled = false
 
-	t1 := StartSegment(tr, start.Add(1*time.Second))
-	EndBasicSegment(tr, t1, start.Add(3*time.Second), "t1")
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
+	EndBasicSegment(tr, thread, t1, start.Add(3*time.Second), "t1")
 
 	if 0 != len(tr.spanEvents) {
 		t.Error(tr.spanEvents)
@@ -643,14 +879,16 @@ func TestSpanEventNotEnabled(t *testing.T) {
 func TestDatastoreSpanEventCreation(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 
 	// Enable that which is necessary to generate span events when segments are ended.
 	tr.LazilyCalculateSampled = func() bool { return true }
 	tr.SpanEventsEnabled = true
 
-	t1 := StartSegment(tr, start.Add(1*time.Second))
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
 	EndDatastoreSegment(EndDatastoreParams{
 		Tracer:     tr,
+		Thread:     thread,
 		Start:      t1,
 		Now:        start.Add(3 * time.Second),
 		Product:    "MySQL",
@@ -670,13 +908,14 @@ func TestDatastoreSpanEventCreation(t *testing.T) {
 func TestHTTPSpanEventCreation(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 
 	// Enable that which is necessary to generate span events when segments are ended.
 	tr.LazilyCalculateSampled = func() bool { return true }
 	tr.SpanEventsEnabled = true
 
-	t1 := StartSegment(tr, start.Add(1*time.Second))
-	EndExternalSegment(tr, t1, start.Add(3*time.Second), nil, "", nil)
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
+	EndExternalSegment(tr, thread, t1, start.Add(3*time.Second), nil, "", nil)
 
 	// Since an external segment has just ended, there should be exactly one HTTP span event in tr.spanEvents[]
 	if 1 != len(tr.spanEvents) {
@@ -686,3 +925,85 @@ func TestHTTPSpanEventCreation(t *testing.T) {
 		t.Error(tr.spanEvents[0].Category)
 	}
 }
+
+func TestSegmentExternalTiming(t *testing.T) {
+	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
+	tr := &TxnData{
+		SpanEventsEnabled:      true,
+		LazilyCalculateSampled: func() bool { return true },
+	}
+	tr.TxnTrace.Enabled = true
+	tr.TxnTrace.StackTraceThreshold = 1 * time.Hour
+	thread := &Thread{}
+
+	timing := &ExternalTiming{
+		DNS:              time.Millisecond,
+		Wait:             2 * time.Second,
+		ConnectionReused: true,
+		RemoteAddress:    "10.0.0.1:443",
+	}
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
+	EndExternalSegmentWithTiming(tr, thread, t1, start.Add(4*time.Second), parseURL("https://f1.com"), "GET", nil, timing)
+
+	js, err := tr.TxnTrace.nodes[0].params.MarshalJSON()
+	if nil != err || string(js) != `{"uri":"https://f1.com","http.dnsDuration":0.001,"http.waitDuration":2,"http.connectionReused":true,"peer.address":"10.0.0.1:443"}` {
+		t.Error(string(js), err)
+	}
+	intrinsics := tr.spanEvents[0].Intrinsics()
+	if intrinsics["http.waitDuration"] != 2.0 || intrinsics["http.connectionReused"] != true ||
+		intrinsics["peer.address"] != "10.0.0.1:443" {
+		t.Error(intrinsics)
+	}
+	if _, ok := intrinsics["http.tlsDuration"]; ok {
+		t.Error(intrinsics)
+	}
+}
+
+func TestSegmentAttributes(t *testing.T) {
+	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
+	input := sampleAttributeConfigInput
+	input.SpanEvents.Exclude = []string{"traceOnly"}
+	input.TransactionTracer.Exclude = []string{"spanOnly"}
+	tr := &TxnData{
+		SpanEventsEnabled:      true,
+		LazilyCalculateSampled: func() bool { return true },
+	}
+	tr.Attrs = NewAttributes(CreateAttributeConfig(input, true))
+	tr.TxnTrace.Enabled = true
+	tr.TxnTrace.StackTraceThreshold = 1 * time.Hour
+	thread := &Thread{}
+
+	if err := AddSpanAttribute(tr, thread, "root", 1); nil != err {
+		t.Error(err)
+	}
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
+	if err := AddSegmentAttribute(tr, thread, t1, "spanOnly", "zip"); nil != err {
+		t.Error(err)
+	}
+	if err := AddSpanAttribute(tr, thread, "traceOnly", true); nil != err {
+		t.Error(err)
+	}
+	if err := AddSegmentAttribute(tr, thread, t1, "invalid", struct{}{}); nil == err {
+		t.Error("invalid attribute type accepted")
+	}
+	if err := EndBasicSegment(tr, thread, t1, start.Add(2*time.Second), "t1"); nil != err {
+		t.Error(err)
+	}
+	if err := AddSegmentAttribute(tr, thread, t1, "late", 1); errSegmentEnded != err {
+		t.Error(err)
+	}
+	if err := AddSegmentAttribute(tr, thread, SegmentStartTime{}, "zero", 1); errMalformedSegment != err {
+		t.Error(err)
+	}
+
+	if attrs := tr.spanEvents[0].UserAttributes(); len(attrs) != 1 || attrs["spanOnly"] != "zip" {
+		t.Error(attrs)
+	}
+	if attrs := tr.rootSpanEvent().UserAttributes(); len(attrs) != 1 || attrs["root"] != 1 {
+		t.Error(attrs)
+	}
+	js, err := tr.TxnTrace.nodes[0].params.MarshalJSON()
+	if nil != err || string(js) != `{"traceOnly":true}` {
+		t.Error(string(js), err)
+	}
+}
@@ -123,11 +123,15 @@ func sharedTransactionIntrinsics(e *TxnEvent, w *jsonFieldsWriter) {
 func sharedBetterCATIntrinsics(e *TxnEvent, w *jsonFieldsWriter) {
 	if e.BetterCAT.Enabled {
 		if p := e.BetterCAT.Inbound; nil != p {
-			w.stringField("parent.type", p.Type)
-			w.stringField("parent.app", p.App)
-			w.stringField("parent.account", p.Account)
+			if p.HasNewRelicTraceInfo {
+				w.stringField("parent.type", p.Type)
+				w.stringField("parent.app", p.App)
+				w.stringField("parent.account", p.Account)
+			}
 			w.stringField("parent.transportType", p.TransportType)
-			w.floatField("parent.transportDuration", p.TransportDuration.Seconds())
+			if p.HasNewRelicTraceInfo {
+				w.floatField("parent.transportDuration", p.TransportDuration.Seconds())
+			}
 		}
 
 		w.stringField("guid", e.BetterCAT.ID)
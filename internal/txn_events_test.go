@@ -129,6 +129,7 @@ func TestTxnEventMarshalWithDatastoreExternal(t *testing.T) {
 func TestTxnEventMarshalWithInboundCaller(t *testing.T) {
 	e := sampleTxnEvent
 	e.BetterCAT.Inbound = &Payload{
+		HasNewRelicTraceInfo: true,
 		payloadCaller: payloadCaller{
 			TransportType: "HTTP",
 			Type:          "Browser",
@@ -166,6 +167,7 @@ func TestTxnEventMarshalWithInboundCaller(t *testing.T) {
 func TestTxnEventMarshalWithInboundCallerOldCAT(t *testing.T) {
 	e := sampleTxnEventWithOldCAT
 	e.BetterCAT.Inbound = &Payload{
+		HasNewRelicTraceInfo: true,
 		payloadCaller: payloadCaller{
 			TransportType: "HTTP",
 			Type:          "Browser",
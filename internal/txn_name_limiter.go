@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/newrelic/go-agent/internal/logger"
+)
+
+// TxnNameOtherSuffix is appended to the prefix of transactions whose names
+// exceed the TxnNameLimiter limit.
+const TxnNameOtherSuffix = "/other"
+
+// TxnNameLimiter limits the number of distinct transaction names with the same
+// prefix in each harvest.  The prefix is the namespace, eg.
+// "WebTransaction/Go", followed by the first segment of the name after it, eg.
+// "WebTransaction/Go/users" for "WebTransaction/Go/users/123", so that only
+// the names of the route containing IDs are collapsed.  Each transaction name
+// creates several metrics, and names containing IDs would otherwise fill the
+// metric table.
+type TxnNameLimiter struct {
+	sync.Mutex
+	limit  int
+	logger logger.Logger
+	// names contains the distinct names seen this harvest by prefix.
+	names map[string]map[string]struct{}
+	// limited counts the transactions renamed this harvest by prefix.
+	limited map[string]int
+}
+
+// NewTxnNameLimiter creates a TxnNameLimiter.  nil is returned if the limit
+// is not positive, and a nil TxnNameLimiter does not limit names.
+func NewTxnNameLimiter(limit int, lg logger.Logger) *TxnNameLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &TxnNameLimiter{
+		limit:   limit,
+		logger:  lg,
+		names:   make(map[string]map[string]struct{}),
+		limited: make(map[string]int),
+	}
+}
+
+// txnNamePrefix returns the prefix whose distinct names are counted.  Names
+// with a single segment after the namespace, and names outside of the
+// namespace, are counted with the namespace itself.
+func txnNamePrefix(name, namespace string) string {
+	rest := strings.TrimPrefix(name, namespace+"/")
+	if rest == name {
+		return namespace
+	}
+	if idx := strings.Index(rest, "/"); idx > 0 {
+		return namespace + "/" + rest[:idx]
+	}
+	return namespace
+}
+
+// Limit returns the name that should be used for the transaction.  The name
+// is returned unchanged unless the limit of distinct names for its prefix has
+// been reached, in which case the prefix followed by TxnNameOtherSuffix is
+// returned.
+func (l *TxnNameLimiter) Limit(name, namespace string) string {
+	if nil == l || "" == name {
+		return name
+	}
+	prefix := txnNamePrefix(name, namespace)
+	l.Lock()
+	defer l.Unlock()
+
+	names := l.names[prefix]
+	if nil == names {
+		names = make(map[string]struct{})
+		l.names[prefix] = names
+	}
+	if _, ok := names[name]; ok {
+		return name
+	}
+	if len(names) < l.limit {
+		names[name] = struct{}{}
+		return name
+	}
+	if 0 == l.limited[prefix] {
+		l.logger.Warn("transaction name limit reached", map[string]interface{}{
+			"prefix": prefix,
+			"limit":  l.limit,
+			"name":   name,
+		})
+	}
+	l.limited[prefix]++
+	return prefix + TxnNameOtherSuffix
+}
+
+// MergeIntoHarvest adds a supportability metric for each prefix whose names
+// were limited and begins a new harvest period.  Nothing happens if l is nil.
+func (l *TxnNameLimiter) MergeIntoHarvest(h *Harvest) {
+	if nil == l {
+		return
+	}
+	l.Lock()
+	limited := l.limited
+	l.names = make(map[string]map[string]struct{})
+	l.limited = make(map[string]int)
+	l.Unlock()
+
+	for prefix, count := range limited {
+		h.Metrics.addCount(txnNamesLimitedPrefix+prefix, float64(count), forced)
+	}
+}
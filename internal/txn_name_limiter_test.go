@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/internal/logger"
+)
+
+func TestTxnNamePrefix(t *testing.T) {
+	for name, expect := range map[string]string{
+		"WebTransaction/Go/users/123":     "WebTransaction/Go/users",
+		"WebTransaction/Go/users/123/zip": "WebTransaction/Go/users",
+		"WebTransaction/Go/login":         "WebTransaction/Go",
+		"WebTransaction/Go//users":        "WebTransaction/Go",
+		"WebTransaction/Other/users/123":  "WebTransaction/Go",
+	} {
+		if out := txnNamePrefix(name, "WebTransaction/Go"); out != expect {
+			t.Error(name, out)
+		}
+	}
+}
+
+func TestTxnNameLimiter(t *testing.T) {
+	l := NewTxnNameLimiter(2, logger.ShimLogger{})
+	for name, expect := range map[string]string{
+		"WebTransaction/Go/users/1": "WebTransaction/Go/users/1",
+		"WebTransaction/Go/users/2": "WebTransaction/Go/users/2",
+	} {
+		if out := l.Limit(name, "WebTransaction/Go"); out != expect {
+			t.Error(name, out)
+		}
+	}
+	if out := l.Limit("WebTransaction/Go/users/3", "WebTransaction/Go"); out != "WebTransaction/Go/users/other" {
+		t.Error(out)
+	}
+	if out := l.Limit("WebTransaction/Go/users/4", "WebTransaction/Go"); out != "WebTransaction/Go/users/other" {
+		t.Error(out)
+	}
+	// Names seen before the limit was reached are unchanged.
+	if out := l.Limit("WebTransaction/Go/users/1", "WebTransaction/Go"); out != "WebTransaction/Go/users/1" {
+		t.Error(out)
+	}
+	// Other routes and namespaces have their own limits.
+	for name, namespace := range map[string]string{
+		"WebTransaction/Go/login":     "WebTransaction/Go",
+		"WebTransaction/Go/orders/1":  "WebTransaction/Go",
+		"OtherTransaction/Go/users/3": "OtherTransaction/Go",
+	} {
+		if out := l.Limit(name, namespace); out != name {
+			t.Error(name, out)
+		}
+	}
+
+	h := NewHarvest(time.Now(), DefaultHarvestConfig)
+	l.MergeIntoHarvest(h)
+	ExpectMetrics(t, h.Metrics, []WantMetric{
+		{Name: "Supportability/Go/TransactionNames/Limited/WebTransaction/Go/users", Scope: "", Forced: true, Data: []float64{2, 0, 0, 0, 0, 0}},
+	})
+
+	// The names are reset each harvest.
+	if out := l.Limit("WebTransaction/Go/users/3", "WebTransaction/Go"); out != "WebTransaction/Go/users/3" {
+		t.Error(out)
+	}
+	h = NewHarvest(time.Now(), DefaultHarvestConfig)
+	l.MergeIntoHarvest(h)
+	ExpectMetrics(t, h.Metrics, []WantMetric{})
+}
+
+func TestTxnNameLimiterDisabled(t *testing.T) {
+	l := NewTxnNameLimiter(0, logger.ShimLogger{})
+	if nil != l {
+		t.Fatal(l)
+	}
+	if out := l.Limit("WebTransaction/Go/a", "WebTransaction/Go"); out != "WebTransaction/Go/a" {
+		t.Error(out)
+	}
+	l.MergeIntoHarvest(NewHarvest(time.Now(), DefaultHarvestConfig))
+}
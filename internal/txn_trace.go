@@ -27,6 +27,8 @@ type traceNodeParams struct {
 	Query           string
 	TransactionGUID string
 	queryParameters queryParameters
+	externalTiming  *ExternalTiming
+	userAttributes  spanAttributes
 }
 
 func (p *traceNodeParams) WriteJSON(buf *bytes.Buffer) {
@@ -56,6 +58,14 @@ func (p *traceNodeParams) WriteJSON(buf *bytes.Buffer) {
 	if nil != p.queryParameters {
 		w.writerField("query_parameters", p.queryParameters)
 	}
+	if nil != p.externalTiming {
+		p.externalTiming.writeFields(&w)
+	}
+	for key, atr := range p.userAttributes {
+		if 0 != atr.dests&destTxnTrace {
+			writeAttributeValueJSON(&w, key, atr.value)
+		}
+	}
 	buf.WriteByte('}')
 }
 
@@ -72,6 +82,7 @@ type traceNode struct {
 	duration time.Duration
 	params   *traceNodeParams
 	name     string
+	threadID uint64
 }
 
 func (h traceNodeHeap) Len() int           { return len(h) }
@@ -113,6 +124,7 @@ func (trace *TxnTrace) witnessNode(end segmentEnd, name string, params *traceNod
 		duration: end.duration,
 		name:     name,
 		params:   params,
+		threadID: end.threadID,
 	}
 	if !trace.considerNode(end) {
 		return
@@ -120,6 +132,12 @@ func (trace *TxnTrace) witnessNode(end segmentEnd, name string, params *traceNod
 	if trace.nodes == nil {
 		trace.nodes = make(traceNodeHeap, 0, startingTxnTraceNodes)
 	}
+	if end.attributes.hasDest(destTxnTrace) {
+		if node.params == nil {
+			node.params = new(traceNodeParams)
+		}
+		node.params.userAttributes = end.attributes
+	}
 	if end.exclusive >= trace.StackTraceThreshold {
 		if node.params == nil {
 			p := new(traceNodeParams)
@@ -184,9 +202,15 @@ func printNodeStart(buf *bytes.Buffer, n nodeDetails) {
 	buf.WriteByte('[')
 }
 
-func printChildren(buf *bytes.Buffer, traceStart time.Time, nodes sortedTraceNodes, next int, stop segmentStamp) int {
+// printChildren prints nodes of the given thread, starting at index next, until
+// a node that does not start before the stop stamp is found.  A nil stop prints
+// every remaining node of the thread.
+func printChildren(buf *bytes.Buffer, traceStart time.Time, nodes sortedTraceNodes, next int, stop *segmentStamp, threadID uint64) int {
 	firstChild := true
-	for next < len(nodes) && nodes[next].start.Stamp < stop {
+	for next < len(nodes) && nodes[next].threadID == threadID {
+		if nil != stop && nodes[next].start.Stamp >= *stop {
+			break
+		}
 		if firstChild {
 			firstChild = false
 		} else {
@@ -198,7 +222,8 @@ func printChildren(buf *bytes.Buffer, traceStart time.Time, nodes sortedTraceNod
 			relativeStop:  nodes[next].stop.Time.Sub(traceStart),
 			params:        nodes[next].params,
 		})
-		next = printChildren(buf, traceStart, nodes, next+1, nodes[next].stop.Stamp)
+		stopStamp := nodes[next].stop.Stamp
+		next = printChildren(buf, traceStart, nodes, next+1, &stopStamp, threadID)
 		buf.WriteString("]]")
 
 	}
@@ -207,9 +232,17 @@ func printChildren(buf *bytes.Buffer, traceStart time.Time, nodes sortedTraceNod
 
 type sortedTraceNodes []*traceNode
 
-func (s sortedTraceNodes) Len() int           { return len(s) }
-func (s sortedTraceNodes) Less(i, j int) bool { return s[i].start.Stamp < s[j].start.Stamp }
-func (s sortedTraceNodes) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s sortedTraceNodes) Len() int      { return len(s) }
+func (s sortedTraceNodes) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+// Less sorts the nodes by thread and then by start stamp so that the nodes of
+// each goroutine are adjacent and in the order they were started.
+func (s sortedTraceNodes) Less(i, j int) bool {
+	if s[i].threadID != s[j].threadID {
+		return s[i].threadID < s[j].threadID
+	}
+	return s[i].start.Stamp < s[j].start.Stamp
+}
 
 // MarshalJSON is used for testing.
 //
@@ -267,9 +300,12 @@ func (trace *HarvestTrace) writeJSON(buf *bytes.Buffer) {
 		relativeStop:  trace.Duration,
 	})
 
-	if len(nodes) > 0 {
-		lastStopStamp := nodes[len(nodes)-1].stop.Stamp + 1
-		printChildren(buf, trace.Start, nodes, 0, lastStopStamp)
+	// The segments of each goroutine are children of the root node.
+	for next := 0; next < len(nodes); {
+		if next > 0 {
+			buf.WriteByte(',')
+		}
+		next = printChildren(buf, trace.Start, nodes, next, nil, nodes[next].threadID)
 	}
 
 	buf.WriteString("]]") // end outer root
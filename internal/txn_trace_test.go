@@ -11,14 +11,16 @@ import (
 func TestTxnTrace(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 	tr.TxnTrace.Enabled = true
 	tr.TxnTrace.StackTraceThreshold = 1 * time.Hour
 	tr.TxnTrace.SegmentThreshold = 0
 
-	t1 := StartSegment(tr, start.Add(1*time.Second))
-	t2 := StartSegment(tr, start.Add(2*time.Second))
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
+	t2 := StartSegment(tr, thread, start.Add(2*time.Second))
 	EndDatastoreSegment(EndDatastoreParams{
 		Tracer:             tr,
+		Thread:             thread,
 		Start:              t2,
 		Now:                start.Add(3 * time.Second),
 		Product:            "MySQL",
@@ -30,26 +32,27 @@ func TestTxnTrace(t *testing.T) {
 		Host:               "db-server-1",
 		PortPathOrID:       "3306",
 	})
-	t3 := StartSegment(tr, start.Add(4*time.Second))
-	EndExternalSegment(tr, t3, start.Add(5*time.Second), parseURL("http://example.com/zip/zap?secret=shhh"), "", nil)
-	EndBasicSegment(tr, t1, start.Add(6*time.Second), "t1")
-	t4 := StartSegment(tr, start.Add(7*time.Second))
-	t5 := StartSegment(tr, start.Add(8*time.Second))
-	t6 := StartSegment(tr, start.Add(9*time.Second))
-	EndBasicSegment(tr, t6, start.Add(10*time.Second), "t6")
-	EndBasicSegment(tr, t5, start.Add(11*time.Second), "t5")
-	t7 := StartSegment(tr, start.Add(12*time.Second))
+	t3 := StartSegment(tr, thread, start.Add(4*time.Second))
+	EndExternalSegment(tr, thread, t3, start.Add(5*time.Second), parseURL("http://example.com/zip/zap?secret=shhh"), "", nil)
+	EndBasicSegment(tr, thread, t1, start.Add(6*time.Second), "t1")
+	t4 := StartSegment(tr, thread, start.Add(7*time.Second))
+	t5 := StartSegment(tr, thread, start.Add(8*time.Second))
+	t6 := StartSegment(tr, thread, start.Add(9*time.Second))
+	EndBasicSegment(tr, thread, t6, start.Add(10*time.Second), "t6")
+	EndBasicSegment(tr, thread, t5, start.Add(11*time.Second), "t5")
+	t7 := StartSegment(tr, thread, start.Add(12*time.Second))
 	EndDatastoreSegment(EndDatastoreParams{
 		Tracer:    tr,
+		Thread:    thread,
 		Start:     t7,
 		Now:       start.Add(13 * time.Second),
 		Product:   "MySQL",
 		Operation: "SELECT",
 		// no collection
 	})
-	t8 := StartSegment(tr, start.Add(14*time.Second))
-	EndExternalSegment(tr, t8, start.Add(15*time.Second), nil, "", nil)
-	EndBasicSegment(tr, t4, start.Add(16*time.Second), "t4")
+	t8 := StartSegment(tr, thread, start.Add(14*time.Second))
+	EndExternalSegment(tr, thread, t8, start.Add(15*time.Second), nil, "", nil)
+	EndBasicSegment(tr, thread, t4, start.Add(16*time.Second), "t4")
 
 	acfg := CreateAttributeConfig(sampleAttributeConfigInput, true)
 	attr := NewAttributes(acfg)
@@ -197,17 +200,113 @@ func TestTxnTrace(t *testing.T) {
 	testExpectedJSON(t, expect, string(js))
 }
 
+func TestTxnTraceMultipleThreads(t *testing.T) {
+	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
+	tr := &TxnData{}
+	thread := &Thread{}
+	thread1 := NewThread(tr)
+	tr.TxnTrace.Enabled = true
+	tr.TxnTrace.StackTraceThreshold = 1 * time.Hour
+	tr.TxnTrace.SegmentThreshold = 0
+
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
+	t3 := StartSegment(tr, thread1, start.Add(2*time.Second))
+	t2 := StartSegment(tr, thread, start.Add(3*time.Second))
+	EndBasicSegment(tr, thread, t2, start.Add(4*time.Second), "t2")
+	EndBasicSegment(tr, thread, t1, start.Add(5*time.Second), "t1")
+	EndBasicSegment(tr, thread1, t3, start.Add(6*time.Second), "t3")
+
+	ht := newHarvestTraces()
+	ht.regular.addTxnTrace(&HarvestTrace{
+		TxnEvent: TxnEvent{
+			Start:     start,
+			Duration:  20 * time.Second,
+			FinalName: "WebTransaction/Go/hello",
+			Attrs:     NewAttributes(CreateAttributeConfig(sampleAttributeConfigInput, true)),
+		},
+		Trace: tr.TxnTrace,
+	})
+
+	expect := `["12345",[[
+	   1417136460000000,
+	   20000,
+	   "WebTransaction/Go/hello",
+	   null,
+	   [
+	      0,
+	      {},
+	      {},
+	      [
+	         0,
+	         20000,
+	         "ROOT",
+	         {},
+	         [
+	            [
+	               0,
+	               20000,
+	               "WebTransaction/Go/hello",
+	               {},
+	               [
+	                  [
+	                     1000,
+	                     5000,
+	                     "Custom/t1",
+	                     {},
+	                     [
+	                        [
+	                           3000,
+	                           4000,
+	                           "Custom/t2",
+	                           {},
+	                           []
+	                        ]
+	                     ]
+	                  ],
+	                  [
+	                     2000,
+	                     6000,
+	                     "Custom/t3",
+	                     {},
+	                     []
+	                  ]
+	               ]
+	            ]
+	         ]
+	      ],
+	      {
+	         "agentAttributes":{},
+	         "userAttributes":{},
+	         "intrinsics":{}
+	      }
+	   ],
+	   "",
+	   null,
+	   false,
+	   null,
+	   ""
+	]]]`
+
+	js, err := ht.Data("12345", start)
+	if nil != err {
+		t.Fatal(err)
+	}
+	testExpectedJSON(t, expect, string(js))
+}
+
 func TestTxnTraceOldCAT(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 	tr.TxnTrace.Enabled = true
 	tr.TxnTrace.StackTraceThreshold = 1 * time.Hour
 	tr.TxnTrace.SegmentThreshold = 0
 
-	t1 := StartSegment(tr, start.Add(1*time.Second))
-	t2 := StartSegment(tr, start.Add(2*time.Second))
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
+	t2 := StartSegment(tr, thread, start.Add(2*time.Second))
 	EndDatastoreSegment(EndDatastoreParams{
 		Tracer:             tr,
+		Thread:             thread,
 		Start:              t2,
 		Now:                start.Add(3 * time.Second),
 		Product:            "MySQL",
@@ -219,26 +318,27 @@ func TestTxnTraceOldCAT(t *testing.T) {
 		Host:               "db-server-1",
 		PortPathOrID:       "3306",
 	})
-	t3 := StartSegment(tr, start.Add(4*time.Second))
-	EndExternalSegment(tr, t3, start.Add(5*time.Second), parseURL("http://example.com/zip/zap?secret=shhh"), "", nil)
-	EndBasicSegment(tr, t1, start.Add(6*time.Second), "t1")
-	t4 := StartSegment(tr, start.Add(7*time.Second))
-	t5 := StartSegment(tr, start.Add(8*time.Second))
-	t6 := StartSegment(tr, start.Add(9*time.Second))
-	EndBasicSegment(tr, t6, start.Add(10*time.Second), "t6")
-	EndBasicSegment(tr, t5, start.Add(11*time.Second), "t5")
-	t7 := StartSegment(tr, start.Add(12*time.Second))
+	t3 := StartSegment(tr, thread, start.Add(4*time.Second))
+	EndExternalSegment(tr, thread, t3, start.Add(5*time.Second), parseURL("http://example.com/zip/zap?secret=shhh"), "", nil)
+	EndBasicSegment(tr, thread, t1, start.Add(6*time.Second), "t1")
+	t4 := StartSegment(tr, thread, start.Add(7*time.Second))
+	t5 := StartSegment(tr, thread, start.Add(8*time.Second))
+	t6 := StartSegment(tr, thread, start.Add(9*time.Second))
+	EndBasicSegment(tr, thread, t6, start.Add(10*time.Second), "t6")
+	EndBasicSegment(tr, thread, t5, start.Add(11*time.Second), "t5")
+	t7 := StartSegment(tr, thread, start.Add(12*time.Second))
 	EndDatastoreSegment(EndDatastoreParams{
 		Tracer:    tr,
+		Thread:    thread,
 		Start:     t7,
 		Now:       start.Add(13 * time.Second),
 		Product:   "MySQL",
 		Operation: "SELECT",
 		// no collection
 	})
-	t8 := StartSegment(tr, start.Add(14*time.Second))
-	EndExternalSegment(tr, t8, start.Add(15*time.Second), nil, "", nil)
-	EndBasicSegment(tr, t4, start.Add(16*time.Second), "t4")
+	t8 := StartSegment(tr, thread, start.Add(14*time.Second))
+	EndExternalSegment(tr, thread, t8, start.Add(15*time.Second), nil, "", nil)
+	EndBasicSegment(tr, thread, t4, start.Add(16*time.Second), "t4")
 
 	acfg := CreateAttributeConfig(sampleAttributeConfigInput, true)
 	attr := NewAttributes(acfg)
@@ -592,6 +692,7 @@ func TestTxnTraceNoSegmentsNoAttributesOldCAT(t *testing.T) {
 func TestTxnTraceSlowestNodesSaved(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 	tr.TxnTrace.Enabled = true
 	tr.TxnTrace.StackTraceThreshold = 1 * time.Hour
 	tr.TxnTrace.SegmentThreshold = 0
@@ -600,9 +701,9 @@ func TestTxnTraceSlowestNodesSaved(t *testing.T) {
 	durations := []int{5, 4, 6, 3, 7, 2, 8, 1, 9}
 	now := start
 	for _, d := range durations {
-		s := StartSegment(tr, now)
+		s := StartSegment(tr, thread, now)
 		now = now.Add(time.Duration(d) * time.Second)
-		EndBasicSegment(tr, s, now, strconv.Itoa(d))
+		EndBasicSegment(tr, thread, s, now, strconv.Itoa(d))
 	}
 
 	acfg := CreateAttributeConfig(sampleAttributeConfigInput, true)
@@ -712,6 +813,7 @@ func TestTxnTraceSlowestNodesSaved(t *testing.T) {
 func TestTxnTraceSlowestNodesSavedOldCAT(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 	tr.TxnTrace.Enabled = true
 	tr.TxnTrace.StackTraceThreshold = 1 * time.Hour
 	tr.TxnTrace.SegmentThreshold = 0
@@ -720,9 +822,9 @@ func TestTxnTraceSlowestNodesSavedOldCAT(t *testing.T) {
 	durations := []int{5, 4, 6, 3, 7, 2, 8, 1, 9}
 	now := start
 	for _, d := range durations {
-		s := StartSegment(tr, now)
+		s := StartSegment(tr, thread, now)
 		now = now.Add(time.Duration(d) * time.Second)
-		EndBasicSegment(tr, s, now, strconv.Itoa(d))
+		EndBasicSegment(tr, thread, s, now, strconv.Itoa(d))
 	}
 
 	acfg := CreateAttributeConfig(sampleAttributeConfigInput, true)
@@ -822,6 +924,7 @@ func TestTxnTraceSlowestNodesSavedOldCAT(t *testing.T) {
 func TestTxnTraceSegmentThreshold(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 	tr.TxnTrace.Enabled = true
 	tr.TxnTrace.StackTraceThreshold = 1 * time.Hour
 	tr.TxnTrace.SegmentThreshold = 7 * time.Second
@@ -830,9 +933,9 @@ func TestTxnTraceSegmentThreshold(t *testing.T) {
 	durations := []int{5, 4, 6, 3, 7, 2, 8, 1, 9}
 	now := start
 	for _, d := range durations {
-		s := StartSegment(tr, now)
+		s := StartSegment(tr, thread, now)
 		now = now.Add(time.Duration(d) * time.Second)
-		EndBasicSegment(tr, s, now, strconv.Itoa(d))
+		EndBasicSegment(tr, thread, s, now, strconv.Itoa(d))
 	}
 
 	acfg := CreateAttributeConfig(sampleAttributeConfigInput, true)
@@ -928,6 +1031,7 @@ func TestTxnTraceSegmentThreshold(t *testing.T) {
 func TestTxnTraceSegmentThresholdOldCAT(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 	tr.TxnTrace.Enabled = true
 	tr.TxnTrace.StackTraceThreshold = 1 * time.Hour
 	tr.TxnTrace.SegmentThreshold = 7 * time.Second
@@ -936,9 +1040,9 @@ func TestTxnTraceSegmentThresholdOldCAT(t *testing.T) {
 	durations := []int{5, 4, 6, 3, 7, 2, 8, 1, 9}
 	now := start
 	for _, d := range durations {
-		s := StartSegment(tr, now)
+		s := StartSegment(tr, thread, now)
 		now = now.Add(time.Duration(d) * time.Second)
-		EndBasicSegment(tr, s, now, strconv.Itoa(d))
+		EndBasicSegment(tr, thread, s, now, strconv.Itoa(d))
 	}
 
 	acfg := CreateAttributeConfig(sampleAttributeConfigInput, true)
@@ -1185,19 +1289,21 @@ func TestLongestTraceSavedOldCAT(t *testing.T) {
 func TestTxnTraceStackTraceThreshold(t *testing.T) {
 	start := time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC)
 	tr := &TxnData{}
+	thread := &Thread{}
 	tr.TxnTrace.Enabled = true
 	tr.TxnTrace.StackTraceThreshold = 2 * time.Second
 	tr.TxnTrace.SegmentThreshold = 0
 	tr.TxnTrace.maxNodes = 5
 
 	// below stack trace threshold
-	t1 := StartSegment(tr, start.Add(1*time.Second))
-	EndBasicSegment(tr, t1, start.Add(2*time.Second), "t1")
+	t1 := StartSegment(tr, thread, start.Add(1*time.Second))
+	EndBasicSegment(tr, thread, t1, start.Add(2*time.Second), "t1")
 
 	// not above stack trace threshold w/out params
-	t2 := StartSegment(tr, start.Add(2*time.Second))
+	t2 := StartSegment(tr, thread, start.Add(2*time.Second))
 	EndDatastoreSegment(EndDatastoreParams{
 		Tracer:     tr,
+		Thread:     thread,
 		Start:      t2,
 		Now:        start.Add(4 * time.Second),
 		Product:    "MySQL",
@@ -1206,8 +1312,8 @@ func TestTxnTraceStackTraceThreshold(t *testing.T) {
 	})
 
 	// node above stack trace threshold w/ params
-	t3 := StartSegment(tr, start.Add(4*time.Second))
-	EndExternalSegment(tr, t3, start.Add(6*time.Second), parseURL("http://example.com/zip/zap?secret=shhh"), "", nil)
+	t3 := StartSegment(tr, thread, start.Add(4*time.Second))
+	EndExternalSegment(tr, thread, t3, start.Add(6*time.Second), parseURL("http://example.com/zip/zap?secret=shhh"), "", nil)
 
 	p := tr.TxnTrace.nodes[0].params
 	if nil != p {
@@ -3,6 +3,7 @@ package newrelic
 import (
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"net/http"
 	"os"
@@ -34,11 +35,35 @@ type appData struct {
 type app struct {
 	config      Config
 	rpmControls internal.RpmControls
-	testHarvest *internal.Harvest
+
+	// testHarvest is used in place of the processor goroutine when
+	// testing.  testHarvestLock allows it to be swapped while
+	// transactions are being recorded.
+	testHarvest     *internal.Harvest
+	testHarvestLock sync.Mutex
 
 	// placeholderRun is used when the application is not connected.
 	placeholderRun *appRun
 
+	// serverless is non-nil when the application is running in serverless
+	// mode.  Data is merged into its harvest synchronously rather than
+	// being sent to the processor goroutine.
+	serverless *internal.ServerlessHarvest
+
+	// traceObserver is non-nil when infinite tracing is enabled.
+	traceObserver *internal.TraceObserver
+
+	// profiler is non-nil when the thread profiler is enabled.
+	profiler *internal.Profiler
+
+	// spool is non-nil when harvest data which cannot be sent is buffered
+	// on disk.
+	spool *internal.Spool
+
+	// nameLimiter is non-nil when the number of distinct transaction
+	// names is limited.
+	nameLimiter *internal.TxnNameLimiter
+
 	// initiateShutdown is used to tell the processor to shutdown.
 	initiateShutdown chan struct{}
 
@@ -77,9 +102,23 @@ type appRun struct {
 	// AttributeConfig is calculated on every connect since it depends on
 	// the security policies.
 	AttributeConfig *internal.AttributeConfig
+
+	// harvestConfig contains the event harvest period and reservoir
+	// sizes, which may be set by the collector.
+	harvestConfig internal.HarvestConfig
 }
 
 func newAppRun(config Config, reply *internal.ConnectReply) *appRun {
+	if nil != config.InfiniteTracing.TraceObserver {
+		// Every transaction is sampled when using infinite tracing
+		// since sampling is done by the trace observer.
+		reply.AdaptiveSampler = internal.SampleEverything{}
+	}
+	if len(config.TransactionNaming.Rules) > 0 {
+		reply.SetLocalTxnNameRules(config.localTxnNameRules())
+	}
+	// The rules were checked by Config.Validate.
+	redactor, _ := internal.NewRedactor(config.redactionRules())
 	return &appRun{
 		ConnectReply: reply,
 		AttributeConfig: internal.CreateAttributeConfig(internal.AttributeConfigInput{
@@ -88,16 +127,23 @@ func newAppRun(config Config, reply *internal.ConnectReply) *appRun {
 			TransactionEvents: convertAttributeDestinationConfig(config.TransactionEvents.Attributes),
 			TransactionTracer: convertAttributeDestinationConfig(config.TransactionTracer.Attributes),
 			BrowserMonitoring: convertAttributeDestinationConfig(config.BrowserMonitoring.Attributes),
+			SpanEvents:        convertAttributeDestinationConfig(config.SpanEvents.Attributes),
+			Redactor:          redactor,
+			RequestHeaders:    config.headerAttributes(config.HeaderAttributes.Request),
+			ResponseHeaders:   config.headerAttributes(config.HeaderAttributes.Response),
 		}, reply.SecurityPolicies.AttributesInclude.Enabled()),
+		harvestConfig: reply.HarvestConfig(config.harvestConfig()),
 	}
 }
 
 func (app *app) doHarvest(h *internal.Harvest, harvestStart time.Time, run *appRun) {
 	h.CreateFinalMetrics()
-	h.Metrics = h.Metrics.ApplyRules(run.MetricRules)
+	if nil != h.Metrics {
+		h.Metrics = h.Metrics.ApplyRules(run.MetricRules)
+	}
 
 	payloads := h.Payloads(app.config.DistributedTracer.Enabled)
-	for _, p := range payloads {
+	for i, p := range payloads {
 		cmd := p.EndpointMethod()
 		data, err := p.Data(run.RunID.String(), harvestStart)
 
@@ -112,6 +158,22 @@ func (app *app) doHarvest(h *internal.Harvest, harvestStart time.Time, run *appR
 			continue
 		}
 
+		if sink := app.config.HarvestSink; nil != sink {
+			err := sink.WriteHarvest(HarvestPayload{
+				Cmd:          cmd,
+				RunID:        run.RunID.String(),
+				HarvestStart: harvestStart,
+				Data:         data,
+			})
+			if nil != err {
+				app.config.Logger.Warn("harvest sink failure", map[string]interface{}{
+					"cmd":   cmd,
+					"error": err.Error(),
+				})
+			}
+			continue
+		}
+
 		call := internal.RpmCmd{
 			Collector:         run.Collector,
 			RunID:             run.RunID.String(),
@@ -123,6 +185,12 @@ func (app *app) doHarvest(h *internal.Harvest, harvestStart time.Time, run *appR
 		resp := internal.CollectorRequest(call, app.rpmControls)
 
 		if resp.IsDisconnect() || resp.IsRestartException() {
+			if resp.IsRestartException() {
+				// The data is sent once the application has
+				// reconnected.
+				app.spoolWrite(cmd, run, data)
+				app.spoolPayloads(payloads[i+1:], harvestStart, run)
+			}
 			select {
 			case app.collectorErrorChan <- resp:
 			case <-app.shutdownStarted:
@@ -139,12 +207,116 @@ func (app *app) doHarvest(h *internal.Harvest, harvestStart time.Time, run *appR
 		}
 
 		if resp.ShouldSaveHarvestData() {
-			app.Consume(run.RunID, p)
+			select {
+			case <-app.shutdownStarted:
+				// There is no later harvest to merge the
+				// data into.
+				app.spoolWrite(cmd, run, data)
+			default:
+				app.Consume(run.RunID, p)
+			}
+		} else if resp.IsConnectionFailure() {
+			app.spoolWrite(cmd, run, data)
+		}
+	}
+}
+
+// spoolWrite stores a payload which could not be sent in the spool, if the
+// spool is enabled.
+func (app *app) spoolWrite(cmd string, run *appRun, data []byte) {
+	if nil == app.spool {
+		return
+	}
+	if err := app.spool.Write(cmd, run.RunID.String(), data); nil != err {
+		app.config.Logger.Warn("unable to spool harvest data", map[string]interface{}{
+			"cmd":   cmd,
+			"error": err.Error(),
+		})
+	}
+}
+
+// spoolPayloads stores payloads which were not attempted in the spool, if
+// the spool is enabled.
+func (app *app) spoolPayloads(payloads []internal.PayloadCreator, harvestStart time.Time, run *appRun) {
+	if nil == app.spool {
+		return
+	}
+	for _, p := range payloads {
+		data, err := p.Data(run.RunID.String(), harvestStart)
+		if nil == err && nil != data {
+			app.spoolWrite(p.EndpointMethod(), run, data)
 		}
 	}
 }
 
+// replaySpool sends the payloads stored in the spool using the new run.
+func (app *app) replaySpool(run *appRun) {
+	app.spool.Replay(run.RunID.String(), run.harvestConfig, time.Now(), func(cmd string, data []byte) internal.RPMResponse {
+		return internal.CollectorRequest(internal.RpmCmd{
+			Collector:         run.Collector,
+			RunID:             run.RunID.String(),
+			Name:              cmd,
+			Data:              data,
+			RequestHeadersMap: run.RequestHeadersMap,
+		}, app.rpmControls)
+	})
+}
+
+// doAgentCommands executes the commands sent by the collector in reply to
+// get_agent_commands and reports their results.
+func (app *app) doAgentCommands(run *appRun) {
+	call := internal.RpmCmd{
+		Collector:         run.Collector,
+		RunID:             run.RunID.String(),
+		RequestHeadersMap: run.RequestHeadersMap,
+	}
+	cmds, resp := internal.GetAgentCommands(call, app.rpmControls)
+	if resp.IsDisconnect() || resp.IsRestartException() {
+		select {
+		case app.collectorErrorChan <- resp:
+		case <-app.shutdownStarted:
+		}
+		return
+	}
+	if nil != resp.Err {
+		app.config.Logger.Warn("agent commands failure", map[string]interface{}{
+			"error": resp.Err.Error(),
+		})
+		return
+	}
+	if 0 == len(cmds) {
+		return
+	}
+
+	results := internal.ExecuteAgentCommands(cmds, app.profiler)
+	data, err := results.Data(call.RunID, time.Now())
+	if nil != err {
+		app.config.Logger.Warn("unable to create agent command results", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	call.Name = results.EndpointMethod()
+	call.Data = data
+	resp = internal.CollectorRequest(call, app.rpmControls)
+	if nil != resp.Err {
+		app.config.Logger.Warn("agent command results failure", map[string]interface{}{
+			"error": resp.Err.Error(),
+		})
+	}
+}
+
 func (app *app) connectRoutine() {
+	if nil != app.config.HarvestSink {
+		// The harvest data is written to the sink, so there is no need
+		// to connect.
+		select {
+		case app.connectChan <- newAppRun(app.config, internal.OfflineConnectReply()):
+		case <-app.shutdownStarted:
+		}
+		return
+	}
+
 	backoff := internal.ConnectBackoffStart
 	for {
 		reply, resp := internal.ConnectAttempt(config{app.config},
@@ -181,7 +353,7 @@ func (app *app) connectRoutine() {
 
 func debug(data internal.Harvestable, lg Logger) {
 	now := time.Now()
-	h := internal.NewHarvest(now)
+	h := internal.NewHarvest(now, internal.DefaultHarvestConfig)
 	data.MergeIntoHarvest(h)
 	ps := h.Payloads(false)
 	for _, p := range ps {
@@ -228,16 +400,45 @@ func (app *app) process() {
 	var h *internal.Harvest
 	var run *appRun
 
+	// Metrics and traces are harvested every HarvestPeriod.  Events are
+	// harvested using a separate ticker since the collector may choose a
+	// different period.  eventTicker is non-nil when the app is connected.
 	harvestTicker := time.NewTicker(internal.HarvestPeriod)
 	defer harvestTicker.Stop()
+	var eventTicker *time.Ticker
+	stopEventTicker := func() {
+		if nil != eventTicker {
+			eventTicker.Stop()
+			eventTicker = nil
+		}
+	}
+	defer stopEventTicker()
 
 	for {
+		// Receiving from a nil channel blocks forever, so events are
+		// not harvested until the app is connected.
+		var eventTickerC <-chan time.Time
+		if nil != eventTicker {
+			eventTickerC = eventTicker.C
+		}
+
 		select {
 		case <-harvestTicker.C:
 			if nil != run {
 				now := time.Now()
-				go app.doHarvest(h, now, run)
-				h = internal.NewHarvest(now)
+				app.traceObserver.MergeIntoHarvest(h)
+				app.profiler.MergeIntoHarvest(h)
+				app.spool.MergeIntoHarvest(h)
+				app.nameLimiter.MergeIntoHarvest(h)
+				go app.doHarvest(h.Ready(internal.HarvestMetricsTraces, now), now, run)
+				if nil != app.profiler {
+					go app.doAgentCommands(run)
+				}
+			}
+		case <-eventTickerC:
+			if nil != run {
+				now := time.Now()
+				go app.doHarvest(h.Ready(internal.HarvestTypesEvents, now), now, run)
 			}
 		case d := <-app.dataChan:
 			if nil != run && run.RunID == d.id {
@@ -261,7 +462,14 @@ func (app *app) process() {
 						done = true
 					}
 				}
-				app.doHarvest(h, time.Now(), run)
+				app.traceObserver.Shutdown(internal.TraceObserverShutdownTimeout)
+				app.traceObserver.MergeIntoHarvest(h)
+				app.profiler.Shutdown()
+				app.profiler.MergeIntoHarvest(h)
+				app.spool.MergeIntoHarvest(h)
+				app.nameLimiter.MergeIntoHarvest(h)
+				now := time.Now()
+				app.doHarvest(h.Ready(internal.HarvestTypesAll, now), now, run)
 			}
 
 			close(app.shutdownComplete)
@@ -269,6 +477,7 @@ func (app *app) process() {
 		case resp := <-app.collectorErrorChan:
 			run = nil
 			h = nil
+			stopEventTicker()
 			app.setState(nil, nil)
 
 			if resp.IsDisconnect() {
@@ -283,7 +492,10 @@ func (app *app) process() {
 				go app.connectRoutine()
 			}
 		case run = <-app.connectChan:
-			h = internal.NewHarvest(time.Now())
+			h = internal.NewHarvest(time.Now(), run.harvestConfig)
+			stopEventTicker()
+			eventTicker = time.NewTicker(run.harvestConfig.EventPeriod)
+			app.traceObserver.SetRunID(run.RunID)
 			app.setState(run, nil)
 
 			app.config.Logger.Info("application connected", map[string]interface{}{
@@ -291,12 +503,15 @@ func (app *app) process() {
 				"run": run.RunID.String(),
 			})
 			processConnectMessages(run, app.config.Logger)
+			if nil != app.spool {
+				go app.replaySpool(run)
+			}
 		}
 	}
 }
 
 func (app *app) Shutdown(timeout time.Duration) {
-	if !app.config.Enabled {
+	if !app.config.Enabled || app.config.ServerlessMode.Enabled {
 		return
 	}
 
@@ -347,7 +562,7 @@ func runSampler(app *app, period time.Duration) {
 }
 
 func (app *app) WaitForConnection(timeout time.Duration) error {
-	if !app.config.Enabled {
+	if !app.config.Enabled || app.config.ServerlessMode.Enabled {
 		return nil
 	}
 	deadline := time.Now().Add(timeout)
@@ -368,6 +583,29 @@ func (app *app) WaitForConnection(timeout time.Duration) error {
 	}
 }
 
+// newServerlessConnectReply creates the reply used in serverless mode, where
+// there is no connect.
+func newServerlessConnectReply(config Config) *internal.ConnectReply {
+	reply := internal.ConnectReplyDefaults()
+
+	reply.ApdexThresholdSeconds = config.ServerlessMode.ApdexThreshold.Seconds()
+
+	reply.AccountID = config.ServerlessMode.AccountID
+	reply.TrustedAccountKey = config.ServerlessMode.TrustedAccountKey
+	reply.PrimaryAppID = config.ServerlessMode.PrimaryAppID
+
+	if "" == reply.TrustedAccountKey {
+		// The trust key does not need to be provided by customers whose
+		// account ID is the same as the trust key.
+		reply.TrustedAccountKey = reply.AccountID
+	}
+
+	// Each invocation is a single transaction, so every transaction is
+	// sampled.
+	reply.AdaptiveSampler = internal.SampleEverything{}
+	return reply
+}
+
 func newApp(c Config) (Application, error) {
 	c = copyConfigReferenceFields(c)
 	if err := c.Validate(); nil != err {
@@ -400,6 +638,14 @@ func newApp(c Config) (Application, error) {
 		},
 	}
 
+	if app.config.ServerlessMode.Enabled {
+		app.placeholderRun = newAppRun(c, newServerlessConnectReply(c))
+	} else {
+		// Serverless harvests contain a single transaction, so the
+		// names are not limited.
+		app.nameLimiter = internal.NewTxnNameLimiter(c.TransactionNaming.MaxNamesPerPrefix, c.Logger)
+	}
+
 	app.config.Logger.Info("application created", map[string]interface{}{
 		"app":     app.config.AppName,
 		"version": Version,
@@ -410,6 +656,45 @@ func newApp(c Config) (Application, error) {
 		return app, nil
 	}
 
+	if app.config.ServerlessMode.Enabled {
+		// No goroutines are spawned in serverless mode: the data is
+		// written when ServerlessWrite is called.
+		app.serverless = internal.NewServerlessHarvest(app.config.Logger, Version, os.Getenv, app.placeholderRun.harvestConfig)
+		return app, nil
+	}
+
+	if nil != c.InfiniteTracing.TraceObserver {
+		app.traceObserver = internal.NewTraceObserver(internal.TraceObserverConfig{
+			Dialer:    c.InfiniteTracing.TraceObserver,
+			License:   c.License,
+			QueueSize: c.InfiniteTracing.SpanEvents.QueueSize,
+			Logger:    c.Logger,
+		})
+	}
+
+	if c.ThreadProfiler.Enabled && nil == c.HarvestSink {
+		app.profiler = internal.NewProfiler(internal.ProfilerConfig{
+			Logger:        c.Logger,
+			CPUProfileDir: c.ThreadProfiler.CPUProfileDir,
+		})
+	}
+
+	if "" != c.Spool.Directory && nil == c.HarvestSink {
+		spool, err := internal.NewSpool(internal.SpoolConfig{
+			Directory: c.Spool.Directory,
+			MaxBytes:  c.Spool.MaxBytes,
+			MaxAge:    c.Spool.MaxAge,
+			Logger:    c.Logger,
+		})
+		if nil != err {
+			app.config.Logger.Warn("unable to create spool", map[string]interface{}{
+				"directory": c.Spool.Directory,
+				"error":     err.Error(),
+			})
+		}
+		app.spool = spool
+	}
+
 	go app.process()
 	go app.connectRoutine()
 
@@ -439,6 +724,7 @@ func newTestApp(replyfn func(*internal.ConnectReply), cfg Config) (expectApp, er
 
 var (
 	_ internal.HarvestTestinger = &app{}
+	_ internal.HarvestSwapper   = &app{}
 	_ internal.Expect           = &app{}
 )
 
@@ -448,7 +734,19 @@ func (app *app) HarvestTesting(replyfn func(*internal.ConnectReply)) {
 		replyfn(reply)
 		app.placeholderRun = newAppRun(app.config, reply)
 	}
-	app.testHarvest = internal.NewHarvest(time.Now())
+	app.testHarvestLock.Lock()
+	defer app.testHarvestLock.Unlock()
+
+	app.testHarvest = internal.NewHarvest(time.Now(), app.placeholderRun.harvestConfig)
+}
+
+func (app *app) SwapTestHarvest() *internal.Harvest {
+	app.testHarvestLock.Lock()
+	defer app.testHarvestLock.Unlock()
+
+	h := app.testHarvest
+	app.testHarvest = internal.NewHarvest(time.Now(), app.placeholderRun.harvestConfig)
+	return h
 }
 
 func (app *app) getState() (*appRun, error) {
@@ -470,17 +768,31 @@ func (app *app) setState(run *appRun, err error) {
 	app.err = err
 }
 
-// StartTransaction implements newrelic.Application's StartTransaction.
-func (app *app) StartTransaction(name string, w http.ResponseWriter, r *http.Request) Transaction {
+func (app *app) createTxn(name string, w http.ResponseWriter) *thread {
 	run, _ := app.getState()
-	txn := upgradeTxn(newTxn(txnInput{
+	return newTxn(txnInput{
 		app:        app,
 		Config:     app.config,
 		Reply:      run.ConnectReply,
 		writer:     w,
 		Consumer:   app,
 		attrConfig: run.AttributeConfig,
-	}, name))
+
+		traceObserver: app.traceObserver,
+		nameLimiter:   app.nameLimiter,
+	}, name)
+}
+
+// StartTransaction implements newrelic.Application's StartTransaction.
+func (app *app) StartTransaction(name string, w http.ResponseWriter, r *http.Request) Transaction {
+	if nil == r {
+		if prefix, bgName, ok := splitBackgroundName(name); ok {
+			thd := app.createTxn(bgName, w)
+			thd.namePrefix = prefix
+			return upgradeTxn(thd)
+		}
+	}
+	txn := upgradeTxn(app.createTxn(name, w))
 
 	if nil != r {
 		txn.SetWebRequest(NewWebRequest(r))
@@ -488,6 +800,14 @@ func (app *app) StartTransaction(name string, w http.ResponseWriter, r *http.Req
 	return txn
 }
 
+// StartBackgroundTransactionWithPrefix implements
+// BackgroundTransactionStarter.
+func (app *app) StartBackgroundTransactionWithPrefix(prefix, name string) Transaction {
+	thd := app.createTxn(name, nil)
+	thd.namePrefix = prefix
+	return upgradeTxn(thd)
+}
+
 var (
 	errHighSecurityEnabled        = errors.New("high security enabled")
 	errCustomEventsDisabled       = errors.New("custom events disabled")
@@ -504,12 +824,13 @@ func (app *app) RecordCustomEvent(eventType string, params map[string]interface{
 		return errCustomEventsDisabled
 	}
 
+	run, _ := app.getState()
+	params = run.AttributeConfig.Redactor().RedactParams(params)
 	event, e := internal.CreateCustomEvent(eventType, params, time.Now())
 	if nil != e {
 		return e
 	}
 
-	run, _ := app.getState()
 	if !run.CollectCustomEvents {
 		return errCustomEventsRemoteDisabled
 	}
@@ -548,13 +869,28 @@ func (app *app) RecordCustomMetric(name string, value float64) error {
 	return nil
 }
 
+func (app *app) mergeIntoTestHarvest(data internal.Harvestable) bool {
+	app.testHarvestLock.Lock()
+	defer app.testHarvestLock.Unlock()
+
+	if nil == app.testHarvest {
+		return false
+	}
+	data.MergeIntoHarvest(app.testHarvest)
+	return true
+}
+
 func (app *app) Consume(id internal.AgentRunID, data internal.Harvestable) {
 	if "" != debugLogging {
 		debug(data, app.config.Logger)
 	}
 
-	if nil != app.testHarvest {
-		data.MergeIntoHarvest(app.testHarvest)
+	if nil != app.serverless {
+		app.serverless.Consume(data)
+		return
+	}
+
+	if app.mergeIntoTestHarvest(data) {
 		return
 	}
 
@@ -568,6 +904,11 @@ func (app *app) Consume(id internal.AgentRunID, data internal.Harvestable) {
 	}
 }
 
+// ServerlessWrite implements internal.ServerlessWriter.
+func (app *app) ServerlessWrite(arn string, writer io.Writer) {
+	app.serverless.Write(arn, writer)
+}
+
 func (app *app) ExpectCustomEvents(t internal.Validator, want []internal.WantEvent) {
 	internal.ExpectCustomEvents(internal.ExtendValidator(t, "custom events"), app.testHarvest.CustomEvents, want)
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/newrelic/go-agent/internal"
@@ -603,3 +604,208 @@ func TestRequestURIExcluded(t *testing.T) {
 		UserAttributes:  userAttributes,
 	}})
 }
+
+func TestRedactionRules(t *testing.T) {
+	cfgfn := func(cfg *Config) {
+		cfg.Redaction.Rules = []RedactionRule{
+			{Pattern: RedactionPatternEmail},
+			{Pattern: `account-[0-9]+`, Hash: true},
+		}
+	}
+	app := testApp(nil, cfgfn, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	u, err := url.Parse("/users/bob@example.com?remove=me")
+	if nil != err {
+		t.Error(err)
+	}
+	txn.SetWebRequest(customRequest{u: u})
+	txn.AddAttribute("owner", "account-123 bob@example.com")
+	txn.NoticeError(errors.New("unknown user bob@example.com"))
+	txn.End()
+
+	if err := app.RecordCustomEvent("myType", map[string]interface{}{"email": "al@example.com", "n": 1}); nil != err {
+		t.Error(err)
+	}
+
+	redactor, _ := internal.NewRedactor([]internal.RedactionRule{{Pattern: `account-[0-9]+`, Hash: true}})
+	hashed := redactor.Redact("account-123")
+	agentAttributes := map[string]interface{}{"request.uri": "/users/[REDACTED]"}
+	userAttributes := map[string]interface{}{"owner": hashed + " [REDACTED]"}
+
+	app.ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name":             "WebTransaction/Go/hello",
+			"nr.apdexPerfZone": "F",
+		},
+		AgentAttributes: agentAttributes,
+		UserAttributes:  userAttributes,
+	}})
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":     "*errors.errorString",
+			"error.message":   "unknown user [REDACTED]",
+			"transactionName": "WebTransaction/Go/hello",
+		},
+		AgentAttributes: agentAttributes,
+		UserAttributes:  userAttributes,
+	}})
+	app.ExpectCustomEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"type":      "myType",
+			"timestamp": internal.MatchAnything,
+		},
+		UserAttributes: map[string]interface{}{"email": "[REDACTED]", "n": 1},
+	}})
+}
+
+func TestRedactionRulesHighSecurity(t *testing.T) {
+	cfgfn := func(cfg *Config) {
+		cfg.HighSecurity = true
+		cfg.Redaction.Rules = []RedactionRule{{Pattern: RedactionPatternEmail, Replacement: "[email]"}}
+	}
+	app := testApp(nil, cfgfn, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	u, err := url.Parse("/users/bob@example.com")
+	if nil != err {
+		t.Error(err)
+	}
+	txn.SetWebRequest(customRequest{u: u})
+	txn.End()
+
+	app.ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name":             "WebTransaction/Go/hello",
+			"nr.apdexPerfZone": "S",
+		},
+		AgentAttributes: map[string]interface{}{"request.uri": "/users/[email]"},
+		UserAttributes:  map[string]interface{}{},
+	}})
+}
+
+func TestRedactionPatterns(t *testing.T) {
+	redactor, err := internal.NewRedactor([]internal.RedactionRule{
+		{Pattern: RedactionPatternEmail},
+		{Pattern: RedactionPatternCardNumber},
+		{Pattern: RedactionPatternToken},
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	for input, expect := range map[string]string{
+		"contact first.last+tag@mail.example.co.uk now": "contact [REDACTED] now",
+		"card 4111 1111 1111 1111 declined":             "card [REDACTED] declined",
+		"card 4111-1111-1111-1111":                      "card [REDACTED]",
+		"order 12345 shipped":                           "order 12345 shipped",
+		"Authorization: Bearer abc.DEF-123":             "Authorization: [REDACTED]",
+		"url?api_key=s3cr3t&x=1":                        "url?[REDACTED]&x=1",
+		`{"password": "hunter2"}`:                       `{"[REDACTED]"}`,
+	} {
+		if out := redactor.Redact(input); out != expect {
+			t.Errorf("%q: %q", input, out)
+		}
+	}
+}
+
+func TestInvalidRedactionAndAttributePatterns(t *testing.T) {
+	cfg := NewConfig("my app", testLicenseKey)
+	cfg.Redaction.Rules = []RedactionRule{{Pattern: "a("}}
+	if _, err := NewApplication(cfg); nil == err {
+		t.Error("invalid redaction pattern accepted")
+	}
+	cfg = NewConfig("my app", testLicenseKey)
+	cfg.SpanEvents.Attributes.Exclude = []string{"/a(/"}
+	_, err := NewApplication(cfg)
+	if nil == err || !strings.HasPrefix(err.Error(), `SpanEvents.Attributes.Exclude: invalid pattern "/a(/"`) {
+		t.Error(err)
+	}
+}
+
+func TestAttributePatternsExclude(t *testing.T) {
+	cfgfn := func(cfg *Config) {
+		cfg.Attributes.Exclude = []string{"/^secret-[0-9]+$/", "user.*.token"}
+	}
+	app := testApp(nil, cfgfn, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	txn.AddAttribute("secret-1", 1)
+	txn.AddAttribute("secret-a", 2)
+	txn.AddAttribute("user.api.token", 3)
+	txn.End()
+
+	app.ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name": "OtherTransaction/Go/hello",
+		},
+		UserAttributes: map[string]interface{}{"secret-a": 2},
+	}})
+}
+
+func headerAttributesTransaction(app Application) {
+	req, _ := http.NewRequest("GET", "http://example.com/hello", nil)
+	req.Header.Set("X-Tenant-ID", "tenant")
+	req.Header.Set("Authorization", "Bearer secret")
+	txn := app.StartTransaction("hello", newCompatibleResponseRecorder(), req)
+	txn.Header().Set("X-Request-ID", "request")
+	txn.WriteHeader(200)
+	txn.End()
+}
+
+func TestHeaderAttributes(t *testing.T) {
+	app := testApp(nil, func(cfg *Config) {
+		cfg.HeaderAttributes.Request = []string{"X-Tenant-ID", "Authorization"}
+		cfg.HeaderAttributes.Response = []string{"X-Request-ID"}
+	}, t)
+	headerAttributesTransaction(app)
+	app.ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name":             "WebTransaction/Go/hello",
+			"nr.apdexPerfZone": "S",
+		},
+		AgentAttributes: map[string]interface{}{
+			"request.method":                "GET",
+			"request.uri":                   "http://example.com/hello",
+			"httpResponseCode":              "200",
+			"request.headers.x-tenant-id":   "tenant",
+			"response.headers.x-request-id": "request",
+		},
+	}})
+
+	// Sensitive headers are recorded if included explicitly.
+	app = testApp(nil, func(cfg *Config) {
+		cfg.HeaderAttributes.Request = []string{"Authorization"}
+		cfg.Attributes.Include = []string{"request.headers.authorization"}
+	}, t)
+	headerAttributesTransaction(app)
+	app.ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name":             "WebTransaction/Go/hello",
+			"nr.apdexPerfZone": "S",
+		},
+		AgentAttributes: map[string]interface{}{
+			"request.method":                "GET",
+			"request.uri":                   "http://example.com/hello",
+			"httpResponseCode":              "200",
+			"request.headers.authorization": "Bearer secret",
+		},
+	}})
+}
+
+func TestHeaderAttributesHighSecurity(t *testing.T) {
+	app := testApp(nil, func(cfg *Config) {
+		cfg.HighSecurity = true
+		cfg.HeaderAttributes.Request = []string{"X-Tenant-ID", "Authorization"}
+		cfg.Attributes.Include = []string{"request.headers.authorization"}
+	}, t)
+	headerAttributesTransaction(app)
+	app.ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name":             "WebTransaction/Go/hello",
+			"nr.apdexPerfZone": "S",
+		},
+		AgentAttributes: map[string]interface{}{
+			"request.method":              "GET",
+			"request.uri":                 "http://example.com/hello",
+			"httpResponseCode":            "200",
+			"request.headers.x-tenant-id": "tenant",
+		},
+	}})
+}
@@ -0,0 +1,163 @@
+package newrelic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/internal"
+)
+
+func TestStartBackgroundTransaction(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := StartBackgroundTransaction(app, "Job", "sendEmails")
+	txn.End()
+	app.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "OtherTransaction/Job/sendEmails", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransaction/all", Scope: "", Forced: true, Data: nil},
+	})
+	app.ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name": "OtherTransaction/Job/sendEmails",
+		},
+	}})
+}
+
+// wrappedApp hides the BackgroundTransactionStarter implementation of the
+// Application it wraps.
+type wrappedApp struct{ Application }
+
+func TestStartBackgroundTransactionWrappedApp(t *testing.T) {
+	app := testApp(nil, nil, t)
+	if _, ok := interface{}(wrappedApp{app}).(BackgroundTransactionStarter); ok {
+		t.Fatal("wrapped app implements BackgroundTransactionStarter")
+	}
+	txn := StartBackgroundTransaction(wrappedApp{app}, "Job", "sendEmails")
+	txn.End()
+	txn = StartMessageTransaction(wrappedApp{app}, MessageConsumer{
+		Library:         "RabbitMQ",
+		DestinationType: MessageQueue,
+		DestinationName: "UsersQueue",
+	}, nil)
+	txn.End()
+	app.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "OtherTransaction/Job/sendEmails", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransaction/Message/RabbitMQ/Queue/Named/UsersQueue", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransaction/all", Scope: "", Forced: true, Data: nil},
+	})
+}
+
+func TestStartTransactionBackgroundName(t *testing.T) {
+	app := testApp(nil, nil, t)
+	app.StartTransaction("OtherTransaction/Job/sendEmails", nil, nil).End()
+	app.StartTransaction("OtherTransaction/", nil, nil).End()
+	app.ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{"name": "OtherTransaction/Job/sendEmails"},
+	}, {
+		Intrinsics: map[string]interface{}{"name": "OtherTransaction/Go/OtherTransaction/"},
+	}})
+}
+
+func TestStartBackgroundTransactionEmptyCategory(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := StartBackgroundTransaction(app, "", "hello")
+	txn.End()
+	app.ExpectMetrics(t, backgroundMetrics)
+}
+
+func TestStartBackgroundTransactionTrimsCategory(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := StartBackgroundTransaction(app, "/Task/", "hello")
+	txn.End()
+	app.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "OtherTransaction/Task/hello", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransaction/all", Scope: "", Forced: true, Data: nil},
+	})
+}
+
+func TestStartBackgroundTransactionSetWebRequest(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := StartBackgroundTransaction(app, "Job", "hello")
+	if err := txn.SetWebRequest(NewWebRequest(helloRequest)); nil != err {
+		t.Error(err)
+	}
+	txn.End()
+	app.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "OtherTransaction/Job/hello", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransaction/all", Scope: "", Forced: true, Data: nil},
+	})
+	app.ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name": "OtherTransaction/Job/hello",
+		},
+		AgentAttributes: map[string]interface{}{
+			"request.uri":                   "/hello",
+			"request.headers.host":          "my_domain.com",
+			"request.headers.contentLength": 753,
+			"request.method":                "GET",
+			"request.headers.accept":        "text/plain",
+			"request.headers.contentType":   "text/html; charset=utf-8",
+		},
+	}})
+}
+
+func TestStartBackgroundTransactionSetName(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := StartBackgroundTransaction(app, "Job", "hello")
+	txn.SetName("goodbye")
+	txn.End()
+	app.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "OtherTransaction/Job/goodbye", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransaction/all", Scope: "", Forced: true, Data: nil},
+	})
+}
+
+func TestStartBackgroundTransactionNoticeError(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := StartBackgroundTransaction(app, "Job", "hello")
+	txn.NoticeError(myError{})
+	txn.End()
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":     "newrelic.myError",
+			"error.message":   "my msg",
+			"transactionName": "OtherTransaction/Job/hello",
+		},
+	}})
+}
+
+func TestBackgroundThreshold(t *testing.T) {
+	cfgfn := func(cfg *Config) {
+		cfg.TransactionTracer.Threshold.IsApdexFailing = false
+		cfg.TransactionTracer.Threshold.Duration = 1 * time.Hour
+		cfg.TransactionTracer.BackgroundThreshold = 1 * time.Nanosecond
+		cfg.TransactionTracer.SegmentThreshold = 0
+	}
+	app := testApp(nil, cfgfn, t)
+	txn := app.StartTransaction("hello", nil, helloRequest)
+	txn.End()
+	txn = StartBackgroundTransaction(app, "Job", "hello")
+	time.Sleep(time.Millisecond)
+	txn.End()
+	app.ExpectTxnTraces(t, []internal.WantTxnTrace{{
+		MetricName:  "OtherTransaction/Job/hello",
+		NumSegments: 0,
+	}})
+}
+
+func TestBackgroundThresholdNotExceeded(t *testing.T) {
+	cfgfn := func(cfg *Config) {
+		cfg.TransactionTracer.Threshold.IsApdexFailing = false
+		cfg.TransactionTracer.Threshold.Duration = 0
+		cfg.TransactionTracer.BackgroundThreshold = 1 * time.Hour
+		cfg.TransactionTracer.SegmentThreshold = 0
+	}
+	app := testApp(nil, cfgfn, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	txn.End()
+	txn = app.StartTransaction("hello", nil, helloRequest)
+	txn.End()
+	app.ExpectTxnTraces(t, []internal.WantTxnTrace{{
+		MetricName:  "WebTransaction/Go/hello",
+		NumSegments: 0,
+	}})
+}
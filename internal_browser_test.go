@@ -1,7 +1,12 @@
 package newrelic
 
 import (
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/newrelic/go-agent/internal"
@@ -174,3 +179,204 @@ func BenchmarkBrowserTimingHeaderSuccess(b *testing.B) {
 		hdr.WithTags()
 	}
 }
+
+func autoInstrumentConfig(cfg *Config) {
+	cfg.BrowserMonitoring.AutoInstrument = true
+}
+
+// splitInjectedHeader removes the browser timing header from the body and
+// returns the surrounding content.
+func splitInjectedHeader(t *testing.T, body string) (before, after string) {
+	start := strings.Index(body, string(browserStartTag)+"loader")
+	if start < 0 {
+		t.Fatal("browser timing header not found", body)
+	}
+	end := strings.Index(body[start:], string(browserEndTag))
+	if end < 0 {
+		t.Fatal("browser timing header end not found", body)
+	}
+	return body[:start], body[start+end+len(browserEndTag):]
+}
+
+func TestBrowserAutoInstrumentMetaCharset(t *testing.T) {
+	app := testApp(browserReplyFields, autoInstrumentConfig, t)
+	w := httptest.NewRecorder()
+	txn := app.StartTransaction("hello", w, nil)
+	page := `<!DOCTYPE html><html><HEAD><title>hi</title><meta charset="utf-8"><link rel="stylesheet" href="a.css"></head><body>hello</body></html>`
+	txn.Header().Set("Content-Type", "text/html; charset=utf-8")
+	txn.Header().Set("Content-Length", strconv.Itoa(len(page)))
+	txn.WriteHeader(http.StatusCreated)
+	txn.Write([]byte(page[:10]))
+	if 0 != w.Body.Len() {
+		t.Error("response not buffered", w.Body.String())
+	}
+	txn.Write([]byte(page[10:]))
+	txn.End()
+
+	if w.Code != http.StatusCreated {
+		t.Error(w.Code)
+	}
+	body := w.Body.String()
+	before, after := splitInjectedHeader(t, body)
+	if before != `<!DOCTYPE html><html><HEAD><title>hi</title><meta charset="utf-8">` ||
+		after != `<link rel="stylesheet" href="a.css"></head><body>hello</body></html>` {
+		t.Error(body)
+	}
+	if cl := w.Header().Get("Content-Length"); cl != strconv.Itoa(len(body)) {
+		t.Error(cl, len(body))
+	}
+	app.ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name": "OtherTransaction/Go/hello",
+		},
+		AgentAttributes: map[string]interface{}{
+			"httpResponseCode":               "201",
+			"response.headers.contentType":   "text/html; charset=utf-8",
+			"response.headers.contentLength": len(body),
+		},
+	}})
+}
+
+func TestBrowserAutoInstrumentHeadTag(t *testing.T) {
+	app := testApp(browserReplyFields, autoInstrumentConfig, t)
+	w := httptest.NewRecorder()
+	txn := app.StartTransaction("hello", w, nil)
+	// The Content-Type is detected from the body.
+	txn.Write([]byte(`<html><head data-x="1"><header>`))
+	txn.Write([]byte(`</header><title>hi</title></head><body>hello</body></html>`))
+	if 0 == w.Body.Len() {
+		t.Error("response not written after the head")
+	}
+	txn.End()
+
+	before, after := splitInjectedHeader(t, w.Body.String())
+	if before != `<html><head data-x="1">` ||
+		after != `<header></header><title>hi</title></head><body>hello</body></html>` {
+		t.Error(w.Body.String())
+	}
+}
+
+func TestBrowserAutoInstrumentAtEnd(t *testing.T) {
+	app := testApp(browserReplyFields, autoInstrumentConfig, t)
+	w := httptest.NewRecorder()
+	txn := app.StartTransaction("hello", w, nil)
+	txn.Header().Set("Content-Type", "text/html")
+	txn.Write([]byte(`<html><head><title>hi`))
+	if 0 != w.Body.Len() {
+		t.Error("response not buffered", w.Body.String())
+	}
+	txn.End()
+
+	before, after := splitInjectedHeader(t, w.Body.String())
+	if before != `<html><head>` || after != `<title>hi` {
+		t.Error(w.Body.String())
+	}
+}
+
+func TestBrowserAutoInstrumentSkipped(t *testing.T) {
+	page := `<html><head><title>hi</title></head><body>hello</body></html>`
+	testcases := []struct {
+		name   string
+		cfgFn  func(*Config)
+		header map[string]string
+		body   string
+		flush  bool
+	}{
+		{name: "disabled", body: page},
+		{name: "json", cfgFn: autoInstrumentConfig, header: map[string]string{"Content-Type": "application/json"}, body: page},
+		{name: "sniffed text", cfgFn: autoInstrumentConfig, body: "just some text <head>"},
+		{name: "compressed", cfgFn: autoInstrumentConfig, header: map[string]string{"Content-Type": "text/html", "Content-Encoding": "gzip"}, body: page},
+		{name: "streamed", cfgFn: autoInstrumentConfig, header: map[string]string{"Content-Type": "text/html"}, body: `<html><head><title>`, flush: true},
+		{name: "already injected", cfgFn: autoInstrumentConfig, body: `<html><head><script>window.NREUM||(NREUM={})</script></head></html>`},
+		{name: "no head", cfgFn: autoInstrumentConfig, header: map[string]string{"Content-Type": "text/html"}, body: `<html><body>hello</body></html>`},
+	}
+	for _, tc := range testcases {
+		app := testApp(browserReplyFields, tc.cfgFn, t)
+		w := httptest.NewRecorder()
+		txn := app.StartTransaction("hello", w, nil)
+		for key, val := range tc.header {
+			txn.Header().Set(key, val)
+		}
+		txn.Write([]byte(tc.body))
+		if tc.flush {
+			txn.(http.Flusher).Flush()
+			if !w.Flushed || w.Body.String() != tc.body {
+				t.Error(tc.name, "response not flushed", w.Body.String())
+			}
+			txn.Write([]byte(`hi</title></head>`))
+			tc.body += `hi</title></head>`
+		}
+		txn.End()
+		if w.Body.String() != tc.body {
+			t.Error(tc.name, w.Body.String())
+		}
+	}
+}
+
+func TestBrowserAutoInstrumentNoBody(t *testing.T) {
+	app := testApp(browserReplyFields, autoInstrumentConfig, t)
+	w := httptest.NewRecorder()
+	txn := app.StartTransaction("hello", w, nil)
+	txn.WriteHeader(http.StatusNotModified)
+	if w.Code != http.StatusNotModified {
+		t.Error("status code not written", w.Code)
+	}
+	txn.End()
+}
+
+// rwReaderFrom records whether ReadFrom is called.
+type rwReaderFrom struct {
+	*httptest.ResponseRecorder
+	readFromCalled bool
+}
+
+func (rw *rwReaderFrom) ReadFrom(r io.Reader) (int64, error) {
+	rw.readFromCalled = true
+	return io.Copy(rw.ResponseRecorder, r)
+}
+
+func TestBrowserAutoInstrumentReadFrom(t *testing.T) {
+	app := testApp(browserReplyFields, autoInstrumentConfig, t)
+	rw := &rwReaderFrom{ResponseRecorder: httptest.NewRecorder()}
+	txn := app.StartTransaction("hello", rw, nil)
+	txn.Header().Set("Content-Type", "text/html")
+	txn.(io.ReaderFrom).ReadFrom(strings.NewReader(`<html><head></head><body>`))
+	// The buffered response has been written, so later calls use the
+	// ResponseWriter's ReadFrom method.
+	txn.(io.ReaderFrom).ReadFrom(strings.NewReader(`</body></html>`))
+	txn.End()
+
+	if !rw.readFromCalled {
+		t.Error("ReadFrom not called after injection")
+	}
+	before, after := splitInjectedHeader(t, rw.Body.String())
+	if before != `<html><head>` || after != `</head><body></body></html>` {
+		t.Error(rw.Body.String())
+	}
+}
+
+func TestBrowserInsertionPoint(t *testing.T) {
+	testcases := []struct {
+		html   string
+		expect string
+	}{
+		{html: `<head></head>`, expect: `<head>`},
+		{html: `<HEAD lang="en">`, expect: `<HEAD lang="en">`},
+		{html: `<header></header>`, expect: ``},
+		{html: `<head><meta charset="utf-8"><meta name="x"></head>`, expect: `<head><meta charset="utf-8">`},
+		{html: `<head><META CHARSET=utf-8 /></head>`, expect: `<head><META CHARSET=utf-8 />`},
+		{html: `<head></head><body><meta charset="utf-8">`, expect: `<head>`},
+		{html: `<html><body></body></html>`, expect: ``},
+		{html: `<head><script>NREUM</script>`, expect: ``},
+	}
+	for _, tc := range testcases {
+		idx := browserInsertionPoint([]byte(tc.html))
+		if "" == tc.expect {
+			if -1 != idx {
+				t.Error(tc.html, idx)
+			}
+		} else if idx < 0 || tc.html[:idx] != tc.expect {
+			t.Error(tc.html, idx)
+		}
+	}
+}
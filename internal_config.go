@@ -38,15 +38,127 @@ func copyConfigReferenceFields(cfg Config) Config {
 		copy(ignored, cfg.ErrorCollector.IgnoreStatusCodes)
 		cp.ErrorCollector.IgnoreStatusCodes = ignored
 	}
+	if nil != cfg.ErrorCollector.ExpectStatusCodes {
+		expected := make([]int, len(cfg.ErrorCollector.ExpectStatusCodes))
+		copy(expected, cfg.ErrorCollector.ExpectStatusCodes)
+		cp.ErrorCollector.ExpectStatusCodes = expected
+	}
+	if nil != cfg.ErrorCollector.ExpectClasses {
+		expected := make([]string, len(cfg.ErrorCollector.ExpectClasses))
+		copy(expected, cfg.ErrorCollector.ExpectClasses)
+		cp.ErrorCollector.ExpectClasses = expected
+	}
+	if nil != cfg.ErrorCollector.ExpectMessages {
+		cp.ErrorCollector.ExpectMessages = make(map[string][]string, len(cfg.ErrorCollector.ExpectMessages))
+		for class, msgs := range cfg.ErrorCollector.ExpectMessages {
+			expected := make([]string, len(msgs))
+			copy(expected, msgs)
+			cp.ErrorCollector.ExpectMessages[class] = expected
+		}
+	}
+	if nil != cfg.HeaderAttributes.Request {
+		headers := make([]string, len(cfg.HeaderAttributes.Request))
+		copy(headers, cfg.HeaderAttributes.Request)
+		cp.HeaderAttributes.Request = headers
+	}
+	if nil != cfg.HeaderAttributes.Response {
+		headers := make([]string, len(cfg.HeaderAttributes.Response))
+		copy(headers, cfg.HeaderAttributes.Response)
+		cp.HeaderAttributes.Response = headers
+	}
+	if nil != cfg.Redaction.Rules {
+		rules := make([]RedactionRule, len(cfg.Redaction.Rules))
+		copy(rules, cfg.Redaction.Rules)
+		cp.Redaction.Rules = rules
+	}
+	if nil != cfg.TransactionNaming.Rules {
+		rules := make([]TransactionNamingRule, len(cfg.TransactionNaming.Rules))
+		copy(rules, cfg.TransactionNaming.Rules)
+		cp.TransactionNaming.Rules = rules
+	}
 
 	cp.Attributes = copyDestConfig(cfg.Attributes)
 	cp.ErrorCollector.Attributes = copyDestConfig(cfg.ErrorCollector.Attributes)
 	cp.TransactionEvents.Attributes = copyDestConfig(cfg.TransactionEvents.Attributes)
 	cp.TransactionTracer.Attributes = copyDestConfig(cfg.TransactionTracer.Attributes)
+	cp.SpanEvents.Attributes = copyDestConfig(cfg.SpanEvents.Attributes)
 
 	return cp
 }
 
+func (c Config) localTxnNameRules() []internal.LocalRule {
+	rules := make([]internal.LocalRule, len(c.TransactionNaming.Rules))
+	for i, r := range c.TransactionNaming.Rules {
+		rules[i] = internal.LocalRule{
+			MatchExpression: r.MatchExpression,
+			Replacement:     r.Replacement,
+			Ignore:          r.Ignore,
+			EachSegment:     r.EachSegment,
+			ReplaceAll:      r.ReplaceAll,
+			TerminateChain:  r.TerminateChain,
+			EvalOrder:       r.EvalOrder,
+		}
+	}
+	return rules
+}
+
+// headerAttributes returns the configured header names, omitting sensitive
+// headers in high security mode.
+func (c Config) headerAttributes(names []string) []string {
+	if !c.HighSecurity {
+		return names
+	}
+	var allowed []string
+	for _, name := range names {
+		if !internal.IsSensitiveHeader(name) {
+			allowed = append(allowed, name)
+		}
+	}
+	return allowed
+}
+
+func (c Config) redactionRules() []internal.RedactionRule {
+	rules := make([]internal.RedactionRule, len(c.Redaction.Rules))
+	for i, r := range c.Redaction.Rules {
+		rules[i] = internal.RedactionRule{
+			Pattern:     r.Pattern,
+			Replacement: r.Replacement,
+			Hash:        r.Hash,
+		}
+	}
+	return rules
+}
+
+// validateAttributePatterns checks the regular expressions of the attribute
+// include and exclude settings.
+func (c Config) validateAttributePatterns() error {
+	fields := []struct {
+		path    string
+		matches []string
+	}{
+		{"Attributes.Include", c.Attributes.Include},
+		{"Attributes.Exclude", c.Attributes.Exclude},
+		{"ErrorCollector.Attributes.Include", c.ErrorCollector.Attributes.Include},
+		{"ErrorCollector.Attributes.Exclude", c.ErrorCollector.Attributes.Exclude},
+		{"TransactionEvents.Attributes.Include", c.TransactionEvents.Attributes.Include},
+		{"TransactionEvents.Attributes.Exclude", c.TransactionEvents.Attributes.Exclude},
+		{"TransactionTracer.Attributes.Include", c.TransactionTracer.Attributes.Include},
+		{"TransactionTracer.Attributes.Exclude", c.TransactionTracer.Attributes.Exclude},
+		{"BrowserMonitoring.Attributes.Include", c.BrowserMonitoring.Attributes.Include},
+		{"BrowserMonitoring.Attributes.Exclude", c.BrowserMonitoring.Attributes.Exclude},
+		{"SpanEvents.Attributes.Include", c.SpanEvents.Attributes.Include},
+		{"SpanEvents.Attributes.Exclude", c.SpanEvents.Attributes.Exclude},
+	}
+	for _, f := range fields {
+		for _, match := range f.matches {
+			if err := internal.ValidateAttributePattern(match); nil != err {
+				return c.validationSource(fmt.Errorf("%s: invalid pattern %q: %v", f.path, match, err), f.path)
+			}
+		}
+	}
+	return nil
+}
+
 const (
 	agentLanguage = "go"
 )
@@ -81,6 +193,10 @@ func (s settings) MarshalJSON() ([]byte, error) {
 	c.Transport = nil
 	logger := c.Logger
 	c.Logger = nil
+	sink := c.HarvestSink
+	c.HarvestSink = nil
+	observer := c.InfiniteTracing.TraceObserver
+	c.InfiniteTracing.TraceObserver = nil
 
 	js, err := json.Marshal(c)
 	if nil != err {
@@ -96,6 +212,20 @@ func (s settings) MarshalJSON() ([]byte, error) {
 	delete(fields, `License`)
 	fields[`Transport`] = transportSetting(transport)
 	fields[`Logger`] = loggerSetting(logger)
+	if nil != sink {
+		fields[`HarvestSink`] = fmt.Sprintf("%T", sink)
+	}
+	if ec, ok := fields[`ErrorCollector`].(map[string]interface{}); ok {
+		ec[`ErrorGroupCallback`] = nil
+		if nil != c.ErrorCollector.ErrorGroupCallback {
+			ec[`ErrorGroupCallback`] = fmt.Sprintf("%T", c.ErrorCollector.ErrorGroupCallback)
+		}
+	}
+	if nil != observer {
+		if it, ok := fields[`InfiniteTracing`].(map[string]interface{}); ok {
+			it[`TraceObserver`] = fmt.Sprintf("%T", observer)
+		}
+	}
 
 	// Browser monitoring support.
 	if c.BrowserMonitoring.Enabled {
@@ -107,20 +237,21 @@ func (s settings) MarshalJSON() ([]byte, error) {
 
 func configConnectJSONInternal(c Config, pid int, util *utilization.Data, e internal.Environment, version string, securityPolicies *internal.SecurityPolicies, metadata map[string]string) ([]byte, error) {
 	return json.Marshal([]interface{}{struct {
-		Pid              int                        `json:"pid"`
-		Language         string                     `json:"language"`
-		Version          string                     `json:"agent_version"`
-		Host             string                     `json:"host"`
-		HostDisplayName  string                     `json:"display_host,omitempty"`
-		Settings         interface{}                `json:"settings"`
-		AppName          []string                   `json:"app_name"`
-		HighSecurity     bool                       `json:"high_security"`
-		Labels           internal.Labels            `json:"labels,omitempty"`
-		Environment      internal.Environment       `json:"environment"`
-		Identifier       string                     `json:"identifier"`
-		Util             *utilization.Data          `json:"utilization"`
-		SecurityPolicies *internal.SecurityPolicies `json:"security_policies,omitempty"`
-		Metadata         map[string]string          `json:"metadata"`
+		Pid              int                         `json:"pid"`
+		Language         string                      `json:"language"`
+		Version          string                      `json:"agent_version"`
+		Host             string                      `json:"host"`
+		HostDisplayName  string                      `json:"display_host,omitempty"`
+		Settings         interface{}                 `json:"settings"`
+		AppName          []string                    `json:"app_name"`
+		HighSecurity     bool                        `json:"high_security"`
+		Labels           internal.Labels             `json:"labels,omitempty"`
+		Environment      internal.Environment        `json:"environment"`
+		Identifier       string                      `json:"identifier"`
+		Util             *utilization.Data           `json:"utilization"`
+		SecurityPolicies *internal.SecurityPolicies  `json:"security_policies,omitempty"`
+		Metadata         map[string]string           `json:"metadata"`
+		EventData        internal.EventHarvestConfig `json:"event_harvest_config"`
 	}{
 		Pid:             pid,
 		Language:        agentLanguage,
@@ -147,9 +278,35 @@ func configConnectJSONInternal(c Config, pid int, util *utilization.Data, e inte
 		Util:             util,
 		SecurityPolicies: securityPolicies,
 		Metadata:         metadata,
+		EventData:        c.harvestConfig().EventHarvestConfig(),
 	}})
 }
 
+// eventLimit returns the reservoir size configured using MaxSamplesStored.
+// Zero and negative values use the default, and values above the limit are
+// lowered to the limit.
+func eventLimit(configured, defaultMax, limit int) int {
+	if configured <= 0 {
+		return defaultMax
+	}
+	if configured > limit {
+		return limit
+	}
+	return configured
+}
+
+// harvestConfig returns the locally configured event harvest period and
+// reservoir sizes.  The connect reply may override these values.
+func (c Config) harvestConfig() internal.HarvestConfig {
+	return internal.HarvestConfig{
+		EventPeriod:     internal.HarvestPeriod,
+		MaxTxnEvents:    eventLimit(c.TransactionEvents.MaxSamplesStored, internal.MaxTxnEvents, maxTxnEventsLimit),
+		MaxCustomEvents: eventLimit(c.CustomInsightsEvents.MaxSamplesStored, internal.MaxCustomEvents, maxCustomEventsLimit),
+		MaxErrorEvents:  internal.MaxErrorEvents,
+		MaxSpanEvents:   eventLimit(c.SpanEvents.MaxSamplesStored, internal.MaxSpanEvents, maxSpanEventsLimit),
+	}
+}
+
 const (
 	// https://source.datanerd.us/agents/agent-specs/blob/master/Connect-LEGACY.md#metadata-hash
 	metadataPrefix = "NEW_RELIC_METADATA_"
@@ -0,0 +1,222 @@
+package newrelic
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testGetenv(env map[string]string) func(string) string {
+	return func(key string) string { return env[key] }
+}
+
+func writeConfigFile(t *testing.T, contents string) (string, func()) {
+	dir, err := ioutil.TempDir("", "config")
+	if nil != err {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "newrelic.json")
+	if err := ioutil.WriteFile(filename, []byte(contents), 0644); nil != err {
+		t.Fatal(err)
+	}
+	return filename, func() { os.RemoveAll(dir) }
+}
+
+func TestConfigEnvName(t *testing.T) {
+	for path, expect := range map[string]string{
+		"AppName":                             "NEW_RELIC_APP_NAME",
+		"License":                             "NEW_RELIC_LICENSE_KEY",
+		"DatastoreTracer.SlowQuery.Threshold": "NEW_RELIC_DATASTORE_TRACER_SLOW_QUERY_THRESHOLD",
+		"Utilization.DetectAWS":               "NEW_RELIC_UTILIZATION_DETECT_AWS",
+		"ThreadProfiler.CPUProfileDir":        "NEW_RELIC_THREAD_PROFILER_CPU_PROFILE_DIR",
+		"ServerlessMode.PrimaryAppID":         "NEW_RELIC_SERVERLESS_MODE_PRIMARY_APP_ID",
+		"Attributes.Include":                  "NEW_RELIC_ATTRIBUTES_INCLUDE",
+	} {
+		if name := configEnvName(path); name != expect {
+			t.Error(path, name)
+		}
+	}
+}
+
+func TestConfigFromEnvironment(t *testing.T) {
+	cfg := NewConfig("my app", "")
+	err := configFromEnvironment(&cfg, testGetenv(map[string]string{
+		"NEW_RELIC_APP_NAME":                              "env app",
+		"NEW_RELIC_LICENSE_KEY":                           "0123456789012345678901234567890123456789",
+		"NEW_RELIC_HIGH_SECURITY":                         "true",
+		"NEW_RELIC_LABELS":                                "env:prod; team:web",
+		"NEW_RELIC_DATASTORE_TRACER_SLOW_QUERY_THRESHOLD": "50ms",
+		"NEW_RELIC_DATASTORE_TRACER_RECORD_SQL":           "raw",
+		"NEW_RELIC_ATTRIBUTES_EXCLUDE":                    "request.headers.*, response.*",
+		"NEW_RELIC_ERROR_COLLECTOR_IGNORE_STATUS_CODES":   "404,500",
+		"NEW_RELIC_ERROR_COLLECTOR_EXPECT_MESSAGES":       "a:b,c;d:e",
+		"NEW_RELIC_SPAN_EVENTS_MAX_SAMPLES_STORED":        "2000",
+		"NEW_RELIC_SPOOL_MAX_BYTES":                       "1024",
+		"NEW_RELIC_LOG":                                   "stdout",
+		"NEW_RELIC_LOG_LEVEL":                             "debug",
+	}))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if cfg.AppName != "env app" ||
+		cfg.License != "0123456789012345678901234567890123456789" ||
+		!cfg.HighSecurity ||
+		cfg.DatastoreTracer.SlowQuery.Threshold != 50*time.Millisecond ||
+		cfg.DatastoreTracer.RecordSQL != RecordSQLRaw ||
+		cfg.SpanEvents.MaxSamplesStored != 2000 ||
+		cfg.Spool.MaxBytes != 1024 {
+		t.Error(cfg)
+	}
+	if !reflect.DeepEqual(cfg.Labels, map[string]string{"env": "prod", "team": "web"}) {
+		t.Error(cfg.Labels)
+	}
+	if !reflect.DeepEqual(cfg.Attributes.Exclude, []string{"request.headers.*", "response.*"}) {
+		t.Error(cfg.Attributes.Exclude)
+	}
+	if !reflect.DeepEqual(cfg.ErrorCollector.IgnoreStatusCodes, []int{404, 500}) {
+		t.Error(cfg.ErrorCollector.IgnoreStatusCodes)
+	}
+	if !reflect.DeepEqual(cfg.ErrorCollector.ExpectMessages, map[string][]string{"a": {"b", "c"}, "d": {"e"}}) {
+		t.Error(cfg.ErrorCollector.ExpectMessages)
+	}
+	if nil == cfg.Logger || !cfg.Logger.DebugEnabled() {
+		t.Error(cfg.Logger)
+	}
+	// Fields without environment variables keep their values.
+	if !cfg.ErrorCollector.Enabled || cfg.TransactionTracer.SegmentThreshold != 2*time.Millisecond {
+		t.Error(cfg)
+	}
+}
+
+func TestConfigFromEnvironmentInvalid(t *testing.T) {
+	for env, expect := range map[string]string{
+		"NEW_RELIC_HIGH_SECURITY":                         `environment variable NEW_RELIC_HIGH_SECURITY: strconv.ParseBool: parsing "yes please": invalid syntax`,
+		"NEW_RELIC_DATASTORE_TRACER_SLOW_QUERY_THRESHOLD": `environment variable NEW_RELIC_DATASTORE_TRACER_SLOW_QUERY_THRESHOLD: time: invalid duration "yes please"`,
+		"NEW_RELIC_LABELS":                                `environment variable NEW_RELIC_LABELS: invalid key:value pair`,
+		"NEW_RELIC_LOG":                                   `environment variable NEW_RELIC_LOG: invalid value "yes please", must be stdout or stderr`,
+	} {
+		cfg := NewConfig("my app", "")
+		err := configFromEnvironment(&cfg, testGetenv(map[string]string{env: "yes please"}))
+		if nil == err || !strings.HasPrefix(err.Error(), expect) {
+			t.Error(env, err)
+		}
+	}
+}
+
+func TestConfigFromFile(t *testing.T) {
+	filename, cleanup := writeConfigFile(t, `{
+		"AppName": "file app",
+		"enabled": false,
+		"Labels": {"env": "staging"},
+		"DatastoreTracer": {
+			"SlowQuery": {"Threshold": "50ms"},
+			"RecordSQL": "off"
+		},
+		"TransactionTracer": {"SegmentThreshold": 1000000},
+		"Attributes": {"Exclude": ["request.headers.*"]},
+		"ErrorCollector": {"IgnoreStatusCodes": "404,500"},
+		"TransactionNaming": {"Rules": [{"MatchExpression": "/health$", "Ignore": true}]}
+	}`)
+	defer cleanup()
+
+	cfg := NewConfig("my app", "")
+	if err := ConfigFromFile(&cfg, filename); nil != err {
+		t.Fatal(err)
+	}
+	if cfg.AppName != "file app" ||
+		cfg.Enabled ||
+		cfg.DatastoreTracer.SlowQuery.Threshold != 50*time.Millisecond ||
+		cfg.DatastoreTracer.RecordSQL != RecordSQLOff ||
+		cfg.TransactionTracer.SegmentThreshold != time.Millisecond ||
+		!cfg.DatastoreTracer.SlowQuery.Enabled {
+		t.Error(cfg)
+	}
+	if !reflect.DeepEqual(cfg.Labels, map[string]string{"env": "staging"}) {
+		t.Error(cfg.Labels)
+	}
+	if !reflect.DeepEqual(cfg.Attributes.Exclude, []string{"request.headers.*"}) {
+		t.Error(cfg.Attributes.Exclude)
+	}
+	if !reflect.DeepEqual(cfg.ErrorCollector.IgnoreStatusCodes, []int{404, 500}) {
+		t.Error(cfg.ErrorCollector.IgnoreStatusCodes)
+	}
+	if !reflect.DeepEqual(cfg.TransactionNaming.Rules, []TransactionNamingRule{{MatchExpression: "/health$", Ignore: true}}) {
+		t.Error(cfg.TransactionNaming.Rules)
+	}
+}
+
+func TestConfigFromFileInvalid(t *testing.T) {
+	for contents, expect := range map[string]string{
+		`{"AppNam": "app"}`:                            `unknown setting AppNam`,
+		`{"DatastoreTracer": {"SlowQuery": {"x": 1}}}`: `unknown setting DatastoreTracer.SlowQuery.x`,
+		`{"Transport": null}`:                          `Transport cannot be set from a config file`,
+		`{"HighSecurity": 5}`:                          `HighSecurity: json: cannot unmarshal number`,
+		`{"DatastoreTracer": []}`:                      `DatastoreTracer: json: cannot unmarshal array`,
+	} {
+		filename, cleanup := writeConfigFile(t, contents)
+		cfg := NewConfig("my app", "")
+		err := ConfigFromFile(&cfg, filename)
+		if nil == err || !strings.HasPrefix(err.Error(), "config file "+filename+": "+expect) {
+			t.Error(contents, err)
+		}
+		cleanup()
+	}
+	cfg := NewConfig("my app", "")
+	if err := ConfigFromFile(&cfg, "does/not/exist.json"); nil == err {
+		t.Error("missing file loaded")
+	}
+}
+
+func TestNewConfigFromEnvironmentPrecedence(t *testing.T) {
+	filename, cleanup := writeConfigFile(t, `{
+		"AppName": "file app",
+		"HighSecurity": true
+	}`)
+	defer cleanup()
+
+	cfg, err := newConfigFromEnvironment(testGetenv(map[string]string{
+		"NEW_RELIC_CONFIG_FILE": filename,
+		"NEW_RELIC_APP_NAME":    "env app",
+	}))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if cfg.AppName != "env app" || !cfg.HighSecurity || !cfg.ErrorCollector.Enabled {
+		t.Error(cfg)
+	}
+}
+
+func TestValidateReportsSource(t *testing.T) {
+	cfg := NewConfig("my app", "")
+	err := configFromEnvironment(&cfg, testGetenv(map[string]string{
+		"NEW_RELIC_LICENSE_KEY": "too short",
+	}))
+	if nil != err {
+		t.Fatal(err)
+	}
+	err = cfg.Validate()
+	if nil == err || err.Error() != "environment variable NEW_RELIC_LICENSE_KEY: "+errLicenseLen.Error() {
+		t.Error(err)
+	}
+
+	// The source is not reported once the field is changed in code.
+	cfg.License = "also too short"
+	if err := cfg.Validate(); err != errLicenseLen {
+		t.Error(err)
+	}
+
+	filename, cleanup := writeConfigFile(t, `{"DatastoreTracer": {"RecordSQL": "everything"}}`)
+	defer cleanup()
+	cfg = NewConfig("my app", "0123456789012345678901234567890123456789")
+	if err := ConfigFromFile(&cfg, filename); nil != err {
+		t.Fatal(err)
+	}
+	err = cfg.Validate()
+	if nil == err || err.Error() != "config file "+filename+": "+errRecordSQLMode.Error() {
+		t.Error(err)
+	}
+}
@@ -35,6 +35,10 @@ func TestCopyConfigReferenceFieldsPresent(t *testing.T) {
 	cfg := NewConfig("my appname", "0123456789012345678901234567890123456789")
 	cfg.Labels["zip"] = "zap"
 	cfg.ErrorCollector.IgnoreStatusCodes = append(cfg.ErrorCollector.IgnoreStatusCodes, 405)
+	cfg.ErrorCollector.ExpectStatusCodes = append(cfg.ErrorCollector.ExpectStatusCodes, 409)
+	cfg.ErrorCollector.ExpectClasses = append(cfg.ErrorCollector.ExpectClasses, "*errors.errorString")
+	cfg.ErrorCollector.ExpectMessages = map[string][]string{"klass": {"msg"}}
+	cfg.ErrorCollector.ErrorGroupCallback = func(ErrorInfo) string { return "group" }
 	cfg.Attributes.Include = append(cfg.Attributes.Include, "1")
 	cfg.Attributes.Exclude = append(cfg.Attributes.Exclude, "2")
 	cfg.TransactionEvents.Attributes.Include = append(cfg.TransactionEvents.Attributes.Include, "3")
@@ -43,6 +47,9 @@ func TestCopyConfigReferenceFieldsPresent(t *testing.T) {
 	cfg.ErrorCollector.Attributes.Exclude = append(cfg.ErrorCollector.Attributes.Exclude, "6")
 	cfg.TransactionTracer.Attributes.Include = append(cfg.TransactionTracer.Attributes.Include, "7")
 	cfg.TransactionTracer.Attributes.Exclude = append(cfg.TransactionTracer.Attributes.Exclude, "8")
+	cfg.SpanEvents.Attributes.Include = append(cfg.SpanEvents.Attributes.Include, "9")
+	cfg.SpanEvents.Attributes.Exclude = append(cfg.SpanEvents.Attributes.Exclude, "10")
+	cfg.TransactionNaming.Rules = []TransactionNamingRule{{MatchExpression: "11"}}
 	cfg.Transport = &http.Transport{}
 	cfg.Logger = NewLogger(os.Stdout)
 
@@ -50,6 +57,9 @@ func TestCopyConfigReferenceFieldsPresent(t *testing.T) {
 
 	cfg.Labels["zop"] = "zup"
 	cfg.ErrorCollector.IgnoreStatusCodes[0] = 201
+	cfg.ErrorCollector.ExpectStatusCodes[0] = 202
+	cfg.ErrorCollector.ExpectClasses[0] = "zap"
+	cfg.ErrorCollector.ExpectMessages["klass"][0] = "zap"
 	cfg.Attributes.Include[0] = "zap"
 	cfg.Attributes.Exclude[0] = "zap"
 	cfg.TransactionEvents.Attributes.Include[0] = "zap"
@@ -58,6 +68,9 @@ func TestCopyConfigReferenceFieldsPresent(t *testing.T) {
 	cfg.ErrorCollector.Attributes.Exclude[0] = "zap"
 	cfg.TransactionTracer.Attributes.Include[0] = "zap"
 	cfg.TransactionTracer.Attributes.Exclude[0] = "zap"
+	cfg.SpanEvents.Attributes.Include[0] = "zap"
+	cfg.SpanEvents.Attributes.Exclude[0] = "zap"
+	cfg.TransactionNaming.Rules[0].MatchExpression = "zap"
 
 	expect := internal.CompactJSONString(`[
 	{
@@ -74,40 +87,84 @@ func TestCopyConfigReferenceFieldsPresent(t *testing.T) {
 					"Exclude":null,
 					"Include":null
 				},
+				"AutoInstrument":false,
 				"Enabled":true
 			},
 			"CrossApplicationTracer":{"Enabled":true},
-			"CustomInsightsEvents":{"Enabled":true},
+			"CustomInsightsEvents":{
+				"Enabled":true,
+				"MaxSamplesStored":10000
+			},
 			"DatastoreTracer":{
 				"DatabaseNameReporting":{"Enabled":true},
 				"InstanceReporting":{"Enabled":true},
 				"QueryParameters":{"Enabled":true},
+				"RecordSQL":"obfuscated",
 				"SlowQuery":{
 					"Enabled":true,
 					"Threshold":10000000
 				}
 			},
-			"DistributedTracer":{"Enabled":false},
+			"DistributedTracer":{"Enabled":false,"ExcludeNewRelicHeader":false},
 			"Enabled":true,
 			"ErrorCollector":{
 				"Attributes":{"Enabled":true,"Exclude":["6"],"Include":["5"]},
 				"CaptureEvents":true,
 				"Enabled":true,
+				"ErrorGroupCallback":"newrelic.ErrorGroupCallback",
+				"ExpectClasses":["*errors.errorString"],
+				"ExpectMessages":{"klass":["msg"]},
+				"ExpectStatusCodes":[409],
 				"IgnoreStatusCodes":[404,405]
 			},
+			"HTTPClientTrace":{"Enabled":false},
+			"HarvestSink":null,
+			"HeaderAttributes":{"Request":null,"Response":null},
 			"HighSecurity":false,
 			"HostDisplayName":"",
+			"InfiniteTracing":{
+				"SpanEvents":{"QueueSize":10000},
+				"TraceObserver":null
+			},
 			"Labels":{"zip":"zap"},
 			"Logger":"*logger.logFile",
+			"Redaction":{"Rules":null},
 			"RuntimeSampler":{"Enabled":true},
 			"SecurityPoliciesToken":"",
-			"SpanEvents":{"Enabled":true},
+			"ServerlessMode":{
+				"AccountID":"",
+				"ApdexThreshold":500000000,
+				"Enabled":false,
+				"PrimaryAppID":"",
+				"TrustedAccountKey":""
+			},
+			"SpanEvents":{
+				"Attributes":{"Enabled":true,"Exclude":["10"],"Include":["9"]},
+				"Enabled":true,
+				"MaxSamplesStored":1000
+			},
+			"Spool":{"Directory":"","MaxAge":14400000000000,"MaxBytes":16777216},
+			"ThreadProfiler":{"CPUProfileDir":"","Enabled":false},
 			"TransactionEvents":{
 				"Attributes":{"Enabled":true,"Exclude":["4"],"Include":["3"]},
-				"Enabled":true
+				"Enabled":true,
+				"MaxSamplesStored":10000
+			},
+			"TransactionNaming":{
+				"MaxNamesPerPrefix":0,
+				"Rules":[{
+					"EachSegment":false,
+					"EvalOrder":0,
+					"Ignore":false,
+					"MatchExpression":"11",
+					"ReplaceAll":false,
+					"Replacement":"",
+					"TerminateChain":false
+				}]
 			},
 			"TransactionTracer":{
 				"Attributes":{"Enabled":true,"Exclude":["8"],"Include":["7"]},
+				"BackgroundThreshold":0,
 				"Enabled":true,
 				"SegmentThreshold":2000000,
 				"StackTraceThreshold":500000000,
@@ -156,6 +213,15 @@ func TestCopyConfigReferenceFieldsPresent(t *testing.T) {
 		},
 		"metadata":{
 			"NEW_RELIC_METADATA_ZAP":"zip"
+		},
+		"event_harvest_config":{
+			"report_period_ms":60000,
+			"harvest_limits":{
+				"analytic_event_data":10000,
+				"custom_event_data":10000,
+				"error_event_data":100,
+				"span_event_data":1000
+			}
 		}
 	}]`)
 
@@ -210,40 +276,73 @@ func TestCopyConfigReferenceFieldsAbsent(t *testing.T) {
 					"Exclude":null,
 					"Include":null
 				},
+				"AutoInstrument":false,
 				"Enabled":true
 			},
 			"CrossApplicationTracer":{"Enabled":true},
-			"CustomInsightsEvents":{"Enabled":true},
+			"CustomInsightsEvents":{
+				"Enabled":true,
+				"MaxSamplesStored":10000
+			},
 			"DatastoreTracer":{
 				"DatabaseNameReporting":{"Enabled":true},
 				"InstanceReporting":{"Enabled":true},
 				"QueryParameters":{"Enabled":true},
+				"RecordSQL":"obfuscated",
 				"SlowQuery":{
 					"Enabled":true,
 					"Threshold":10000000
 				}
 			},
-			"DistributedTracer":{"Enabled":false},
+			"DistributedTracer":{"Enabled":false,"ExcludeNewRelicHeader":false},
 			"Enabled":true,
 			"ErrorCollector":{
 				"Attributes":{"Enabled":true,"Exclude":null,"Include":null},
 				"CaptureEvents":true,
 				"Enabled":true,
+				"ErrorGroupCallback":null,
+				"ExpectClasses":null,
+				"ExpectMessages":null,
+				"ExpectStatusCodes":null,
 				"IgnoreStatusCodes":null
 			},
+			"HTTPClientTrace":{"Enabled":false},
+			"HarvestSink":null,
+			"HeaderAttributes":{"Request":null,"Response":null},
 			"HighSecurity":false,
 			"HostDisplayName":"",
+			"InfiniteTracing":{
+				"SpanEvents":{"QueueSize":10000},
+				"TraceObserver":null
+			},
 			"Labels":null,
 			"Logger":null,
+			"Redaction":{"Rules":null},
 			"RuntimeSampler":{"Enabled":true},
 			"SecurityPoliciesToken":"",
-			"SpanEvents":{"Enabled":true},
+			"ServerlessMode":{
+				"AccountID":"",
+				"ApdexThreshold":500000000,
+				"Enabled":false,
+				"PrimaryAppID":"",
+				"TrustedAccountKey":""
+			},
+			"SpanEvents":{
+				"Attributes":{"Enabled":true,"Exclude":null,"Include":null},
+				"Enabled":true,
+				"MaxSamplesStored":1000
+			},
+			"Spool":{"Directory":"","MaxAge":14400000000000,"MaxBytes":16777216},
+			"ThreadProfiler":{"CPUProfileDir":"","Enabled":false},
 			"TransactionEvents":{
 				"Attributes":{"Enabled":true,"Exclude":null,"Include":null},
-				"Enabled":true
+				"Enabled":true,
+				"MaxSamplesStored":10000
 			},
+			"TransactionNaming":{"MaxNamesPerPrefix":0,"Rules":null},
 			"TransactionTracer":{
 				"Attributes":{"Enabled":true,"Exclude":null,"Include":null},
+				"BackgroundThreshold":0,
 				"Enabled":true,
 				"SegmentThreshold":2000000,
 				"StackTraceThreshold":500000000,
@@ -282,7 +381,16 @@ func TestCopyConfigReferenceFieldsAbsent(t *testing.T) {
 			"total_ram_mib":1024,
 			"hostname":"my-hostname"
 		},
-		"metadata":{}
+		"metadata":{},
+		"event_harvest_config":{
+			"report_period_ms":60000,
+			"harvest_limits":{
+				"analytic_event_data":10000,
+				"custom_event_data":10000,
+				"error_event_data":100,
+				"span_event_data":1000
+			}
+		}
 	}]`)
 
 	metadata := map[string]string{}
@@ -372,6 +480,15 @@ func TestValidate(t *testing.T) {
 	if err := c.Validate(); err != errMixedTracers {
 		t.Error(err)
 	}
+	c = Config{
+		License: "0123456789012345678901234567890123456789",
+		AppName: "my app",
+		Enabled: true,
+	}
+	c.DatastoreTracer.RecordSQL = "everything"
+	if err := c.Validate(); err != errRecordSQLMode {
+		t.Error(err)
+	}
 }
 
 func TestValidateWithPoliciesToken(t *testing.T) {
@@ -424,3 +541,23 @@ func TestGatherMetadata(t *testing.T) {
 		t.Error(metadata)
 	}
 }
+
+func TestConfigHarvestConfig(t *testing.T) {
+	cfg := NewConfig("my app", "0123456789012345678901234567890123456789")
+	if hc := cfg.harvestConfig(); hc != internal.DefaultHarvestConfig {
+		t.Error(hc)
+	}
+	cfg.CustomInsightsEvents.MaxSamplesStored = 50 * 1000
+	cfg.TransactionEvents.MaxSamplesStored = 20 * 1000
+	cfg.SpanEvents.MaxSamplesStored = -1
+	hc := cfg.harvestConfig()
+	if hc.MaxCustomEvents != 50*1000 {
+		t.Error(hc.MaxCustomEvents)
+	}
+	if hc.MaxTxnEvents != maxTxnEventsLimit {
+		t.Error(hc.MaxTxnEvents)
+	}
+	if hc.MaxSpanEvents != internal.MaxSpanEvents {
+		t.Error(hc.MaxSpanEvents)
+	}
+}
@@ -3,6 +3,8 @@
 package newrelic
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"testing"
 
@@ -84,3 +86,78 @@ func TestNewRoundTripperNilTransaction(t *testing.T) {
 		{Name: "External/example.com/all", Scope: scope, Forced: false, Data: nil},
 	})
 }
+
+func TestWrapBackgroundFunc(t *testing.T) {
+	app := testApp(nil, nil, t)
+	fn := WrapBackgroundFunc(app, "Job", "myJob", func(ctx context.Context) error {
+		txn := FromContext(ctx)
+		segment := StartSegment(txn, "mySegment")
+		segment.End()
+		return nil
+	})
+	if err := fn(context.Background()); nil != err {
+		t.Error(err)
+	}
+
+	scope := "OtherTransaction/Job/myJob"
+	app.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "OtherTransaction/Job/myJob", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransaction/all", Scope: "", Forced: true, Data: nil},
+		{Name: "Custom/mySegment", Scope: "", Forced: false, Data: nil},
+		{Name: "Custom/mySegment", Scope: scope, Forced: false, Data: nil},
+	})
+}
+
+func TestWrapBackgroundFuncError(t *testing.T) {
+	app := testApp(nil, nil, t)
+	myErr := errors.New("job failed")
+	fn := WrapBackgroundFunc(app, "Job", "myJob", func(ctx context.Context) error {
+		return myErr
+	})
+	if err := fn(context.Background()); err != myErr {
+		t.Error("error not returned", err)
+	}
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":     "*errors.errorString",
+			"error.message":   "job failed",
+			"transactionName": "OtherTransaction/Job/myJob",
+		},
+	}})
+}
+
+func TestWrapBackgroundFuncPanic(t *testing.T) {
+	app := testApp(nil, nil, t)
+	fn := WrapBackgroundFunc(app, "Job", "myJob", func(ctx context.Context) error {
+		panic("oops")
+	})
+	func() {
+		defer func() {
+			if r := recover(); r != "oops" {
+				t.Error("panic not propagated", r)
+			}
+		}()
+		fn(context.Background())
+	}()
+	app.ExpectErrors(t, []internal.WantError{{
+		TxnName: "OtherTransaction/Job/myJob",
+		Msg:     "oops",
+		Klass:   internal.PanicErrorKlass,
+		Caller:  "go-agent.(*txn).End",
+	}})
+}
+
+func TestWrapBackgroundFuncNilApp(t *testing.T) {
+	called := false
+	fn := WrapBackgroundFunc(nil, "Job", "myJob", func(ctx context.Context) error {
+		called = true
+		if nil != FromContext(ctx) {
+			t.Error("unexpected transaction in context")
+		}
+		return nil
+	})
+	fn(context.Background())
+	if !called {
+		t.Error("function not called")
+	}
+}
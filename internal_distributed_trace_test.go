@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"reflect"
 	"strings"
@@ -1598,3 +1599,235 @@ func TestDistributedTraceDisabledSpanEventsEnabled(t *testing.T) {
 	// ensure no span events created
 	app.ExpectSpanEventsCount(t, 0)
 }
+
+type traceContextTestcase struct {
+	TestName          string              `json:"test_name"`
+	Comment           string              `json:"comment,omitempty"`
+	TrustedAccountKey string              `json:"trusted_account_key"`
+	AccountID         string              `json:"account_id"`
+	WebTransaction    bool                `json:"web_transaction"`
+	RaisesException   bool                `json:"raises_exception"`
+	ForceSampledTrue  bool                `json:"force_sampled_true"`
+	SpanEventsEnabled bool                `json:"span_events_enabled"`
+	TransportType     string              `json:"transport_type"`
+	InboundHeaders    []map[string]string `json:"inbound_headers,omitempty"`
+
+	OutboundPayloads []fieldExpectations `json:"outbound_payloads,omitempty"`
+
+	Intrinsics struct {
+		TargetEvents     []string           `json:"target_events"`
+		Common           *fieldExpectations `json:"common,omitempty"`
+		Transaction      *fieldExpectations `json:"Transaction,omitempty"`
+		Span             *fieldExpectations `json:"Span,omitempty"`
+		TransactionError *fieldExpectations `json:"TransactionError,omitempty"`
+	} `json:"intrinsics"`
+
+	ExpectedMetrics [][2]interface{} `json:"expected_metrics"`
+}
+
+// traceContextOutboundFields splits the outbound traceparent and tracestate
+// headers into the fields named by the cross agent tests.
+func traceContextOutboundFields(hdrs http.Header) map[string]string {
+	fields := make(map[string]string)
+	add := func(key, value string) {
+		if "" != value {
+			fields[key] = value
+		}
+	}
+	if parts := strings.Split(hdrs.Get(DistributedTraceW3CTraceParentHeader), "-"); 4 == len(parts) {
+		add("traceparent.version", parts[0])
+		add("traceparent.trace_id", parts[1])
+		add("traceparent.parent_id", parts[2])
+		add("traceparent.trace_flags", parts[3])
+	}
+	var vendors []string
+	for _, member := range strings.Split(hdrs.Get(DistributedTraceW3CTraceStateHeader), ",") {
+		kv := strings.SplitN(member, "=", 2)
+		if 2 != len(kv) {
+			continue
+		}
+		if !strings.HasSuffix(kv[0], "@nr") {
+			vendors = append(vendors, kv[0])
+			continue
+		}
+		add("tracestate.tenant_id", strings.TrimSuffix(kv[0], "@nr"))
+		if parts := strings.Split(kv[1], "-"); 9 == len(parts) {
+			add("tracestate.version", parts[0])
+			add("tracestate.parent_type", parts[1])
+			add("tracestate.parent_account_id", parts[2])
+			add("tracestate.parent_application_id", parts[3])
+			add("tracestate.span_id", parts[4])
+			add("tracestate.transaction_id", parts[5])
+			add("tracestate.sampled", parts[6])
+			add("tracestate.priority", parts[7])
+			add("tracestate.timestamp", parts[8])
+		}
+	}
+	add("tracestate.vendors", strings.Join(vendors, ","))
+	return fields
+}
+
+func assertTraceContextOutbound(expect fieldExpectations, t internal.Validator, hdrs http.Header) {
+	fields := traceContextOutboundFields(hdrs)
+	for k, v := range expect.Exact {
+		if v != fields[k] {
+			t.Error(fmt.Sprintf("exact outbound header field mismatch key=%s wanted=%v got=%v",
+				k, v, fields[k]))
+		}
+	}
+	for _, e := range expect.Expected {
+		if _, ok := fields[e]; !ok {
+			t.Error(fmt.Sprintf("expected outbound header field missing key=%s", e))
+		}
+	}
+	for _, u := range expect.Unexpected {
+		if _, ok := fields[u]; ok {
+			t.Error(fmt.Sprintf("unexpected outbound header field present key=%s", u))
+		}
+	}
+}
+
+func runTraceContextCrossAgentTestcase(tst *testing.T, tc traceContextTestcase) {
+	t := internal.ExtendValidator(tst, "test="+tc.TestName)
+	configCallback := enableBetterCAT
+	if false == tc.SpanEventsEnabled {
+		configCallback = disableSpanEvents
+	}
+
+	app := testApp(func(reply *internal.ConnectReply) {
+		reply.AccountID = tc.AccountID
+		reply.AppID = "456"
+		reply.PrimaryAppID = "456"
+		reply.TrustedAccountKey = tc.TrustedAccountKey
+		reply.AdaptiveSampler = internal.SampleEverything{}
+	}, configCallback, tst)
+
+	txn := app.StartTransaction("hello", nil, nil)
+	if tc.WebTransaction {
+		txn.SetWebRequest(nil)
+	}
+
+	if tc.RaisesException {
+		txn.NoticeError(errors.New("my error message"))
+	}
+
+	for _, inbound := range tc.InboundHeaders {
+		hdrs := http.Header{}
+		for k, v := range inbound {
+			hdrs.Set(k, v)
+		}
+		// Note that the error return value is not tested here because
+		// some of the tests are intentionally errors.
+		txn.AcceptDistributedTracePayload(getTransport(tc.TransportType), hdrs)
+	}
+
+	for _, expect := range tc.OutboundPayloads {
+		hdrs := http.Header{}
+		txn.InsertDistributedTraceHeaders(hdrs)
+		assertTraceContextOutbound(expect, t, hdrs)
+	}
+
+	if err := txn.End(); nil != err {
+		t.Error(err)
+	}
+
+	wantMetrics := []internal.WantMetric{}
+	for _, metric := range tc.ExpectedMetrics {
+		wantMetrics = append(wantMetrics,
+			internal.WantMetric{Name: metric[0].(string), Scope: "", Forced: nil, Data: nil})
+	}
+	app.ExpectMetricsPresent(t, wantMetrics)
+
+	for _, value := range tc.Intrinsics.TargetEvents {
+		switch value {
+		case "Transaction":
+			assertTestCaseIntrinsics(t,
+				tc.Intrinsics.Common,
+				tc.Intrinsics.Transaction,
+				app.ExpectTxnEventsPresent,
+				app.ExpectTxnEventsAbsent)
+		case "Span":
+			assertTestCaseIntrinsics(t,
+				tc.Intrinsics.Common,
+				tc.Intrinsics.Span,
+				app.ExpectSpanEventsPresent,
+				app.ExpectSpanEventsAbsent)
+		case "TransactionError":
+			assertTestCaseIntrinsics(t,
+				tc.Intrinsics.Common,
+				tc.Intrinsics.TransactionError,
+				app.ExpectErrorEventsPresent,
+				app.ExpectErrorEventsAbsent)
+		}
+	}
+}
+
+func TestTraceContextCrossAgent(t *testing.T) {
+	var tcs []traceContextTestcase
+	if err := crossagent.ReadJSON("distributed_tracing/trace_context.json", &tcs); nil != err {
+		t.Fatal(err)
+	}
+	for _, tc := range tcs {
+		runTraceContextCrossAgentTestcase(t, tc)
+	}
+}
+
+func TestTraceContextSetWebRequestPrefersW3C(t *testing.T) {
+	app := testApp(distributedTracingReplyFields, enableBetterCAT, t)
+	payload := makePayload(app, nil)
+	req, err := http.NewRequest("GET", "http://example.com", nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	req.Header.Set(DistributedTracePayloadHeader, payload.HTTPSafe())
+	req.Header.Set(DistributedTraceW3CTraceParentHeader, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	txn := app.StartTransaction("hello", nil, req)
+	txn.End()
+	app.ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "Supportability/TraceContext/Accept/Success", Scope: "", Forced: true, Data: nil},
+		{Name: "Supportability/TraceContext/TraceState/NoNrEntry", Scope: "", Forced: true, Data: nil},
+	})
+	app.ExpectTxnEventsPresent(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"traceId":      "0af7651916cd43dd8448eb211c80319c",
+			"parentSpanId": "b7ad6b7169203331",
+		},
+	}})
+}
+
+func TestTraceContextExternalSegmentHeaders(t *testing.T) {
+	app := testApp(distributedTracingReplyFields, enableBetterCAT, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	s := StartExternalSegment(txn, req)
+	if "" == req.Header.Get(DistributedTracePayloadHeader) {
+		t.Error("missing Newrelic header")
+	}
+	tp := req.Header.Get(DistributedTraceW3CTraceParentHeader)
+	if !strings.HasPrefix(tp, "00-") || 55 != len(tp) {
+		t.Error("invalid traceparent header", tp)
+	}
+	if ts := req.Header.Get(DistributedTraceW3CTraceStateHeader); !strings.HasPrefix(ts, "123@nr=0-0-123-456-") {
+		t.Error("invalid tracestate header", ts)
+	}
+	s.End()
+	txn.End()
+}
+
+func TestTraceContextExcludeNewRelicHeader(t *testing.T) {
+	app := testApp(distributedTracingReplyFields, func(cfg *Config) {
+		enableBetterCAT(cfg)
+		cfg.DistributedTracer.ExcludeNewRelicHeader = true
+	}, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	hdrs := http.Header{}
+	txn.InsertDistributedTraceHeaders(hdrs)
+	if "" != hdrs.Get(DistributedTracePayloadHeader) {
+		t.Error("Newrelic header should be excluded")
+	}
+	if "" == hdrs.Get(DistributedTraceW3CTraceParentHeader) ||
+		"" == hdrs.Get(DistributedTraceW3CTraceStateHeader) {
+		t.Error("missing W3C headers", hdrs)
+	}
+	txn.End()
+}
@@ -0,0 +1,37 @@
+// +build go1.13
+
+package newrelic
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/newrelic/go-agent/internal"
+)
+
+func TestNoticeErrorWrappedWithErrorf(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	err := txn.NoticeError(fmt.Errorf("unable to load user: %w", Error{
+		Message:    "connection refused",
+		Class:      "ConnectionError",
+		Attributes: map[string]interface{}{"host": "db"},
+	}))
+	if nil != err {
+		t.Error(err)
+	}
+	txn.End()
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":     "ConnectionError",
+			"error.message":   "unable to load user: connection refused",
+			"transactionName": "OtherTransaction/Go/hello",
+		},
+		UserAttributes: map[string]interface{}{
+			"host": "db",
+		},
+		AgentAttributes: map[string]interface{}{
+			AttributeErrorChain: "unable to load user: connection refused\nconnection refused",
+		},
+	}})
+}
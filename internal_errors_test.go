@@ -1,6 +1,7 @@
 package newrelic
 
 import (
+	"net/http"
 	"runtime"
 	"strconv"
 	"testing"
@@ -562,3 +563,301 @@ func TestTooManyExtraErrorAttributes(t *testing.T) {
 	app.ExpectErrorEvents(t, []internal.WantEvent{})
 	app.ExpectMetrics(t, backgroundMetrics)
 }
+
+var (
+	backgroundExpectedErrorMetrics = append([]internal.WantMetric{
+		{Name: "ErrorsExpected/all", Scope: "", Forced: true, Data: singleCount},
+	}, backgroundMetrics...)
+)
+
+func TestNoticeErrorExpecter(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	err := txn.NoticeError(Error{
+		Message:  "my msg",
+		Class:    "my class",
+		Expected: true,
+	})
+	if nil != err {
+		t.Error(err)
+	}
+	txn.End()
+	app.ExpectErrors(t, []internal.WantError{{
+		TxnName: "OtherTransaction/Go/hello",
+		Msg:     "my msg",
+		Klass:   "my class",
+		Caller:  "go-agent.TestNoticeErrorExpecter",
+	}})
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":     "my class",
+			"error.message":   "my msg",
+			"error.expected":  true,
+			"transactionName": "OtherTransaction/Go/hello",
+		},
+	}})
+	app.ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name":  "OtherTransaction/Go/hello",
+			"error": false,
+		},
+	}})
+	app.ExpectMetrics(t, backgroundExpectedErrorMetrics)
+}
+
+func TestNoticeErrorExpectedByConfig(t *testing.T) {
+	cfgfn := func(cfg *Config) {
+		cfg.ErrorCollector.ExpectClasses = []string{"newrelic.myError"}
+		cfg.ErrorCollector.ExpectMessages = map[string][]string{
+			"my class": {"expected msg"},
+		}
+	}
+	app := testApp(nil, cfgfn, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	txn.NoticeError(myError{})
+	txn.NoticeError(Error{Message: "expected msg", Class: "my class"})
+	txn.End()
+	app.ExpectErrorEvents(t, []internal.WantEvent{
+		{
+			Intrinsics: map[string]interface{}{
+				"error.class":     "newrelic.myError",
+				"error.message":   "my msg",
+				"error.expected":  true,
+				"transactionName": "OtherTransaction/Go/hello",
+			},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"error.class":     "my class",
+				"error.message":   "expected msg",
+				"error.expected":  true,
+				"transactionName": "OtherTransaction/Go/hello",
+			},
+		},
+	})
+	app.ExpectMetrics(t, backgroundExpectedErrorMetrics)
+}
+
+func TestNoticeErrorUnexpectedMessage(t *testing.T) {
+	cfgfn := func(cfg *Config) {
+		cfg.ErrorCollector.ExpectMessages = map[string][]string{
+			"my class": {"expected msg"},
+		}
+	}
+	app := testApp(nil, cfgfn, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	txn.NoticeError(Error{Message: "other msg", Class: "my class"})
+	txn.End()
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":     "my class",
+			"error.message":   "other msg",
+			"transactionName": "OtherTransaction/Go/hello",
+		},
+	}})
+	app.ExpectMetrics(t, backgroundErrorMetrics)
+}
+
+func TestExpectedResponseCode(t *testing.T) {
+	cfgfn := func(cfg *Config) {
+		cfg.ErrorCollector.ExpectStatusCodes = []int{http.StatusBadRequest}
+	}
+	app := testApp(nil, cfgfn, t)
+	w := newCompatibleResponseRecorder()
+	txn := app.StartTransaction("hello", w, helloRequest)
+	txn.WriteHeader(http.StatusBadRequest)
+	txn.End()
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":     "400",
+			"error.message":   "Bad Request",
+			"error.expected":  true,
+			"transactionName": "WebTransaction/Go/hello",
+		},
+	}})
+	app.ExpectMetrics(t, append([]internal.WantMetric{
+		{Name: "ErrorsExpected/all", Scope: "", Forced: true, Data: singleCount},
+	}, webMetrics...))
+}
+
+func TestErrorGroupCallback(t *testing.T) {
+	var infos []ErrorInfo
+	cfgfn := func(cfg *Config) {
+		cfg.ErrorCollector.ErrorGroupCallback = func(info ErrorInfo) string {
+			infos = append(infos, info)
+			if info.Expected {
+				return ""
+			}
+			return "group:" + info.Class
+		}
+	}
+	app := testApp(nil, cfgfn, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	txn.SetName("renamed")
+	txn.NoticeError(myError{})
+	txn.NoticeError(Error{Message: "my msg", Class: "my class", Expected: true})
+	txn.End()
+
+	if len(infos) != 2 {
+		t.Fatal(infos)
+	}
+	if infos[0].Error != (myError{}) || infos[0].TransactionName != "OtherTransaction/Go/renamed" ||
+		infos[0].Message != "my msg" || infos[0].Class != "newrelic.myError" || infos[0].Expected {
+		t.Error(infos[0])
+	}
+	if !infos[1].Expected {
+		t.Error(infos[1])
+	}
+	app.ExpectErrorEvents(t, []internal.WantEvent{
+		{
+			Intrinsics: map[string]interface{}{
+				"error.class":     "newrelic.myError",
+				"error.message":   "my msg",
+				"transactionName": "OtherTransaction/Go/renamed",
+			},
+			AgentAttributes: map[string]interface{}{
+				AttributeErrorGroupName: "group:newrelic.myError",
+			},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"error.class":     "my class",
+				"error.message":   "my msg",
+				"error.expected":  true,
+				"transactionName": "OtherTransaction/Go/renamed",
+			},
+			AgentAttributes: map[string]interface{}{},
+		},
+	})
+}
+
+type wrappingError struct {
+	msg   string
+	err   error
+	attrs map[string]interface{}
+}
+
+func (e wrappingError) Error() string                           { return e.msg + ": " + e.err.Error() }
+func (e wrappingError) Unwrap() error                           { return e.err }
+func (e wrappingError) ErrorAttributes() map[string]interface{} { return e.attrs }
+
+func TestNoticeErrorChain(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	err := txn.NoticeError(wrappingError{
+		msg:   "outer",
+		attrs: map[string]interface{}{"zip": "outer", "top": 1},
+		err: wrappingError{
+			msg:   "middle",
+			attrs: map[string]interface{}{"zip": "middle", "middle": true},
+			err: Error{
+				Message:    "inner",
+				Class:      "inner class",
+				Attributes: map[string]interface{}{"zip": "inner", "inner": "zap"},
+			},
+		},
+	})
+	if nil != err {
+		t.Error(err)
+	}
+	txn.End()
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":     "inner class",
+			"error.message":   "outer: middle: inner",
+			"transactionName": "OtherTransaction/Go/hello",
+		},
+		UserAttributes: map[string]interface{}{
+			"zip":    "outer",
+			"top":    1,
+			"middle": true,
+			"inner":  "zap",
+		},
+		AgentAttributes: map[string]interface{}{
+			AttributeErrorChain: "outer: middle: inner\nmiddle: inner\ninner",
+		},
+	}})
+}
+
+func TestNoticeErrorChainRootClass(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	txn.NoticeError(wrappingError{msg: "outer", err: myError{}})
+	txn.End()
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":     "newrelic.myError",
+			"error.message":   "outer: my msg",
+			"transactionName": "OtherTransaction/Go/hello",
+		},
+		AgentAttributes: map[string]interface{}{
+			AttributeErrorChain: "outer: my msg\nmy msg",
+		},
+	}})
+}
+
+func TestNoticeErrorChainExpected(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	txn.NoticeError(wrappingError{msg: "outer", err: Error{Message: "inner", Expected: true}})
+	txn.End()
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":     "newrelic.Error",
+			"error.message":   "outer: inner",
+			"error.expected":  true,
+			"transactionName": "OtherTransaction/Go/hello",
+		},
+		AgentAttributes: map[string]interface{}{
+			AttributeErrorChain: "outer: inner\ninner",
+		},
+	}})
+}
+
+func TestNoticeErrorChainHighSecurity(t *testing.T) {
+	cfgFn := func(cfg *Config) { cfg.HighSecurity = true }
+	app := testApp(nil, cfgFn, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	txn.NoticeError(wrappingError{msg: "outer", err: myError{}})
+	txn.End()
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":     "newrelic.myError",
+			"error.message":   highSecurityErrorMsg,
+			"transactionName": "OtherTransaction/Go/hello",
+		},
+		AgentAttributes: map[string]interface{}{},
+	}})
+}
+
+func TestNoticeErrorChainTooManyAttributes(t *testing.T) {
+	outer := make(map[string]interface{})
+	inner := make(map[string]interface{})
+	for i := 0; i < internal.AttributeErrorLimit; i++ {
+		outer[strconv.Itoa(i)] = i
+		inner[strconv.Itoa(i+internal.AttributeErrorLimit)] = i
+	}
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	err := txn.NoticeError(wrappingError{msg: "outer", attrs: outer, err: Error{Attributes: inner}})
+	if err != errTooManyErrorAttributes {
+		t.Error(err)
+	}
+}
+
+type cyclicError struct{}
+
+func (e *cyclicError) Error() string { return "cycle" }
+func (e *cyclicError) Unwrap() error { return e }
+
+func TestErrorChainLimit(t *testing.T) {
+	if chain := errorChain(&cyclicError{}); len(chain) != internal.ErrorChainLimit {
+		t.Error(len(chain))
+	}
+	if chain := errorChain(myError{}); len(chain) != 1 {
+		t.Error(chain)
+	}
+	if chain := errorChain(nil); len(chain) != 0 {
+		t.Error(chain)
+	}
+}
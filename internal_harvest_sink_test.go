@@ -0,0 +1,240 @@
+package newrelic
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/internal"
+)
+
+type recordingSink struct {
+	sync.Mutex
+	payloads []HarvestPayload
+}
+
+func (s *recordingSink) WriteHarvest(p HarvestPayload) error {
+	s.Lock()
+	defer s.Unlock()
+	s.payloads = append(s.payloads, p)
+	return nil
+}
+
+func (s *recordingSink) cmds() map[string]HarvestPayload {
+	s.Lock()
+	defer s.Unlock()
+	m := make(map[string]HarvestPayload)
+	for _, p := range s.payloads {
+		m[p.Cmd] = p
+	}
+	return m
+}
+
+func TestHarvestWriterSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sink := NewHarvestWriterSink(buf)
+	start := time.Unix(1561000000, 0)
+	if err := sink.WriteHarvest(HarvestPayload{
+		Cmd:          "metric_data",
+		RunID:        "offline",
+		HarvestStart: start,
+		Data:         []byte(`["offline", 1, 2, []]`),
+	}); nil != err {
+		t.Fatal(err)
+	}
+	if err := sink.WriteHarvest(HarvestPayload{
+		Cmd:          "error_data",
+		RunID:        "offline",
+		HarvestStart: start,
+		Data:         []byte(`["offline",[]]`),
+	}); nil != err {
+		t.Fatal(err)
+	}
+	expect := `{"cmd":"metric_data","run_id":"offline","harvest_start":1561000000,"data":["offline",1,2,[]]}` + "\n" +
+		`{"cmd":"error_data","run_id":"offline","harvest_start":1561000000,"data":["offline",[]]}` + "\n"
+	if out := buf.String(); out != expect {
+		t.Error(out)
+	}
+}
+
+func TestHarvestWriterSinkInvalidData(t *testing.T) {
+	buf := &bytes.Buffer{}
+	sink := NewHarvestWriterSink(buf)
+	err := sink.WriteHarvest(HarvestPayload{
+		Cmd:  "metric_data",
+		Data: []byte(`{`),
+	})
+	if nil == err {
+		t.Error("expected error for invalid json")
+	}
+	if buf.Len() != 0 {
+		t.Error(buf.String())
+	}
+}
+
+func TestHarvestDirectorySink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harvest_sink")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sink := NewHarvestDirectorySink(filepath.Join(dir, "payloads"))
+	start := time.Unix(1561000000, 123)
+	if err := sink.WriteHarvest(HarvestPayload{
+		Cmd:          "metric_data",
+		RunID:        "offline",
+		HarvestStart: start,
+		Data:         []byte(`["offline"]`),
+	}); nil != err {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "payloads", "1561000000000000123_metric_data.json"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	expect := `{"cmd":"metric_data","run_id":"offline","harvest_start":1561000000,"data":["offline"]}` + "\n"
+	if string(contents) != expect {
+		t.Error(string(contents))
+	}
+}
+
+func TestHarvestSinkNoLicenseRequired(t *testing.T) {
+	cfg := NewConfig("my app", "")
+	cfg.HarvestSink = &recordingSink{}
+	if err := cfg.Validate(); nil != err {
+		t.Error(err)
+	}
+	cfg.License = "wronglength"
+	if err := cfg.Validate(); err != errLicenseLen {
+		t.Error(err)
+	}
+}
+
+func TestHarvestSinkApplication(t *testing.T) {
+	sink := &recordingSink{}
+	cfg := NewConfig("my app", "")
+	cfg.HarvestSink = sink
+	cfg.RuntimeSampler.Enabled = false
+	app, err := NewApplication(cfg)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := app.WaitForConnection(5 * time.Second); nil != err {
+		t.Fatal(err)
+	}
+	txn := app.StartTransaction("hello", nil, nil)
+	txn.NoticeError(myError{})
+	txn.End()
+	app.Shutdown(10 * time.Second)
+
+	cmds := sink.cmds()
+	for _, cmd := range []string{
+		"metric_data",
+		"analytic_event_data",
+		"error_data",
+		"error_event_data",
+	} {
+		p, ok := cmds[cmd]
+		if !ok {
+			t.Error("missing payload", cmd)
+			continue
+		}
+		if p.RunID != internal.OfflineRunID.String() {
+			t.Error(cmd, p.RunID)
+		}
+		var js interface{}
+		if err := json.Unmarshal(p.Data, &js); nil != err {
+			t.Error(cmd, err)
+		}
+	}
+}
+
+type otlpRequest struct {
+	path        string
+	contentType string
+	apiKey      string
+	size        int
+}
+
+func TestOTLPHarvestSinkApplication(t *testing.T) {
+	var lock sync.Mutex
+	var requests []otlpRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		lock.Lock()
+		defer lock.Unlock()
+		requests = append(requests, otlpRequest{
+			path:        r.URL.Path,
+			contentType: r.Header.Get("Content-Type"),
+			apiKey:      r.Header.Get("Api-Key"),
+			size:        len(body),
+		})
+	}))
+	defer srv.Close()
+
+	cfg := NewConfig("my app", "")
+	cfg.HarvestSink = NewOTLPHarvestSink(OTLPConfig{
+		Endpoint:    srv.URL + "/",
+		Headers:     map[string]string{"Api-Key": "secret"},
+		ServiceName: cfg.AppName,
+	})
+	cfg.RuntimeSampler.Enabled = false
+	cfg.DistributedTracer.Enabled = true
+	cfg.CrossApplicationTracer.Enabled = false
+	app, err := NewApplication(cfg)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := app.WaitForConnection(5 * time.Second); nil != err {
+		t.Fatal(err)
+	}
+	txn := app.StartTransaction("hello", nil, nil)
+	txn.NoticeError(myError{})
+	txn.End()
+	app.Shutdown(10 * time.Second)
+
+	lock.Lock()
+	defer lock.Unlock()
+	paths := make(map[string]int)
+	for _, r := range requests {
+		paths[r.path]++
+		if r.contentType != "application/x-protobuf" || r.apiKey != "secret" || r.size == 0 {
+			t.Error(r)
+		}
+	}
+	// Transaction events and error events are both sent as logs, and
+	// error traces are not sent.
+	if paths["/v1/traces"] != 1 || paths["/v1/logs"] != 2 || paths["/v1/metrics"] != 1 || len(paths) != 3 {
+		t.Error(paths)
+	}
+}
+
+func TestOTLPHarvestSinkFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	sink := NewOTLPHarvestSink(OTLPConfig{Endpoint: srv.URL})
+	err := sink.WriteHarvest(HarvestPayload{
+		Cmd:  "metric_data",
+		Data: []byte(`["offline",1000,1060,[[{"name":"WebTransaction"},[1,1,1,1,1,1]]]]`),
+	})
+	if nil == err || err.Error() != "OTLP response code: 503" {
+		t.Error(err)
+	}
+	if err := sink.WriteHarvest(HarvestPayload{
+		Cmd:  "error_data",
+		Data: []byte(`["offline",[]]`),
+	}); nil != err {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,207 @@
+// +build go1.8
+
+package newrelic
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/internal"
+)
+
+// clientTraceRoundTripper calls the httptrace hooks of the request's context
+// as a reused connection would, without making a request.
+func clientTraceRoundTripper(t *testing.T) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		trace := httptrace.ContextClientTrace(r.Context())
+		if nil == trace {
+			t.Fatal("missing client trace")
+		}
+		conn, other := net.Pipe()
+		defer conn.Close()
+		defer other.Close()
+		trace.GotConn(httptrace.GotConnInfo{Conn: conn, Reused: true})
+		trace.WroteRequest(httptrace.WroteRequestInfo{})
+		time.Sleep(time.Millisecond)
+		trace.GotFirstResponseByte()
+		time.Sleep(time.Millisecond)
+		return &http.Response{
+			StatusCode: 200,
+			Request:    r,
+			Body:       ioutil.NopCloser(strings.NewReader("hello")),
+		}, nil
+	})
+}
+
+func TestRoundTripperHTTPClientTrace(t *testing.T) {
+	replyfn := func(reply *internal.ConnectReply) {
+		reply.AdaptiveSampler = internal.SampleEverything{}
+	}
+	cfgfn := func(cfg *Config) {
+		cfg.DistributedTracer.Enabled = true
+		cfg.CrossApplicationTracer.Enabled = false
+		cfg.HTTPClientTrace.Enabled = true
+	}
+	app := testApp(replyfn, cfgfn, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	client := &http.Client{Transport: NewRoundTripper(txn, clientTraceRoundTripper(t))}
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	resp, err := client.Do(req)
+	if nil != err || 200 != resp.StatusCode {
+		t.Fatal(resp, err)
+	}
+	if _, ok := resp.Body.(*responseBodyTimer); !ok {
+		t.Errorf("response body not wrapped: %T", resp.Body)
+	}
+	resp.Body.Close()
+	// The round tripper does not modify the request.
+	if len(req.Header) != 0 || nil != httptrace.ContextClientTrace(req.Context()) {
+		t.Error("request modified", req.Header)
+	}
+	txn.End()
+	app.ExpectSpanEvents(t, []internal.WantEvent{
+		{
+			Intrinsics: map[string]interface{}{
+				"name":          "OtherTransaction/Go/hello",
+				"sampled":       true,
+				"category":      "generic",
+				"priority":      internal.MatchAnything,
+				"guid":          internal.MatchAnything,
+				"transactionId": internal.MatchAnything,
+				"nr.entryPoint": true,
+				"traceId":       internal.MatchAnything,
+			},
+			UserAttributes:  map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":                  "External/example.com/all",
+				"sampled":               true,
+				"category":              "http",
+				"priority":              internal.MatchAnything,
+				"guid":                  internal.MatchAnything,
+				"transactionId":         internal.MatchAnything,
+				"traceId":               internal.MatchAnything,
+				"parentId":              internal.MatchAnything,
+				"http.url":              "http://example.com/",
+				"http.method":           "GET",
+				"span.kind":             "client",
+				"component":             "http",
+				"http.waitDuration":     internal.MatchAnything,
+				"http.responseDuration": internal.MatchAnything,
+				"http.connectionReused": true,
+				"peer.address":          "pipe",
+			},
+			UserAttributes:  map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{},
+		},
+	})
+}
+
+func TestHTTPClientTraceResponseBody(t *testing.T) {
+	cfgfn := func(cfg *Config) { cfg.HTTPClientTrace.Enabled = true }
+	app := testApp(nil, cfgfn, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	s := StartExternalSegment(txn, req)
+	httptrace.ContextClientTrace(req.Context()).GotFirstResponseByte()
+	s.End()
+	timing := s.clientTrace.recorded
+	if nil == timing || timing.Response > 10*time.Millisecond {
+		t.Fatal(timing)
+	}
+
+	// The response phase is extended until the body is read to EOF.
+	body := s.clientTrace.wrapResponseBody(s.StartTime.thread, ioutil.NopCloser(strings.NewReader("hello")))
+	time.Sleep(20 * time.Millisecond)
+	if _, err := ioutil.ReadAll(body); nil != err {
+		t.Fatal(err)
+	}
+	extended := timing.Response
+	if extended < 20*time.Millisecond {
+		t.Error(extended)
+	}
+	// Closing the body after EOF does not extend it further.
+	time.Sleep(time.Millisecond)
+	body.Close()
+	if timing.Response != extended {
+		t.Error(timing.Response, extended)
+	}
+
+	// The timing is not changed once the transaction has ended.
+	body = s.clientTrace.wrapResponseBody(s.StartTime.thread, ioutil.NopCloser(strings.NewReader("hello")))
+	txn.End()
+	body.Close()
+	if timing.Response != extended {
+		t.Error(timing.Response, extended)
+	}
+}
+
+type readWriteCloser struct {
+	io.Reader
+	io.Writer
+}
+
+func (readWriteCloser) Close() error { return nil }
+
+func TestHTTPClientTraceWritableBodyNotWrapped(t *testing.T) {
+	ct := &httpClientTrace{}
+	ct.timing(time.Now())
+	body := readWriteCloser{}
+	if out := ct.wrapResponseBody(&thread{}, body); out != io.ReadCloser(body) {
+		t.Error(out)
+	}
+}
+
+func TestStartExternalSegmentHTTPClientTraceDisabled(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	s := StartExternalSegment(txn, req)
+	if nil != s.clientTrace || nil != httptrace.ContextClientTrace(req.Context()) {
+		t.Error("client trace added when disabled")
+	}
+	s.End()
+	txn.End()
+}
+
+func TestHTTPClientTraceTiming(t *testing.T) {
+	start := time.Now()
+	ct := &httpClientTrace{
+		dnsStart:     start,
+		dnsDone:      start.Add(1 * time.Millisecond),
+		connectStart: start.Add(1 * time.Millisecond),
+		connectDone:  start.Add(3 * time.Millisecond),
+		tlsStart:     start.Add(3 * time.Millisecond),
+		tlsDone:      start.Add(6 * time.Millisecond),
+		wroteRequest: start.Add(7 * time.Millisecond),
+		firstByte:    start.Add(10 * time.Millisecond),
+		remoteAddr:   "10.0.0.1:443",
+	}
+	timing := ct.timing(start.Add(15 * time.Millisecond))
+	if timing.DNS != 1*time.Millisecond ||
+		timing.Connect != 2*time.Millisecond ||
+		timing.TLS != 3*time.Millisecond ||
+		timing.Wait != 3*time.Millisecond ||
+		timing.Response != 5*time.Millisecond ||
+		timing.ConnectionReused ||
+		timing.RemoteAddress != "10.0.0.1:443" {
+		t.Error(timing)
+	}
+	// Phases which do not complete are not recorded.
+	ct = &httpClientTrace{wroteRequest: start}
+	if timing := ct.timing(start.Add(time.Second)); timing.Wait != 0 || timing.Response != 0 {
+		t.Error(timing)
+	}
+	var nilTrace *httpClientTrace
+	if nil != nilTrace.timing(start) {
+		t.Error("nil trace has timing")
+	}
+}
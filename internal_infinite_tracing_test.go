@@ -0,0 +1,115 @@
+package newrelic
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/internal"
+	"github.com/newrelic/go-agent/internal/logger"
+)
+
+type testTraceObserver struct {
+	sync.Mutex
+	spans []*internal.SpanEvent
+}
+
+func (o *testTraceObserver) DialTraceObserver(license string, runID internal.AgentRunID) (internal.TraceObserverStream, error) {
+	return o, nil
+}
+
+func (o *testTraceObserver) Send(e *internal.SpanEvent) error {
+	o.Lock()
+	defer o.Unlock()
+	o.spans = append(o.spans, e)
+	return nil
+}
+
+func (o *testTraceObserver) Close() error { return nil }
+
+func TestInfiniteTracing(t *testing.T) {
+	observer := &testTraceObserver{}
+	cfgfn := func(cfg *Config) {
+		cfg.DistributedTracer.Enabled = true
+		cfg.CrossApplicationTracer.Enabled = false
+		cfg.InfiniteTracing.TraceObserver = observer
+	}
+	// The connect reply does not sample any transactions, but every
+	// transaction is sampled when using infinite tracing.
+	application := testApp(nil, cfgfn, t)
+	to := internal.NewTraceObserver(internal.TraceObserverConfig{
+		Dialer:  observer,
+		License: "license",
+		Logger:  logger.ShimLogger{},
+	})
+	application.(*app).traceObserver = to
+	to.SetRunID("run-id")
+
+	txn := application.StartTransaction("hello", nil, nil)
+	segment := StartSegment(txn, "mySegment")
+	segment.End()
+	txn.End()
+	to.Shutdown(5 * time.Second)
+
+	// The span events are sent to the trace observer rather than being
+	// harvested.
+	application.ExpectSpanEvents(t, []internal.WantEvent{})
+	if len(observer.spans) != 2 {
+		t.Fatal(len(observer.spans))
+	}
+	segmentSpan, rootSpan := observer.spans[0], observer.spans[1]
+	if segmentSpan.Name != "Custom/mySegment" || rootSpan.Name != "OtherTransaction/Go/hello" {
+		t.Error(segmentSpan.Name, rootSpan.Name)
+	}
+	if !segmentSpan.Sampled || !rootSpan.Sampled {
+		t.Error(segmentSpan.Sampled, rootSpan.Sampled)
+	}
+	if segmentSpan.ParentID != rootSpan.GUID || segmentSpan.TraceID != rootSpan.TraceID {
+		t.Error(segmentSpan.ParentID, rootSpan.GUID, segmentSpan.TraceID, rootSpan.TraceID)
+	}
+	if !rootSpan.IsEntrypoint || rootSpan.TraceID == "" {
+		t.Error(rootSpan.IsEntrypoint, rootSpan.TraceID)
+	}
+}
+
+func TestInfiniteTracingIgnoredTransaction(t *testing.T) {
+	// Test that segment span events are sent as their segments end, and
+	// that the root span event of an ignored transaction is not sent.
+	observer := &testTraceObserver{}
+	cfgfn := func(cfg *Config) {
+		cfg.DistributedTracer.Enabled = true
+		cfg.CrossApplicationTracer.Enabled = false
+		cfg.InfiniteTracing.TraceObserver = observer
+	}
+	application := testApp(nil, cfgfn, t)
+	to := internal.NewTraceObserver(internal.TraceObserverConfig{
+		Dialer:  observer,
+		License: "license",
+		Logger:  logger.ShimLogger{},
+	})
+	application.(*app).traceObserver = to
+	to.SetRunID("run-id")
+
+	txn := application.StartTransaction("ignored", nil, nil)
+	StartSegment(txn, "mySegment").End()
+	txn.Ignore()
+	txn.End()
+	to.Shutdown(5 * time.Second)
+
+	if len(observer.spans) != 1 || observer.spans[0].Name != "Custom/mySegment" {
+		t.Error(observer.spans)
+	}
+}
+
+func TestInfiniteTracingRequiresDistributedTracing(t *testing.T) {
+	cfg := NewConfig("my app", "0123456789012345678901234567890123456789")
+	cfg.InfiniteTracing.TraceObserver = &testTraceObserver{}
+	if err := cfg.Validate(); err != errInfiniteTracingRequiresDT {
+		t.Error(err)
+	}
+	cfg.DistributedTracer.Enabled = true
+	cfg.CrossApplicationTracer.Enabled = false
+	if err := cfg.Validate(); nil != err {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,255 @@
+package newrelic
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/newrelic/go-agent/internal"
+)
+
+func TestMessageProducerSegment(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, helloRequest)
+	s := MessageProducerSegment{
+		StartTime:       StartSegmentNow(txn),
+		Library:         "RabbitMQ",
+		DestinationType: MessageExchange,
+		DestinationName: "myExchange",
+	}
+	if err := s.End(); nil != err {
+		t.Error(err)
+	}
+	txn.End()
+	scope := "WebTransaction/Go/hello"
+	app.ExpectMetrics(t, append([]internal.WantMetric{
+		{Name: "MessageBroker/RabbitMQ/Exchange/Produce/Named/myExchange", Scope: "", Forced: false, Data: nil},
+		{Name: "MessageBroker/RabbitMQ/Exchange/Produce/Named/myExchange", Scope: scope, Forced: false, Data: nil},
+	}, webMetrics...))
+}
+
+func TestMessageProducerSegmentTemporary(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	s := MessageProducerSegment{
+		StartTime:            StartSegmentNow(txn),
+		Library:              "Kafka",
+		DestinationType:      MessageTopic,
+		DestinationName:      "amq.gen-1234",
+		DestinationTemporary: true,
+	}
+	if err := s.End(); nil != err {
+		t.Error(err)
+	}
+	txn.End()
+	scope := "OtherTransaction/Go/hello"
+	app.ExpectMetrics(t, append([]internal.WantMetric{
+		{Name: "MessageBroker/Kafka/Topic/Produce/Temp", Scope: "", Forced: false, Data: nil},
+		{Name: "MessageBroker/Kafka/Topic/Produce/Temp", Scope: scope, Forced: false, Data: nil},
+	}, backgroundMetrics...))
+}
+
+func TestMessageProducerSegmentMissingFields(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	s := MessageProducerSegment{
+		StartTime: StartSegmentNow(txn),
+	}
+	if err := s.End(); nil != err {
+		t.Error(err)
+	}
+	txn.End()
+	scope := "OtherTransaction/Go/hello"
+	app.ExpectMetrics(t, append([]internal.WantMetric{
+		{Name: "MessageBroker/Unknown/Unknown/Produce/Named/Unknown", Scope: "", Forced: false, Data: nil},
+		{Name: "MessageBroker/Unknown/Unknown/Produce/Named/Unknown", Scope: scope, Forced: false, Data: nil},
+	}, backgroundMetrics...))
+}
+
+func TestMessageProducerSegmentNilTxn(t *testing.T) {
+	var s *MessageProducerSegment
+	if err := s.End(); nil != err {
+		t.Error(err)
+	}
+	s = &MessageProducerSegment{StartTime: StartSegmentNow(nil)}
+	if err := s.End(); nil != err {
+		t.Error(err)
+	}
+}
+
+func TestMessageProducerSegmentTxnEnded(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	s := MessageProducerSegment{
+		StartTime:       StartSegmentNow(txn),
+		Library:         "RabbitMQ",
+		DestinationType: MessageQueue,
+		DestinationName: "myQueue",
+	}
+	txn.End()
+	if err := s.End(); err != errAlreadyEnded {
+		t.Error(err)
+	}
+	app.ExpectMetrics(t, backgroundMetrics)
+}
+
+func TestMessageProducerSegmentSpanEvent(t *testing.T) {
+	replyfn := func(reply *internal.ConnectReply) {
+		reply.AdaptiveSampler = internal.SampleEverything{}
+	}
+	cfgfn := func(cfg *Config) {
+		cfg.DistributedTracer.Enabled = true
+		cfg.CrossApplicationTracer.Enabled = false
+	}
+	app := testApp(replyfn, cfgfn, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	s := MessageProducerSegment{
+		StartTime:       StartSegmentNow(txn),
+		Library:         "RabbitMQ",
+		DestinationType: MessageQueue,
+		DestinationName: "myQueue",
+	}
+	s.End()
+	txn.End()
+	app.ExpectSpanEvents(t, []internal.WantEvent{
+		{
+			Intrinsics: map[string]interface{}{
+				"name":          "OtherTransaction/Go/hello",
+				"sampled":       true,
+				"category":      "generic",
+				"priority":      internal.MatchAnything,
+				"guid":          internal.MatchAnything,
+				"transactionId": internal.MatchAnything,
+				"nr.entryPoint": true,
+				"traceId":       internal.MatchAnything,
+			},
+			UserAttributes:  map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":          "MessageBroker/RabbitMQ/Queue/Produce/Named/myQueue",
+				"sampled":       true,
+				"category":      "generic",
+				"priority":      internal.MatchAnything,
+				"guid":          internal.MatchAnything,
+				"transactionId": internal.MatchAnything,
+				"traceId":       internal.MatchAnything,
+				"parentId":      internal.MatchAnything,
+			},
+			UserAttributes:  map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{},
+		},
+	})
+}
+
+func TestStartMessageTransaction(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := StartMessageTransaction(app, MessageConsumer{
+		Library:         "RabbitMQ",
+		DestinationType: MessageQueue,
+		DestinationName: "UsersQueue",
+	}, nil)
+	txn.End()
+	app.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "OtherTransaction/Message/RabbitMQ/Queue/Named/UsersQueue", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransaction/all", Scope: "", Forced: true, Data: nil},
+	})
+	app.ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name": "OtherTransaction/Message/RabbitMQ/Queue/Named/UsersQueue",
+		},
+	}})
+}
+
+func TestStartMessageTransactionTemporary(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := StartMessageTransaction(app, MessageConsumer{
+		Library:              "JMS",
+		DestinationType:      MessageTopic,
+		DestinationName:      "TempTopic-1234",
+		DestinationTemporary: true,
+	}, nil)
+	txn.End()
+	app.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "OtherTransaction/Message/JMS/Topic/Temp", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransaction/all", Scope: "", Forced: true, Data: nil},
+	})
+}
+
+func TestStartMessageTransactionSetName(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := StartMessageTransaction(app, MessageConsumer{
+		Library:         "RabbitMQ",
+		DestinationType: MessageQueue,
+		DestinationName: "UsersQueue",
+	}, nil)
+	txn.SetName("Kafka/Topic/Named/Orders")
+	txn.End()
+	app.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "OtherTransaction/Message/Kafka/Topic/Named/Orders", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransaction/all", Scope: "", Forced: true, Data: nil},
+	})
+}
+
+func TestStartMessageTransactionDistributedTrace(t *testing.T) {
+	app := testApp(distributedTracingReplyFields, enableBetterCAT, t)
+
+	producer := app.StartTransaction("producer", nil, nil)
+	hdrs := http.Header{}
+	s := MessageProducerSegment{
+		StartTime:       StartSegmentNow(producer),
+		Library:         "Kafka",
+		DestinationType: MessageTopic,
+		DestinationName: "Orders",
+	}
+	producer.InsertDistributedTraceHeaders(hdrs)
+	s.End()
+	producer.End()
+
+	consumer := StartMessageTransaction(app, MessageConsumer{
+		Library:         "Kafka",
+		DestinationType: MessageTopic,
+		DestinationName: "Orders",
+		TransportType:   TransportKafka,
+	}, hdrs)
+	consumer.End()
+
+	app.ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "OtherTransaction/Message/Kafka/Topic/Named/Orders", Scope: "", Forced: true, Data: nil},
+		{Name: "DurationByCaller/App/123/456/Kafka/all", Scope: "", Forced: false, Data: nil},
+		{Name: "DurationByCaller/App/123/456/Kafka/allOther", Scope: "", Forced: false, Data: nil},
+		{Name: "Supportability/TraceContext/Accept/Success", Scope: "", Forced: true, Data: nil},
+	})
+	app.ExpectTxnEventsPresent(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name": "OtherTransaction/Go/producer",
+		},
+	}, {
+		Intrinsics: map[string]interface{}{
+			"name":                 "OtherTransaction/Message/Kafka/Topic/Named/Orders",
+			"parent.type":          "App",
+			"parent.transportType": "Kafka",
+			"parentId":             internal.MatchAnything,
+			"parentSpanId":         internal.MatchAnything,
+		},
+	}})
+}
+
+func TestStartMessageTransactionDefaultTransport(t *testing.T) {
+	app := testApp(distributedTracingReplyFields, enableBetterCAT, t)
+	hdrs := http.Header{}
+	hdrs.Set(DistributedTraceW3CTraceParentHeader, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	txn := StartMessageTransaction(app, MessageConsumer{
+		Library:         "RabbitMQ",
+		DestinationType: MessageQueue,
+		DestinationName: "UsersQueue",
+	}, hdrs)
+	txn.End()
+	app.ExpectTxnEventsPresent(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name":                 "OtherTransaction/Message/RabbitMQ/Queue/Named/UsersQueue",
+			"traceId":              "0af7651916cd43dd8448eb211c80319c",
+			"parent.transportType": "Queue",
+		},
+	}})
+}
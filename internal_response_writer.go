@@ -2,26 +2,261 @@ package newrelic
 
 import (
 	"bufio"
+	"bytes"
 	"io"
+	"mime"
 	"net"
 	"net/http"
+	"strconv"
+
+	"github.com/newrelic/go-agent/internal"
 )
 
 func (txn *txn) CloseNotify() <-chan bool {
 	return txn.getWriter().(http.CloseNotifier).CloseNotify()
 }
 func (txn *txn) Flush() {
+	// Flushing indicates a streamed response: the buffered response is
+	// written unchanged.
+	txn.stopInjection()
 	txn.getWriter().(http.Flusher).Flush()
 }
 func (txn *txn) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	txn.stopInjection()
 	return txn.getWriter().(http.Hijacker).Hijack()
 }
 func (txn *txn) ReadFrom(r io.Reader) (int64, error) {
+	if nil != txn.getInjector() {
+		// writerOnly hides the ReadFrom method to prevent io.Copy
+		// from calling this method again.
+		return io.Copy(writerOnly{txn}, r)
+	}
 	return txn.getWriter().(io.ReaderFrom).ReadFrom(r)
 }
 
-func upgradeTxn(txn *txn) Transaction {
-	// Note that txn.getWriter() is not used here.  The transaction is
+type writerOnly struct{ io.Writer }
+
+// browserInjectionBufferLimit limits the amount of an HTML response which is
+// buffered while looking for the end of the head.  Responses whose head is
+// larger are written unchanged.
+const browserInjectionBufferLimit = 64 * 1024
+
+// browserInjector buffers the beginning of an HTML response so that the
+// browser timing header can be inserted when
+// Config.BrowserMonitoring.AutoInstrument is enabled.  The status code and
+// the buffered body are written once the insertion point is found.
+type browserInjector struct {
+	// buffering is set once the response is known to be HTML.
+	buffering bool
+	// code is the status code provided to WriteHeader, or zero if
+	// WriteHeader has not been called.
+	code int
+	buf  bytes.Buffer
+}
+
+// getInjector returns the transaction's browserInjector, or nil if the
+// response is not being buffered for browser injection.
+func (txn *txn) getInjector() *browserInjector {
+	txn.Lock()
+	defer txn.Unlock()
+
+	if txn.injectionFinished || txn.finished || txn.wroteHeader || nil == txn.writer {
+		return nil
+	}
+	if !txn.Config.BrowserMonitoring.Enabled || !txn.Config.BrowserMonitoring.AutoInstrument {
+		return nil
+	}
+	// The agent loader is empty if browser has been disabled by the
+	// server or the application is not yet connected.
+	if "" == txn.Reply.AgentLoader {
+		return nil
+	}
+	if nil == txn.injector {
+		txn.injector = &browserInjector{}
+	}
+	return txn.injector
+}
+
+// codeHasBody returns false for status codes which do not permit a body.
+func codeHasBody(code int) bool {
+	return !(code >= 100 && code < 200) &&
+		code != http.StatusNoContent &&
+		code != http.StatusNotModified
+}
+
+// deferWriteHeader records the status code so that it can be written after
+// the Content-Length has been adjusted.  It returns false if the status code
+// should be written immediately.
+func (inj *browserInjector) deferWriteHeader(code int) bool {
+	if 0 != inj.code {
+		// Like http.ResponseWriter, ignore superfluous calls.
+		return true
+	}
+	if !codeHasBody(code) {
+		return false
+	}
+	inj.code = code
+	return true
+}
+
+// isHTMLResponse determines whether the response should be buffered, using
+// the first bytes of the body when the Content-Type is not set.
+func isHTMLResponse(hdr http.Header, b []byte) bool {
+	if nil == hdr {
+		return false
+	}
+	if enc := hdr.Get("Content-Encoding"); "" != enc && "identity" != enc {
+		return false
+	}
+	contentType := hdr.Get("Content-Type")
+	if "" == contentType {
+		contentType = http.DetectContentType(b)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return nil == err && "text/html" == mediaType
+}
+
+func (txn *txn) injectorWrite(inj *browserInjector, b []byte) (int, error) {
+	if !inj.buffering {
+		if !isHTMLResponse(txn.Header(), b) {
+			txn.stopInjection()
+			return txn.write(b)
+		}
+		inj.buffering = true
+	}
+	inj.buf.Write(b)
+
+	head := inj.buf.Bytes()
+	if !browserHeadComplete(head) && len(head) < browserInjectionBufferLimit {
+		return len(b), nil
+	}
+	return len(b), txn.endInjection(inj, browserInsertionPoint(head))
+}
+
+// stopInjection writes the buffered response unchanged.
+func (txn *txn) stopInjection() {
+	if inj := txn.getInjector(); nil != inj {
+		txn.endInjection(inj, -1)
+	}
+}
+
+// finishInjection writes the buffered response when the transaction ends,
+// inserting the browser timing header if the insertion point is found.
+func (txn *txn) finishInjection() {
+	if inj := txn.getInjector(); nil != inj {
+		txn.endInjection(inj, browserInsertionPoint(inj.buf.Bytes()))
+	}
+}
+
+// endInjection inserts the browser timing header at the index provided,
+// unless it is negative, and then writes the status code and the buffered
+// response.
+func (txn *txn) endInjection(inj *browserInjector, insertAt int) error {
+	var script []byte
+	txn.Lock()
+	txn.injectionFinished = true
+	txn.injector = nil
+	if insertAt >= 0 {
+		hdr, err := txn.browserTimingHeaderLocked()
+		if nil != err {
+			txn.Config.Logger.Debug("unable to insert browser timing header", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		script = hdr.WithTags()
+	}
+	txn.Unlock()
+
+	body := inj.buf.Bytes()
+	if nil != script {
+		body = appendSlices(body[:insertAt], script, body[insertAt:])
+		if hdr := txn.Header(); nil != hdr {
+			if length, err := strconv.Atoi(hdr.Get("Content-Length")); nil == err {
+				hdr.Set("Content-Length", strconv.Itoa(length+len(script)))
+			}
+		}
+	}
+	if 0 != inj.code {
+		txn.writeHeader(inj.code)
+	}
+	if len(body) > 0 {
+		_, err := txn.write(body)
+		return err
+	}
+	return nil
+}
+
+// asciiLower lowercases ASCII letters without changing the length of the
+// input so that indices remain valid.
+func asciiLower(b []byte) []byte {
+	lower := make([]byte, len(b))
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+	return lower
+}
+
+// browserHeadComplete returns true once the end of the head has been
+// buffered.
+func browserHeadComplete(html []byte) bool {
+	lower := asciiLower(html)
+	return bytes.Contains(lower, []byte("</head")) || bytes.Contains(lower, []byte("<body"))
+}
+
+// findTag returns the index just past the end of the first tag with the name
+// provided whose attributes contain attr, or -1 if there is none.
+func findTag(lower []byte, name, attr string) int {
+	open := []byte("<" + name)
+	for offset := 0; ; {
+		idx := bytes.Index(lower[offset:], open)
+		if idx < 0 {
+			return -1
+		}
+		start := offset + idx + len(open)
+		end := bytes.IndexByte(lower[start:], '>')
+		if end < 0 {
+			return -1
+		}
+		end += start
+		// The tag name must be followed by the end of the tag or
+		// whitespace, eg. "<head>" matches "head" but "<header>"
+		// does not.
+		if next := lower[start]; '>' == next || '/' == next || ' ' == next || '\t' == next || '\n' == next || '\r' == next {
+			if bytes.Contains(lower[start:end], []byte(attr)) {
+				return end + 1
+			}
+		}
+		offset = start
+	}
+}
+
+// browserInsertionPoint returns the index at which the browser timing header
+// is inserted: after the first meta charset tag in the head, or after the
+// head tag itself.  It returns -1 if the header should not be inserted,
+// including when the response already contains a browser timing header.
+func browserInsertionPoint(html []byte) int {
+	lower := asciiLower(html)
+	if bytes.Contains(lower, []byte("nreum")) {
+		return -1
+	}
+	headEnd := len(lower)
+	if idx := bytes.Index(lower, []byte("</head")); idx >= 0 {
+		headEnd = idx
+	} else if idx := bytes.Index(lower, []byte("<body")); idx >= 0 {
+		headEnd = idx
+	}
+	head := lower[:headEnd]
+	if idx := findTag(head, "meta", "charset"); idx >= 0 {
+		return idx
+	}
+	return findTag(head, "head", "")
+}
+
+func upgradeTxn(thd *thread) Transaction {
+	// Note that thd.getWriter() is not used here.  The transaction is
 	// locked (or under construction) when this function is used.
 
 	// GENERATED CODE DO NOT MODIFY
@@ -33,114 +268,130 @@ func upgradeTxn(txn *txn) Transaction {
 		i3 int32 = 1 << 3
 	)
 	var interfaceSet int32
-	if _, ok := txn.writer.(http.CloseNotifier); ok {
+	if _, ok := thd.writer.(http.CloseNotifier); ok {
 		interfaceSet |= i0
 	}
-	if _, ok := txn.writer.(http.Flusher); ok {
+	if _, ok := thd.writer.(http.Flusher); ok {
 		interfaceSet |= i1
 	}
-	if _, ok := txn.writer.(http.Hijacker); ok {
+	if _, ok := thd.writer.(http.Hijacker); ok {
 		interfaceSet |= i2
 	}
-	if _, ok := txn.writer.(io.ReaderFrom); ok {
+	if _, ok := thd.writer.(io.ReaderFrom); ok {
 		interfaceSet |= i3
 	}
 	switch interfaceSet {
 	default: // No optional interfaces implemented
 		return struct {
 			Transaction
-		}{txn}
+			internal.AddAgentAttributer
+		}{thd, thd}
 	case i0:
 		return struct {
 			Transaction
+			internal.AddAgentAttributer
 			http.CloseNotifier
-		}{txn, txn}
+		}{thd, thd, thd}
 	case i1:
 		return struct {
 			Transaction
+			internal.AddAgentAttributer
 			http.Flusher
-		}{txn, txn}
+		}{thd, thd, thd}
 	case i0 | i1:
 		return struct {
 			Transaction
+			internal.AddAgentAttributer
 			http.CloseNotifier
 			http.Flusher
-		}{txn, txn, txn}
+		}{thd, thd, thd, thd}
 	case i2:
 		return struct {
 			Transaction
+			internal.AddAgentAttributer
 			http.Hijacker
-		}{txn, txn}
+		}{thd, thd, thd}
 	case i0 | i2:
 		return struct {
 			Transaction
+			internal.AddAgentAttributer
 			http.CloseNotifier
 			http.Hijacker
-		}{txn, txn, txn}
+		}{thd, thd, thd, thd}
 	case i1 | i2:
 		return struct {
 			Transaction
+			internal.AddAgentAttributer
 			http.Flusher
 			http.Hijacker
-		}{txn, txn, txn}
+		}{thd, thd, thd, thd}
 	case i0 | i1 | i2:
 		return struct {
 			Transaction
+			internal.AddAgentAttributer
 			http.CloseNotifier
 			http.Flusher
 			http.Hijacker
-		}{txn, txn, txn, txn}
+		}{thd, thd, thd, thd, thd}
 	case i3:
 		return struct {
 			Transaction
+			internal.AddAgentAttributer
 			io.ReaderFrom
-		}{txn, txn}
+		}{thd, thd, thd}
 	case i0 | i3:
 		return struct {
 			Transaction
+			internal.AddAgentAttributer
 			http.CloseNotifier
 			io.ReaderFrom
-		}{txn, txn, txn}
+		}{thd, thd, thd, thd}
 	case i1 | i3:
 		return struct {
 			Transaction
+			internal.AddAgentAttributer
 			http.Flusher
 			io.ReaderFrom
-		}{txn, txn, txn}
+		}{thd, thd, thd, thd}
 	case i0 | i1 | i3:
 		return struct {
 			Transaction
+			internal.AddAgentAttributer
 			http.CloseNotifier
 			http.Flusher
 			io.ReaderFrom
-		}{txn, txn, txn, txn}
+		}{thd, thd, thd, thd, thd}
 	case i2 | i3:
 		return struct {
 			Transaction
+			internal.AddAgentAttributer
 			http.Hijacker
 			io.ReaderFrom
-		}{txn, txn, txn}
+		}{thd, thd, thd, thd}
 	case i0 | i2 | i3:
 		return struct {
 			Transaction
+			internal.AddAgentAttributer
 			http.CloseNotifier
 			http.Hijacker
 			io.ReaderFrom
-		}{txn, txn, txn, txn}
+		}{thd, thd, thd, thd, thd}
 	case i1 | i2 | i3:
 		return struct {
 			Transaction
+			internal.AddAgentAttributer
 			http.Flusher
 			http.Hijacker
 			io.ReaderFrom
-		}{txn, txn, txn, txn}
+		}{thd, thd, thd, thd, thd}
 	case i0 | i1 | i2 | i3:
 		return struct {
 			Transaction
+			internal.AddAgentAttributer
 			http.CloseNotifier
 			http.Flusher
 			http.Hijacker
 			io.ReaderFrom
-		}{txn, txn, txn, txn, txn}
+		}{thd, thd, thd, thd, thd, thd}
 	}
 }
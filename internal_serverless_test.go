@@ -0,0 +1,165 @@
+package newrelic
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/internal"
+)
+
+func serverlessConfig() Config {
+	cfg := NewConfig("", "")
+	cfg.ServerlessMode.Enabled = true
+	cfg.ServerlessMode.AccountID = "123"
+	cfg.ServerlessMode.PrimaryAppID = "456"
+	cfg.CrossApplicationTracer.Enabled = false
+	cfg.DistributedTracer.Enabled = true
+	return cfg
+}
+
+func TestServerlessWrite(t *testing.T) {
+	app, err := NewApplication(serverlessConfig())
+	if nil != err {
+		t.Fatal(err)
+	}
+	txn := app.StartTransaction("hello", nil, nil)
+	txn.End()
+
+	buf := &bytes.Buffer{}
+	internal.ServerlessWrite(app, "lambda-arn", buf)
+
+	metadata, data, err := internal.ParseServerlessPayload(buf.Bytes())
+	if nil != err {
+		t.Fatal(err)
+	}
+	if v := string(metadata["arn"]); v != `"lambda-arn"` {
+		t.Error(v)
+	}
+	if v := string(metadata["agent_version"]); v != `"`+Version+`"` {
+		t.Error(v)
+	}
+	for _, cmd := range []string{"metric_data", "analytic_event_data", "span_event_data"} {
+		if _, ok := data[cmd]; !ok {
+			t.Error("missing", cmd)
+		}
+	}
+	if v := string(data["analytic_event_data"]); !strings.Contains(v, `"name":"OtherTransaction/Go/hello"`) {
+		t.Error(v)
+	}
+
+	// The data has been written, so nothing remains for the next write.
+	buf = &bytes.Buffer{}
+	internal.ServerlessWrite(app, "lambda-arn", buf)
+	if 0 != buf.Len() {
+		t.Error(buf.String())
+	}
+}
+
+func TestServerlessDisabledApp(t *testing.T) {
+	cfg := serverlessConfig()
+	cfg.Enabled = false
+	app, err := NewApplication(cfg)
+	if nil != err {
+		t.Fatal(err)
+	}
+	txn := app.StartTransaction("hello", nil, nil)
+	txn.End()
+
+	buf := &bytes.Buffer{}
+	internal.ServerlessWrite(app, "lambda-arn", buf)
+	if 0 != buf.Len() {
+		t.Error(buf.String())
+	}
+}
+
+func TestServerlessShutdownAndWait(t *testing.T) {
+	app, err := NewApplication(serverlessConfig())
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := app.WaitForConnection(time.Nanosecond); nil != err {
+		t.Error(err)
+	}
+	start := time.Now()
+	app.Shutdown(10 * time.Second)
+	if time.Since(start) > 5*time.Second {
+		t.Error("shutdown should not block in serverless mode")
+	}
+}
+
+func TestServerlessDistributedTracingConfigPresent(t *testing.T) {
+	cfgfn := func(cfg *Config) {
+		*cfg = serverlessConfig()
+		cfg.ServerlessMode.TrustedAccountKey = "789"
+	}
+	app := testApp(nil, cfgfn, t)
+	payload := app.StartTransaction("hello", nil, nil).CreateDistributedTracePayload()
+	txn := app.StartTransaction("hello", nil, nil)
+	txn.AcceptDistributedTracePayload(TransportHTTP, payload)
+	txn.End()
+
+	app.ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "DurationByCaller/App/123/456/HTTP/all", Scope: "", Forced: false, Data: nil},
+	})
+}
+
+func TestServerlessDistributedTracingConfigAbsent(t *testing.T) {
+	cfgfn := func(cfg *Config) {
+		*cfg = serverlessConfig()
+		cfg.ServerlessMode.AccountID = ""
+		cfg.ServerlessMode.PrimaryAppID = ""
+	}
+	app := testApp(nil, cfgfn, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	payload := txn.CreateDistributedTracePayload()
+	if "" != payload.Text() {
+		t.Error(payload.Text())
+	}
+}
+
+func TestServerlessApdexThreshold(t *testing.T) {
+	cfgfn := func(cfg *Config) {
+		*cfg = serverlessConfig()
+		cfg.ServerlessMode.ApdexThreshold = 2 * time.Second
+	}
+	app := testApp(nil, cfgfn, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	txn.SetWebRequest(nil)
+	txn.End()
+
+	app.ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "Apdex", Scope: "", Forced: true, Data: []float64{1, 0, 0, 2, 2, 0}},
+	})
+}
+
+func TestServerlessValidate(t *testing.T) {
+	cfg := NewConfig("", "")
+	if err := cfg.Validate(); err != errLicenseLen {
+		t.Error(err)
+	}
+	cfg.ServerlessMode.Enabled = true
+	if err := cfg.Validate(); nil != err {
+		t.Error(err)
+	}
+}
+
+func TestAddAgentAttribute(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	internal.AddAgentAttribute(txn, internal.AttributeAWSRequestID, "request-id", nil)
+	internal.AddAgentAttribute(txn, internal.AttributeAWSLambdaColdStart, "", true)
+	txn.End()
+	internal.AddAgentAttribute(txn, internal.AttributeAWSLambdaARN, "arn", nil)
+
+	app.ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name": "OtherTransaction/Go/hello",
+		},
+		AgentAttributes: map[string]interface{}{
+			AttributeAWSRequestID:       "request-id",
+			AttributeAWSLambdaColdStart: true,
+		},
+	}})
+}
@@ -810,3 +810,63 @@ func TestDatastoreAPICrossAgent(t *testing.T) {
 		}})
 	}
 }
+
+func TestSlowQueryRecordSQL(t *testing.T) {
+	const (
+		rawQuery           = "SELECT * FROM users WHERE name = 'bob' AND age = 21"
+		obfuscatedQuery    = "SELECT * FROM users WHERE name = ? AND age = ?"
+		parameterizedQuery = "SELECT * FROM users WHERE name = ? AND age = ?"
+		replacedQuery      = "'SELECT' on 'users' using 'MySQL'"
+	)
+	testcases := []struct {
+		name          string
+		mode          RecordSQLMode
+		highSecurity  bool
+		policy        string
+		parameterized string
+		expect        string
+	}{
+		{name: "default obfuscates raw", mode: RecordSQLObfuscated, expect: obfuscatedQuery},
+		{name: "unset obfuscates raw", mode: "", expect: obfuscatedQuery},
+		{name: "raw", mode: RecordSQLRaw, expect: rawQuery},
+		{name: "off", mode: RecordSQLOff, expect: replacedQuery},
+		{name: "off parameterized", mode: RecordSQLOff, parameterized: parameterizedQuery, expect: replacedQuery},
+		{name: "obfuscated prefers parameterized", mode: RecordSQLObfuscated, parameterized: "SELECT * FROM users WHERE id = $1", expect: "SELECT * FROM users WHERE id = $1"},
+		{name: "raw prefers raw", mode: RecordSQLRaw, parameterized: "SELECT * FROM users WHERE id = $1", expect: rawQuery},
+		{name: "high security raw", mode: RecordSQLRaw, highSecurity: true, expect: obfuscatedQuery},
+		{name: "policy enabled raw", mode: RecordSQLRaw, policy: "enabled", expect: obfuscatedQuery},
+		{name: "policy disabled", mode: RecordSQLObfuscated, policy: "disabled", expect: replacedQuery},
+	}
+
+	for _, tc := range testcases {
+		cfgfn := func(cfg *Config) {
+			cfg.DatastoreTracer.SlowQuery.Threshold = 0
+			cfg.DatastoreTracer.RecordSQL = tc.mode
+			cfg.HighSecurity = tc.highSecurity
+		}
+		replyfn := func(reply *internal.ConnectReply) {
+			if "" != tc.policy {
+				reply.SecurityPolicies.RecordSQL.SetEnabled("enabled" == tc.policy)
+			}
+		}
+		app := testApp(replyfn, cfgfn, t)
+		txn := app.StartTransaction("hello", nil, nil)
+		s1 := DatastoreSegment{
+			StartTime:          StartSegmentNow(txn),
+			Product:            DatastoreMySQL,
+			Collection:         "users",
+			Operation:          "SELECT",
+			ParameterizedQuery: tc.parameterized,
+			RawQuery:           rawQuery,
+		}
+		s1.End()
+		txn.End()
+
+		app.ExpectSlowQueries(internal.ExtendValidator(t, tc.name), []internal.WantSlowQuery{{
+			Count:      1,
+			MetricName: "Datastore/statement/MySQL/users/SELECT",
+			Query:      tc.expect,
+			TxnName:    "OtherTransaction/Go/hello",
+		}})
+	}
+}
@@ -108,3 +108,98 @@ func TestSpanEventsDisabledWithoutDistributedTracing(t *testing.T) {
 	txn.End()
 	app.ExpectSpanEvents(t, []internal.WantEvent{})
 }
+
+func TestSpanEventUserAttributes(t *testing.T) {
+	replyfn := func(reply *internal.ConnectReply) {
+		reply.AdaptiveSampler = internal.SampleEverything{}
+	}
+	cfgfn := func(cfg *Config) {
+		cfg.DistributedTracer.Enabled = true
+		cfg.CrossApplicationTracer.Enabled = false
+		cfg.SpanEvents.Attributes.Exclude = []string{"excluded"}
+	}
+	app := testApp(replyfn, cfgfn, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	txn.AddSpanAttribute("root", "zip")
+	segment := StartSegment(txn, "mySegment")
+	segment.AddAttribute("segment", 1)
+	segment.AddAttribute("excluded", 2)
+	ds := &DatastoreSegment{
+		StartTime: StartSegmentNow(txn),
+		Product:   DatastoreMySQL,
+		Operation: "SELECT",
+	}
+	txn.AddSpanAttribute("datastore", true)
+	ds.End()
+	segment.End()
+	if err := segment.AddAttribute("late", 3); nil == err {
+		t.Error("attribute added to ended segment")
+	}
+	txn.End()
+	app.ExpectSpanEvents(t, []internal.WantEvent{
+		{
+			Intrinsics: map[string]interface{}{
+				"name":          "OtherTransaction/Go/hello",
+				"sampled":       true,
+				"category":      "generic",
+				"priority":      internal.MatchAnything,
+				"guid":          internal.MatchAnything,
+				"transactionId": internal.MatchAnything,
+				"nr.entryPoint": true,
+				"traceId":       internal.MatchAnything,
+			},
+			UserAttributes:  map[string]interface{}{"root": "zip"},
+			AgentAttributes: map[string]interface{}{},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":          "Datastore/operation/MySQL/SELECT",
+				"sampled":       true,
+				"category":      "datastore",
+				"priority":      internal.MatchAnything,
+				"guid":          internal.MatchAnything,
+				"transactionId": internal.MatchAnything,
+				"traceId":       internal.MatchAnything,
+				"parentId":      internal.MatchAnything,
+				"component":     "MySQL",
+				"span.kind":     "client",
+				"db.statement":  "'SELECT' on 'unknown' using 'MySQL'",
+			},
+			UserAttributes:  map[string]interface{}{"datastore": true},
+			AgentAttributes: map[string]interface{}{},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":          "Custom/mySegment",
+				"sampled":       true,
+				"category":      "generic",
+				"priority":      internal.MatchAnything,
+				"guid":          internal.MatchAnything,
+				"transactionId": internal.MatchAnything,
+				"traceId":       internal.MatchAnything,
+				"parentId":      internal.MatchAnything,
+			},
+			UserAttributes:  map[string]interface{}{"segment": 1},
+			AgentAttributes: map[string]interface{}{},
+		},
+	})
+}
+
+func TestSpanAttributesHighSecurity(t *testing.T) {
+	cfgfn := func(cfg *Config) {
+		cfg.HighSecurity = true
+		cfg.DistributedTracer.Enabled = true
+		cfg.CrossApplicationTracer.Enabled = false
+	}
+	app := testApp(nil, cfgfn, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	if err := txn.AddSpanAttribute("zip", "zap"); err != errHighSecurityEnabled {
+		t.Error(err)
+	}
+	segment := StartSegment(txn, "mySegment")
+	if err := segment.AddAttribute("zip", "zap"); err != errHighSecurityEnabled {
+		t.Error(err)
+	}
+	segment.End()
+	txn.End()
+}
@@ -0,0 +1,264 @@
+// +build go1.10
+
+package newrelic
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/newrelic/go-agent/internal"
+)
+
+// fakeDriver is a driver.Driver whose connections implement the optional
+// context interfaces only if contextMethods is true.
+type fakeDriver struct {
+	contextMethods bool
+}
+
+type fakeConn struct{}
+type fakeConnContext struct{ fakeConn }
+type fakeStmt struct{}
+type fakeTx struct{}
+type fakeRows struct{}
+type fakeResult struct{}
+
+func (d fakeDriver) Open(name string) (driver.Conn, error) {
+	if d.contextMethods {
+		return fakeConnContext{}, nil
+	}
+	return fakeConn{}, nil
+}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+func (fakeConnContext) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return fakeResult{}, nil
+}
+func (fakeConnContext) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return fakeRows{}, nil
+}
+
+func (fakeStmt) Close() error                                    { return nil }
+func (fakeStmt) NumInput() int                                   { return -1 }
+func (fakeStmt) Exec(args []driver.Value) (driver.Result, error) { return fakeResult{}, nil }
+func (fakeStmt) Query(args []driver.Value) (driver.Rows, error)  { return fakeRows{}, nil }
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+func (fakeRows) Columns() []string              { return []string{"id"} }
+func (fakeRows) Close() error                   { return nil }
+func (fakeRows) Next(dest []driver.Value) error { return io.EOF }
+
+func (fakeResult) LastInsertId() (int64, error) { return 0, nil }
+func (fakeResult) RowsAffected() (int64, error) { return 1, nil }
+
+var fakeDriverBuilder = SQLDriverSegmentBuilder{
+	BaseSegment: DatastoreSegment{Product: DatastoreMySQL},
+	ParseQuery: func(s *DatastoreSegment, query string) {
+		fields := strings.Fields(query)
+		s.Operation = strings.ToLower(fields[0])
+		s.Collection = fields[len(fields)-1]
+	},
+	ParseDSN: func(s *DatastoreSegment, dsn string) {
+		s.Host = "db-server-1"
+		s.PortPathOrID = dsn
+	},
+}
+
+func init() {
+	sql.Register("nrfake", InstrumentSQLDriver(fakeDriver{}, fakeDriverBuilder))
+	sql.Register("nrfakecontext", InstrumentSQLDriver(fakeDriver{contextMethods: true}, fakeDriverBuilder))
+}
+
+func sqlDriverMetrics(operation string) []internal.WantMetric {
+	scope := "OtherTransaction/Go/hello"
+	return append([]internal.WantMetric{
+		{Name: "Datastore/all", Scope: "", Forced: true, Data: nil},
+		{Name: "Datastore/allOther", Scope: "", Forced: true, Data: nil},
+		{Name: "Datastore/MySQL/all", Scope: "", Forced: true, Data: nil},
+		{Name: "Datastore/MySQL/allOther", Scope: "", Forced: true, Data: nil},
+		{Name: "Datastore/instance/MySQL/db-server-1/3306", Scope: "", Forced: false, Data: nil},
+		{Name: "Datastore/operation/MySQL/" + operation, Scope: "", Forced: false, Data: nil},
+		{Name: "Datastore/statement/MySQL/users/" + operation, Scope: "", Forced: false, Data: nil},
+		{Name: "Datastore/statement/MySQL/users/" + operation, Scope: scope, Forced: false, Data: nil},
+	}, backgroundMetrics...)
+}
+
+func TestSQLDriverQueryContext(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	ctx := NewContext(context.Background(), txn)
+
+	db, err := sql.Open("nrfakecontext", "3306")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, "SELECT * FROM users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	txn.End()
+
+	app.ExpectMetrics(t, sqlDriverMetrics("select"))
+}
+
+func TestSQLDriverExecContext(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	ctx := NewContext(context.Background(), txn)
+
+	db, err := sql.Open("nrfakecontext", "3306")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, "DELETE FROM users"); err != nil {
+		t.Fatal(err)
+	}
+	txn.End()
+
+	app.ExpectMetrics(t, sqlDriverMetrics("delete"))
+}
+
+func TestSQLDriverPreparedStatement(t *testing.T) {
+	// The connection does not implement driver.ExecerContext, so
+	// database/sql prepares a statement.
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	ctx := NewContext(context.Background(), txn)
+
+	db, err := sql.Open("nrfake", "3306")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, "UPDATE users", 1, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	txn.End()
+
+	app.ExpectMetrics(t, sqlDriverMetrics("update"))
+}
+
+func TestSQLDriverNoTransaction(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, nil)
+
+	db, err := sql.Open("nrfakecontext", "3306")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(context.Background(), "DELETE FROM users"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("DELETE FROM users"); err != nil {
+		t.Fatal(err)
+	}
+	txn.End()
+
+	app.ExpectMetrics(t, backgroundMetrics)
+}
+
+func TestSQLDriverTx(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	ctx := NewContext(context.Background(), txn)
+
+	db, err := sql.Open("nrfake", "3306")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	txn.End()
+
+	scope := "OtherTransaction/Go/hello"
+	app.ExpectMetrics(t, append([]internal.WantMetric{
+		{Name: "Datastore/all", Scope: "", Forced: true, Data: nil},
+		{Name: "Datastore/allOther", Scope: "", Forced: true, Data: nil},
+		{Name: "Datastore/MySQL/all", Scope: "", Forced: true, Data: nil},
+		{Name: "Datastore/MySQL/allOther", Scope: "", Forced: true, Data: nil},
+		{Name: "Datastore/instance/MySQL/db-server-1/3306", Scope: "", Forced: false, Data: nil},
+		{Name: "Datastore/operation/MySQL/COMMIT", Scope: "", Forced: false, Data: nil},
+		{Name: "Datastore/operation/MySQL/COMMIT", Scope: scope, Forced: false, Data: nil},
+	}, backgroundMetrics...))
+}
+
+func TestSQLDriverBeginTxUnsupportedOptions(t *testing.T) {
+	db, err := sql.Open("nrfake", "3306")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != errReadOnlyUnsupported {
+		t.Error(err)
+	}
+}
+
+func TestSQLDriverSlowQuery(t *testing.T) {
+	cfgfn := func(cfg *Config) {
+		cfg.DatastoreTracer.SlowQuery.Threshold = 0
+	}
+	app := testApp(nil, cfgfn, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	ctx := NewContext(context.Background(), txn)
+
+	db, err := sql.Open("nrfakecontext", "3306")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, "SELECT * FROM users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	txn.End()
+
+	app.ExpectSlowQueries(t, []internal.WantSlowQuery{{
+		Count:        1,
+		MetricName:   "Datastore/statement/MySQL/users/select",
+		Query:        "SELECT * FROM users",
+		TxnName:      "OtherTransaction/Go/hello",
+		TxnURL:       "",
+		DatabaseName: "",
+		Host:         "db-server-1",
+		PortPathOrID: "3306",
+	}})
+}
+
+func TestInstrumentSQLConnector(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	ctx := NewContext(context.Background(), txn)
+
+	bld := fakeDriverBuilder
+	bld.BaseSegment.Host = "db-server-1"
+	bld.BaseSegment.PortPathOrID = "3306"
+	connector := dsnConnector{dsn: "3306", driver: fakeDriver{contextMethods: true}}
+	db := sql.OpenDB(InstrumentSQLConnector(connector, bld))
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, "INSERT INTO users"); err != nil {
+		t.Fatal(err)
+	}
+	txn.End()
+
+	app.ExpectMetrics(t, sqlDriverMetrics("insert"))
+}
@@ -5,6 +5,7 @@ import (
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
@@ -432,6 +433,64 @@ func TestSetName(t *testing.T) {
 	app.ExpectMetrics(t, backgroundMetrics)
 }
 
+func TestSetNameLocalRules(t *testing.T) {
+	cfgfn := func(cfg *Config) {
+		cfg.TransactionNaming.Rules = []TransactionNamingRule{
+			{MatchExpression: "^OtherTransaction/Go/users/[0-9]+$", Replacement: "OtherTransaction/Go/users/{id}"},
+			{MatchExpression: "/health$", Ignore: true},
+		}
+	}
+	app := testApp(nil, cfgfn, t)
+	txn := app.StartTransaction("one", nil, nil)
+	txn.SetName("users/123")
+	txn.End()
+	txn = app.StartTransaction("health", nil, nil)
+	txn.End()
+
+	app.ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name": "OtherTransaction/Go/users/{id}",
+		},
+	}})
+}
+
+func TestInvalidLocalRules(t *testing.T) {
+	cfg := NewConfig("my app", testLicenseKey)
+	cfg.TransactionNaming.Rules = []TransactionNamingRule{{MatchExpression: "("}}
+	if _, err := NewApplication(cfg); nil == err {
+		t.Error("invalid rule accepted")
+	}
+}
+
+func TestTransactionNamesLimited(t *testing.T) {
+	cfgfn := func(cfg *Config) { cfg.TransactionNaming.MaxNamesPerPrefix = 1 }
+	testapp := testApp(nil, cfgfn, t)
+	for _, name := range []string{"users/1", "users/2", "users/1", "users/3", "important"} {
+		testapp.StartTransaction(name, nil, nil).End()
+	}
+
+	testapp.ExpectTxnEvents(t, []internal.WantEvent{
+		{Intrinsics: map[string]interface{}{"name": "OtherTransaction/Go/users/1"}},
+		{Intrinsics: map[string]interface{}{"name": "OtherTransaction/Go/users/other"}},
+		{Intrinsics: map[string]interface{}{"name": "OtherTransaction/Go/users/1"}},
+		{Intrinsics: map[string]interface{}{"name": "OtherTransaction/Go/users/other"}},
+		{Intrinsics: map[string]interface{}{"name": "OtherTransaction/Go/important"}},
+	})
+	a := testapp.(*app)
+	a.nameLimiter.MergeIntoHarvest(a.testHarvest)
+	testapp.ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "Supportability/Go/TransactionNames/Limited/OtherTransaction/Go/users", Scope: "", Forced: true, Data: []float64{2, 0, 0, 0, 0, 0}},
+		{Name: "OtherTransaction/Go/users/other", Scope: "", Forced: true, Data: nil},
+	})
+}
+
+func TestTransactionNamesNotLimitedByDefault(t *testing.T) {
+	testapp := testApp(nil, nil, t)
+	if a := testapp.(*app); nil != a.nameLimiter {
+		t.Error(a.nameLimiter)
+	}
+}
+
 func deferEndPanic(txn Transaction, panicMe interface{}) (r interface{}) {
 	defer func() {
 		r = recover()
@@ -927,6 +986,68 @@ func TestTraceSegmentOutOfOrder(t *testing.T) {
 	}, webMetrics...))
 }
 
+func TestTraceSegmentNewGoroutine(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, helloRequest)
+	s1 := StartSegment(txn, "s1")
+	txn2 := txn.NewGoroutine()
+	s2 := StartSegment(txn2, "s2")
+	// Segments of different goroutines may be ended in any order.
+	if err := s1.End(); nil != err {
+		t.Error(err)
+	}
+	if err := s2.End(); nil != err {
+		t.Error(err)
+	}
+	txn.End()
+	scope := "WebTransaction/Go/hello"
+	app.ExpectMetrics(t, append([]internal.WantMetric{
+		{Name: "Custom/s1", Scope: "", Forced: false, Data: nil},
+		{Name: "Custom/s1", Scope: scope, Forced: false, Data: nil},
+		{Name: "Custom/s2", Scope: "", Forced: false, Data: nil},
+		{Name: "Custom/s2", Scope: scope, Forced: false, Data: nil},
+	}, webMetrics...))
+}
+
+func TestTraceSegmentConcurrentGoroutines(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, helloRequest)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(txn Transaction) {
+			defer wg.Done()
+			s := StartSegment(txn, "async")
+			StartSegment(txn, "inner").End()
+			if err := s.End(); nil != err {
+				t.Error(err)
+			}
+		}(txn.NewGoroutine())
+	}
+	wg.Wait()
+	txn.End()
+	scope := "WebTransaction/Go/hello"
+	app.ExpectMetrics(t, append([]internal.WantMetric{
+		{Name: "Custom/async", Scope: "", Forced: false, Data: nil},
+		{Name: "Custom/async", Scope: scope, Forced: false, Data: nil},
+		{Name: "Custom/inner", Scope: "", Forced: false, Data: nil},
+		{Name: "Custom/inner", Scope: scope, Forced: false, Data: nil},
+	}, webMetrics...))
+}
+
+func TestNewGoroutineTxnEnded(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, helloRequest)
+	txn.End()
+	txn2 := txn.NewGoroutine()
+	if err := StartSegment(txn2, "segment").End(); err != errAlreadyEnded {
+		t.Error(err)
+	}
+	if err := txn2.End(); err != errAlreadyEnded {
+		t.Error(err)
+	}
+}
+
 func TestTraceSegmentEndedBeforeStartSegment(t *testing.T) {
 	app := testApp(nil, nil, t)
 	txn := app.StartTransaction("hello", nil, helloRequest)
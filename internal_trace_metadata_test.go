@@ -0,0 +1,108 @@
+package newrelic
+
+import (
+	"testing"
+
+	"github.com/newrelic/go-agent/internal"
+)
+
+func TestTraceMetadata(t *testing.T) {
+	replyfn := func(reply *internal.ConnectReply) {
+		distributedTracingReplyFields(reply)
+		reply.EntityGUID = "entity-guid"
+	}
+	cfgfn := func(cfg *Config) {
+		enableBetterCAT(cfg)
+		cfg.AppName = "my app;other app"
+	}
+	app := testApp(replyfn, cfgfn, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	root := txn.GetTraceMetadata()
+	if "" == root.TraceID || "" == root.SpanID {
+		t.Fatal(root)
+	}
+	segment := StartSegment(txn, "mySegment")
+	inSegment := txn.GetTraceMetadata()
+	if inSegment.TraceID != root.TraceID {
+		t.Error(inSegment.TraceID, root.TraceID)
+	}
+	if inSegment.SpanID == root.SpanID || "" == inSegment.SpanID {
+		t.Error(inSegment.SpanID, root.SpanID)
+	}
+	segment.End()
+	if after := txn.GetTraceMetadata(); after != root {
+		t.Error(after, root)
+	}
+	link := txn.GetLinkingMetadata()
+	if link != (LinkingMetadata{
+		TraceID:    root.TraceID,
+		SpanID:     root.SpanID,
+		EntityName: "my app",
+		EntityType: "SERVICE",
+		EntityGUID: "entity-guid",
+		Hostname:   internal.ThisHost,
+	}) {
+		t.Error(link)
+	}
+	txn.End()
+	app.ExpectSpanEvents(t, []internal.WantEvent{
+		{
+			Intrinsics: map[string]interface{}{
+				"name":          "OtherTransaction/Go/hello",
+				"sampled":       true,
+				"category":      "generic",
+				"priority":      internal.MatchAnything,
+				"guid":          root.SpanID,
+				"transactionId": internal.MatchAnything,
+				"nr.entryPoint": true,
+				"traceId":       root.TraceID,
+			},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":          "Custom/mySegment",
+				"sampled":       true,
+				"category":      "generic",
+				"priority":      internal.MatchAnything,
+				"guid":          inSegment.SpanID,
+				"transactionId": internal.MatchAnything,
+				"traceId":       root.TraceID,
+				"parentId":      root.SpanID,
+			},
+		},
+	})
+}
+
+func TestTraceMetadataInboundPayload(t *testing.T) {
+	app := testApp(distributedTracingReplyFields, enableBetterCAT, t)
+	payload := makePayload(app, nil)
+	txn := app.StartTransaction("hello", nil, nil)
+	if err := txn.AcceptDistributedTracePayload(TransportHTTP, payload); nil != err {
+		t.Fatal(err)
+	}
+	md := txn.GetTraceMetadata()
+	if md.TraceID != payload.(internal.Payload).TracedID {
+		t.Error(md.TraceID, payload)
+	}
+}
+
+func TestTraceMetadataSpanEventsDisabled(t *testing.T) {
+	app := testApp(distributedTracingReplyFields, disableSpanEvents, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	md := txn.GetTraceMetadata()
+	if "" == md.TraceID || "" != md.SpanID {
+		t.Error(md)
+	}
+}
+
+func TestTraceMetadataDistributedTracingDisabled(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	if md := txn.GetTraceMetadata(); md != (TraceMetadata{}) {
+		t.Error(md)
+	}
+	link := txn.GetLinkingMetadata()
+	if "" != link.TraceID || "" != link.SpanID || "my app" != link.EntityName || "SERVICE" != link.EntityType {
+		t.Error(link)
+	}
+}
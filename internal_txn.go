@@ -21,6 +21,11 @@ type txnInput struct {
 	Reply      *internal.ConnectReply
 	Consumer   dataConsumer
 	attrConfig *internal.AttributeConfig
+	// traceObserver is non-nil when infinite tracing is enabled.
+	traceObserver *internal.TraceObserver
+	// nameLimiter is non-nil when the number of distinct transaction
+	// names is limited.
+	nameLimiter *internal.TxnNameLimiter
 }
 
 type txn struct {
@@ -36,14 +41,41 @@ type txn struct {
 
 	ignore bool
 
+	// namePrefix is set for transactions started using
+	// StartBackgroundTransaction or StartMessageTransaction.  It replaces
+	// the default "OtherTransaction/Go" prefix of the transaction name, and
+	// these transactions remain background transactions even if
+	// SetWebRequest is called.
+	namePrefix string
+
 	// wroteHeader prevents capturing multiple response code errors if the
 	// user erroneously calls WriteHeader multiple times.
 	wroteHeader bool
 
+	// injector buffers the beginning of HTML responses when
+	// Config.BrowserMonitoring.AutoInstrument is enabled.
+	// injectionFinished is set once the response is no longer buffered.
+	injector          *browserInjector
+	injectionFinished bool
+
+	// mainThread tracks the segments of the goroutine that started the
+	// transaction.
+	mainThread internal.Thread
+
 	internal.TxnData
 }
 
-func newTxn(input txnInput, name string) *txn {
+// thread is the Transaction implementation.  Every goroutine using a
+// transaction has its own thread so that its segments are tracked on a
+// separate segment stack.
+type thread struct {
+	*txn
+	// thread does not have locking because it should only be accessed
+	// while the txn is locked.
+	thread *internal.Thread
+}
+
+func newTxn(input txnInput, name string) *thread {
 	txn := &txn{
 		txnInput: input,
 	}
@@ -57,6 +89,7 @@ func newTxn(input txnInput, name string) *txn {
 		txn.BetterCAT.ID = internal.NewSpanID()
 		txn.SpanEventsEnabled = txn.Config.SpanEvents.Enabled && txn.Reply.CollectSpanEvents
 		txn.LazilyCalculateSampled = txn.lazilyCalculateSampled
+		txn.TraceObserver = input.traceObserver
 	}
 
 	txn.Attrs.Agent.Add(internal.AttributeHostDisplayName, txn.Config.HostDisplayName, nil)
@@ -74,7 +107,10 @@ func newTxn(input txnInput, name string) *txn {
 	noGUID := txn.Config.DistributedTracer.Enabled
 	txn.CrossProcess.Init(doOldCAT, noGUID, input.Reply)
 
-	return txn
+	return &thread{
+		txn:    txn,
+		thread: &txn.mainThread,
+	}
 }
 
 // lazilyCalculateSampled calculates and returns whether or not the transaction
@@ -121,17 +157,22 @@ func (txn *txn) SetWebRequest(r WebRequest) error {
 		return errAlreadyEnded
 	}
 
-	// Any call to SetWebRequest should indicate a web transaction.
-	txn.IsWeb = true
+	// Any call to SetWebRequest should indicate a web transaction, unless
+	// the transaction was explicitly started as a background transaction.
+	if "" == txn.namePrefix {
+		txn.IsWeb = true
+	}
 
 	if nil == r {
 		return nil
 	}
 	if h := r.Header(); nil != h {
-		txn.Queuing = internal.QueueDuration(h, txn.Start)
+		if txn.IsWeb {
+			txn.Queuing = internal.QueueDuration(h, txn.Start)
+		}
 
-		if p := h.Get(DistributedTracePayloadHeader); p != "" {
-			txn.acceptDistributedTracePayloadLocked(r.Transport(), p)
+		if "" != h.Get(DistributedTraceW3CTraceParentHeader) || "" != h.Get(DistributedTracePayloadHeader) {
+			txn.acceptDistributedTracePayloadLocked(r.Transport(), h)
 		}
 
 		txn.CrossProcess.InboundHTTPRequest(h)
@@ -142,7 +183,8 @@ func (txn *txn) SetWebRequest(r WebRequest) error {
 	return nil
 }
 
-func (txn *txn) SetWebResponse(w http.ResponseWriter) Transaction {
+func (thd *thread) SetWebResponse(w http.ResponseWriter) Transaction {
+	txn := thd.txn
 	txn.Lock()
 	defer txn.Unlock()
 
@@ -151,7 +193,7 @@ func (txn *txn) SetWebResponse(w http.ResponseWriter) Transaction {
 	// data flowing through as expected.
 	txn.writer = w
 
-	return upgradeTxn(txn)
+	return upgradeTxn(thd)
 }
 
 func (txn *txn) slowQueriesEnabled() bool {
@@ -179,10 +221,16 @@ func (txn *txn) freezeName() {
 		return
 	}
 
-	txn.FinalName = internal.CreateFullTxnName(txn.Name, txn.Reply, txn.IsWeb)
+	prefix := txn.namePrefix
+	if "" == prefix {
+		prefix = internal.TxnNamePrefix(txn.IsWeb)
+	}
+	txn.FinalName = internal.CreateFullTxnNameWithPrefix(txn.Name, prefix, txn.Reply)
 	if "" == txn.FinalName {
 		txn.ignore = true
+		return
 	}
+	txn.FinalName = txn.nameLimiter.Limit(txn.FinalName, prefix)
 }
 
 func (txn *txn) getsApdex() bool {
@@ -190,6 +238,9 @@ func (txn *txn) getsApdex() bool {
 }
 
 func (txn *txn) txnTraceThreshold() time.Duration {
+	if d := txn.Config.TransactionTracer.BackgroundThreshold; 0 != d && !txn.IsWeb {
+		return d
+	}
 	if txn.Config.TransactionTracer.Threshold.IsApdexFailing {
 		return internal.ApdexFailingThreshold(txn.ApdexThreshold)
 	}
@@ -246,7 +297,9 @@ func (txn *txn) MergeIntoHarvest(h *internal.Harvest) {
 		h.SlowSQLs.Merge(txn.SlowQueries, txn.TxnEvent)
 	}
 
-	if txn.BetterCAT.Sampled && txn.SpanEventsEnabled {
+	// When infinite tracing is enabled the span events have already been
+	// sent to the trace observer.
+	if txn.BetterCAT.Sampled && txn.SpanEventsEnabled && nil == txn.TraceObserver {
 		h.SpanEvents.MergeFromTransaction(&txn.TxnData)
 	}
 }
@@ -263,6 +316,15 @@ func responseCodeIsError(cfg *Config, code int) bool {
 	return true
 }
 
+func responseCodeIsExpected(cfg *Config, code int) bool {
+	for _, expectCode := range cfg.ErrorCollector.ExpectStatusCodes {
+		if code == expectCode {
+			return true
+		}
+	}
+	return false
+}
+
 func headersJustWritten(txn *txn, code int, hdr http.Header) {
 	txn.Lock()
 	defer txn.Unlock()
@@ -280,7 +342,10 @@ func headersJustWritten(txn *txn, code int, hdr http.Header) {
 
 	if responseCodeIsError(&txn.Config, code) {
 		e := internal.TxnErrorFromResponseCode(time.Now(), code)
-		e.Stack = internal.GetStackTrace(1)
+		// Skip txn.write or txn.writeHeader so that the stack
+		// trace begins with the Transaction method.
+		e.Stack = internal.GetStackTrace(2)
+		e.Expected = responseCodeIsExpected(&txn.Config, code)
 		txn.noticeErrorInternal(e)
 	}
 }
@@ -351,6 +416,22 @@ func (txn *txn) Header() http.Header {
 }
 
 func (txn *txn) Write(b []byte) (n int, err error) {
+	if inj := txn.getInjector(); nil != inj {
+		return txn.injectorWrite(inj, b)
+	}
+	return txn.write(b)
+}
+
+func (txn *txn) WriteHeader(code int) {
+	if inj := txn.getInjector(); nil != inj && inj.deferWriteHeader(code) {
+		return
+	}
+	txn.writeHeader(code)
+}
+
+// write and writeHeader write to the ResponseWriter and record the response
+// code.  They are used directly once browser injection has finished.
+func (txn *txn) write(b []byte) (n int, err error) {
 	rw := txn.getWriter()
 	hdr := nilSafeHeader(rw)
 
@@ -367,7 +448,7 @@ func (txn *txn) Write(b []byte) (n int, err error) {
 	return
 }
 
-func (txn *txn) WriteHeader(code int) {
+func (txn *txn) writeHeader(code int) {
 	rw := txn.getWriter()
 	hdr := nilSafeHeader(rw)
 
@@ -381,6 +462,10 @@ func (txn *txn) WriteHeader(code int) {
 }
 
 func (txn *txn) End() error {
+	// Write any response buffered for browser injection before the
+	// transaction is locked and finished.
+	txn.finishInjection()
+
 	txn.Lock()
 	defer txn.Unlock()
 
@@ -399,11 +484,15 @@ func (txn *txn) End() error {
 
 	txn.Stop = time.Now()
 	txn.Duration = txn.Stop.Sub(txn.Start)
-	if children := internal.TracerRootChildren(&txn.TxnData); txn.Duration > children {
+	// Segments of goroutines created with NewGoroutine run concurrently
+	// with the transaction: only the main thread's segments are subtracted
+	// to avoid counting concurrent time twice.
+	if children := internal.TracerRootChildren(&txn.mainThread); txn.Duration > children {
 		txn.Exclusive = txn.Duration - children
 	}
 
 	txn.freezeName()
+	txn.groupErrors()
 	// Make a sampling decision if there have been no segments or outbound
 	// payloads.
 	txn.lazilyCalculateSampled()
@@ -439,6 +528,9 @@ func (txn *txn) End() error {
 	}
 
 	if !txn.ignore {
+		if txn.BetterCAT.Sampled && txn.SpanEventsEnabled {
+			txn.ObserveRootSpanEvent()
+		}
 		txn.Consumer.Consume(txn.Reply.RunID, txn)
 	}
 
@@ -455,19 +547,62 @@ func (txn *txn) AddAttribute(name string, value interface{}) error {
 	txn.Lock()
 	defer txn.Unlock()
 
+	if err := txn.userAttributesAllowed(); nil != err {
+		return err
+	}
+
+	return internal.AddUserAttribute(txn.Attrs, name, value, internal.DestAll)
+}
+
+// userAttributesAllowed returns an error if custom attributes are disabled.
+func (txn *txn) userAttributesAllowed() error {
 	if txn.Config.HighSecurity {
 		return errHighSecurityEnabled
 	}
-
 	if !txn.Reply.SecurityPolicies.CustomParameters.Enabled() {
 		return errSecurityPolicy
 	}
-
 	if txn.finished {
 		return errAlreadyEnded
 	}
+	return nil
+}
 
-	return internal.AddUserAttribute(txn.Attrs, name, value, internal.DestAll)
+func (thd *thread) AddSpanAttribute(name string, value interface{}) error {
+	txn := thd.txn
+	txn.Lock()
+	defer txn.Unlock()
+
+	if err := txn.userAttributesAllowed(); nil != err {
+		return err
+	}
+	return internal.AddSpanAttribute(&txn.TxnData, thd.thread, name, value)
+}
+
+func addSegmentAttribute(start SegmentStartTime, name string, value interface{}) error {
+	thd := start.thread
+	if nil == thd {
+		return nil
+	}
+	txn := thd.txn
+	txn.Lock()
+	defer txn.Unlock()
+
+	if err := txn.userAttributesAllowed(); nil != err {
+		return err
+	}
+	return internal.AddSegmentAttribute(&txn.TxnData, thd.thread, start.start, name, value)
+}
+
+// AddAgentAttribute implements internal.AddAgentAttributer.
+func (txn *txn) AddAgentAttribute(id internal.AgentAttributeID, stringVal string, otherVal interface{}) {
+	txn.Lock()
+	defer txn.Unlock()
+
+	if txn.finished {
+		return
+	}
+	txn.Attrs.Agent.Add(id, stringVal, otherVal)
 }
 
 var (
@@ -485,6 +620,41 @@ const (
 	securityPolicyErrorMsg = "message removed by security policy"
 )
 
+// errorExpected returns whether the error class or message is configured as
+// expected.
+func (txn *txn) errorExpected(err internal.ErrorData) bool {
+	for _, class := range txn.Config.ErrorCollector.ExpectClasses {
+		if err.Klass == class {
+			return true
+		}
+	}
+	for _, msg := range txn.Config.ErrorCollector.ExpectMessages[err.Klass] {
+		if err.Msg == msg {
+			return true
+		}
+	}
+	return false
+}
+
+// groupErrors names the group of each error using the error group callback.
+// It must be called after the transaction name is frozen.
+func (txn *txn) groupErrors() {
+	callback := txn.Config.ErrorCollector.ErrorGroupCallback
+	for _, e := range txn.Errors {
+		if nil != callback {
+			e.GroupName = callback(ErrorInfo{
+				Error:           e.Err,
+				TransactionName: txn.FinalName,
+				Message:         e.Msg,
+				Class:           e.Klass,
+				Expected:        e.Expected,
+			})
+		}
+		// Release the error now that the callback is done with it.
+		e.Err = nil
+	}
+}
+
 func (txn *txn) noticeErrorInternal(err internal.ErrorData) error {
 	if !txn.Config.ErrorCollector.Enabled {
 		return errorsLocallyDisabled
@@ -498,16 +668,28 @@ func (txn *txn) noticeErrorInternal(err internal.ErrorData) error {
 		txn.Errors = internal.NewTxnErrors(internal.MaxTxnErrors)
 	}
 
+	if !err.Expected {
+		err.Expected = txn.errorExpected(err)
+	}
+
+	redactor := txn.attrConfig.Redactor()
+	err.Msg = redactor.Redact(err.Msg)
+	err.Chain = redactor.Redact(err.Chain)
+
 	if txn.Config.HighSecurity {
 		err.Msg = highSecurityErrorMsg
+		err.Chain = ""
 	}
 
 	if !txn.Reply.SecurityPolicies.AllowRawExceptionMessages.Enabled() {
 		err.Msg = securityPolicyErrorMsg
+		err.Chain = ""
 	}
 
 	txn.Errors.Add(err)
-	txn.TxnData.TxnEvent.HasError = true //mark transaction as having an error
+	if !err.Expected {
+		txn.TxnData.TxnEvent.HasError = true //mark transaction as having an error
+	}
 	return nil
 }
 
@@ -531,35 +713,71 @@ func (txn *txn) NoticeError(err error) error {
 	e := internal.ErrorData{
 		When: time.Now(),
 		Msg:  err.Error(),
-	}
-	if ec, ok := err.(ErrorClasser); ok {
-		e.Klass = ec.ErrorClass()
+		Err:  err,
+	}
+
+	// The error may wrap other errors.  The outermost layer implementing
+	// ErrorExpecter decides whether the error is expected, while the
+	// innermost class and stack trace are the most specific.
+	chain := errorChain(err)
+	expecterFound := false
+	for _, layer := range chain {
+		if ee, ok := layer.(ErrorExpecter); ok && !expecterFound {
+			e.Expected = ee.ErrorExpected()
+			expecterFound = true
+		}
+		if ec, ok := layer.(ErrorClasser); ok {
+			if class := ec.ErrorClass(); "" != class {
+				e.Klass = class
+			}
+		}
+		if st, ok := layer.(StackTracer); ok {
+			if stack := st.StackTrace(); nil != stack {
+				e.Stack = stack
+				// Note that if the provided stack trace is
+				// excessive in length, it will be truncated
+				// during JSON creation.
+			}
+		}
 	}
 	if "" == e.Klass {
-		e.Klass = reflect.TypeOf(err).String()
-	}
-	if st, ok := err.(StackTracer); ok {
-		e.Stack = st.StackTrace()
-		// Note that if the provided stack trace is excessive in length,
-		// it will be truncated during JSON creation.
+		e.Klass = reflect.TypeOf(chain[len(chain)-1]).String()
 	}
 	if nil == e.Stack {
 		e.Stack = internal.GetStackTrace(2)
 	}
-
-	if ea, ok := err.(ErrorAttributer); ok && !txn.Config.HighSecurity && txn.Reply.SecurityPolicies.CustomParameters.Enabled() {
-		unvetted := ea.ErrorAttributes()
-		if len(unvetted) > internal.AttributeErrorLimit {
-			return errTooManyErrorAttributes
+	if len(chain) > 1 {
+		msgs := make([]string, len(chain))
+		for i, layer := range chain {
+			msgs[i] = layer.Error()
 		}
+		e.Chain = internal.StringLengthByteLimit(strings.Join(msgs, "\n"), internal.ErrorChainByteLimit)
+	}
 
-		e.ExtraAttributes = make(map[string]interface{})
-		for key, val := range unvetted {
-			val, errr := internal.ValidateUserAttribute(key, val)
-			if nil != errr {
-				return errr
+	if !txn.Config.HighSecurity && txn.Reply.SecurityPolicies.CustomParameters.Enabled() {
+		// Attributes of outer layers take precedence over those of
+		// the errors they wrap.
+		for _, layer := range chain {
+			ea, ok := layer.(ErrorAttributer)
+			if !ok {
+				continue
+			}
+			for key, val := range ea.ErrorAttributes() {
+				if _, ok := e.ExtraAttributes[key]; ok {
+					continue
+				}
+				val, errr := internal.ValidateUserAttribute(key, txn.attrConfig.Redactor().RedactValue(val))
+				if nil != errr {
+					return errr
+				}
+				if nil == e.ExtraAttributes {
+					e.ExtraAttributes = make(map[string]interface{})
+				}
+				if len(e.ExtraAttributes) >= internal.AttributeErrorLimit {
+					return errTooManyErrorAttributes
+				}
+				e.ExtraAttributes[key] = val
 			}
-			e.ExtraAttributes[key] = val
 		}
 	}
 
@@ -589,21 +807,39 @@ func (txn *txn) Ignore() error {
 	return nil
 }
 
-func (txn *txn) StartSegmentNow() SegmentStartTime {
+func (thd *thread) StartSegmentNow() SegmentStartTime {
 	var s internal.SegmentStartTime
+	txn := thd.txn
 	txn.Lock()
 	if !txn.finished {
-		s = internal.StartSegment(&txn.TxnData, time.Now())
+		s = internal.StartSegment(&txn.TxnData, thd.thread, time.Now())
 	}
 	txn.Unlock()
 	return SegmentStartTime{
 		segment: segment{
-			start: s,
-			txn:   txn,
+			start:  s,
+			thread: thd,
 		},
 	}
 }
 
+func (thd *thread) NewGoroutine() Transaction {
+	txn := thd.txn
+	txn.Lock()
+	defer txn.Unlock()
+
+	if txn.finished {
+		// Segments started on a finished transaction are never
+		// recorded, so the same thread may be safely returned.
+		return upgradeTxn(thd)
+	}
+
+	return upgradeTxn(&thread{
+		txn:    txn,
+		thread: internal.NewThread(&txn.TxnData),
+	})
+}
+
 const (
 	// Browser fields are encoded using the first digits of the license
 	// key.
@@ -622,6 +858,10 @@ func (txn *txn) BrowserTimingHeader() (*BrowserTimingHeader, error) {
 	txn.Lock()
 	defer txn.Unlock()
 
+	return txn.browserTimingHeaderLocked()
+}
+
+func (txn *txn) browserTimingHeaderLocked() (*BrowserTimingHeader, error) {
 	if !txn.Config.BrowserMonitoring.Enabled {
 		return nil, errBrowserDisabled
 	}
@@ -673,37 +913,69 @@ func (txn *txn) BrowserTimingHeader() (*BrowserTimingHeader, error) {
 }
 
 type segment struct {
-	start internal.SegmentStartTime
-	txn   *txn
+	start  internal.SegmentStartTime
+	thread *thread
 }
 
 func endSegment(s *Segment) error {
 	if nil == s {
 		return nil
 	}
-	txn := s.StartTime.txn
-	if nil == txn {
+	thd := s.StartTime.thread
+	if nil == thd {
 		return nil
 	}
+	txn := thd.txn
 	var err error
 	txn.Lock()
 	if txn.finished {
 		err = errAlreadyEnded
 	} else {
-		err = internal.EndBasicSegment(&txn.TxnData, s.StartTime.start, time.Now(), s.Name)
+		err = internal.EndBasicSegment(&txn.TxnData, thd.thread, s.StartTime.start, time.Now(), s.Name)
 	}
 	txn.Unlock()
 	return err
 }
 
+// datastoreQuery returns the query of the segment that should be recorded.
+func (txn *txn) datastoreQuery(s *DatastoreSegment) string {
+	mode := txn.Config.DatastoreTracer.RecordSQL
+	if txn.Config.HighSecurity && RecordSQLRaw == mode {
+		mode = RecordSQLObfuscated
+	}
+	if policy := txn.Reply.SecurityPolicies.RecordSQL; policy.IsSet() {
+		if !policy.Enabled() {
+			mode = RecordSQLOff
+		} else if RecordSQLRaw == mode {
+			mode = RecordSQLObfuscated
+		}
+	}
+
+	switch mode {
+	case RecordSQLOff:
+		return ""
+	case RecordSQLRaw:
+		if "" != s.RawQuery {
+			return s.RawQuery
+		}
+		return s.ParameterizedQuery
+	default:
+		if "" != s.ParameterizedQuery || "" == s.RawQuery {
+			return s.ParameterizedQuery
+		}
+		return internal.ObfuscateSQL(s.RawQuery, string(s.Product))
+	}
+}
+
 func endDatastore(s *DatastoreSegment) error {
 	if nil == s {
 		return nil
 	}
-	txn := s.StartTime.txn
-	if nil == txn {
+	thd := s.StartTime.thread
+	if nil == thd {
 		return nil
 	}
+	txn := thd.txn
 	txn.Lock()
 	defer txn.Unlock()
 
@@ -718,9 +990,6 @@ func endDatastore(s *DatastoreSegment) error {
 	}
 	if txn.Reply.SecurityPolicies.RecordSQL.IsSet() {
 		s.QueryParameters = nil
-		if !txn.Reply.SecurityPolicies.RecordSQL.Enabled() {
-			s.ParameterizedQuery = ""
-		}
 	}
 	if !txn.Config.DatastoreTracer.DatabaseNameReporting.Enabled {
 		s.DatabaseName = ""
@@ -731,12 +1000,13 @@ func endDatastore(s *DatastoreSegment) error {
 	}
 	return internal.EndDatastoreSegment(internal.EndDatastoreParams{
 		Tracer:             &txn.TxnData,
+		Thread:             thd.thread,
 		Start:              s.StartTime.start,
 		Now:                time.Now(),
 		Product:            string(s.Product),
 		Collection:         s.Collection,
 		Operation:          s.Operation,
-		ParameterizedQuery: s.ParameterizedQuery,
+		ParameterizedQuery: txn.datastoreQuery(s),
 		QueryParameters:    s.QueryParameters,
 		Host:               s.Host,
 		PortPathOrID:       s.PortPathOrID,
@@ -744,6 +1014,33 @@ func endDatastore(s *DatastoreSegment) error {
 	})
 }
 
+func endMessage(s *MessageProducerSegment) error {
+	if nil == s {
+		return nil
+	}
+	thd := s.StartTime.thread
+	if nil == thd {
+		return nil
+	}
+	txn := thd.txn
+	txn.Lock()
+	defer txn.Unlock()
+
+	if txn.finished {
+		return errAlreadyEnded
+	}
+	return internal.EndMessageSegment(internal.EndMessageParams{
+		Tracer:          &txn.TxnData,
+		Thread:          thd.thread,
+		Start:           s.StartTime.start,
+		Now:             time.Now(),
+		Library:         s.Library,
+		DestinationType: string(s.DestinationType),
+		DestinationName: s.DestinationName,
+		DestinationTemp: s.DestinationTemporary,
+	})
+}
+
 func externalSegmentMethod(s *ExternalSegment) string {
 	r := s.Request
 
@@ -782,10 +1079,11 @@ func endExternal(s *ExternalSegment) error {
 	if nil == s {
 		return nil
 	}
-	txn := s.StartTime.txn
-	if nil == txn {
+	thd := s.StartTime.thread
+	if nil == thd {
 		return nil
 	}
+	txn := thd.txn
 	txn.Lock()
 	defer txn.Unlock()
 
@@ -797,7 +1095,8 @@ func endExternal(s *ExternalSegment) error {
 	if nil != err {
 		return err
 	}
-	return internal.EndExternalSegment(&txn.TxnData, s.StartTime.start, time.Now(), u, m, s.Response)
+	now := time.Now()
+	return internal.EndExternalSegmentWithTiming(&txn.TxnData, thd.thread, s.StartTime.start, now, u, m, s.Response, s.clientTrace.timing(now))
 }
 
 // oldCATOutboundHeaders generates the Old CAT and Synthetics headers, depending
@@ -826,24 +1125,41 @@ func oldCATOutboundHeaders(txn *txn) http.Header {
 }
 
 func outboundHeaders(s *ExternalSegment) http.Header {
-	txn := s.StartTime.txn
+	thd := s.StartTime.thread
 
-	if nil == txn {
+	if nil == thd {
 		return http.Header{}
 	}
 
-	hdr := oldCATOutboundHeaders(txn)
+	hdr := oldCATOutboundHeaders(thd.txn)
 
 	// hdr may be empty, or it may contain headers.  If DistributedTracer
 	// is enabled, add more to the existing hdr
-	if p := txn.CreateDistributedTracePayload().HTTPSafe(); "" != p {
-		hdr.Add(DistributedTracePayloadHeader, p)
-		return hdr
-	}
+	thd.InsertDistributedTraceHeaders(hdr)
 
 	return hdr
 }
 
+func (thd *thread) InsertDistributedTraceHeaders(hdrs http.Header) {
+	if nil == hdrs {
+		return
+	}
+	p, ok := thd.CreateDistributedTracePayload().(internal.Payload)
+	if !ok {
+		return
+	}
+	txn := thd.txn
+	txn.Lock()
+	defer txn.Unlock()
+
+	hdrs.Set(DistributedTraceW3CTraceParentHeader, p.W3CTraceParent())
+	hdrs.Set(DistributedTraceW3CTraceStateHeader, p.W3CTraceState())
+	if !txn.Config.DistributedTracer.ExcludeNewRelicHeader {
+		hdrs.Set(DistributedTracePayloadHeader, p.HTTPSafe())
+	}
+	txn.TraceContextCreateSuccess = true
+}
+
 const (
 	maxSampledDistributedPayloads = 35
 )
@@ -853,9 +1169,10 @@ type shimPayload struct{}
 func (s shimPayload) Text() string     { return "" }
 func (s shimPayload) HTTPSafe() string { return "" }
 
-func (txn *txn) CreateDistributedTracePayload() (payload DistributedTracePayload) {
+func (thd *thread) CreateDistributedTracePayload() (payload DistributedTracePayload) {
 	payload = shimPayload{}
 
+	txn := thd.txn
 	txn.Lock()
 	defer txn.Unlock()
 
@@ -888,10 +1205,13 @@ func (txn *txn) CreateDistributedTracePayload() (payload DistributedTracePayload
 	if txn.Reply.AccountID != txn.Reply.TrustedAccountKey {
 		p.TrustedAccountKey = txn.Reply.TrustedAccountKey
 	}
+	if nil != txn.BetterCAT.Inbound {
+		p.NonTrustedTraceState = txn.BetterCAT.Inbound.NonTrustedTraceState
+	}
 
 	sampled := txn.lazilyCalculateSampled()
 	if sampled && txn.SpanEventsEnabled {
-		p.ID = txn.CurrentSpanIdentifier()
+		p.ID = txn.CurrentSpanIdentifier(thd.thread)
 	}
 
 	// limit the number of outbound sampled=true payloads to prevent too
@@ -947,6 +1267,13 @@ func (txn *txn) acceptDistributedTracePayloadLocked(t TransportType, p interface
 		return nil
 	}
 
+	if hdrs, ok := p.(http.Header); ok {
+		if tp := hdrs.Get(DistributedTraceW3CTraceParentHeader); "" != tp {
+			return txn.acceptTraceContextLocked(t, tp, hdrs)
+		}
+		p = hdrs.Get(DistributedTracePayloadHeader)
+	}
+
 	payload, err := internal.AcceptPayload(p)
 	if nil != err {
 		if _, ok := err.(internal.ErrPayloadParse); ok {
@@ -982,6 +1309,40 @@ func (txn *txn) acceptDistributedTracePayloadLocked(t TransportType, p interface
 		return errTrustedAccountKey
 	}
 
+	txn.setInboundPayloadLocked(t, payload)
+	txn.AcceptPayloadSuccess = true
+
+	return nil
+}
+
+// acceptTraceContextLocked accepts the W3C traceparent and tracestate
+// headers.  The traceparent header determines the trace id and the parent
+// span id, while the trusted New Relic tracestate entry, if present,
+// identifies the caller and carries its sampling decision.
+func (txn *txn) acceptTraceContextLocked(t TransportType, traceParent string, hdrs http.Header) error {
+	payload, err := internal.ParseTraceParent(traceParent)
+	if nil != err {
+		txn.TraceContextParentParseException = true
+		return err
+	}
+
+	traceState := strings.Join(hdrs[http.CanonicalHeaderKey(DistributedTraceW3CTraceStateHeader)], ",")
+	switch payload.ParseTraceState(traceState, txn.Reply.TrustedAccountKey) {
+	case nil:
+		txn.AcceptPayloadSuccess = true
+	case internal.ErrTraceStateNoNewRelicEntry:
+		txn.TraceContextStateNoNrEntry = true
+	default:
+		txn.TraceContextStateInvalidNrEntry = true
+	}
+
+	txn.setInboundPayloadLocked(t, payload)
+	txn.TraceContextAcceptSuccess = true
+
+	return nil
+}
+
+func (txn *txn) setInboundPayloadLocked(t TransportType, payload *internal.Payload) {
 	if 0 != payload.Priority {
 		txn.BetterCAT.Priority = payload.Priority
 	}
@@ -1002,15 +1363,50 @@ func (txn *txn) acceptDistributedTracePayloadLocked(t TransportType, p interface
 		txn.Config.Logger.Debug("Invalid transport type, defaulting to Unknown", map[string]interface{}{})
 	}
 
-	if tm := payload.Timestamp.Time(); txn.Start.After(tm) {
+	if tm := payload.Timestamp.Time(); payload.HasNewRelicTraceInfo && txn.Start.After(tm) {
 		txn.BetterCAT.Inbound.TransportDuration = txn.Start.Sub(tm)
 	}
-
-	txn.AcceptPayloadSuccess = true
-
-	return nil
 }
 
 func (txn *txn) Application() Application {
 	return txn.app
 }
+
+func (thd *thread) getTraceMetadataLocked() TraceMetadata {
+	var metadata TraceMetadata
+	txn := thd.txn
+	if !txn.BetterCAT.Enabled {
+		return metadata
+	}
+	metadata.TraceID = txn.BetterCAT.TraceID()
+	if txn.SpanEventsEnabled && txn.lazilyCalculateSampled() {
+		metadata.SpanID = txn.CurrentSpanIdentifier(thd.thread)
+	}
+	return metadata
+}
+
+func (thd *thread) GetTraceMetadata() TraceMetadata {
+	txn := thd.txn
+	txn.Lock()
+	defer txn.Unlock()
+
+	return thd.getTraceMetadataLocked()
+}
+
+const linkingEntityType = "SERVICE"
+
+func (thd *thread) GetLinkingMetadata() LinkingMetadata {
+	txn := thd.txn
+	txn.Lock()
+	defer txn.Unlock()
+
+	trace := thd.getTraceMetadataLocked()
+	return LinkingMetadata{
+		TraceID:    trace.TraceID,
+		SpanID:     trace.SpanID,
+		EntityName: strings.TrimSpace(strings.SplitN(txn.Config.AppName, ";", 2)[0]),
+		EntityType: linkingEntityType,
+		EntityGUID: txn.Reply.EntityGUID,
+		Hostname:   internal.ThisHost,
+	}
+}
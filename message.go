@@ -0,0 +1,75 @@
+package newrelic
+
+import (
+	"net/http"
+
+	"github.com/newrelic/go-agent/internal"
+)
+
+// MessageDestinationType is used for the MessageProducerSegment and
+// MessageConsumer DestinationType fields.
+type MessageDestinationType string
+
+// These message destination type constants are used as the DestinationType of
+// MessageProducerSegment and MessageConsumer.
+const (
+	MessageQueue    MessageDestinationType = "Queue"
+	MessageTopic    MessageDestinationType = "Topic"
+	MessageExchange MessageDestinationType = "Exchange"
+)
+
+// MessageConsumer describes the message processed by a message consumer
+// transaction.  See StartMessageTransaction.
+type MessageConsumer struct {
+	// Library is the name of the library instrumented, eg. "RabbitMQ",
+	// "Kafka", or "JMS".
+	Library string
+	// DestinationType is the destination type: MessageQueue, MessageTopic,
+	// or MessageExchange.
+	DestinationType MessageDestinationType
+	// DestinationName is the name of the queue, topic, or exchange, eg.
+	// "UsersQueue".
+	DestinationName string
+	// DestinationTemporary must be set to true if the destination is
+	// temporary.  This improves transaction grouping since temporary
+	// destinations usually have random names.
+	DestinationTemporary bool
+	// TransportType is the transport over which the message was received.
+	// It is used when accepting distributed tracing headers and defaults
+	// to TransportQueue.
+	TransportType TransportType
+}
+
+// StartMessageTransaction begins a background transaction which processes a
+// message received from a queueing system.  The transaction is named
+// "OtherTransaction/Message/{Library}/{DestinationType}/Named/{DestinationName}".
+// The headers provided, which may be nil, are used to accept an inbound
+// distributed trace: they may contain the W3C Trace Context headers or the
+// Newrelic header added by Transaction.InsertDistributedTraceHeaders.
+//
+//	txn := newrelic.StartMessageTransaction(app, newrelic.MessageConsumer{
+//		Library:         "RabbitMQ",
+//		DestinationType: newrelic.MessageQueue,
+//		DestinationName: "UsersQueue",
+//	}, headers)
+//	defer txn.End()
+//
+func StartMessageTransaction(app Application, c MessageConsumer, hdrs http.Header) Transaction {
+	name := internal.MessageMetricKey{
+		Library:         c.Library,
+		DestinationType: string(c.DestinationType),
+		DestinationName: c.DestinationName,
+		DestinationTemp: c.DestinationTemporary,
+	}.TxnName()
+
+	txn := startBackgroundTransaction(app, internal.MessageMetricPrefix, name)
+
+	if nil != hdrs {
+		t := c.TransportType
+		if "" == t.name {
+			t = TransportQueue
+		}
+		txn.AcceptDistributedTracePayload(t, hdrs)
+	}
+	return txn
+}
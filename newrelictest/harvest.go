@@ -0,0 +1,259 @@
+package newrelictest
+
+import (
+	"github.com/newrelic/go-agent/internal"
+)
+
+// Validator is used to report expectation failures.  *testing.T and
+// *testing.B implement Validator.
+type Validator interface {
+	Error(...interface{})
+}
+
+var (
+	// MatchAnything may be used as an attribute value in an expectation to
+	// match any value.
+	MatchAnything = internal.MatchAnything
+)
+
+// WantMetric is a metric expectation.  If Data is nil, then any data values are
+// acceptable.  Otherwise Data contains the count, total, exclusive, min, max,
+// and sum of squares.
+type WantMetric struct {
+	Name   string
+	Scope  string
+	Forced interface{} // true, false, or nil
+	Data   []float64
+}
+
+// WantEvent is a transaction, error, span, or custom event expectation.
+type WantEvent struct {
+	Intrinsics      map[string]interface{}
+	UserAttributes  map[string]interface{}
+	AgentAttributes map[string]interface{}
+}
+
+// WantError is a traced error expectation.  Caller is the name of the function
+// which called Transaction.NoticeError, eg. "mypackage.myFunction".
+type WantError struct {
+	TxnName         string
+	Msg             string
+	Klass           string
+	Caller          string
+	UserAttributes  map[string]interface{}
+	AgentAttributes map[string]interface{}
+}
+
+// WantTxnTrace is a transaction trace expectation.
+type WantTxnTrace struct {
+	MetricName      string
+	NumSegments     int
+	UserAttributes  map[string]interface{}
+	AgentAttributes map[string]interface{}
+}
+
+// WantSlowQuery is a slow query expectation.
+type WantSlowQuery struct {
+	Count        int32
+	MetricName   string
+	Query        string
+	TxnName      string
+	TxnURL       string
+	DatabaseName string
+	Host         string
+	PortPathOrID string
+	Params       map[string]interface{}
+}
+
+// WantTxn is the expectation used by ExpectTxnMetrics.  Name is the name
+// given to StartTransaction.
+type WantTxn struct {
+	Name      string
+	IsWeb     bool
+	NumErrors int
+}
+
+func convertMetrics(want []WantMetric) []internal.WantMetric {
+	metrics := make([]internal.WantMetric, len(want))
+	for i, m := range want {
+		metrics[i] = internal.WantMetric{
+			Name:   m.Name,
+			Scope:  m.Scope,
+			Forced: m.Forced,
+			Data:   m.Data,
+		}
+	}
+	return metrics
+}
+
+func convertEvents(want []WantEvent) []internal.WantEvent {
+	events := make([]internal.WantEvent, len(want))
+	for i, e := range want {
+		events[i] = internal.WantEvent{
+			Intrinsics:      e.Intrinsics,
+			UserAttributes:  e.UserAttributes,
+			AgentAttributes: e.AgentAttributes,
+		}
+	}
+	return events
+}
+
+// Harvest contains the data recorded by an Application between harvests.
+type Harvest struct {
+	harvest *internal.Harvest
+}
+
+// ExpectMetrics tests that the harvest contains exactly the metrics expected.
+func (h *Harvest) ExpectMetrics(t Validator, want []WantMetric) {
+	t = internal.ExtendValidator(t, "metrics")
+	internal.ExpectMetrics(t, h.harvest.Metrics, convertMetrics(want))
+}
+
+// ExpectMetricsPresent tests that the harvest contains the metrics expected
+// and possibly others.
+func (h *Harvest) ExpectMetricsPresent(t Validator, want []WantMetric) {
+	t = internal.ExtendValidator(t, "metrics")
+	internal.ExpectMetricsPresent(t, h.harvest.Metrics, convertMetrics(want))
+}
+
+// ExpectTxnMetrics tests that the harvest contains exactly the metrics created
+// by a single transaction without segments.
+func (h *Harvest) ExpectTxnMetrics(t Validator, want WantTxn) {
+	t = internal.ExtendValidator(t, "metrics")
+	internal.ExpectTxnMetrics(t, h.harvest.Metrics, internal.WantTxn{
+		Name:      want.Name,
+		IsWeb:     want.IsWeb,
+		NumErrors: want.NumErrors,
+	})
+}
+
+// ExpectTxnEvents tests that the harvest contains exactly the transaction
+// events expected.
+func (h *Harvest) ExpectTxnEvents(t Validator, want []WantEvent) {
+	t = internal.ExtendValidator(t, "txn events")
+	internal.ExpectTxnEvents(t, h.harvest.TxnEvents, convertEvents(want))
+}
+
+// ExpectTxnEventsPresent tests that the transaction events contain the
+// attributes expected and possibly others.
+func (h *Harvest) ExpectTxnEventsPresent(t Validator, want []WantEvent) {
+	t = internal.ExtendValidator(t, "txn events")
+	internal.ExpectTxnEventsPresent(t, h.harvest.TxnEvents, convertEvents(want))
+}
+
+// ExpectTxnEventsAbsent tests that the transaction events do not contain the
+// attributes named.
+func (h *Harvest) ExpectTxnEventsAbsent(t Validator, names []string) {
+	t = internal.ExtendValidator(t, "txn events")
+	internal.ExpectTxnEventsAbsent(t, h.harvest.TxnEvents, names)
+}
+
+// ExpectErrorEvents tests that the harvest contains exactly the error events
+// expected.
+func (h *Harvest) ExpectErrorEvents(t Validator, want []WantEvent) {
+	t = internal.ExtendValidator(t, "error events")
+	internal.ExpectErrorEvents(t, h.harvest.ErrorEvents, convertEvents(want))
+}
+
+// ExpectErrorEventsPresent tests that the error events contain the attributes
+// expected and possibly others.
+func (h *Harvest) ExpectErrorEventsPresent(t Validator, want []WantEvent) {
+	t = internal.ExtendValidator(t, "error events")
+	internal.ExpectErrorEventsPresent(t, h.harvest.ErrorEvents, convertEvents(want))
+}
+
+// ExpectErrorEventsAbsent tests that the error events do not contain the
+// attributes named.
+func (h *Harvest) ExpectErrorEventsAbsent(t Validator, names []string) {
+	t = internal.ExtendValidator(t, "error events")
+	internal.ExpectErrorEventsAbsent(t, h.harvest.ErrorEvents, names)
+}
+
+// ExpectErrors tests that the harvest contains exactly the traced errors
+// expected.
+func (h *Harvest) ExpectErrors(t Validator, want []WantError) {
+	errs := make([]internal.WantError, len(want))
+	for i, e := range want {
+		errs[i] = internal.WantError{
+			TxnName:         e.TxnName,
+			Msg:             e.Msg,
+			Klass:           e.Klass,
+			Caller:          e.Caller,
+			UserAttributes:  e.UserAttributes,
+			AgentAttributes: e.AgentAttributes,
+		}
+	}
+	t = internal.ExtendValidator(t, "traced errors")
+	internal.ExpectErrors(t, h.harvest.ErrorTraces, errs)
+}
+
+// ExpectSpanEvents tests that the harvest contains exactly the span events
+// expected.
+func (h *Harvest) ExpectSpanEvents(t Validator, want []WantEvent) {
+	t = internal.ExtendValidator(t, "span events")
+	internal.ExpectSpanEvents(t, h.harvest.SpanEvents, convertEvents(want))
+}
+
+// ExpectSpanEventsPresent tests that the span events contain the attributes
+// expected and possibly others.
+func (h *Harvest) ExpectSpanEventsPresent(t Validator, want []WantEvent) {
+	t = internal.ExtendValidator(t, "span events")
+	internal.ExpectSpanEventsPresent(t, h.harvest.SpanEvents, convertEvents(want))
+}
+
+// ExpectSpanEventsAbsent tests that the span events do not contain the
+// attributes named.
+func (h *Harvest) ExpectSpanEventsAbsent(t Validator, names []string) {
+	t = internal.ExtendValidator(t, "span events")
+	internal.ExpectSpanEventsAbsent(t, h.harvest.SpanEvents, names)
+}
+
+// ExpectSpanEventsCount tests the number of span events.
+func (h *Harvest) ExpectSpanEventsCount(t Validator, c int) {
+	t = internal.ExtendValidator(t, "span events")
+	internal.ExpectSpanEventsCount(t, h.harvest.SpanEvents, c)
+}
+
+// ExpectCustomEvents tests that the harvest contains exactly the custom events
+// expected.
+func (h *Harvest) ExpectCustomEvents(t Validator, want []WantEvent) {
+	t = internal.ExtendValidator(t, "custom events")
+	internal.ExpectCustomEvents(t, h.harvest.CustomEvents, convertEvents(want))
+}
+
+// ExpectTxnTraces tests that the harvest contains exactly the transaction
+// traces expected.
+func (h *Harvest) ExpectTxnTraces(t Validator, want []WantTxnTrace) {
+	traces := make([]internal.WantTxnTrace, len(want))
+	for i, tr := range want {
+		traces[i] = internal.WantTxnTrace{
+			MetricName:      tr.MetricName,
+			NumSegments:     tr.NumSegments,
+			UserAttributes:  tr.UserAttributes,
+			AgentAttributes: tr.AgentAttributes,
+		}
+	}
+	t = internal.ExtendValidator(t, "txn traces")
+	internal.ExpectTxnTraces(t, h.harvest.TxnTraces, traces)
+}
+
+// ExpectSlowQueries tests that the harvest contains exactly the slow queries
+// expected.
+func (h *Harvest) ExpectSlowQueries(t Validator, want []WantSlowQuery) {
+	queries := make([]internal.WantSlowQuery, len(want))
+	for i, q := range want {
+		queries[i] = internal.WantSlowQuery{
+			Count:        q.Count,
+			MetricName:   q.MetricName,
+			Query:        q.Query,
+			TxnName:      q.TxnName,
+			TxnURL:       q.TxnURL,
+			DatabaseName: q.DatabaseName,
+			Host:         q.Host,
+			PortPathOrID: q.PortPathOrID,
+			Params:       q.Params,
+		}
+	}
+	t = internal.ExtendValidator(t, "slow queries")
+	internal.ExpectSlowQueries(t, h.harvest.SlowSQLs, queries)
+}
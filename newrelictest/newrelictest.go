@@ -0,0 +1,150 @@
+// Package newrelictest provides an in-memory Application for testing
+// instrumentation without a New Relic collector.
+//
+// Create an Application, exercise the code being tested, and then harvest the
+// data and make assertions about it:
+//
+//	func TestMyHandler(t *testing.T) {
+//		app, err := newrelictest.NewApplication(newrelic.NewConfig("my app", ""), nil)
+//		if nil != err {
+//			t.Fatal(err)
+//		}
+//		txn := app.StartTransaction("hello", nil, nil)
+//		myFunction(txn)
+//		txn.End()
+//
+//		h := app.Harvest()
+//		h.ExpectMetricsPresent(t, []newrelictest.WantMetric{
+//			{Name: "Custom/mySegment", Scope: "OtherTransaction/Go/hello"},
+//		})
+//	}
+package newrelictest
+
+import (
+	"time"
+
+	newrelic "github.com/newrelic/go-agent"
+	"github.com/newrelic/go-agent/internal"
+)
+
+// Reply contains the settings which New Relic sends to the application when it
+// connects.  It allows tests to control server side configuration.
+type Reply struct {
+	// ApdexThreshold is the Apdex threshold of web transactions.
+	ApdexThreshold time.Duration
+	// KeyTxnApdex contains the Apdex thresholds of key transactions,
+	// indexed by full transaction name, eg. "WebTransaction/Go/hello".
+	KeyTxnApdex map[string]time.Duration
+
+	// These fields control which data types are collected.
+	CollectAnalyticsEvents bool
+	CollectCustomEvents    bool
+	CollectTraces          bool
+	CollectErrors          bool
+	CollectErrorEvents     bool
+	CollectSpanEvents      bool
+
+	// These fields are used by distributed tracing.
+	AccountID         string
+	AppID             string
+	PrimaryAppID      string
+	TrustedAccountKey string
+	// TrustedAccounts contains the account ids trusted by cross
+	// application tracing.
+	TrustedAccounts []int
+
+	// SampleEverything causes every distributed tracing transaction to be
+	// sampled.  Otherwise no transactions are sampled.
+	SampleEverything bool
+
+	// EntityGUID is returned in Transaction.GetLinkingMetadata.
+	EntityGUID string
+}
+
+// DefaultReply returns the Reply used when nil is passed to NewApplication:
+// every data type is collected and every transaction is sampled.
+func DefaultReply() *Reply {
+	defaults := internal.ConnectReplyDefaults()
+	return &Reply{
+		ApdexThreshold:         time.Duration(defaults.ApdexThresholdSeconds * float64(time.Second)),
+		CollectAnalyticsEvents: defaults.CollectAnalyticsEvents,
+		CollectCustomEvents:    defaults.CollectCustomEvents,
+		CollectTraces:          defaults.CollectTraces,
+		CollectErrors:          defaults.CollectErrors,
+		CollectErrorEvents:     defaults.CollectErrorEvents,
+		CollectSpanEvents:      defaults.CollectSpanEvents,
+		SampleEverything:       true,
+	}
+}
+
+func (r *Reply) apply(reply *internal.ConnectReply) {
+	reply.ApdexThresholdSeconds = r.ApdexThreshold.Seconds()
+	if nil != r.KeyTxnApdex {
+		reply.KeyTxnApdex = make(map[string]float64, len(r.KeyTxnApdex))
+		for name, d := range r.KeyTxnApdex {
+			reply.KeyTxnApdex[name] = d.Seconds()
+		}
+	}
+
+	reply.CollectAnalyticsEvents = r.CollectAnalyticsEvents
+	reply.CollectCustomEvents = r.CollectCustomEvents
+	reply.CollectTraces = r.CollectTraces
+	reply.CollectErrors = r.CollectErrors
+	reply.CollectErrorEvents = r.CollectErrorEvents
+	reply.CollectSpanEvents = r.CollectSpanEvents
+
+	reply.AccountID = r.AccountID
+	reply.AppID = r.AppID
+	reply.PrimaryAppID = r.PrimaryAppID
+	reply.TrustedAccountKey = r.TrustedAccountKey
+	reply.TrustedAccounts = make(map[int]struct{}, len(r.TrustedAccounts))
+	for _, id := range r.TrustedAccounts {
+		reply.TrustedAccounts[id] = struct{}{}
+	}
+
+	reply.EntityGUID = r.EntityGUID
+
+	if r.SampleEverything {
+		reply.AdaptiveSampler = internal.SampleEverything{}
+	} else {
+		reply.AdaptiveSampler = internal.SampleNothing{}
+	}
+}
+
+// Application is a newrelic.Application which records data in memory rather
+// than sending it to New Relic.  It never connects and spawns no goroutines.
+type Application struct {
+	newrelic.Application
+}
+
+// NewApplication creates an Application using the Config and Reply provided.
+// The Config is validated as it is by newrelic.NewApplication, except that the
+// license is optional.  Config.Enabled is ignored.  If reply is nil then
+// DefaultReply is used.
+func NewApplication(cfg newrelic.Config, reply *Reply) (*Application, error) {
+	cfg.Enabled = false
+	app, err := newrelic.NewApplication(cfg)
+	if nil != err {
+		return nil, err
+	}
+	if nil == reply {
+		reply = DefaultReply()
+	}
+	internal.HarvestTesting(app, reply.apply)
+	return &Application{Application: app}, nil
+}
+
+// StartBackgroundTransactionWithPrefix implements
+// newrelic.BackgroundTransactionStarter so that newrelic.StartBackgroundTransaction
+// and newrelic.StartMessageTransaction name transactions as they do with the
+// Application returned by newrelic.NewApplication.
+func (app *Application) StartBackgroundTransactionWithPrefix(prefix, name string) newrelic.Transaction {
+	return app.Application.(newrelic.BackgroundTransactionStarter).StartBackgroundTransactionWithPrefix(prefix, name)
+}
+
+// Harvest synchronously harvests the data recorded since the Application was
+// created or since the previous harvest.  Metric name rules are not applied
+// and supportability metrics are not created.
+func (app *Application) Harvest() *Harvest {
+	return &Harvest{harvest: internal.SwapTestHarvest(app.Application)}
+}
@@ -0,0 +1,170 @@
+package newrelictest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	newrelic "github.com/newrelic/go-agent"
+)
+
+func testApp(reply *Reply, t *testing.T) *Application {
+	cfg := newrelic.NewConfig("my app", "")
+	cfg.CrossApplicationTracer.Enabled = false
+	cfg.DistributedTracer.Enabled = true
+	app, err := NewApplication(cfg, reply)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestNewApplicationInvalidConfig(t *testing.T) {
+	cfg := newrelic.NewConfig("my app", "invalid license")
+	if _, err := NewApplication(cfg, nil); nil == err {
+		t.Error("expected invalid config error")
+	}
+}
+
+func TestCustomSegment(t *testing.T) {
+	app := testApp(nil, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	newrelic.StartSegment(txn, "mySegment").End()
+	txn.AddAttribute("zip", "zap")
+	txn.End()
+
+	h := app.Harvest()
+	h.ExpectMetrics(t, []WantMetric{
+		{Name: "OtherTransaction/Go/hello", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransaction/all", Scope: "", Forced: true, Data: nil},
+		{Name: "DurationByCaller/Unknown/Unknown/Unknown/Unknown/all", Scope: "", Forced: false, Data: nil},
+		{Name: "DurationByCaller/Unknown/Unknown/Unknown/Unknown/allOther", Scope: "", Forced: false, Data: nil},
+		{Name: "Custom/mySegment", Scope: "", Forced: false, Data: nil},
+		{Name: "Custom/mySegment", Scope: "OtherTransaction/Go/hello", Forced: false, Data: nil},
+	})
+	h.ExpectTxnEvents(t, []WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name":     "OtherTransaction/Go/hello",
+			"guid":     MatchAnything,
+			"priority": MatchAnything,
+			"sampled":  true,
+			"traceId":  MatchAnything,
+		},
+		UserAttributes:  map[string]interface{}{"zip": "zap"},
+		AgentAttributes: map[string]interface{}{},
+	}})
+	h.ExpectSpanEventsCount(t, 2)
+	h.ExpectSpanEventsPresent(t, []WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name":          "OtherTransaction/Go/hello",
+			"nr.entryPoint": true,
+		},
+	}, {
+		Intrinsics: map[string]interface{}{
+			"name": "Custom/mySegment",
+		},
+	}})
+}
+
+func TestBackgroundTransactionNames(t *testing.T) {
+	app := testApp(nil, t)
+	if _, ok := interface{}(app).(newrelic.BackgroundTransactionStarter); !ok {
+		t.Fatal("Application does not implement BackgroundTransactionStarter")
+	}
+	newrelic.StartBackgroundTransaction(app, "Job", "sendEmails").End()
+	newrelic.StartMessageTransaction(app, newrelic.MessageConsumer{
+		Library:         "RabbitMQ",
+		DestinationType: newrelic.MessageQueue,
+		DestinationName: "UsersQueue",
+	}, nil).End()
+
+	h := app.Harvest()
+	h.ExpectMetricsPresent(t, []WantMetric{
+		{Name: "OtherTransaction/Job/sendEmails", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransaction/Message/RabbitMQ/Queue/Named/UsersQueue", Scope: "", Forced: true, Data: nil},
+	})
+	h.ExpectTxnEventsPresent(t, []WantEvent{{
+		Intrinsics: map[string]interface{}{"name": "OtherTransaction/Job/sendEmails"},
+	}, {
+		Intrinsics: map[string]interface{}{"name": "OtherTransaction/Message/RabbitMQ/Queue/Named/UsersQueue"},
+	}})
+}
+
+func TestHarvestResets(t *testing.T) {
+	app := testApp(nil, t)
+	if err := app.RecordCustomEvent("myEvent", map[string]interface{}{"zip": 1}); nil != err {
+		t.Fatal(err)
+	}
+	app.Harvest().ExpectCustomEvents(t, []WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"type":      "myEvent",
+			"timestamp": MatchAnything,
+		},
+		UserAttributes: map[string]interface{}{"zip": 1},
+	}})
+	app.Harvest().ExpectCustomEvents(t, []WantEvent{})
+}
+
+func TestErrors(t *testing.T) {
+	app, err := NewApplication(newrelic.NewConfig("my app", ""), nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	txn := app.StartTransaction("hello", nil, nil)
+	txn.NoticeError(errors.New("oops"))
+	txn.End()
+
+	h := app.Harvest()
+	h.ExpectTxnMetrics(t, WantTxn{Name: "hello", NumErrors: 1})
+	h.ExpectErrorEvents(t, []WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":     "*errors.errorString",
+			"error.message":   "oops",
+			"transactionName": "OtherTransaction/Go/hello",
+		},
+	}})
+}
+
+func TestReplySettings(t *testing.T) {
+	reply := DefaultReply()
+	reply.CollectTraces = false
+	reply.CollectSpanEvents = false
+	reply.ApdexThreshold = 2 * time.Second
+	app := testApp(reply, t)
+	txn := app.StartTransaction("hello", nil, nil)
+	txn.SetWebRequest(nil)
+	txn.End()
+
+	h := app.Harvest()
+	h.ExpectTxnTraces(t, []WantTxnTrace{})
+	h.ExpectSpanEventsCount(t, 0)
+	h.ExpectMetricsPresent(t, []WantMetric{
+		{Name: "Apdex", Scope: "", Forced: true, Data: []float64{1, 0, 0, 2, 2, 0}},
+	})
+}
+
+func TestSlowQueries(t *testing.T) {
+	cfg := newrelic.NewConfig("my app", "")
+	cfg.DatastoreTracer.SlowQuery.Threshold = 0
+	app, err := NewApplication(cfg, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	txn := app.StartTransaction("hello", nil, nil)
+	s := newrelic.DatastoreSegment{
+		StartTime:          newrelic.StartSegmentNow(txn),
+		Product:            newrelic.DatastorePostgres,
+		Collection:         "users",
+		Operation:          "INSERT",
+		ParameterizedQuery: "INSERT INTO users (name) VALUES ($1)",
+	}
+	s.End()
+	txn.End()
+
+	app.Harvest().ExpectSlowQueries(t, []WantSlowQuery{{
+		Count:      1,
+		MetricName: "Datastore/statement/Postgres/users/INSERT",
+		Query:      "INSERT INTO users (name) VALUES ($1)",
+		TxnName:    "OtherTransaction/Go/hello",
+	}})
+}
@@ -0,0 +1,103 @@
+package newrelic
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/newrelic/go-agent/internal"
+)
+
+// OTLPConfig configures the HarvestSink created by NewOTLPHarvestSink.
+type OTLPConfig struct {
+	// Endpoint is the base URL of the OTLP/HTTP receiver, eg.
+	// "http://localhost:4318".  Spans are sent to Endpoint + "/v1/traces",
+	// events to Endpoint + "/v1/logs", and metrics to Endpoint +
+	// "/v1/metrics".
+	Endpoint string
+	// Headers are added to each request, eg. for authentication.
+	Headers map[string]string
+	// ServiceName is the "service.name" resource attribute, usually the
+	// same as Config.AppName.  If empty, "unknown_service:" followed by
+	// the executable name is used.
+	ServiceName string
+	// Transport customizes http.Client communication with the receiver.
+	// If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+}
+
+type otlpSink struct {
+	endpoint string
+	headers  map[string]string
+	resource internal.OTLPResource
+	client   *http.Client
+}
+
+// NewOTLPHarvestSink creates a HarvestSink which translates the harvest data
+// into OpenTelemetry protocol (OTLP) protobuf and sends it over OTLP/HTTP, eg.
+// to an OpenTelemetry Collector:
+//
+//	cfg.HarvestSink = newrelic.NewOTLPHarvestSink(newrelic.OTLPConfig{
+//		Endpoint:    "http://localhost:4318",
+//		ServiceName: cfg.AppName,
+//	})
+//
+// Span events become spans with semantic convention attributes such as
+// "db.system" and "http.url".  Transaction, error, and custom events become
+// log records with the event type as the "event.name" attribute.  Metrics
+// become summaries.  Error traces, transaction traces, and slow queries are
+// not sent.  Span events are only created when distributed tracing is
+// enabled.
+func NewOTLPHarvestSink(cfg OTLPConfig) HarvestSink {
+	serviceName := cfg.ServiceName
+	if "" == serviceName {
+		serviceName = "unknown_service:" + filepath.Base(os.Args[0])
+	}
+	return &otlpSink{
+		endpoint: strings.TrimSuffix(cfg.Endpoint, "/"),
+		headers:  cfg.Headers,
+		resource: internal.OTLPResource{
+			ServiceName:  serviceName,
+			AgentVersion: Version,
+		},
+		client: &http.Client{
+			Transport: cfg.Transport,
+			Timeout:   internal.CollectorTimeout,
+		},
+	}
+}
+
+func (s *otlpSink) WriteHarvest(p HarvestPayload) error {
+	path, body, err := internal.OTLPRequest(p.Cmd, p.Data, s.resource)
+	if nil != err {
+		return err
+	}
+	if "" == path {
+		return nil
+	}
+	req, err := http.NewRequest("POST", s.endpoint+path, bytes.NewReader(body))
+	if nil != err {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "NewRelic-Go-Agent/"+Version)
+	for key, val := range s.headers {
+		req.Header.Set(key, val)
+	}
+	resp, err := s.client.Do(req)
+	if nil != err {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("OTLP response code: %d", resp.StatusCode)
+	}
+	return nil
+}
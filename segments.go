@@ -36,6 +36,11 @@ type DatastoreSegment struct {
 	// ParameterizedQuery may be set to the query being performed.  It must
 	// not contain any raw parameters, only placeholders.
 	ParameterizedQuery string
+	// RawQuery may be set to a SQL query which may contain literal values.
+	// Depending on Config.DatastoreTracer.RecordSQL, it is either
+	// obfuscated, recorded as provided, or discarded.  ParameterizedQuery
+	// is preferred when both are set, unless RecordSQL is RecordSQLRaw.
+	RawQuery string
 	// QueryParameters may be used to provide query parameters.  Care should
 	// be taken to only provide parameters which are not sensitive.
 	// QueryParameters are ignored in high security mode.
@@ -61,17 +66,81 @@ type ExternalSegment struct {
 	// is parsed using url.Parse and therefore it MUST include the protocol
 	// (eg. "http://").
 	URL string
+
+	// clientTrace is non-nil when StartExternalSegment added an
+	// httptrace.ClientTrace to the request.  See Config.HTTPClientTrace.
+	clientTrace *httpClientTrace
+}
+
+// MessageProducerSegment is used to instrument calls that add messages to a
+// queueing system.  Here is an example:
+//
+//	seg := &newrelic.MessageProducerSegment{
+//		StartTime:       newrelic.StartSegmentNow(txn),
+//		Library:         "RabbitMQ",
+//		DestinationType: newrelic.MessageExchange,
+//		DestinationName: "myExchange",
+//	}
+//	// Add the distributed tracing headers to the message.
+//	txn.InsertDistributedTraceHeaders(headers)
+//	// ... publish the message here ...
+//	seg.End()
+//
+type MessageProducerSegment struct {
+	StartTime SegmentStartTime
+	// Library is the name of the library instrumented, eg. "RabbitMQ",
+	// "Kafka", or "JMS".
+	Library string
+	// DestinationType is the destination type: MessageQueue, MessageTopic,
+	// or MessageExchange.
+	DestinationType MessageDestinationType
+	// DestinationName is the name of the queue, topic, or exchange, eg.
+	// "UsersQueue".
+	DestinationName string
+	// DestinationTemporary must be set to true if the destination is
+	// temporary.  This improves metric grouping since temporary
+	// destinations usually have random names.
+	DestinationTemporary bool
 }
 
 // End finishes the segment.
 func (s *Segment) End() error { return endSegment(s) }
 
+// AddAttribute adds a key value pair to the segment.  The attribute is
+// included in the segment's span event and transaction trace segment.  The
+// key and value restrictions of Transaction.AddAttribute apply.  Attributes
+// must be added before the segment ends.
+func (s *Segment) AddAttribute(key string, val interface{}) error {
+	return addSegmentAttribute(s.StartTime, key, val)
+}
+
+// AddAttribute adds a key value pair to the datastore segment.  See
+// Segment.AddAttribute.
+func (s *DatastoreSegment) AddAttribute(key string, val interface{}) error {
+	return addSegmentAttribute(s.StartTime, key, val)
+}
+
+// AddAttribute adds a key value pair to the external segment.  See
+// Segment.AddAttribute.
+func (s *ExternalSegment) AddAttribute(key string, val interface{}) error {
+	return addSegmentAttribute(s.StartTime, key, val)
+}
+
+// AddAttribute adds a key value pair to the message producer segment.  See
+// Segment.AddAttribute.
+func (s *MessageProducerSegment) AddAttribute(key string, val interface{}) error {
+	return addSegmentAttribute(s.StartTime, key, val)
+}
+
 // End finishes the datastore segment.
 func (s *DatastoreSegment) End() error { return endDatastore(s) }
 
 // End finishes the external segment.
 func (s *ExternalSegment) End() error { return endExternal(s) }
 
+// End finishes the message producer segment.
+func (s *MessageProducerSegment) End() error { return endMessage(s) }
+
 // OutboundHeaders returns the headers that should be attached to the external
 // request.
 func (s *ExternalSegment) OutboundHeaders() http.Header {
@@ -118,6 +187,10 @@ func StartSegment(txn Transaction, name string) *Segment {
 // distributed tracing headers to the request.  Therefore, it is recommended
 // over populating ExternalSegment structs manually.
 //
+// When Config.HTTPClientTrace is enabled, StartExternalSegment also adds an
+// httptrace.ClientTrace to the request's context to record the phases of the
+// request, such as the DNS lookup and TLS handshake.
+//
 // If the Transaction parameter is nil, StartExternalSegment will look for a
 // Transaction in the request's context using FromContext.  Example:
 //
@@ -144,5 +217,10 @@ func StartExternalSegment(txn Transaction, request *http.Request) *ExternalSegme
 		}
 	}
 
+	if thd := s.StartTime.thread; nil != thd && nil != request &&
+		thd.Config.HTTPClientTrace.Enabled {
+		s.clientTrace = addHTTPClientTrace(request)
+	}
+
 	return s
 }
@@ -0,0 +1,434 @@
+// +build go1.10
+
+package newrelic
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+// SQLDriverSegmentBuilder populates DatastoreSegments for sql.Driver
+// instrumentation.  Use this to instrument a database that is not supported
+// by an existing integration package.
+type SQLDriverSegmentBuilder struct {
+	// BaseSegment is copied into every segment.  The StartTime and
+	// RawQuery fields are ignored.
+	BaseSegment DatastoreSegment
+	// ParseQuery, if non-nil, is used to populate the segment's Operation
+	// and Collection from the query.
+	ParseQuery func(segment *DatastoreSegment, query string)
+	// ParseDSN, if non-nil, is used to populate the segment's Host,
+	// PortPathOrID, and DatabaseName from the data source name.  It is
+	// only used when connections are opened using a data source name:
+	// InstrumentSQLConnector connectors do not have one.
+	ParseDSN func(segment *DatastoreSegment, dataSourceName string)
+}
+
+// InstrumentSQLDriver wraps a driver.Driver, adding instrumentation for exec
+// and query calls made with a context containing a transaction, and for
+// transactions begun with such a context.  The transaction is found using
+// FromContext.  Register the instrumented driver using sql.Register:
+//
+//	func init() {
+//		sql.Register("nrmysql", newrelic.InstrumentSQLDriver(mysql.MySQLDriver{}, newrelic.SQLDriverSegmentBuilder{
+//			BaseSegment: newrelic.DatastoreSegment{Product: newrelic.DatastoreMySQL},
+//			ParseQuery:  parseQuery,
+//			ParseDSN:    parseDSN,
+//		}))
+//	}
+//
+// Here parseQuery and parseDSN are functions you write to populate the
+// segment fields from the query and data source name of your database.
+//
+// Calls made without a context, such as sql.DB.Query rather than
+// sql.DB.QueryContext, are not instrumented.
+func InstrumentSQLDriver(d driver.Driver, bld SQLDriverSegmentBuilder) driver.Driver {
+	return &wrapDriver{bld: bld, original: d}
+}
+
+// InstrumentSQLConnector wraps a driver.Connector, adding instrumentation for
+// exec and query calls made with a context containing a transaction.  Use the
+// result with sql.OpenDB:
+//
+//	db := sql.OpenDB(newrelic.InstrumentSQLConnector(connector, bld))
+//
+func InstrumentSQLConnector(connector driver.Connector, bld SQLDriverSegmentBuilder) driver.Connector {
+	return &wrapConnector{
+		original: connector,
+		bld:      bld,
+		driver:   &wrapDriver{bld: bld, original: connector.Driver()},
+	}
+}
+
+func (bld SQLDriverSegmentBuilder) useDSN(dsn string) SQLDriverSegmentBuilder {
+	if nil != bld.ParseDSN {
+		bld.ParseDSN(&bld.BaseSegment, dsn)
+	}
+	return bld
+}
+
+func (bld SQLDriverSegmentBuilder) startSegment(ctx context.Context, query string) *DatastoreSegment {
+	txn := FromContext(ctx)
+	if nil == txn {
+		return nil
+	}
+	s := bld.BaseSegment
+	s.RawQuery = query
+	if nil != bld.ParseQuery {
+		bld.ParseQuery(&s, query)
+	}
+	s.StartTime = StartSegmentNow(txn)
+	return &s
+}
+
+func (bld SQLDriverSegmentBuilder) startOperationSegment(ctx context.Context, operation string) *DatastoreSegment {
+	txn := FromContext(ctx)
+	if nil == txn {
+		return nil
+	}
+	s := bld.BaseSegment
+	s.Operation = operation
+	s.StartTime = StartSegmentNow(txn)
+	return &s
+}
+
+var (
+	errNamedValuesUnsupported = errors.New("sql: driver does not support the use of Named Parameters")
+	errIsolationUnsupported   = errors.New("sql: driver does not support non-default isolation level")
+	errReadOnlyUnsupported    = errors.New("sql: driver does not support read-only transactions")
+)
+
+// namedValuesToValues is used when the wrapped driver does not support the
+// context methods introduced in Go 1.8.
+func namedValuesToValues(named []driver.NamedValue) ([]driver.Value, error) {
+	args := make([]driver.Value, len(named))
+	for i, nv := range named {
+		if "" != nv.Name {
+			return nil, errNamedValuesUnsupported
+		}
+		args[i] = nv.Value
+	}
+	return args, nil
+}
+
+type wrapDriver struct {
+	bld      SQLDriverSegmentBuilder
+	original driver.Driver
+}
+
+// Open implements driver.Driver.
+func (w *wrapDriver) Open(name string) (driver.Conn, error) {
+	original, err := w.original.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &wrapConn{original: original, bld: w.bld.useDSN(name)}, nil
+}
+
+// OpenConnector implements driver.DriverContext.
+func (w *wrapDriver) OpenConnector(name string) (driver.Connector, error) {
+	var original driver.Connector
+	if dc, ok := w.original.(driver.DriverContext); ok {
+		c, err := dc.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		original = c
+	} else {
+		original = dsnConnector{dsn: name, driver: w.original}
+	}
+	return &wrapConnector{
+		original: original,
+		bld:      w.bld.useDSN(name),
+		driver:   w,
+	}, nil
+}
+
+// dsnConnector is used for drivers which do not implement
+// driver.DriverContext, in the same way as the database/sql package.
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open(c.dsn) }
+func (c dsnConnector) Driver() driver.Driver                        { return c.driver }
+
+type wrapConnector struct {
+	original driver.Connector
+	bld      SQLDriverSegmentBuilder
+	driver   driver.Driver
+}
+
+// Connect implements driver.Connector.
+func (w *wrapConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	original, err := w.original.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &wrapConn{original: original, bld: w.bld}, nil
+}
+
+// Driver implements driver.Connector.
+func (w *wrapConnector) Driver() driver.Driver { return w.driver }
+
+type wrapConn struct {
+	original driver.Conn
+	bld      SQLDriverSegmentBuilder
+}
+
+// Prepare implements driver.Conn.
+func (w *wrapConn) Prepare(query string) (driver.Stmt, error) {
+	original, err := w.original.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &wrapStmt{original: original, bld: w.bld, query: query}, nil
+}
+
+// PrepareContext implements driver.ConnPrepareContext.
+func (w *wrapConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	prep, ok := w.original.(driver.ConnPrepareContext)
+	if !ok {
+		return w.Prepare(query)
+	}
+	original, err := prep.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &wrapStmt{original: original, bld: w.bld, query: query}, nil
+}
+
+// Close implements driver.Conn.
+func (w *wrapConn) Close() error { return w.original.Close() }
+
+// Begin implements driver.Conn.
+func (w *wrapConn) Begin() (driver.Tx, error) {
+	original, err := w.original.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &wrapTx{original: original, bld: w.bld, ctx: context.Background()}, nil
+}
+
+// BeginTx implements driver.ConnBeginTx.
+func (w *wrapConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	var original driver.Tx
+	var err error
+	if b, ok := w.original.(driver.ConnBeginTx); ok {
+		original, err = b.BeginTx(ctx, opts)
+	} else {
+		if 0 != opts.Isolation {
+			return nil, errIsolationUnsupported
+		}
+		if opts.ReadOnly {
+			return nil, errReadOnlyUnsupported
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		original, err = w.original.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &wrapTx{original: original, bld: w.bld, ctx: ctx}, nil
+}
+
+// ExecContext implements driver.ExecerContext.
+func (w *wrapConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	var run func() (driver.Result, error)
+	if e, ok := w.original.(driver.ExecerContext); ok {
+		run = func() (driver.Result, error) { return e.ExecContext(ctx, query, args) }
+	} else if e, ok := w.original.(driver.Execer); ok {
+		run = func() (driver.Result, error) {
+			vals, err := namedValuesToValues(args)
+			if err != nil {
+				return nil, err
+			}
+			return e.Exec(query, vals)
+		}
+	} else {
+		// database/sql will prepare a statement instead, and the
+		// statement will be instrumented.
+		return nil, driver.ErrSkip
+	}
+	segment := w.bld.startSegment(ctx, query)
+	result, err := run()
+	if err != driver.ErrSkip {
+		segment.End()
+	}
+	return result, err
+}
+
+// QueryContext implements driver.QueryerContext.
+func (w *wrapConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	var run func() (driver.Rows, error)
+	if q, ok := w.original.(driver.QueryerContext); ok {
+		run = func() (driver.Rows, error) { return q.QueryContext(ctx, query, args) }
+	} else if q, ok := w.original.(driver.Queryer); ok {
+		run = func() (driver.Rows, error) {
+			vals, err := namedValuesToValues(args)
+			if err != nil {
+				return nil, err
+			}
+			return q.Query(query, vals)
+		}
+	} else {
+		return nil, driver.ErrSkip
+	}
+	segment := w.bld.startSegment(ctx, query)
+	rows, err := run()
+	if err != driver.ErrSkip {
+		segment.End()
+	}
+	return rows, err
+}
+
+// Ping implements driver.Pinger.
+func (w *wrapConn) Ping(ctx context.Context) error {
+	if p, ok := w.original.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// ResetSession implements driver.SessionResetter.
+func (w *wrapConn) ResetSession(ctx context.Context) error {
+	if r, ok := w.original.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// CheckNamedValue implements driver.NamedValueChecker.
+func (w *wrapConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if c, ok := w.original.(driver.NamedValueChecker); ok {
+		return c.CheckNamedValue(nv)
+	}
+	// driver.ErrSkip causes database/sql to use the default conversion.
+	return driver.ErrSkip
+}
+
+type wrapStmt struct {
+	original driver.Stmt
+	bld      SQLDriverSegmentBuilder
+	query    string
+}
+
+// Close implements driver.Stmt.
+func (w *wrapStmt) Close() error { return w.original.Close() }
+
+// NumInput implements driver.Stmt.
+func (w *wrapStmt) NumInput() int { return w.original.NumInput() }
+
+// Exec implements driver.Stmt.
+func (w *wrapStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return w.original.Exec(args)
+}
+
+// Query implements driver.Stmt.
+func (w *wrapStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return w.original.Query(args)
+}
+
+// ExecContext implements driver.StmtExecContext.
+func (w *wrapStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	segment := w.bld.startSegment(ctx, w.query)
+	defer segment.End()
+
+	if e, ok := w.original.(driver.StmtExecContext); ok {
+		return e.ExecContext(ctx, args)
+	}
+	vals, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	return w.original.Exec(vals)
+}
+
+// QueryContext implements driver.StmtQueryContext.
+func (w *wrapStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	segment := w.bld.startSegment(ctx, w.query)
+	defer segment.End()
+
+	if q, ok := w.original.(driver.StmtQueryContext); ok {
+		return q.QueryContext(ctx, args)
+	}
+	vals, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	return w.original.Query(vals)
+}
+
+// CheckNamedValue implements driver.NamedValueChecker.  Since the wrapper hides
+// the driver.ColumnConverter of the original statement, the conversion is
+// performed here in the same way as the database/sql package.
+func (w *wrapStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if c, ok := w.original.(driver.NamedValueChecker); ok {
+		return c.CheckNamedValue(nv)
+	}
+	cc, ok := w.original.(driver.ColumnConverter)
+	if !ok {
+		return driver.ErrSkip
+	}
+	index := nv.Ordinal - 1
+	if n := w.original.NumInput(); n >= 0 && n <= index {
+		return nil
+	}
+	if vr, ok := nv.Value.(driver.Valuer); ok {
+		sv, err := vr.Value()
+		if err != nil {
+			return err
+		}
+		if !driver.IsValue(sv) {
+			return fmt.Errorf("non-Value type %T returned from Value", sv)
+		}
+		nv.Value = sv
+	}
+	arg := nv.Value
+	v, err := cc.ColumnConverter(index).ConvertValue(arg)
+	if err != nil {
+		return err
+	}
+	if !driver.IsValue(v) {
+		return fmt.Errorf("driver ColumnConverter error converted %T to unsupported type %T", arg, v)
+	}
+	nv.Value = v
+	return nil
+}
+
+type wrapTx struct {
+	original driver.Tx
+	bld      SQLDriverSegmentBuilder
+	ctx      context.Context
+}
+
+// Commit implements driver.Tx.
+func (w *wrapTx) Commit() error {
+	segment := w.bld.startOperationSegment(w.ctx, "COMMIT")
+	defer segment.End()
+	return w.original.Commit()
+}
+
+// Rollback implements driver.Tx.
+func (w *wrapTx) Rollback() error {
+	segment := w.bld.startOperationSegment(w.ctx, "ROLLBACK")
+	defer segment.End()
+	return w.original.Rollback()
+}
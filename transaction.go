@@ -6,7 +6,8 @@ import (
 )
 
 // Transaction represents a request or a background task.
-// Each Transaction should only be used in a single goroutine.
+// Each Transaction should only be used in a single goroutine.  Use
+// NewGoroutine to create a Transaction for each additional goroutine.
 type Transaction interface {
 	// The transaction's http.ResponseWriter methods will delegate to the
 	// http.ResponseWriter provided as a parameter to
@@ -42,6 +43,15 @@ type Transaction interface {
 	// https://docs.newrelic.com/docs/agents/manage-apm-agents/agent-metrics/collect-custom-attributes
 	AddAttribute(key string, value interface{}) error
 
+	// AddSpanAttribute adds a key value pair to the span of the segment
+	// most recently started in this goroutine which has not yet ended.  If
+	// there is no such segment, the attribute is added to the span of the
+	// transaction itself.  The attribute is included in span events and
+	// transaction trace segments.  The key and value restrictions of
+	// AddAttribute apply.  Span event and transaction tracer attribute
+	// configuration is applied (see config.go).
+	AddSpanAttribute(key string, value interface{}) error
+
 	// SetWebRequest marks the transaction as a web transaction.  If
 	// WebRequest is non-nil, SetWebRequest will additionally collect
 	// details on request attributes, url, and method.  If headers are
@@ -62,9 +72,9 @@ type Transaction interface {
 
 	// StartSegmentNow allows the timing of functions, external calls, and
 	// datastore calls.  The segments of each transaction MUST be used in a
-	// single goroutine.  Consumers are encouraged to use the
-	// `StartSegmentNow` functions which checks if the Transaction is nil.
-	// See segments.go
+	// single goroutine:  use NewGoroutine to time segments in other
+	// goroutines.  Consumers are encouraged to use the `StartSegmentNow`
+	// functions which checks if the Transaction is nil.  See segments.go
 	StartSegmentNow() SegmentStartTime
 
 	// CreateDistributedTracePayload creates a payload to link the calls
@@ -78,19 +88,30 @@ type Transaction interface {
 	// Just use StartExternalSegment!
 	CreateDistributedTracePayload() DistributedTracePayload
 
+	// InsertDistributedTraceHeaders adds the W3C Trace Context headers
+	// (traceparent and tracestate) and the Newrelic header to the headers
+	// provided.  Use this method to propagate the trace over transports
+	// that carry headers but are not covered by StartExternalSegment, such
+	// as message queues.  Like CreateDistributedTracePayload, this method
+	// should be called every time an outbound call is made.
+	InsertDistributedTraceHeaders(hdrs http.Header)
+
 	// AcceptDistributedTracePayload is used at the beginning of a
 	// transaction to identify the caller.
 	//
-	// Application.StartTransaction calls this method automatically if a
-	// payload is present in the request headers (under the key
-	// DistributedTracePayloadHeader).  Therefore, this method does not need
-	// to be used for typical HTTP transactions.
+	// Application.StartTransaction calls this method automatically if
+	// W3C Trace Context headers (DistributedTraceW3CTraceParentHeader and
+	// DistributedTraceW3CTraceStateHeader) or a New Relic payload
+	// (DistributedTracePayloadHeader) are present in the request headers.
+	// When both are present, the W3C headers are used.  Therefore, this
+	// method does not need to be used for typical HTTP transactions.
 	//
 	// AcceptDistributedTracePayload should be used as early in the
 	// transaction as possible. It may not be called after a call to
 	// CreateDistributedTracePayload.
 	//
-	// The payload parameter may be a DistributedTracePayload or a string.
+	// The payload parameter may be a DistributedTracePayload, a string, or
+	// an http.Header containing the headers described above.
 	AcceptDistributedTracePayload(t TransportType, payload interface{}) error
 
 	// Application returns the Application which started the transaction.
@@ -114,6 +135,81 @@ type Transaction interface {
 	// Relic's Browser support no longer requires a separate footer. The
 	// naming is for consistency with other New Relic language agents.
 	BrowserTimingHeader() (*BrowserTimingHeader, error)
+
+	// NewGoroutine allows you to use the Transaction in multiple
+	// goroutines.  Each goroutine must have its own Transaction reference
+	// returned by NewGoroutine.  You must call NewGoroutine to get a new
+	// Transaction reference every time you wish to pass the Transaction
+	// to another goroutine.  It does not matter if you call this before or
+	// after the other goroutine has started.
+	//
+	// All Transaction methods can be used in any Transaction reference.
+	// The Transaction will end when End() is called in any goroutine.
+	// Segments started in the new goroutine appear as children of the
+	// transaction's root in transaction traces and span events.
+	//
+	// Example passing a new Transaction reference directly to another
+	// goroutine:
+	//
+	//	go func(txn newrelic.Transaction) {
+	//		defer newrelic.StartSegment(txn, "async").End()
+	//		time.Sleep(100 * time.Millisecond)
+	//	}(txn.NewGoroutine())
+	//
+	// Example passing a new Transaction reference on a channel to another
+	// goroutine:
+	//
+	//	ch := make(chan newrelic.Transaction)
+	//	go func() {
+	//		txn := <-ch
+	//		defer newrelic.StartSegment(txn, "async").End()
+	//		time.Sleep(100 * time.Millisecond)
+	//	}()
+	//	ch <- txn.NewGoroutine()
+	//
+	NewGoroutine() Transaction
+
+	// GetTraceMetadata returns distributed tracing identifiers.  Empty
+	// string identifiers are returned if distributed tracing is disabled.
+	GetTraceMetadata() TraceMetadata
+
+	// GetLinkingMetadata returns the fields needed to link data to a
+	// trace or entity.  Use it to decorate application log lines so that
+	// they can be correlated with traces and errors, or use one of the
+	// logs in context integrations in _integrations/logcontext.
+	GetLinkingMetadata() LinkingMetadata
+}
+
+// TraceMetadata is returned by Transaction.GetTraceMetadata.  It contains
+// distributed tracing identifiers.
+type TraceMetadata struct {
+	// TraceID is the identifier for the current distributed trace.
+	TraceID string
+	// SpanID is the identifier for the currently executing span.  It is
+	// only set when the transaction is sampled and span events are
+	// enabled.
+	SpanID string
+}
+
+// LinkingMetadata is returned by Transaction.GetLinkingMetadata.  It contains
+// identifiers needed to link data to a trace or entity.
+type LinkingMetadata struct {
+	// TraceID is the identifier for the current distributed trace.
+	TraceID string
+	// SpanID is the identifier for the currently executing span.
+	SpanID string
+	// EntityName is the application name as set in the Config.  If
+	// multiple application names are specified, only the first is
+	// returned.
+	EntityName string
+	// EntityType is the type of this entity and is always the string
+	// "SERVICE".
+	EntityType string
+	// EntityGUID is the unique identifier for this entity.  It is empty
+	// until the application has connected.
+	EntityGUID string
+	// Hostname is the hostname this entity is running on.
+	Hostname string
 }
 
 // DistributedTracePayload is used to instrument connections between
@@ -131,6 +227,13 @@ const (
 	// DistributedTracePayloadHeader is the header used by New Relic agents
 	// for automatic trace payload instrumentation.
 	DistributedTracePayloadHeader = "Newrelic"
+	// DistributedTraceW3CTraceParentHeader is the header used by W3C
+	// Trace Context compliant tracers to propagate the trace id and the
+	// parent span id.  https://www.w3.org/TR/trace-context/
+	DistributedTraceW3CTraceParentHeader = "Traceparent"
+	// DistributedTraceW3CTraceStateHeader is the header used by W3C Trace
+	// Context compliant tracers to propagate vendor specific data.
+	DistributedTraceW3CTraceStateHeader = "Tracestate"
 )
 
 // TransportType represents the type of connection that the trace payload was